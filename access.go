@@ -0,0 +1,368 @@
+package pamparser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// AccessModule is the module name of pam_access
+const AccessModule = "pam_access.so"
+
+// DefaultAccessFile is the file pam_access reads unless accessfile= names another one
+const DefaultAccessFile = "/etc/security/access.conf"
+
+// Default separators of access.conf, changed by pam_access's fieldsep= and listsep= arguments
+const (
+	// DefaultAccessFieldSep separates the permission, users and origins fields
+	DefaultAccessFieldSep = ":"
+	// DefaultAccessListSep separates the entries of the users and origins lists
+	DefaultAccessListSep = ", \t"
+)
+
+// AccessPermission is the first field of an access.conf entry
+type AccessPermission string
+
+const (
+	// AccessGrant grants access when the entry matches
+	AccessGrant AccessPermission = "+"
+	// AccessDeny denies access when the entry matches
+	AccessDeny AccessPermission = "-"
+)
+
+// accessExcept separates a list from its exceptions
+const accessExcept = "EXCEPT"
+
+// AccessEntry is one permission:users:origins line of access.conf
+type AccessEntry struct {
+	Permission AccessPermission `json:"permission"`
+	Users      []string         `json:"users"`
+	Origins    []string         `json:"origins"`
+	LineNumber int              `json:"line_number,omitempty"`
+}
+
+// AccessConfig represents an access.conf file and the pam_access arguments that affect how
+// it is read and matched
+type AccessConfig struct {
+	FilePath   string        `json:"file_path,omitempty"`
+	Entries    []AccessEntry `json:"entries"`
+	Comments   []string      `json:"comments,omitempty"`
+	FieldSep   string        `json:"field_sep,omitempty"`    // empty means DefaultAccessFieldSep
+	ListSep    string        `json:"list_sep,omitempty"`     // empty means DefaultAccessListSep
+	NoDefGroup bool          `json:"no_def_group,omitempty"` // plain user tokens never match group names
+}
+
+// AccessRequest describes a login attempt to check against access.conf. Group and netgroup
+// membership is not looked up and must be supplied.
+type AccessRequest struct {
+	User      string   `json:"user"`
+	Groups    []string `json:"groups,omitempty"`    // every group the user belongs to
+	Origin    string   `json:"origin"`              // remote host name or address, or the tty for local logins
+	Addresses []string `json:"addresses,omitempty"` // addresses the origin host name resolves to
+	// UserNetgroups are the netgroups the user belongs to, matched by @netgroup in the users field
+	UserNetgroups []string `json:"user_netgroups,omitempty"`
+	// HostNetgroups are the netgroups the origin host belongs to, matched by @netgroup in the
+	// origins field
+	HostNetgroups []string `json:"host_netgroups,omitempty"`
+}
+
+// AccessDecision is the outcome of evaluating an AccessRequest
+type AccessDecision struct {
+	Allowed bool `json:"allowed"`
+	Entry   int  `json:"entry"` // index of the deciding entry, -1 when no entry matched
+	Line    int  `json:"line,omitempty"`
+}
+
+// fieldSep returns the field separator in effect
+func (c *AccessConfig) fieldSep() string {
+	if c.FieldSep == "" {
+		return DefaultAccessFieldSep
+	}
+	return c.FieldSep
+}
+
+// listSep returns the list separators in effect
+func (c *AccessConfig) listSep() string {
+	if c.ListSep == "" {
+		return DefaultAccessListSep
+	}
+	return c.ListSep
+}
+
+// ParseAccess parses access.conf syntax. Empty separators select the defaults. As in
+// pam_access, the origins field runs to the end of the line so it may contain the field
+// separator, e.g. in IPv6 addresses.
+func ParseAccess(reader io.Reader, fieldSep, listSep string) (*AccessConfig, error) {
+	config := &AccessConfig{FieldSep: fieldSep, ListSep: listSep}
+
+	scanner := bufio.NewScanner(reader)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if comment, ok := strings.CutPrefix(line, "#"); ok {
+			config.Comments = append(config.Comments, strings.TrimSpace(comment))
+			continue
+		}
+
+		fields := strings.SplitN(line, config.fieldSep(), 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("expected permission%susers%sorigins at line %d", config.fieldSep(), config.fieldSep(), lineNum)
+		}
+		permission := AccessPermission(strings.TrimSpace(fields[0]))
+		if permission != AccessGrant && permission != AccessDeny {
+			return nil, fmt.Errorf("invalid permission '%s' at line %d, expected + or -", permission, lineNum)
+		}
+
+		entry := AccessEntry{
+			Permission: permission,
+			Users:      splitAccessList(fields[1], config.listSep()),
+			Origins:    splitAccessList(fields[2], config.listSep()),
+			LineNumber: lineNum,
+		}
+		if len(entry.Users) == 0 || len(entry.Origins) == 0 {
+			return nil, fmt.Errorf("empty users or origins list at line %d", lineNum)
+		}
+		config.Entries = append(config.Entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading input: %w", err)
+	}
+	return config, nil
+}
+
+// splitAccessList splits a users or origins field on any of the separators
+func splitAccessList(field, sep string) []string {
+	return strings.FieldsFunc(field, func(r rune) bool { return strings.ContainsRune(sep, r) })
+}
+
+// LoadAccessFile loads an access.conf file
+func LoadAccessFile(filePath, fieldSep, listSep string) (*AccessConfig, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	config, err := ParseAccess(file, fieldSep, listSep)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file %s: %w", filePath, err)
+	}
+	config.FilePath = filePath
+	return config, nil
+}
+
+// LoadAccessForRule loads the access.conf a pam_access rule reads, honoring its accessfile=,
+// fieldsep=, listsep= and nodefgroup arguments. root is prepended to the file path.
+func LoadAccessForRule(rule Rule, root string) (*AccessConfig, error) {
+	if !rule.IsModule(AccessModule) {
+		return nil, fmt.Errorf("rule module %s is not %s", rule.ModulePath, AccessModule)
+	}
+
+	path := DefaultAccessFile
+	if accessFile, ok := rule.ArgumentValue("accessfile"); ok {
+		path = accessFile
+	}
+	fieldSep, _ := rule.ArgumentValue("fieldsep")
+	listSep, _ := rule.ArgumentValue("listsep")
+
+	config, err := LoadAccessFile(filepath.Join(root, path), fieldSep, listSep)
+	if err != nil {
+		return nil, err
+	}
+	config.NoDefGroup = rule.HasArgument("nodefgroup")
+	return config, nil
+}
+
+// String returns the configuration in access.conf syntax, standalone comments first
+func (c *AccessConfig) String() string {
+	var b strings.Builder
+	for _, comment := range c.Comments {
+		b.WriteString("# " + comment + "\n")
+	}
+
+	// Spaces are only added where pam_access will strip them again
+	listSep, pad := c.listSep()[:1], ""
+	if strings.Contains(c.listSep(), " ") {
+		listSep, pad = " ", " "
+	}
+	fieldSep := pad + c.fieldSep() + pad
+	for _, entry := range c.Entries {
+		b.WriteString(string(entry.Permission) + fieldSep +
+			strings.Join(entry.Users, listSep) + fieldSep +
+			strings.Join(entry.Origins, listSep) + "\n")
+	}
+	return b.String()
+}
+
+// Write writes the configuration in access.conf syntax
+func (c *AccessConfig) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, c.String()); err != nil {
+		return fmt.Errorf("error writing access configuration: %w", err)
+	}
+	return nil
+}
+
+// Evaluate decides a login attempt as pam_access does: the first entry whose users and
+// origins both match decides, and access is granted when no entry matches
+func (c *AccessConfig) Evaluate(req AccessRequest) AccessDecision {
+	for i, entry := range c.Entries {
+		if matchAccessList(entry.Users, func(token string) bool { return c.matchUser(token, req) }) &&
+			matchAccessList(entry.Origins, func(token string) bool { return matchAccessOrigin(token, req) }) {
+			return AccessDecision{Allowed: entry.Permission == AccessGrant, Entry: i, Line: entry.LineNumber}
+		}
+	}
+	return AccessDecision{Allowed: true, Entry: -1}
+}
+
+// Allows reports whether the login attempt is granted
+func (c *AccessConfig) Allows(req AccessRequest) bool {
+	return c.Evaluate(req).Allowed
+}
+
+// matchAccessList matches a list with EXCEPT clauses like pam_access's list_match: an item
+// before the first EXCEPT must match, and the rest of the list, itself a list with
+// exceptions, must not
+func matchAccessList(list []string, match func(token string) bool) bool {
+	except := len(list)
+	for i, token := range list {
+		if strings.EqualFold(token, accessExcept) {
+			except = i
+			break
+		}
+	}
+	if !slices.ContainsFunc(list[:except], match) {
+		return false
+	}
+	return except == len(list) || !matchAccessList(list[except+1:], match)
+}
+
+// matchUser matches a users-field token: ALL, (group), @netgroup, user@origin, or a user
+// name that also matches a group name unless nodefgroup is set
+func (c *AccessConfig) matchUser(token string, req AccessRequest) bool {
+	if at := strings.Index(token[min(1, len(token)):], "@"); at >= 0 {
+		at++
+		return c.matchUser(token[:at], req) && matchAccessOrigin(token[at+1:], req)
+	}
+
+	switch {
+	case strings.EqualFold(token, "ALL"):
+		return true
+	case strings.HasPrefix(token, "@"):
+		return slices.Contains(req.UserNetgroups, token[1:])
+	case strings.HasPrefix(token, "(") && strings.HasSuffix(token, ")"):
+		return slices.Contains(req.Groups, token[1:len(token)-1])
+	case token == req.User:
+		return true
+	default:
+		return !c.NoDefGroup && slices.Contains(req.Groups, token)
+	}
+}
+
+// matchAccessOrigin matches an origins-field token: ALL, LOCAL, @netgroup, a .domain suffix,
+// an address prefix ending in '.', an address with /prefix or /netmask, or an exact host
+// name, address or tty
+func matchAccessOrigin(token string, req AccessRequest) bool {
+	origin := req.Origin
+	switch {
+	case strings.EqualFold(token, "ALL"):
+		return true
+	case strings.EqualFold(token, "LOCAL"):
+		return !strings.Contains(origin, ".")
+	case strings.HasPrefix(token, "@"):
+		return slices.Contains(req.HostNetgroups, token[1:])
+	case strings.HasPrefix(token, ".") && len(token) > 1:
+		return len(origin) > len(token) && strings.EqualFold(origin[len(origin)-len(token):], token)
+	case strings.HasSuffix(token, ".") && len(token) > 1:
+		return slices.ContainsFunc(accessAddresses(req), func(addr string) bool { return strings.HasPrefix(addr, token) })
+	case strings.Contains(token, "/"):
+		network := parseAccessNetwork(token)
+		return network != nil && slices.ContainsFunc(accessAddresses(req), func(addr string) bool {
+			ip := net.ParseIP(addr)
+			return ip != nil && network.Contains(ip)
+		})
+	}
+
+	if strings.EqualFold(token, origin) {
+		return true
+	}
+	if ip := net.ParseIP(token); ip != nil {
+		return slices.ContainsFunc(accessAddresses(req), func(addr string) bool { return ip.Equal(net.ParseIP(addr)) })
+	}
+	return false
+}
+
+// accessAddresses returns the addresses a request comes from: the origin itself if it is
+// an address, plus any resolved addresses
+func accessAddresses(req AccessRequest) []string {
+	addresses := slices.Clone(req.Addresses)
+	if net.ParseIP(req.Origin) != nil {
+		addresses = append(addresses, req.Origin)
+	}
+	return addresses
+}
+
+// parseAccessNetwork parses address/prefix or address/netmask
+func parseAccessNetwork(token string) *net.IPNet {
+	if _, network, err := net.ParseCIDR(token); err == nil {
+		return network
+	}
+	addr, mask, _ := strings.Cut(token, "/")
+	ip, maskIP := net.ParseIP(addr), net.ParseIP(mask)
+	if ip == nil || maskIP == nil || ip.To4() == nil || maskIP.To4() == nil {
+		return nil
+	}
+	netmask := net.IPMask(maskIP.To4())
+	return &net.IPNet{IP: ip.To4().Mask(netmask), Mask: netmask}
+}
+
+// Validate checks every entry, returning one warning per problem: malformed networks,
+// EXCEPT clauses with nothing before or after them and items with whitespace that a listsep=
+// without space left in place
+func (c *AccessConfig) Validate() []string {
+	var warnings []string
+	for i, entry := range c.Entries {
+		for _, list := range [][]string{entry.Users, entry.Origins} {
+			for j, token := range list {
+				if strings.EqualFold(token, accessExcept) && (j == 0 || j == len(list)-1) {
+					warnings = append(warnings, fmt.Sprintf("Entry %d (line %d): EXCEPT needs items on both sides", i, entry.LineNumber))
+				}
+				if strings.TrimSpace(token) != token {
+					warnings = append(warnings, fmt.Sprintf("Entry %d (line %d): item '%s' contains whitespace and will not match", i, entry.LineNumber, token))
+				}
+			}
+		}
+		for _, token := range entry.Origins {
+			if strings.Contains(token, "/") && parseAccessNetwork(token) == nil {
+				warnings = append(warnings, fmt.Sprintf("Entry %d (line %d): invalid network '%s'", i, entry.LineNumber, token))
+			}
+		}
+	}
+	return warnings
+}
+
+// CheckAccess evaluates a login attempt against the access.conf of every pam_access rule
+// in the configuration, keyed by rule ID
+func (e *Editor) CheckAccess(req AccessRequest, root string) (map[RuleID]AccessDecision, error) {
+	e.ensureIDs()
+
+	decisions := make(map[RuleID]AccessDecision)
+	for _, i := range e.FindRules(func(rule Rule) bool { return rule.IsModule(AccessModule) }) {
+		rule := e.config.Rules[i]
+		config, err := LoadAccessForRule(rule, root)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		decisions[rule.ID] = config.Evaluate(req)
+	}
+	return decisions, nil
+}
@@ -0,0 +1,179 @@
+package pamparser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleAccess = `# Login access control table
++ : root : LOCAL 192.168.1.0/24
+- : root : ALL
++ : (wheel) : .example.com EXCEPT untrusted.example.com
++ : alice@10.0.0.0/8 : ALL
+- : ALL EXCEPT (staff) deploy : ALL
++ : @ops : 2001:db8::/32
+`
+
+func TestParseAccess(t *testing.T) {
+	config, err := ParseAccess(strings.NewReader(sampleAccess), "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(config.Entries) != 6 || len(config.Comments) != 1 {
+		t.Fatalf("expected 6 entries and 1 comment, got %d and %d", len(config.Entries), len(config.Comments))
+	}
+	want := AccessEntry{Permission: AccessDeny, Users: []string{"ALL", "EXCEPT", "(staff)", "deploy"}, Origins: []string{"ALL"}, LineNumber: 6}
+	if !reflect.DeepEqual(config.Entries[4], want) {
+		t.Errorf("entry 4 = %+v, want %+v", config.Entries[4], want)
+	}
+	if got := config.Entries[5].Origins; !reflect.DeepEqual(got, []string{"2001:db8::/32"}) {
+		t.Errorf("expected the origins field to keep colons, got %q", got)
+	}
+	if warnings := config.Validate(); len(warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+
+	for _, bad := range []string{"* : root : ALL\n", "+ root ALL\n", "+ : : ALL\n"} {
+		if _, err := ParseAccess(strings.NewReader(bad), "", ""); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestAccessConfig_Evaluate(t *testing.T) {
+	config, err := ParseAccess(strings.NewReader(sampleAccess), "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		req   AccessRequest
+		allow bool
+		entry int
+	}{
+		{"root on console", AccessRequest{User: "root", Origin: "tty1"}, true, 0},
+		{"root from lan", AccessRequest{User: "root", Origin: "192.168.1.20"}, true, 0},
+		{"root from lan by name", AccessRequest{User: "root", Origin: "db.lan", Addresses: []string{"192.168.1.7"}}, true, 0},
+		{"root remote", AccessRequest{User: "root", Origin: "203.0.113.9"}, false, 1},
+		{"wheel from domain", AccessRequest{User: "bob", Groups: []string{"wheel"}, Origin: "ws1.example.com"}, true, 2},
+		{"wheel from excepted host", AccessRequest{User: "bob", Groups: []string{"wheel", "staff"}, Origin: "untrusted.example.com"}, true, -1},
+		{"user at network", AccessRequest{User: "alice", Origin: "10.1.2.3"}, true, 3},
+		{"user outside network", AccessRequest{User: "alice", Origin: "172.16.0.1"}, false, 4},
+		{"staff excepted", AccessRequest{User: "carol", Groups: []string{"staff"}, Origin: "172.16.0.1"}, true, -1},
+		{"plain token matches group", AccessRequest{User: "dave", Groups: []string{"deploy"}, Origin: "172.16.0.1"}, true, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := config.Evaluate(tt.req)
+			if got.Allowed != tt.allow || got.Entry != tt.entry {
+				t.Errorf("Evaluate() = %+v, want allowed=%v entry=%d", got, tt.allow, tt.entry)
+			}
+		})
+	}
+
+	config.NoDefGroup = true
+	if config.Allows(AccessRequest{User: "dave", Groups: []string{"deploy"}, Origin: "172.16.0.1"}) {
+		t.Error("expected nodefgroup to stop plain tokens matching groups")
+	}
+}
+
+func TestAccessConfig_Netgroups(t *testing.T) {
+	config, err := ParseAccess(strings.NewReader("+ : @admins : ALL\n+ : ALL : @trusted\n- : ALL : ALL\n"), "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		req   AccessRequest
+		allow bool
+		entry int
+	}{
+		{"user in netgroup", AccessRequest{User: "erin", UserNetgroups: []string{"admins"}, Origin: "ws1"}, true, 0},
+		{"host in the users netgroup", AccessRequest{User: "erin", HostNetgroups: []string{"admins"}, Origin: "ws1"}, false, 2},
+		{"host in netgroup", AccessRequest{User: "erin", HostNetgroups: []string{"trusted"}, Origin: "ws1"}, true, 1},
+		{"user in the origins netgroup", AccessRequest{User: "erin", UserNetgroups: []string{"trusted"}, Origin: "ws1"}, false, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := config.Evaluate(tt.req)
+			if got.Allowed != tt.allow || got.Entry != tt.entry {
+				t.Errorf("Evaluate() = %+v, want allowed=%v entry=%d", got, tt.allow, tt.entry)
+			}
+		})
+	}
+}
+
+func TestMatchAccessList_NestedExcept(t *testing.T) {
+	list := []string{"ALL", "EXCEPT", "a", "b", "EXCEPT", "b"}
+	for token, want := range map[string]bool{"a": false, "b": true, "c": true} {
+		got := matchAccessList(list, func(item string) bool { return item == "ALL" || item == token })
+		if got != want {
+			t.Errorf("match(%s) = %v, want %v", token, got, want)
+		}
+	}
+}
+
+func TestAccessConfig_Separators(t *testing.T) {
+	input := "+|root,admin|tty1,cron\n-|ALL|ALL\n"
+	config, err := ParseAccess(strings.NewReader(input), "|", ",")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := config.Entries[0].Users; !reflect.DeepEqual(got, []string{"root", "admin"}) {
+		t.Errorf("users = %q", got)
+	}
+	if config.String() != input {
+		t.Errorf("String() = %q, want %q", config.String(), input)
+	}
+
+	spaced, err := ParseAccess(strings.NewReader("+ | root | ALL\n"), "|", ",")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if warnings := spaced.Validate(); len(warnings) != 2 {
+		t.Errorf("expected whitespace warnings, got %v", warnings)
+	}
+
+	config, err = ParseAccess(strings.NewReader(sampleAccess), "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reparsed, err := ParseAccess(strings.NewReader(config.String()), "", "")
+	if err != nil || !reflect.DeepEqual(reparsed.Entries, config.Entries) {
+		t.Errorf("written output does not parse back: %v", err)
+	}
+}
+
+func TestEditor_CheckAccess(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "etc", "security")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "access.conf"), []byte("- : guest : ALL\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sshd-access.conf"), []byte("+;ALL;ALL\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := mustParsePamD(t, `account required pam_access.so
+account required pam_access.so accessfile=/etc/security/sshd-access.conf fieldsep=;
+account required pam_unix.so
+`)
+	decisions, err := NewEditor(config).CheckAccess(AccessRequest{User: "guest", Origin: "tty1"}, root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(decisions) != 2 || decisions[1].Allowed || !decisions[2].Allowed {
+		t.Errorf("unexpected decisions: %+v", decisions)
+	}
+}
@@ -0,0 +1,204 @@
+package pamparser
+
+import (
+	"slices"
+	"strconv"
+)
+
+// authImpression is libpam's running verdict on a stack: undecided, positive with
+// PAM_SUCCESS, positive with another status such as new_authtok_reqd, or negative
+type authImpression uint8
+
+const (
+	impressionUndef authImpression = iota
+	impressionSuccess
+	impressionOther
+	impressionNegative
+)
+
+// authExit is how evaluation left a stack
+type authExit uint8
+
+const (
+	exitEnd  authExit = iota // past the last module
+	exitDone                 // a done action
+	exitDie                  // a die action
+)
+
+// authNode is a module of a stack as the control flow analysis sees it, or a substack
+type authNode struct {
+	control  Control
+	returns  []ReturnValue // return values the module can produce
+	mark     uint64        // recorded on the path when the module returns PAM_SUCCESS
+	children []authNode    // rules of a substack
+	substack bool
+}
+
+// authOutcome is one way evaluation can leave a stack
+type authOutcome struct {
+	exit       authExit
+	impression authImpression
+	marks      uint64
+}
+
+// authFlowState is a point of the evaluation, used to share the work of paths that meet
+type authFlowState struct {
+	index      int
+	impression authImpression
+	marks      uint64
+}
+
+// authFlow evaluates a stack for every combination of module results
+type authFlow struct {
+	nodes []authNode
+	start authImpression // the state reset returns to
+	memo  map[authFlowState][]authOutcome
+}
+
+// authReturnValues are the results a module is assumed to be able to produce. PAM_IGNORE is
+// left out: modules only return it when configured to, and counting it would let every
+// required module be skipped.
+var authReturnValues = slices.DeleteFunc(slices.Clone(knownReturnValues), func(rv ReturnValue) bool {
+	return rv == ReturnIgnore
+})
+
+// authNodes builds the control flow nodes of a stack's rules. mark gives the mark a module
+// records on success. Rules reached through the same substack become one substack node;
+// include and substack rules that were not resolved may do anything a required module can.
+func authNodes(rules []StackRule, mark func(Rule) uint64) []authNode {
+	return buildAuthNodes(rules, 0, mark)
+}
+
+// buildAuthNodes builds the nodes of rules nested depth substacks deep
+func buildAuthNodes(rules []StackRule, depth int, mark func(Rule) uint64) []authNode {
+	var nodes []authNode
+	for i := 0; i < len(rules); i++ {
+		rule := rules[i]
+		if len(rule.substacks) > depth {
+			id := rule.substacks[depth]
+			end := i + 1
+			for end < len(rules) && len(rules[end].substacks) > depth && rules[end].substacks[depth] == id {
+				end++
+			}
+			nodes = append(nodes, authNode{children: buildAuthNodes(rules[i:end], depth+1, mark), substack: true})
+			i = end - 1
+			continue
+		}
+
+		node := authNode{control: rule.Control, returns: authReturnValues, mark: mark(rule.Rule)}
+		switch {
+		case includeTarget(rule.Rule) != "":
+			required := ControlRequired
+			node.control = Control{Simple: &required}
+			node.returns = []ReturnValue{ReturnSuccess, ReturnAuthErr, ReturnIgnore}
+		case rule.IsModule("pam_deny.so"):
+			node.returns = []ReturnValue{ReturnAuthErr}
+		case rule.IsModule("pam_permit.so"):
+			node.returns = []ReturnValue{ReturnSuccess}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// authSuccessMarks returns the marks collected on every way the stack can end in
+// PAM_SUCCESS, without duplicates. A stack that can never succeed has none.
+func authSuccessMarks(nodes []authNode) []uint64 {
+	var marks []uint64
+	for _, outcome := range runAuthFlow(nodes, impressionUndef, 0) {
+		if outcome.impression == impressionSuccess && !slices.Contains(marks, outcome.marks) {
+			marks = append(marks, outcome.marks)
+		}
+	}
+	return marks
+}
+
+// runAuthFlow evaluates nodes from a starting state and returns every way evaluation can
+// leave them
+func runAuthFlow(nodes []authNode, start authImpression, marks uint64) []authOutcome {
+	flow := &authFlow{nodes: nodes, start: start, memo: make(map[authFlowState][]authOutcome)}
+	return flow.from(authFlowState{impression: start, marks: marks})
+}
+
+// from returns the outcomes of evaluating the stack from a state, following libpam's
+// _pam_dispatch_aux
+func (f *authFlow) from(state authFlowState) []authOutcome {
+	if state.index >= len(f.nodes) {
+		return []authOutcome{{exit: exitEnd, impression: state.impression, marks: state.marks}}
+	}
+	if outcomes, ok := f.memo[state]; ok {
+		return outcomes
+	}
+
+	var outcomes []authOutcome
+	add := func(outcome authOutcome) {
+		if !slices.Contains(outcomes, outcome) {
+			outcomes = append(outcomes, outcome)
+		}
+	}
+	next := func(index int, impression authImpression, marks uint64) {
+		for _, outcome := range f.from(authFlowState{index: index, impression: impression, marks: marks}) {
+			add(outcome)
+		}
+	}
+
+	node := f.nodes[state.index]
+	if node.substack {
+		// done and die only leave the substack, and jumps cannot leave it
+		for _, outcome := range runAuthFlow(node.children, state.impression, state.marks) {
+			next(state.index+1, outcome.impression, outcome.marks)
+		}
+		f.memo[state] = outcomes
+		return outcomes
+	}
+
+	actions, _ := node.control.actions()
+	effective := effectiveActions(actions)
+	tried := make(map[string]bool)
+	for _, rv := range node.returns {
+		action := effectiveAction(effective, rv)
+		if rv != ReturnSuccess {
+			// failures with the same action lead to the same outcomes
+			if tried[action] {
+				continue
+			}
+			tried[action] = true
+		}
+		impression, marks := state.impression, state.marks
+		if rv == ReturnSuccess {
+			marks |= node.mark
+		}
+
+		switch ActionType(action) {
+		case ActionOK, ActionDone:
+			if impression == impressionUndef || impression == impressionSuccess {
+				impression = impressionOther
+				if rv == ReturnSuccess {
+					impression = impressionSuccess
+				}
+			}
+			if action == string(ActionDone) && impression != impressionNegative {
+				add(authOutcome{exit: exitDone, impression: impression, marks: marks})
+				continue
+			}
+		case ActionBad, ActionDie:
+			impression = impressionNegative
+			if action == string(ActionDie) {
+				add(authOutcome{exit: exitDie, impression: impression, marks: marks})
+				continue
+			}
+		case ActionReset:
+			impression = f.start
+		case ActionIgnore:
+		default:
+			if jump, err := strconv.Atoi(action); err == nil && jump > 0 {
+				next(state.index+1+jump, impression, marks)
+				continue
+			}
+		}
+		next(state.index+1, impression, marks)
+	}
+
+	f.memo[state] = outcomes
+	return outcomes
+}
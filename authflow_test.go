@@ -0,0 +1,85 @@
+package pamparser
+
+import (
+	"slices"
+	"testing"
+)
+
+// stackRules wraps the rules of a pam.d text as an unresolved stack
+func stackRules(t *testing.T, text string) []StackRule {
+	t.Helper()
+	var rules []StackRule
+	for _, rule := range mustParsePamD(t, text).Rules {
+		rules = append(rules, StackRule{Rule: rule})
+	}
+	return rules
+}
+
+func TestAuthSuccessMarks(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []uint64 // marks of the succeeding paths; pam_unix marks 1 and pam_oath 2
+	}{
+		{"required", "auth required pam_unix.so\n", []uint64{1}},
+		{"sufficient alone", "auth sufficient pam_unix.so\n", []uint64{1}},
+		{"optional alone", "auth optional pam_unix.so\n", []uint64{1}},
+		{"deny never succeeds", "auth required pam_deny.so\n", nil},
+		{"ignored success decides nothing", "auth [default=ignore] pam_unix.so\n", nil},
+		{"either module", "auth sufficient pam_unix.so\nauth sufficient pam_oath.so\nauth required pam_deny.so\n", []uint64{1, 2}},
+		{"both modules", "auth required pam_unix.so\nauth required pam_oath.so\n", []uint64{3}},
+		{"die ends the stack", "auth [success=ok default=die] pam_unix.so\nauth sufficient pam_permit.so\n", []uint64{1}},
+		{"done ends the stack", "auth [success=done default=ignore] pam_unix.so\nauth required pam_deny.so\n", []uint64{1}},
+		{"jump past the end", "auth [success=5 default=bad] pam_unix.so\nauth required pam_deny.so\n", nil},
+		{"jump over deny", "auth [success=1 default=ignore] pam_oath.so\nauth requisite pam_deny.so\nauth required pam_permit.so\n", []uint64{2}},
+		{"reset forgets a failure", "auth required pam_deny.so\nauth [default=reset] pam_oath.so\nauth sufficient pam_unix.so\n", []uint64{1, 3}},
+		{"new_authtok_reqd is not success", "auth [success=ok new_authtok_reqd=ok default=bad] pam_unix.so\n", []uint64{1}},
+		{"unresolved include", "auth sufficient pam_rootok.so\nauth include system-auth\n", []uint64{0}},
+	}
+
+	mark := func(rule Rule) uint64 {
+		switch rule.ModuleName() {
+		case "pam_unix.so":
+			return 1
+		case "pam_oath.so":
+			return 2
+		}
+		return 0
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := authSuccessMarks(authNodes(stackRules(t, tt.text), mark))
+			slices.Sort(got)
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("success marks = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAuthNodes_Substacks(t *testing.T) {
+	rules := stackRules(t, `auth required pam_env.so
+auth sufficient pam_unix.so
+auth required pam_deny.so
+auth required pam_oath.so
+`)
+	// rules 1-2 form one substack, and rule 2 also a nested one
+	rules[1].substacks = []int{1}
+	rules[2].substacks = []int{1, 2}
+
+	nodes := authNodes(rules, func(Rule) uint64 { return 0 })
+	if len(nodes) != 3 || !nodes[1].substack || len(nodes[1].children) != 2 || !nodes[1].children[1].substack {
+		t.Fatalf("unexpected nodes: %+v", nodes)
+	}
+
+	// done in the substack only leaves the substack, so pam_oath still runs
+	marks := authSuccessMarks(authNodes(rules[:3], func(rule Rule) uint64 {
+		if rule.IsModule("pam_unix.so") {
+			return 1
+		}
+		return 0
+	}))
+	if !slices.Equal(marks, []uint64{1}) {
+		t.Errorf("success marks = %v", marks)
+	}
+}
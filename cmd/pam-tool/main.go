@@ -0,0 +1,291 @@
+// Package main implements pam-tool, a command-line tool for listing, querying,
+// validating and editing PAM configuration files.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	pp "github.com/StephenBrown2/pamparser"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "pam-tool: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// options holds the parsed command-line flags
+type options struct {
+	file       string
+	output     string
+	addRule    string
+	removeRule string
+	query      string
+	pamd       bool
+	list       bool
+	validate   bool
+	lint       bool
+	format     string
+	fix        string
+	apply      bool
+	backup     bool
+	help       bool
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("pam-tool", flag.ContinueOnError)
+	var opts options
+	flags.StringVar(&opts.file, "file", "", "PAM configuration file to operate on")
+	flags.StringVar(&opts.output, "output", "", "write the result to this file instead of -file")
+	flags.StringVar(&opts.addRule, "add-rule", "", "add a rule, e.g. 'auth required pam_unix.so nullok'")
+	flags.StringVar(&opts.removeRule, "remove-rule", "", "remove rules matching service:type:module (empty parts match anything)")
+	flags.StringVar(&opts.query, "query", "", "list rules matching a query, e.g. 'type=auth and arg:nullok'")
+	flags.BoolVar(&opts.pamd, "pamd", false, "treat the configuration as pam.d format when creating a new one")
+	flags.BoolVar(&opts.list, "list", false, "list the rules in the configuration")
+	flags.BoolVar(&opts.validate, "validate", false, "validate the configuration")
+	flags.BoolVar(&opts.lint, "lint", false, "report validation problems and security findings")
+	flags.StringVar(&opts.format, "format", "text", "output format of -lint: text, json or sarif")
+	flags.StringVar(&opts.fix, "fix", "", "preview the lint fixes of these checks ('all' or a comma-separated list)")
+	flags.BoolVar(&opts.apply, "apply", false, "apply the fixes previewed by -fix and write the result")
+	flags.BoolVar(&opts.backup, "backup", false, "back up the file before writing changes")
+	flags.BoolVar(&opts.help, "help", false, "show this help")
+	flags.Usage = func() { usage(flags) }
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+
+	if opts.help || (opts.file == "" && !opts.pamd) {
+		usage(flags)
+		return nil
+	}
+
+	fm := pp.NewFileManager()
+	config := &pp.Config{IsPamD: opts.pamd}
+	if opts.file != "" {
+		loaded, err := fm.LoadFromFile(opts.file)
+		if err != nil {
+			return err
+		}
+		config = loaded
+	}
+	editor := pp.NewEditor(config)
+
+	if opts.query != "" {
+		indices, err := editor.FindRulesByQuery(opts.query)
+		if err != nil {
+			return fmt.Errorf("invalid query: %w", err)
+		}
+		for _, i := range indices {
+			printRule(config, i)
+		}
+	}
+
+	if opts.list {
+		for i := range config.Rules {
+			printRule(config, i)
+		}
+	}
+
+	if opts.validate {
+		warnings := editor.Validate()
+		if len(warnings) == 0 {
+			fmt.Println("Configuration is valid")
+		}
+		for _, warning := range warnings {
+			fmt.Printf("Warning: %s\n", warning)
+		}
+	}
+
+	if opts.lint {
+		if err := lint(editor, opts.format); err != nil {
+			return err
+		}
+	}
+
+	modified := false
+	if opts.fix != "" {
+		applied, err := fix(editor, opts)
+		if err != nil {
+			return err
+		}
+		modified = modified || applied
+	}
+
+	if opts.removeRule != "" {
+		filter, err := removeFilter(opts.removeRule)
+		if err != nil {
+			return err
+		}
+		removed := len(editor.FindRuleIDs(filter))
+		editor.RemoveRulesByID(editor.FindRuleIDs(filter)...)
+		fmt.Printf("Removed %d rule(s)\n", removed)
+		modified = modified || removed > 0
+	}
+
+	if opts.addRule != "" {
+		added, err := pp.NewParser().Parse(strings.NewReader(opts.addRule), config.IsPamD)
+		if err != nil {
+			return fmt.Errorf("invalid rule: %w", err)
+		}
+		if len(added.Rules) == 0 {
+			return fmt.Errorf("invalid rule: %q contains no rule", opts.addRule)
+		}
+		for _, rule := range added.Rules {
+			editor.AddRule(rule)
+		}
+		modified = true
+	}
+
+	if !modified {
+		return nil
+	}
+	return save(fm, config, opts)
+}
+
+// save writes a modified configuration to -output, -file or stdout
+func save(fm *pp.FileManager, config *pp.Config, opts options) error {
+	target := opts.output
+	if target == "" {
+		target = opts.file
+	}
+	if target == "" {
+		output, err := fm.SaveToString(config)
+		if err != nil {
+			return err
+		}
+		fmt.Print(output)
+		return nil
+	}
+
+	if opts.backup {
+		if _, err := os.Stat(target); err == nil {
+			backupPath, err := fm.BackupFile(target)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Backup created: %s\n", backupPath)
+		}
+	}
+	if err := fm.SaveToFile(config, target); err != nil {
+		return err
+	}
+	fmt.Printf("Configuration written to %s\n", target)
+	return nil
+}
+
+// lint prints the lint diagnostics of a configuration in the requested format
+func lint(editor *pp.Editor, format string) error {
+	diagnostics := editor.Lint()
+	switch format {
+	case "text":
+		for _, d := range diagnostics {
+			fmt.Println(d)
+			if d.Fix != nil {
+				fmt.Printf("  fix: %s\n", d.Fix.Description)
+			}
+		}
+		return nil
+	case "json":
+		if diagnostics == nil {
+			diagnostics = []pp.Diagnostic{}
+		}
+		data, err := json.MarshalIndent(diagnostics, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	case "sarif":
+		data, err := pp.SARIF(diagnostics, ".")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	return fmt.Errorf("invalid format %q, expected text, json or sarif", format)
+}
+
+// fix previews the selected lint fixes as a unified diff and applies them with -apply. It
+// reports whether the configuration was changed.
+func fix(editor *pp.Editor, opts options) (bool, error) {
+	var checks []string
+	if opts.fix != "all" {
+		checks = strings.Split(opts.fix, ",")
+	}
+	plan, err := editor.PlanFixes(checks...)
+	if err != nil {
+		return false, err
+	}
+	fmt.Print(plan.Report())
+	if !plan.HasChanges() {
+		return false, nil
+	}
+	fmt.Print(plan.Diff().Unified())
+	if !opts.apply {
+		fmt.Println("Run again with -apply to apply these fixes")
+		return false, nil
+	}
+	if err := plan.Apply(editor); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// removeFilter builds a filter from a service:type:module pattern
+func removeFilter(pattern string) (pp.RuleFilter, error) {
+	parts := strings.Split(pattern, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid remove pattern %q, expected service:type:module", pattern)
+	}
+
+	filters := []pp.RuleFilter{func(rule pp.Rule) bool { return !rule.IsDirective }}
+	if parts[0] != "" {
+		filters = append(filters, pp.FilterByService(parts[0]))
+	}
+	if parts[1] != "" {
+		filters = append(filters, pp.FilterByType(pp.ModuleType(parts[1])))
+	}
+	if parts[2] != "" {
+		filters = append(filters, pp.FilterByModulePath(parts[2]))
+	}
+	return pp.CombineFilters(filters...), nil
+}
+
+// printRule prints a single rule with its index
+func printRule(config *pp.Config, index int) {
+	output, err := pp.NewWriter().WriteString(&pp.Config{Rules: []pp.Rule{config.Rules[index]}, IsPamD: config.IsPamD})
+	if err != nil {
+		fmt.Printf("%3d: <%v>\n", index, err)
+		return
+	}
+	fmt.Printf("%3d: %s\n", index, strings.TrimRight(output, "\n"))
+}
+
+func usage(flags *flag.FlagSet) {
+	out := flags.Output()
+	fmt.Fprintf(out, `Usage: pam-tool [options]
+
+Examples:
+  pam-tool -file /etc/pam.d/sshd -list
+  pam-tool -file /etc/pam.d/sshd -validate
+  pam-tool -file pam.d/sshd -lint -format sarif > pam.sarif
+  pam-tool -file /etc/pam.d/login -backup -fix nullok,weak-hash -apply
+  pam-tool -file /etc/pam.d/sshd -query 'type=auth and module~"pam_(sss|ldap)"'
+  pam-tool -file /etc/pam.d/sshd -backup -add-rule 'auth required pam_unix.so nullok'
+  pam-tool -file /etc/pam.d/sshd -remove-rule '::pam_ldap'
+  pam-tool -pamd -add-rule 'auth required pam_unix.so' -output new-config
+
+Options:
+`)
+	flags.PrintDefaults()
+}
@@ -46,6 +46,26 @@ session optional pam_systemd.so
 			args:        []string{"-file", tempFile, "-validate"},
 			expectError: false,
 		},
+		{
+			name:        "lint as sarif",
+			args:        []string{"-file", tempFile, "-lint", "-format", "sarif"},
+			expectError: false,
+		},
+		{
+			name:        "lint with unknown format",
+			args:        []string{"-file", tempFile, "-lint", "-format", "xml"},
+			expectError: true,
+		},
+		{
+			name:        "preview fixes",
+			args:        []string{"-file", tempFile, "-fix", "all"},
+			expectError: false,
+		},
+		{
+			name:        "fix with unknown check",
+			args:        []string{"-file", tempFile, "-fix", "nullok,no-such-check"},
+			expectError: true,
+		},
 		{
 			name:        "help flag",
 			args:        []string{"-help"},
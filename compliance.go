@@ -0,0 +1,635 @@
+package pamparser
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Benchmark names a hardening benchmark that compliance controls are taken from
+type Benchmark string
+
+const (
+	// BenchmarkCIS is the CIS Benchmark for Linux distributions
+	BenchmarkCIS Benchmark = "cis"
+	// BenchmarkSTIG is the DISA Security Technical Implementation Guide
+	BenchmarkSTIG Benchmark = "stig"
+)
+
+// ComplianceStatus is the outcome of evaluating a control against a service
+type ComplianceStatus string
+
+const (
+	// CompliancePass means the service satisfies the control
+	CompliancePass ComplianceStatus = "pass"
+	// ComplianceFail means the service violates the control
+	ComplianceFail ComplianceStatus = "fail"
+	// ComplianceNotApplicable means the control does not concern the service
+	ComplianceNotApplicable ComplianceStatus = "not_applicable"
+)
+
+// ComplianceEvidence points at the configuration a result was decided on
+type ComplianceEvidence struct {
+	File string `json:"file"`
+	Line int    `json:"line,omitempty"`
+	Rule string `json:"rule,omitempty"` // the rule or setting as written
+}
+
+// ComplianceControl is one check of the built-in catalogue
+type ComplianceControl struct {
+	ID          string    `json:"id"`
+	Benchmark   Benchmark `json:"benchmark"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Services    []string  `json:"services,omitempty"` // services the control is limited to, all if empty
+
+	check func(t *complianceTarget) complianceOutcome
+}
+
+// ComplianceResult is the outcome of one control for one service
+type ComplianceResult struct {
+	ControlID string               `json:"control_id"`
+	Benchmark Benchmark            `json:"benchmark"`
+	Title     string               `json:"title"`
+	Service   string               `json:"service"`
+	Status    ComplianceStatus     `json:"status"`
+	Message   string               `json:"message"`
+	Evidence  []ComplianceEvidence `json:"evidence,omitempty"`
+}
+
+// ComplianceReport is the outcome of a set of controls for every service on a host
+type ComplianceReport struct {
+	Root    string             `json:"root,omitempty"`
+	Results []ComplianceResult `json:"results"`
+}
+
+// complianceOutcome is what a control's check decides for one service
+type complianceOutcome struct {
+	status   ComplianceStatus
+	message  string
+	evidence []ComplianceEvidence
+}
+
+// complianceTarget is the resolved stack of one service a control is checked against
+type complianceTarget struct {
+	root    string
+	stack   *ServiceStack
+	posture *ServicePosture // assessed on first use
+}
+
+// complianceCatalogue is the built-in set of controls, in report order
+var complianceCatalogue = []ComplianceControl{
+	{
+		ID: "cis-faillock-deny", Benchmark: BenchmarkCIS,
+		Title:       "Lockout for failed password attempts is configured",
+		Description: "pam_faillock locks an account after at most 5 failed attempts.",
+		check:       faillockCheck("deny", "between 1 and 5", func(n int) bool { return n >= 1 && n <= 5 }),
+	},
+	{
+		ID: "cis-faillock-unlock-time", Benchmark: BenchmarkCIS,
+		Title:       "Lockout lasts at least 15 minutes",
+		Description: "pam_faillock unlock_time is 0 (manual unlock) or at least 900 seconds.",
+		check:       faillockCheck("unlock_time", "0 or at least 900", func(n int) bool { return n == 0 || n >= 900 }),
+	},
+	{
+		ID: "cis-pwquality-minlen", Benchmark: BenchmarkCIS,
+		Title:       "Minimum password length is at least 14",
+		Description: "pam_pwquality minlen is at least 14.",
+		check:       pwqualityCheck([]string{"minlen"}, "at least 14", func(n int) bool { return n >= 14 }),
+	},
+	{
+		ID: "cis-pwquality-complexity", Benchmark: BenchmarkCIS,
+		Title:       "Passwords use all character classes",
+		Description: "pam_pwquality requires minclass=4, or dcredit, ucredit, lcredit and ocredit of -1 or less.",
+		check:       pwqualityComplexityCheck,
+	},
+	{
+		ID: "cis-pwhistory-remember", Benchmark: BenchmarkCIS,
+		Title:       "Password reuse is limited",
+		Description: "pam_pwhistory or pam_unix remembers at least 24 previous passwords.",
+		check:       rememberCheck(24),
+	},
+	{
+		ID: "cis-password-hash", Benchmark: BenchmarkCIS,
+		Title:       "Passwords are hashed with a strong algorithm",
+		Description: "pam_unix hashes passwords with sha512 or yescrypt.",
+		check:       hashCheck(0),
+	},
+	{
+		ID: "cis-no-nullok", Benchmark: BenchmarkCIS,
+		Title:       "Empty passwords are not allowed",
+		Description: "pam_unix has no nullok or nullok_secure argument.",
+		check:       nullokCheck,
+	},
+	{
+		ID: "cis-su-wheel", Benchmark: BenchmarkCIS,
+		Title:       "Access to su is restricted",
+		Description: "su requires pam_wheel.so with use_uid in its auth stack.",
+		Services:    []string{"su"},
+		check:       suWheelCheck,
+	},
+	{
+		ID: "stig-faillock-deny", Benchmark: BenchmarkSTIG,
+		Title:       "Accounts lock after three failed attempts",
+		Description: "pam_faillock locks an account after at most 3 failed attempts.",
+		check:       faillockCheck("deny", "between 1 and 3", func(n int) bool { return n >= 1 && n <= 3 }),
+	},
+	{
+		ID: "stig-faillock-interval", Benchmark: BenchmarkSTIG,
+		Title:       "Failed attempts are counted over 15 minutes",
+		Description: "pam_faillock fail_interval is at least 900 seconds.",
+		check:       faillockCheck("fail_interval", "at least 900", func(n int) bool { return n >= 900 }),
+	},
+	{
+		ID: "stig-faillock-unlock-time", Benchmark: BenchmarkSTIG,
+		Title:       "Locked accounts stay locked until released by an administrator",
+		Description: "pam_faillock unlock_time is 0.",
+		check:       faillockCheck("unlock_time", "0", func(n int) bool { return n == 0 }),
+	},
+	{
+		ID: "stig-pwquality-minlen", Benchmark: BenchmarkSTIG,
+		Title:       "Minimum password length is at least 15",
+		Description: "pam_pwquality minlen is at least 15.",
+		check:       pwqualityCheck([]string{"minlen"}, "at least 15", func(n int) bool { return n >= 15 }),
+	},
+	{
+		ID: "stig-pwquality-credits", Benchmark: BenchmarkSTIG,
+		Title:       "Passwords contain every character class",
+		Description: "pam_pwquality dcredit, ucredit, lcredit and ocredit are -1 or less.",
+		check:       pwqualityCheck([]string{"dcredit", "ucredit", "lcredit", "ocredit"}, "-1 or less", func(n int) bool { return n <= -1 }),
+	},
+	{
+		ID: "stig-pwhistory-remember", Benchmark: BenchmarkSTIG,
+		Title:       "Passwords are not reused for five generations",
+		Description: "pam_pwhistory or pam_unix remembers at least 5 previous passwords.",
+		check:       rememberCheck(5),
+	},
+	{
+		ID: "stig-password-hash", Benchmark: BenchmarkSTIG,
+		Title:       "Passwords are hashed with at least 5000 rounds",
+		Description: "pam_unix hashes passwords with yescrypt, or sha512 with at least 5000 rounds set by rounds= or SHA_CRYPT_MIN_ROUNDS.",
+		check:       hashCheck(5000),
+	},
+	{
+		ID: "stig-no-nullok", Benchmark: BenchmarkSTIG,
+		Title:       "Blank passwords cannot be used to log in",
+		Description: "pam_unix has no nullok or nullok_secure argument.",
+		check:       nullokCheck,
+	},
+}
+
+// ComplianceControls returns the built-in controls of the given benchmarks, or all of them
+// if none are given
+func ComplianceControls(benchmarks ...Benchmark) []ComplianceControl {
+	var controls []ComplianceControl
+	for _, control := range complianceCatalogue {
+		if len(benchmarks) == 0 || slices.Contains(benchmarks, control.Benchmark) {
+			controls = append(controls, control)
+		}
+	}
+	return controls
+}
+
+// CheckCompliance evaluates controls against every service in root/etc/pam.d, as resolved by
+// ResolveHost. Controls limited to services the host does not have get a single
+// not-applicable result. root is prepended to every path; pass "" for the running system.
+func (fm *FileManager) CheckCompliance(root string, controls []ComplianceControl) (*ComplianceReport, error) {
+	stacks, err := fm.ResolveHost(root)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ComplianceReport{Root: root, Results: []ComplianceResult{}}
+	for _, control := range controls {
+		evaluated := false
+		for _, stack := range stacks {
+			if len(control.Services) > 0 && !slices.Contains(control.Services, stack.Service) {
+				continue
+			}
+			outcome := control.check(&complianceTarget{root: root, stack: stack})
+			report.add(control, stack.Service, outcome)
+			evaluated = true
+		}
+		if !evaluated {
+			report.add(control, strings.Join(control.Services, ","), complianceOutcome{
+				status:  ComplianceNotApplicable,
+				message: "service is not configured",
+			})
+		}
+	}
+	return report, nil
+}
+
+// add records the outcome of a control for a service
+func (r *ComplianceReport) add(control ComplianceControl, service string, outcome complianceOutcome) {
+	r.Results = append(r.Results, ComplianceResult{
+		ControlID: control.ID,
+		Benchmark: control.Benchmark,
+		Title:     control.Title,
+		Service:   service,
+		Status:    outcome.status,
+		Message:   outcome.message,
+		Evidence:  outcome.evidence,
+	})
+}
+
+// passed builds a passing outcome
+func passed(message string, evidence ...ComplianceEvidence) complianceOutcome {
+	return complianceOutcome{status: CompliancePass, message: message, evidence: evidence}
+}
+
+// failed builds a failing outcome
+func failed(message string, evidence ...ComplianceEvidence) complianceOutcome {
+	return complianceOutcome{status: ComplianceFail, message: message, evidence: evidence}
+}
+
+// notApplicable builds a not-applicable outcome
+func notApplicable(message string) complianceOutcome {
+	return complianceOutcome{status: ComplianceNotApplicable, message: message}
+}
+
+// rules returns the rules of a type that load a module
+func (t *complianceTarget) rules(moduleType ModuleType, module string) []StackRule {
+	var rules []StackRule
+	for _, rule := range t.stack.OfType(moduleType) {
+		if rule.IsModule(module) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// checksPasswords reports whether the auth stack verifies a password
+func (t *complianceTarget) checksPasswords() bool {
+	return slices.ContainsFunc(t.stack.OfType(ModuleTypeAuth), func(rule StackRule) bool {
+		return authFactorModules[rule.ModuleName()] == FactorPassword
+	})
+}
+
+// changesPasswords reports whether the password stack stores passwords with pam_unix
+func (t *complianceTarget) changesPasswords() bool {
+	return len(t.rules(ModuleTypePassword, "pam_unix.so")) > 0
+}
+
+// passwordPolicy returns the password policy posture assessment found for the service. It is
+// only called for services whose password stack changes passwords, so it is never nil.
+func (t *complianceTarget) passwordPolicy() *PasswordPolicy {
+	if t.posture == nil {
+		t.posture = assessStack(t.stack, t.root)
+	}
+	return t.posture.Password
+}
+
+// evidenceOf returns where the policy values named by keys were set, skipping unset ones
+func (pw *PasswordPolicy) evidenceOf(keys ...string) []ComplianceEvidence {
+	var evidence []ComplianceEvidence
+	for _, key := range keys {
+		if e, ok := pw.evidence[key]; ok {
+			evidence = append(evidence, e)
+		}
+	}
+	return evidence
+}
+
+// ruleEvidence points at a rule of the stack
+func ruleEvidence(rule StackRule) ComplianceEvidence {
+	return ComplianceEvidence{File: rule.File, Line: rule.LineNumber, Rule: describeRule(rule.Rule)}
+}
+
+// settingEvidence points at where an effective setting came from: its file line, or the rule
+// for arguments and built-in defaults
+func settingEvidence(root string, setting EffectiveSetting, rule StackRule) ComplianceEvidence {
+	if setting.Source != SettingFromFile {
+		return ruleEvidence(rule)
+	}
+	return ComplianceEvidence{File: rootRelative(root, setting.File), Line: setting.Line, Rule: setting.Key + " = " + setting.Value}
+}
+
+// rootRelative returns the path of a file under root as it is on the host
+func rootRelative(root, file string) string {
+	if root != "" {
+		if rel, err := filepath.Rel(root, file); err == nil {
+			return "/" + rel
+		}
+	}
+	return file
+}
+
+// settingsOutcome checks numeric settings against a condition
+func (t *complianceTarget) settingsOutcome(settings *EffectiveSettings, rule StackRule, keys []string, want string, ok func(int) bool) complianceOutcome {
+	var wrong []string
+	var evidence []ComplianceEvidence
+	for _, key := range keys {
+		setting := settings.Settings[key]
+		evidence = append(evidence, settingEvidence(t.root, setting, rule))
+		n, err := settings.Int(key)
+		if err != nil || !ok(n) {
+			wrong = append(wrong, fmt.Sprintf("%s=%s", key, setting.Value))
+		}
+	}
+	if len(wrong) > 0 {
+		return failed(fmt.Sprintf("%s %s, want %s", settings.Module, strings.Join(wrong, " "), want), evidence...)
+	}
+	return passed(fmt.Sprintf("%s %s is %s", settings.Module, strings.Join(keys, ", "), want), evidence...)
+}
+
+// faillockCheck checks a numeric pam_faillock setting of the rule that counts failures
+func faillockCheck(key, want string, ok func(int) bool) func(*complianceTarget) complianceOutcome {
+	return func(t *complianceTarget) complianceOutcome {
+		if !t.checksPasswords() {
+			return notApplicable("auth stack does not check passwords")
+		}
+		rules := t.rules(ModuleTypeAuth, FaillockModule)
+		index := slices.IndexFunc(rules, func(r StackRule) bool { return r.HasArgument("authfail") })
+		if index < 0 {
+			return failed("pam_faillock does not count failed attempts (no authfail rule)")
+		}
+		rule := rules[index]
+		settings, err := EffectiveFaillockSettings(rule.Rule, t.root)
+		if err != nil {
+			return failed(err.Error(), ruleEvidence(rule))
+		}
+		return t.settingsOutcome(settings, rule, []string{key}, want, ok)
+	}
+}
+
+// pwqualityRule returns the pam_pwquality rule of the password stack and its settings
+func (t *complianceTarget) pwqualityRule() (StackRule, *EffectiveSettings, *complianceOutcome) {
+	if !t.changesPasswords() {
+		outcome := notApplicable("password stack does not change passwords")
+		return StackRule{}, nil, &outcome
+	}
+	rules := t.rules(ModuleTypePassword, PwqualityModule)
+	if len(rules) == 0 {
+		outcome := failed("pam_pwquality is not in the password stack")
+		return StackRule{}, nil, &outcome
+	}
+	settings, err := EffectivePwqualitySettings(rules[0].Rule, t.root)
+	if err != nil {
+		outcome := failed(err.Error(), ruleEvidence(rules[0]))
+		return StackRule{}, nil, &outcome
+	}
+	return rules[0], settings, nil
+}
+
+// pwqualityCheck checks numeric pam_pwquality settings
+func pwqualityCheck(keys []string, want string, ok func(int) bool) func(*complianceTarget) complianceOutcome {
+	return func(t *complianceTarget) complianceOutcome {
+		rule, settings, outcome := t.pwqualityRule()
+		if outcome != nil {
+			return *outcome
+		}
+		return t.settingsOutcome(settings, rule, keys, want, ok)
+	}
+}
+
+// pwqualityComplexityCheck accepts either minclass=4 or negative credits for every class
+func pwqualityComplexityCheck(t *complianceTarget) complianceOutcome {
+	rule, settings, outcome := t.pwqualityRule()
+	if outcome != nil {
+		return *outcome
+	}
+	if minclass, err := settings.Int("minclass"); err == nil && minclass >= 4 {
+		return passed("pam_pwquality minclass requires every character class",
+			settingEvidence(t.root, settings.Settings["minclass"], rule))
+	}
+	return t.settingsOutcome(settings, rule, []string{"dcredit", "ucredit", "lcredit", "ocredit"}, "-1 or less",
+		func(n int) bool { return n <= -1 })
+}
+
+// rememberCheck checks that pam_pwhistory or pam_unix remembers enough passwords
+func rememberCheck(minimum int) func(*complianceTarget) complianceOutcome {
+	return func(t *complianceTarget) complianceOutcome {
+		if !t.changesPasswords() {
+			return notApplicable("password stack does not change passwords")
+		}
+		policy := t.passwordPolicy()
+		evidence := policy.evidenceOf("remember")
+		switch {
+		case policy.Remember == 0:
+			return failed("previous passwords are not remembered")
+		case policy.Remember < minimum:
+			return failed(fmt.Sprintf("remember=%d, want at least %d", policy.Remember, minimum), evidence...)
+		}
+		return passed(fmt.Sprintf("remember=%d", policy.Remember), evidence...)
+	}
+}
+
+// hashCheck checks the pam_unix password hash. With minRounds set, sha512 also needs that
+// many rounds, set by a rounds= argument or SHA_CRYPT_MIN_ROUNDS in login.defs.
+func hashCheck(minRounds int) func(*complianceTarget) complianceOutcome {
+	return func(t *complianceTarget) complianceOutcome {
+		if !t.changesPasswords() {
+			return notApplicable("password stack does not change passwords")
+		}
+		policy := t.passwordPolicy()
+		evidence := policy.evidenceOf("hash", "rounds")
+
+		switch policy.Hash {
+		case "yescrypt", "gost_yescrypt":
+			return passed("passwords are hashed with "+policy.Hash, evidence...)
+		case "sha512":
+			switch {
+			case minRounds == 0:
+				return passed("passwords are hashed with sha512", evidence...)
+			case policy.Rounds == 0:
+				return failed(fmt.Sprintf("sha512 rounds are not configured, want at least %d", minRounds), evidence...)
+			case policy.Rounds < minRounds:
+				return failed(fmt.Sprintf("sha512 uses %d rounds, want at least %d", policy.Rounds, minRounds), evidence...)
+			}
+			return passed(fmt.Sprintf("passwords are hashed with sha512 and %d rounds", policy.Rounds), evidence...)
+		case "":
+			return failed("no password hash is configured", evidence...)
+		}
+		return failed("passwords are hashed with "+policy.Hash, evidence...)
+	}
+}
+
+// nullokCheck fails for every pam_unix rule that accepts empty passwords
+func nullokCheck(t *complianceTarget) complianceOutcome {
+	var evidence []ComplianceEvidence
+	unix := false
+	for _, rule := range t.stack.Rules {
+		if !rule.IsModule("pam_unix.so") {
+			continue
+		}
+		unix = true
+		if rule.HasArgument("nullok") || rule.HasArgument("nullok_secure") {
+			evidence = append(evidence, ruleEvidence(rule))
+		}
+	}
+	switch {
+	case !unix:
+		return notApplicable("pam_unix is not used")
+	case len(evidence) > 0:
+		return failed("pam_unix allows empty passwords", evidence...)
+	}
+	return passed("pam_unix does not allow empty passwords")
+}
+
+// suWheelCheck requires a pam_wheel rule with use_uid whose failure fails the auth stack
+func suWheelCheck(t *complianceTarget) complianceOutcome {
+	rules := t.rules(ModuleTypeAuth, "pam_wheel.so")
+	for _, rule := range rules {
+		if required, _ := controlBlocks(rule.Control); required && rule.HasArgument("use_uid") {
+			return passed("su is restricted by pam_wheel", ruleEvidence(rule))
+		}
+	}
+	if len(rules) > 0 {
+		return failed("pam_wheel is not required with use_uid", ruleEvidence(rules[0]))
+	}
+	return failed("pam_wheel is not in the auth stack")
+}
+
+// Count returns the number of results with a status
+func (r *ComplianceReport) Count(status ComplianceStatus) int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Diagnostics returns the failed results as diagnostics located at their first evidence, or
+// at the service file if there is none. Paths are joined to the report's root.
+func (r *ComplianceReport) Diagnostics() []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, result := range r.Results {
+		if result.Status != ComplianceFail {
+			continue
+		}
+		d := Diagnostic{
+			Check:     result.ControlID,
+			Severity:  SeverityWarning,
+			Message:   fmt.Sprintf("%s: %s: %s", result.Service, result.Title, result.Message),
+			File:      filepath.Join(r.Root, DefaultPamDDir, result.Service),
+			RuleIndex: -1,
+		}
+		if len(result.Evidence) > 0 {
+			d.File = filepath.Join(r.Root, result.Evidence[0].File)
+			d.Line = result.Evidence[0].Line
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics
+}
+
+// Text renders one line per result followed by its evidence
+func (r *ComplianceReport) Text() string {
+	var b strings.Builder
+	for _, result := range r.Results {
+		status := strings.ToUpper(string(result.Status))
+		if result.Status == ComplianceNotApplicable {
+			status = "N/A"
+		}
+		fmt.Fprintf(&b, "%-4s %s [%s] %s\n", status, result.ControlID, result.Service, result.Message)
+		for _, evidence := range result.Evidence {
+			fmt.Fprintf(&b, "       %s\n", evidence)
+		}
+	}
+	fmt.Fprintf(&b, "%d passed, %d failed, %d not applicable\n",
+		r.Count(CompliancePass), r.Count(ComplianceFail), r.Count(ComplianceNotApplicable))
+	return b.String()
+}
+
+// String renders evidence as file:line: rule
+func (e ComplianceEvidence) String() string {
+	location := e.File
+	if e.Line > 0 {
+		location += ":" + strconv.Itoa(e.Line)
+	}
+	if e.Rule == "" {
+		return location
+	}
+	return location + ": " + e.Rule
+}
+
+// JSON renders the report as indented JSON
+func (r *ComplianceReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// junitTestSuites and the types below are the JUnit XML schema understood by CI servers
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnit renders the report as JUnit XML with one test suite per benchmark and one test case
+// per control and service. Failures carry the evidence; not-applicable results are skipped.
+func (r *ComplianceReport) JUnit() ([]byte, error) {
+	suites := junitTestSuites{Name: "pam-compliance"}
+	index := make(map[Benchmark]int)
+	for _, result := range r.Results {
+		i, ok := index[result.Benchmark]
+		if !ok {
+			i = len(suites.Suites)
+			index[result.Benchmark] = i
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: string(result.Benchmark)})
+		}
+		suite := &suites.Suites[i]
+
+		evidence := make([]string, len(result.Evidence))
+		for j, e := range result.Evidence {
+			evidence[j] = e.String()
+		}
+		testCase := junitTestCase{
+			Name:      result.ControlID + ": " + result.Title,
+			ClassName: string(result.Benchmark) + "." + result.Service,
+		}
+		switch result.Status {
+		case ComplianceFail:
+			testCase.Failure = &junitMessage{Message: result.Message, Text: strings.Join(evidence, "\n")}
+			suite.Failures++
+		case ComplianceNotApplicable:
+			testCase.Skipped = &junitMessage{Message: result.Message}
+			suite.Skipped++
+		default:
+			testCase.SystemOut = strings.Join(append([]string{result.Message}, evidence...), "\n")
+		}
+		suite.Cases = append(suite.Cases, testCase)
+		suite.Tests++
+	}
+	for _, suite := range suites.Suites {
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+	}
+
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error writing JUnit report: %w", err)
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
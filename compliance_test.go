@@ -0,0 +1,219 @@
+package pamparser
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+// complianceHost is hardened to CIS but not to STIG, except that su lacks pam_wheel
+var complianceHost = map[string]string{
+	"/etc/pam.d/sshd": "auth include system-auth\npassword include system-auth\n",
+	"/etc/pam.d/su":   "auth sufficient pam_rootok.so\nauth include system-auth\n",
+	"/etc/pam.d/cron": "account required pam_access.so\n",
+	"/etc/pam.d/system-auth": `auth     required      pam_faillock.so preauth
+auth     sufficient    pam_unix.so try_first_pass
+auth     [default=die] pam_faillock.so authfail
+auth     required      pam_deny.so
+password requisite     pam_pwquality.so
+password required      pam_pwhistory.so use_authtok
+password sufficient    pam_unix.so sha512 use_authtok
+`,
+	DefaultFaillockFile:  "deny = 5\nunlock_time = 900\n",
+	DefaultPwqualityFile: "minlen = 14\nminclass = 4\n",
+	DefaultPwhistoryFile: "remember = 24\n",
+}
+
+// complianceStatuses maps control and service to status
+func complianceStatuses(report *ComplianceReport) map[string]ComplianceStatus {
+	statuses := make(map[string]ComplianceStatus)
+	for _, result := range report.Results {
+		statuses[result.ControlID+" "+result.Service] = result.Status
+	}
+	return statuses
+}
+
+func TestCheckCompliance(t *testing.T) {
+	root := writeSettingsFiles(t, complianceHost)
+
+	report, err := NewFileManager().CheckCompliance(root, ComplianceControls())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	statuses := complianceStatuses(report)
+
+	tests := []struct {
+		key  string
+		want ComplianceStatus
+	}{
+		{"cis-faillock-deny sshd", CompliancePass},
+		{"cis-faillock-unlock-time su", CompliancePass},
+		{"cis-faillock-deny cron", ComplianceNotApplicable},
+		{"cis-pwquality-minlen sshd", CompliancePass},
+		{"cis-pwquality-complexity sshd", CompliancePass},
+		{"cis-pwquality-minlen su", ComplianceNotApplicable},
+		{"cis-pwhistory-remember sshd", CompliancePass},
+		{"cis-password-hash sshd", CompliancePass},
+		{"cis-no-nullok sshd", CompliancePass},
+		{"cis-no-nullok cron", ComplianceNotApplicable},
+		{"cis-su-wheel su", ComplianceFail},
+		{"stig-faillock-deny sshd", ComplianceFail},
+		{"stig-faillock-interval sshd", CompliancePass},
+		{"stig-faillock-unlock-time sshd", ComplianceFail},
+		{"stig-pwquality-minlen sshd", ComplianceFail},
+		{"stig-pwquality-credits sshd", ComplianceFail},
+		{"stig-pwhistory-remember sshd", CompliancePass},
+		{"stig-password-hash sshd", ComplianceFail},
+	}
+	for _, tt := range tests {
+		if got := statuses[tt.key]; got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+	if _, ok := statuses["cis-su-wheel sshd"]; ok {
+		t.Error("expected cis-su-wheel to be limited to su")
+	}
+	if _, ok := statuses["cis-faillock-deny system-auth"]; ok {
+		t.Error("expected included files not to be checked as services")
+	}
+
+	// Evidence for a setting points at the file line it was read from
+	for _, result := range report.Results {
+		if result.ControlID == "stig-faillock-deny" && result.Service == "sshd" {
+			if len(result.Evidence) != 1 || result.Evidence[0].String() != "/etc/security/faillock.conf:1: deny = 5" {
+				t.Errorf("evidence = %+v", result.Evidence)
+			}
+			if result.Message != "pam_faillock.so deny=5, want between 1 and 3" {
+				t.Errorf("message = %q", result.Message)
+			}
+		}
+		if result.ControlID == "cis-pwhistory-remember" && result.Service == "sshd" {
+			if len(result.Evidence) != 1 || result.Evidence[0].String() != "/etc/security/pwhistory.conf:1: remember = 24" {
+				t.Errorf("evidence = %+v", result.Evidence)
+			}
+		}
+	}
+}
+
+func TestCheckCompliance_PasswordHash(t *testing.T) {
+	tests := []struct {
+		name      string
+		unix      string
+		loginDefs string
+		cis       ComplianceStatus
+		stig      ComplianceStatus
+	}{
+		{"yescrypt", "pam_unix.so yescrypt", "", CompliancePass, CompliancePass},
+		{"sha512 without rounds", "pam_unix.so sha512", "", CompliancePass, ComplianceFail},
+		{"sha512 with rounds", "pam_unix.so sha512 rounds=65536", "", CompliancePass, CompliancePass},
+		{"sha512 with too few rounds", "pam_unix.so sha512 rounds=1000", "", CompliancePass, ComplianceFail},
+		{"login.defs rounds", "pam_unix.so sha512", "SHA_CRYPT_MIN_ROUNDS 5000\n", CompliancePass, CompliancePass},
+		{"rounds argument overrides login.defs", "pam_unix.so sha512 rounds=1000", "SHA_CRYPT_MIN_ROUNDS 5000\n", CompliancePass, ComplianceFail},
+		{"login.defs method and rounds", "pam_unix.so", "ENCRYPT_METHOD SHA512\nSHA_CRYPT_MIN_ROUNDS 10000\n", CompliancePass, CompliancePass},
+		{"weak hash", "pam_unix.so md5", "", ComplianceFail, ComplianceFail},
+		{"no hash", "pam_unix.so", "", ComplianceFail, ComplianceFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{"/etc/pam.d/passwd": "password required " + tt.unix + "\n"}
+			if tt.loginDefs != "" {
+				files[DefaultLoginDefsFile] = tt.loginDefs
+			}
+			report, err := NewFileManager().CheckCompliance(writeSettingsFiles(t, files), ComplianceControls())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			statuses := complianceStatuses(report)
+			if got := statuses["cis-password-hash passwd"]; got != tt.cis {
+				t.Errorf("cis-password-hash = %q, want %q", got, tt.cis)
+			}
+			if got := statuses["stig-password-hash passwd"]; got != tt.stig {
+				t.Errorf("stig-password-hash = %q, want %q", got, tt.stig)
+			}
+		})
+	}
+}
+
+func TestCheckCompliance_Findings(t *testing.T) {
+	root := writeSettingsFiles(t, map[string]string{
+		"/etc/pam.d/login": `auth     required pam_unix.so nullok
+password required pam_unix.so md5
+`,
+		"/etc/pam.d/su": "auth required pam_wheel.so use_uid\n",
+	})
+
+	report, err := NewFileManager().CheckCompliance(root, ComplianceControls(BenchmarkCIS))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	statuses := complianceStatuses(report)
+	for _, key := range []string{"cis-faillock-deny login", "cis-pwquality-minlen login", "cis-pwhistory-remember login", "cis-password-hash login", "cis-no-nullok login"} {
+		if statuses[key] != ComplianceFail {
+			t.Errorf("%s = %q, want fail", key, statuses[key])
+		}
+	}
+	if statuses["cis-su-wheel su"] != CompliancePass {
+		t.Errorf("cis-su-wheel su = %q, want pass", statuses["cis-su-wheel su"])
+	}
+	if _, ok := statuses["stig-no-nullok login"]; ok {
+		t.Error("expected only CIS controls")
+	}
+
+	for _, result := range report.Results {
+		if result.ControlID == "cis-no-nullok" && result.Service == "login" {
+			if len(result.Evidence) != 1 || result.Evidence[0].File != "/etc/pam.d/login" || result.Evidence[0].Line != 1 {
+				t.Errorf("evidence = %+v", result.Evidence)
+			}
+		}
+	}
+
+	// A control limited to a missing service is reported once as not applicable
+	root = writeSettingsFiles(t, map[string]string{"/etc/pam.d/login": "auth required pam_unix.so\n"})
+	report, err = NewFileManager().CheckCompliance(root, ComplianceControls(BenchmarkCIS))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := complianceStatuses(report)["cis-su-wheel su"]; got != ComplianceNotApplicable {
+		t.Errorf("cis-su-wheel su = %q, want not_applicable", got)
+	}
+}
+
+func TestComplianceReport_Output(t *testing.T) {
+	root := writeSettingsFiles(t, complianceHost)
+	report, err := NewFileManager().CheckCompliance(root, ComplianceControls())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := report.JSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded ComplianceReport
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded.Results) != len(report.Results) {
+		t.Errorf("JSON does not round trip: %v", err)
+	}
+
+	data, err = report.JUnit()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatalf("JUnit output is not valid XML: %v", err)
+	}
+	if len(suites.Suites) != 2 || suites.Suites[0].Name != "cis" || suites.Suites[1].Name != "stig" {
+		t.Fatalf("suites = %+v", suites.Suites)
+	}
+	if suites.Tests != len(report.Results) || suites.Failures != report.Count(ComplianceFail) || suites.Skipped != report.Count(ComplianceNotApplicable) {
+		t.Errorf("totals = %d/%d/%d", suites.Tests, suites.Failures, suites.Skipped)
+	}
+
+	text := report.Text()
+	if !strings.Contains(text, "FAIL cis-su-wheel [su] pam_wheel is not in the auth stack") ||
+		!strings.Contains(text, "failed,") {
+		t.Errorf("Text() = %s", text)
+	}
+}
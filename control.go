@@ -0,0 +1,246 @@
+package pamparser
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// knownReturnValues lists every PAM return value except default, in libpam order
+var knownReturnValues = []ReturnValue{
+	ReturnSuccess, ReturnOpenErr, ReturnSymbolErr, ReturnServiceErr, ReturnSystemErr, ReturnBufErr,
+	ReturnPermDenied, ReturnAuthErr, ReturnCredInsufficient, ReturnAuthinfoUnavail, ReturnUserUnknown,
+	ReturnMaxtries, ReturnNewAuthtokReqd, ReturnAcctExpired, ReturnSessionErr, ReturnCredUnavail,
+	ReturnCredExpired, ReturnCredErr, ReturnNoModuleData, ReturnConvErr, ReturnAuthtokErr,
+	ReturnAuthtokRecoverErr, ReturnAuthtokLockBusy, ReturnAuthtokDisableAging, ReturnTryAgain,
+	ReturnIgnore, ReturnAbort, ReturnAuthtokExpired, ReturnModuleUnknown, ReturnBadItem,
+	ReturnConvAgain, ReturnIncomplete,
+}
+
+// simpleControlActions maps simple control keywords to their bracket equivalents (see pam.conf(5))
+var simpleControlActions = map[ControlType]map[ReturnValue]any{
+	ControlRequired: {
+		ReturnSuccess: ActionOK, ReturnNewAuthtokReqd: ActionOK, ReturnIgnore: ActionIgnore, ReturnDefault: ActionBad,
+	},
+	ControlRequisite: {
+		ReturnSuccess: ActionOK, ReturnNewAuthtokReqd: ActionOK, ReturnIgnore: ActionIgnore, ReturnDefault: ActionDie,
+	},
+	ControlSufficient: {
+		ReturnSuccess: ActionDone, ReturnNewAuthtokReqd: ActionDone, ReturnDefault: ActionIgnore,
+	},
+	ControlOptional: {
+		ReturnSuccess: ActionOK, ReturnNewAuthtokReqd: ActionOK, ReturnDefault: ActionIgnore,
+	},
+}
+
+// actionString renders a complex control action (ActionType, jump count or decoded JSON value)
+func actionString(action any) string {
+	switch v := action.(type) {
+	case ActionType:
+		return string(v)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.Itoa(int(v))
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// actions returns the bracket entries a control stands for. The second result is false for
+// include and substack, which have no bracket equivalent.
+func (c Control) actions() (map[ReturnValue]any, bool) {
+	if c.Simple != nil {
+		actions, ok := simpleControlActions[*c.Simple]
+		return actions, ok
+	}
+	return c.Complex, true
+}
+
+// effectiveActions returns the action taken for every return value, resolving unlisted
+// return values through default and, when default is absent, to bad as libpam does
+func effectiveActions(actions map[ReturnValue]any) map[ReturnValue]string {
+	fallback := string(ActionBad)
+	if action, ok := actions[ReturnDefault]; ok {
+		fallback = actionString(action)
+	}
+
+	effective := make(map[ReturnValue]string, len(knownReturnValues)+1)
+	for _, rv := range knownReturnValues {
+		effective[rv] = fallback
+	}
+	for rv, action := range actions {
+		effective[rv] = actionString(action)
+	}
+	effective[ReturnDefault] = fallback
+	return effective
+}
+
+// ToComplex returns the bracket form of a control. Complex controls are returned as is;
+// include and substack have no bracket form and report false.
+func (c Control) ToComplex() (Control, bool) {
+	actions, ok := c.actions()
+	if !ok {
+		return c, false
+	}
+	return Control{Complex: maps.Clone(actions), Order: slices.Clone(c.Order), Optional: c.Optional}, true
+}
+
+// ToSimple returns the simple keyword equivalent to a control, if there is one
+func (c Control) ToSimple() (Control, bool) {
+	if c.Simple != nil {
+		return c, true
+	}
+	for _, keyword := range []ControlType{ControlRequired, ControlRequisite, ControlSufficient, ControlOptional} {
+		simple := Control{Simple: &keyword, Optional: c.Optional}
+		if Equivalent(c, simple) {
+			return simple, true
+		}
+	}
+	return c, false
+}
+
+// Normalize returns the canonical form of a control: a bracket form with an explicit default
+// and only the return values whose action differs from it. include and substack are returned
+// unchanged. Equivalent controls have identical normalized forms.
+func (c Control) Normalize() Control {
+	actions, ok := c.actions()
+	if !ok {
+		return c
+	}
+
+	effective := effectiveActions(actions)
+	fallback := effective[ReturnDefault]
+	normalized := Control{Complex: map[ReturnValue]any{}, Optional: c.Optional}
+	for rv, action := range effective {
+		if rv != ReturnDefault && action == fallback {
+			continue
+		}
+		if jump, err := strconv.Atoi(action); err == nil {
+			normalized.Complex[rv] = jump
+		} else {
+			normalized.Complex[rv] = ActionType(action)
+		}
+	}
+	return normalized
+}
+
+// Shortest returns the shortest written form equivalent to a control: the simple keyword
+// if there is one, otherwise the shorter of the control and its normalized form
+func (c Control) Shortest() Control {
+	if simple, ok := c.ToSimple(); ok {
+		return simple
+	}
+	w := NewWriter()
+	if normalized := c.Normalize(); len(w.formatControl(normalized)) < len(w.formatControl(c)) {
+		return normalized
+	}
+	return c
+}
+
+// Equivalent reports whether two controls make libpam behave identically for every return
+// value, e.g. required and [success=ok new_authtok_reqd=ok ignore=ignore default=bad]
+func Equivalent(a, b Control) bool {
+	if a.Optional != b.Optional {
+		return false
+	}
+
+	aActions, aOK := a.actions()
+	bActions, bOK := b.actions()
+	if !aOK || !bOK {
+		return a.Simple != nil && b.Simple != nil && *a.Simple == *b.Simple
+	}
+
+	aEffective, bEffective := effectiveActions(aActions), effectiveActions(bActions)
+	for _, pair := range [][2]map[ReturnValue]string{{aEffective, bEffective}, {bEffective, aEffective}} {
+		for rv, action := range pair[0] {
+			if action != effectiveAction(pair[1], rv) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// effectiveAction looks up a return value, falling back to default for return values
+// that were not listed (only possible for values unknown to this package)
+func effectiveAction(effective map[ReturnValue]string, rv ReturnValue) string {
+	if action, ok := effective[rv]; ok {
+		return action
+	}
+	return effective[ReturnDefault]
+}
+
+// ControlProblem describes an invalid entry in a complex control. Column is 1-based and
+// counts from the start of the line when the problem was found while parsing a file, or
+// from the start of the control otherwise.
+type ControlProblem struct {
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (p ControlProblem) Error() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("line %d, column %d: %s", p.Line, p.Column, p.Message)
+	}
+	return fmt.Sprintf("column %d: %s", p.Column, p.Message)
+}
+
+// ControlProblems is the error returned for a complex control with one or more invalid entries
+type ControlProblems []ControlProblem
+
+// Error implements the error interface
+func (ps ControlProblems) Error() string {
+	messages := make([]string, len(ps))
+	for i, p := range ps {
+		messages[i] = p.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// checkAction reports whether a complex control action is a known action keyword or a
+// positive jump
+func checkAction(action any) error {
+	switch v := action.(type) {
+	case ActionType:
+		if !IsValidAction(string(v)) {
+			return fmt.Errorf("unknown action %q", v)
+		}
+	case int:
+		if v <= 0 {
+			return fmt.Errorf("jump %d must be a positive number of rules", v)
+		}
+	case float64: // decoded from JSON
+		if v <= 0 || v != float64(int(v)) {
+			return fmt.Errorf("jump %v must be a positive number of rules", v)
+		}
+	default:
+		return fmt.Errorf("unsupported action %v", v)
+	}
+	return nil
+}
+
+// complexControlProblems describes the invalid entries of a complex control built in code,
+// in sorted return value order
+func complexControlProblems(c Control) []string {
+	keys := make([]ReturnValue, 0, len(c.Complex))
+	for rv := range c.Complex {
+		keys = append(keys, rv)
+	}
+	slices.Sort(keys)
+
+	var problems []string
+	for _, rv := range keys {
+		if !IsValidReturnValue(string(rv)) {
+			problems = append(problems, fmt.Sprintf("unknown return value %q", rv))
+		}
+		if err := checkAction(c.Complex[rv]); err != nil {
+			problems = append(problems, fmt.Sprintf("%v for %q", err, rv))
+		}
+	}
+	return problems
+}
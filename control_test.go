@@ -0,0 +1,308 @@
+package pamparser
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustParseControl(t *testing.T, s string) Control {
+	t.Helper()
+	control, err := NewParser().parseControl(s)
+	if err != nil {
+		t.Fatalf("failed to parse control %q: %v", s, err)
+	}
+	return control
+}
+
+func TestEquivalent(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"required", "[success=ok new_authtok_reqd=ok ignore=ignore default=bad]", true},
+		{"required", "[success=ok new_authtok_reqd=ok ignore=ignore]", true}, // default is bad
+		{"requisite", "[success=ok new_authtok_reqd=ok ignore=ignore default=die]", true},
+		{"sufficient", "[success=done new_authtok_reqd=done default=ignore]", true},
+		{"optional", "[success=ok new_authtok_reqd=ok default=ignore]", true},
+		{"optional", "[success=ok new_authtok_reqd=ok default=ignore auth_err=ignore]", true},
+		{"required", "requisite", false},
+		{"required", "[success=ok default=bad]", false},
+		{"-required", "required", false},
+		{"-optional", "-[success=ok new_authtok_reqd=ok default=ignore]", true},
+		{"[success=1 default=ignore]", "[default=ignore success=1]", true},
+		{"[success=1 default=ignore]", "[success=2 default=ignore]", false},
+		{"include", "include", true},
+		{"include", "substack", false},
+		{"include", "[default=bad]", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			a, b := mustParseControl(t, tt.a), mustParseControl(t, tt.b)
+			if got := Equivalent(a, b); got != tt.want {
+				t.Errorf("Equivalent() = %v, want %v", got, tt.want)
+			}
+			if got := Equivalent(b, a); got != tt.want {
+				t.Errorf("Equivalent() is not symmetric")
+			}
+		})
+	}
+}
+
+func TestControl_Conversions(t *testing.T) {
+	w := NewWriter()
+
+	tests := []struct {
+		control    string
+		complex    string
+		simple     string
+		normalized string
+		shortest   string
+	}{
+		{
+			control:    "required",
+			complex:    "[default=bad ignore=ignore new_authtok_reqd=ok success=ok]",
+			simple:     "required",
+			normalized: "[default=bad ignore=ignore new_authtok_reqd=ok success=ok]",
+			shortest:   "required",
+		},
+		{
+			control:    "[success=done new_authtok_reqd=done default=ignore]",
+			complex:    "[success=done new_authtok_reqd=done default=ignore]",
+			simple:     "sufficient",
+			normalized: "[default=ignore new_authtok_reqd=done success=done]",
+			shortest:   "sufficient",
+		},
+		{
+			control:    "[success=1 auth_err=bad default=bad]",
+			complex:    "[success=1 auth_err=bad default=bad]",
+			simple:     "",
+			normalized: "[default=bad success=1]",
+			shortest:   "[default=bad success=1]",
+		},
+		{
+			control:    "[success=1]",
+			complex:    "[success=1]",
+			simple:     "",
+			normalized: "[default=bad success=1]",
+			shortest:   "[success=1]",
+		},
+		{
+			control:    "substack",
+			complex:    "",
+			simple:     "substack",
+			normalized: "substack",
+			shortest:   "substack",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.control, func(t *testing.T) {
+			control := mustParseControl(t, tt.control)
+
+			complex, ok := control.ToComplex()
+			if ok != (tt.complex != "") || (ok && w.formatControl(complex) != tt.complex) {
+				t.Errorf("ToComplex() = %s, %v; want %q", w.formatControl(complex), ok, tt.complex)
+			}
+			simple, ok := control.ToSimple()
+			if ok != (tt.simple != "") || (ok && w.formatControl(simple) != tt.simple) {
+				t.Errorf("ToSimple() = %s, %v; want %q", w.formatControl(simple), ok, tt.simple)
+			}
+			if got := w.formatControl(control.Normalize()); got != tt.normalized {
+				t.Errorf("Normalize() = %s, want %s", got, tt.normalized)
+			}
+			if got := w.formatControl(control.Shortest()); got != tt.shortest {
+				t.Errorf("Shortest() = %s, want %s", got, tt.shortest)
+			}
+			if !Equivalent(control, control.Normalize()) || !Equivalent(control, control.Shortest()) {
+				t.Error("converted forms must stay equivalent")
+			}
+		})
+	}
+}
+
+func TestWriter_ShortestControls(t *testing.T) {
+	config := mustParsePamD(t, `auth [success=ok new_authtok_reqd=ok ignore=ignore default=bad] pam_unix.so
+auth [success=1 auth_err=bad default=bad] pam_sss.so
+session [success=ok new_authtok_reqd=ok default=ignore] pam_systemd.so
+`)
+
+	output, err := NewWriter().SetShortestControls(true).WriteString(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"auth required pam_unix.so", "auth [default=bad success=1] pam_sss.so", "session optional pam_systemd.so"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+}
+
+func TestEditor_RemoveDuplicateRules(t *testing.T) {
+	config := mustParsePamD(t, `auth required pam_unix.so nullok
+auth [success=ok new_authtok_reqd=ok ignore=ignore default=bad] pam_unix.so nullok
+auth required pam_unix.so
+auth sufficient pam_unix.so nullok
+@include common-auth
+@include common-auth
+`)
+	editor := NewEditor(config)
+
+	if removed := editor.RemoveDuplicateRules(); removed != 2 {
+		t.Errorf("expected 2 duplicates removed, got %d", removed)
+	}
+	if len(config.Rules) != 4 {
+		t.Errorf("expected 4 rules left, got %d", len(config.Rules))
+	}
+	if editor.RemoveDuplicateRules() != 0 {
+		t.Error("expected second run to remove nothing")
+	}
+}
+
+func TestDiff_EquivalentControls(t *testing.T) {
+	a := mustParsePamD(t, "auth required pam_unix.so\n")
+	b := mustParsePamD(t, "auth [success=ok new_authtok_reqd=ok ignore=ignore default=bad] pam_unix.so\n")
+	if diff := Diff(a, b); diff.HasChanges() {
+		t.Errorf("equivalent controls should not be reported, got %v", diff.Changes)
+	}
+}
+
+func TestParser_ComplexControlValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		problems []ControlProblem
+	}{
+		{"valid", "auth [success=1 new_authtok_reqd=done default=bad] pam_unix.so", nil},
+		{
+			name: "misspelled value and action",
+			line: "auth [sucess=ok default=badd] pam_unix.so",
+			problems: []ControlProblem{
+				{Line: 1, Column: 7, Message: `unknown return value "sucess"`},
+				{Line: 1, Column: 25, Message: `unknown action "badd" for "default"`},
+			},
+		},
+		{
+			name: "zero and negative jumps",
+			line: "auth  [success=0 auth_err=-2] pam_unix.so",
+			problems: []ControlProblem{
+				{Line: 1, Column: 16, Message: `jump 0 must be a positive number of rules for "success"`},
+				{Line: 1, Column: 27, Message: `jump -2 must be a positive number of rules for "auth_err"`},
+			},
+		},
+		{
+			name: "duplicate key",
+			line: "auth [success=ok success=done] pam_unix.so",
+			problems: []ControlProblem{
+				{Line: 1, Column: 18, Message: `duplicate return value "success"`},
+			},
+		},
+		{
+			name: "malformed pair",
+			line: "auth [success default=bad] pam_unix.so",
+			problems: []ControlProblem{
+				{Line: 1, Column: 7, Message: `invalid control pair "success", expected value=action`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser().Parse(strings.NewReader(tt.line), true)
+			var problems ControlProblems
+			if tt.problems == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if !errors.As(err, &problems) || !reflect.DeepEqual([]ControlProblem(problems), tt.problems) {
+				t.Errorf("got error %v, want %v", err, ControlProblems(tt.problems))
+			}
+
+			parser := NewParser().SetLenient(true)
+			config, err := parser.Parse(strings.NewReader(tt.line), true)
+			if err != nil {
+				t.Fatalf("lenient parse failed: %v", err)
+			}
+			if len(config.Rules) != 1 {
+				t.Fatalf("expected 1 rule, got %d", len(config.Rules))
+			}
+			if warnings := parser.Warnings(); !reflect.DeepEqual(warnings, tt.problems) {
+				t.Errorf("Warnings() = %v, want %v", warnings, tt.problems)
+			}
+		})
+	}
+}
+
+func TestParser_ComplexControlProblemsOptional(t *testing.T) {
+	_, err := NewParser().parseControl("-[sucess=ok]")
+	if err == nil || err.Error() != `column 3: unknown return value "sucess"` {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestEditor_ValidateComplexControl(t *testing.T) {
+	config := &Config{IsPamD: true, Rules: []Rule{{
+		Type:       ModuleTypeAuth,
+		Control:    Control{Complex: map[ReturnValue]any{"sucess": ActionOK, ReturnDefault: 0}},
+		ModulePath: "pam_unix.so",
+	}}}
+
+	warnings := NewEditor(config).Validate()
+	want := []string{
+		`Rule 0: invalid complex control: jump 0 must be a positive number of rules for "default"`,
+		`Rule 0: invalid complex control: unknown return value "sucess"`,
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("Validate() = %q, want %q", warnings, want)
+	}
+}
+
+func TestWriter_ComplexControlKeyOrder(t *testing.T) {
+	input := "auth [success=1 default=ignore] pam_unix.so\n"
+	config := mustParsePamD(t, input)
+
+	output, err := NewWriter().WriteString(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(output, "[success=1 default=ignore]") {
+		t.Errorf("expected parsed key order to be kept, got:\n%s", output)
+	}
+
+	tests := []struct {
+		name    string
+		control Control
+		want    string
+	}{
+		{
+			name:    "keys added after parsing go last, sorted",
+			control: Control{Complex: map[ReturnValue]any{ReturnSuccess: 1, ReturnDefault: ActionIgnore, ReturnUserUnknown: ActionIgnore, ReturnAuthErr: ActionDie}, Order: []ReturnValue{ReturnSuccess, ReturnDefault}},
+			want:    "[success=1 default=ignore auth_err=die user_unknown=ignore]",
+		},
+		{
+			name:    "removed keys are skipped",
+			control: Control{Complex: map[ReturnValue]any{ReturnDefault: ActionIgnore}, Order: []ReturnValue{ReturnSuccess, ReturnDefault}},
+			want:    "[default=ignore]",
+		},
+		{
+			name:    "constructed controls are sorted",
+			control: Control{Complex: map[ReturnValue]any{ReturnSuccess: 1, ReturnDefault: ActionIgnore}},
+			want:    "[default=ignore success=1]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewWriter().formatControl(tt.control); got != tt.want {
+				t.Errorf("formatControl() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// Copies made by the editor keep the order
+	copied := NewEditor(config).GetConfig()
+	if got := NewWriter().formatControl(copied.Rules[0].Control); got != "[success=1 default=ignore]" {
+		t.Errorf("GetConfig() lost key order: %s", got)
+	}
+}
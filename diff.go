@@ -0,0 +1,615 @@
+package pamparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ChangeKind classifies a difference between two configurations
+type ChangeKind string
+
+const (
+	// ChangeAdded means the rule only exists in the new configuration
+	ChangeAdded ChangeKind = "added"
+	// ChangeRemoved means the rule only exists in the old configuration
+	ChangeRemoved ChangeKind = "removed"
+	// ChangeMoved means the rule changed position relative to the other rules
+	ChangeMoved ChangeKind = "moved"
+	// ChangeControl means the rule's control field changed
+	ChangeControl ChangeKind = "control_changed"
+	// ChangeArguments means module arguments were added or removed
+	ChangeArguments ChangeKind = "arguments_changed"
+	// ChangeModule means the rule loads the same module name from a different path
+	ChangeModule ChangeKind = "module_changed"
+	// ChangeInclude means the target of an include directive or include/substack control changed
+	ChangeInclude ChangeKind = "include_changed"
+	// ChangeComment means only the inline comment changed
+	ChangeComment ChangeKind = "comment_changed"
+)
+
+// weakeningArguments are module arguments whose addition relaxes authentication
+var weakeningArguments = []string{"nullok", "nullok_secure", "no_magic_root", "no_warn"}
+
+// hardeningArguments are module arguments whose removal relaxes authentication or password policy
+var hardeningArguments = []string{
+	"deny", "unlock_time", "even_deny_root", "enforce_for_root", "minlen", "remember",
+	"use_authtok", "try_first_pass", "use_first_pass", "sha512", "yescrypt", "rounds", "authfail", "preauth",
+}
+
+// RuleChange describes a single difference between two configurations
+type RuleChange struct {
+	Kind             ChangeKind `json:"kind"`
+	Description      string     `json:"description"`
+	Old              *Rule      `json:"old,omitempty"`
+	New              *Rule      `json:"new,omitempty"`
+	AddedArguments   []string   `json:"added_arguments,omitempty"`
+	RemovedArguments []string   `json:"removed_arguments,omitempty"`
+	OldIndex         int        `json:"old_index"`
+	NewIndex         int        `json:"new_index"`
+	SecurityRelevant bool       `json:"security_relevant"`
+}
+
+// ConfigDiff is the structural difference between two configurations
+type ConfigDiff struct {
+	OldPath  string       `json:"old_path,omitempty"`
+	NewPath  string       `json:"new_path,omitempty"`
+	Changes  []RuleChange `json:"changes"`
+	oldLines []string
+	newLines []string
+}
+
+// ruleKey identifies rules that play the same role in a stack: the type plus the module,
+// or the directive type for directives and the control for include/substack rules.
+// The service is only part of the key for pam.conf rules; in pam.d files it is derived
+// from the file name, which differs between the files being compared.
+func ruleKey(rule Rule, withService bool) string {
+	service := ""
+	if withService {
+		service = strings.ToLower(rule.Service)
+	}
+	if rule.IsDirective {
+		return service + "|@" + rule.DirectiveType
+	}
+	if isIncludeControl(rule.Control) {
+		return service + "|" + string(GetNormalizedModuleType(rule.Type)) + "|" + string(*rule.Control.Simple)
+	}
+	return service + "|" + string(GetNormalizedModuleType(rule.Type)) + "|" + rule.ModuleName()
+}
+
+// isIncludeControl reports whether the control is include or substack, whose module path is a file name
+func isIncludeControl(control Control) bool {
+	return control.Simple != nil && (*control.Simple == ControlInclude || *control.Simple == ControlSubstack)
+}
+
+// includeTarget returns the file a directive or include/substack rule refers to
+func includeTarget(rule Rule) string {
+	if rule.IsDirective {
+		return rule.DirectiveTarget
+	}
+	if isIncludeControl(rule.Control) {
+		return rule.ModulePath
+	}
+	return ""
+}
+
+// controlStrength ranks simple controls by how much a module's failure matters
+func controlStrength(control Control) int {
+	control, _ = control.ToSimple()
+	if control.Simple == nil {
+		return -1
+	}
+	switch *control.Simple {
+	case ControlRequired, ControlRequisite:
+		return 2
+	case ControlSufficient:
+		return 1
+	case ControlOptional:
+		return 0
+	default:
+		return -1
+	}
+}
+
+// rulesIdentical reports whether two rules have the same key, control, target and arguments
+func rulesIdentical(a, b Rule, withService bool) bool {
+	return ruleKey(a, withService) == ruleKey(b, withService) &&
+		Equivalent(a.Control, b.Control) &&
+		includeTarget(a) == includeTarget(b) &&
+		a.ModulePath == b.ModulePath &&
+		slices.Equal(a.Arguments, b.Arguments)
+}
+
+// Diff computes the structural difference between two configurations.
+// Rules are matched by type and module (or directive), preferring identical rules and
+// otherwise pairing rules with the same key in order of appearance.
+func Diff(a, b *Config) *ConfigDiff {
+	if a == nil {
+		a = &Config{}
+	}
+	if b == nil {
+		b = &Config{}
+	}
+
+	diff := &ConfigDiff{
+		OldPath:  a.FilePath,
+		NewPath:  b.FilePath,
+		oldLines: formatRuleLines(a),
+		newLines: formatRuleLines(b),
+	}
+
+	pairs := matchRules(a.Rules, b.Rules, !a.IsPamD && !b.IsPamD)
+
+	newToOld := make(map[int]int, len(pairs))
+	for oldIdx, newIdx := range pairs {
+		newToOld[newIdx] = oldIdx
+	}
+
+	for i := range a.Rules {
+		if _, matched := pairs[i]; !matched {
+			diff.Changes = append(diff.Changes, removedChange(a.Rules[i], i))
+		}
+	}
+
+	moved := movedRules(pairs)
+	for i := range b.Rules {
+		oldIdx, matched := newToOld[i]
+		if !matched {
+			diff.Changes = append(diff.Changes, addedChange(b.Rules[i], i))
+			continue
+		}
+		diff.Changes = append(diff.Changes, pairChanges(a.Rules[oldIdx], b.Rules[i], oldIdx, i, moved[oldIdx])...)
+	}
+
+	return diff
+}
+
+// matchRules pairs old rule indices with new rule indices
+func matchRules(oldRules, newRules []Rule, withService bool) map[int]int {
+	pairs := make(map[int]int)
+	usedNew := make(map[int]bool)
+
+	// First pass: identical rules, in order
+	for i, oldRule := range oldRules {
+		for j, newRule := range newRules {
+			if !usedNew[j] && rulesIdentical(oldRule, newRule, withService) {
+				pairs[i] = j
+				usedNew[j] = true
+				break
+			}
+		}
+	}
+
+	// Second pass: remaining rules with the same key, in order
+	for i, oldRule := range oldRules {
+		if _, ok := pairs[i]; ok {
+			continue
+		}
+		for j, newRule := range newRules {
+			if !usedNew[j] && ruleKey(oldRule, withService) == ruleKey(newRule, withService) {
+				pairs[i] = j
+				usedNew[j] = true
+				break
+			}
+		}
+	}
+
+	return pairs
+}
+
+// movedRules finds matched rules whose relative order changed, i.e. those outside
+// the longest run of pairs that keeps its order
+func movedRules(pairs map[int]int) map[int]bool {
+	oldIndices := make([]int, 0, len(pairs))
+	for oldIdx := range pairs {
+		oldIndices = append(oldIndices, oldIdx)
+	}
+	// order pairs by new position
+	slices.SortFunc(oldIndices, func(x, y int) int { return pairs[x] - pairs[y] })
+
+	// longest increasing subsequence of old indices
+	n := len(oldIndices)
+	length := make([]int, n)
+	prev := make([]int, n)
+	best := -1
+	for i := range n {
+		length[i], prev[i] = 1, -1
+		for j := range i {
+			if oldIndices[j] < oldIndices[i] && length[j]+1 > length[i] {
+				length[i], prev[i] = length[j]+1, j
+			}
+		}
+		if best == -1 || length[i] > length[best] {
+			best = i
+		}
+	}
+
+	stable := make(map[int]bool, n)
+	for i := best; i >= 0; i = prev[i] {
+		stable[oldIndices[i]] = true
+	}
+
+	moved := make(map[int]bool)
+	for _, oldIdx := range oldIndices {
+		if !stable[oldIdx] {
+			moved[oldIdx] = true
+		}
+	}
+	return moved
+}
+
+// describeRule returns a short one-line description of a rule
+func describeRule(rule Rule) string {
+	w := NewWriter()
+	w.MaxLineLength = 0
+	return w.formatRule(rule)
+}
+
+// removedChange builds the change for a rule that only exists in the old configuration
+func removedChange(rule Rule, index int) RuleChange {
+	r := rule
+	return RuleChange{
+		Kind:        ChangeRemoved,
+		Description: "removed " + describeRule(rule),
+		Old:         &r,
+		OldIndex:    index,
+		NewIndex:    -1,
+		// Dropping a module whose failure mattered, or an include, changes what is enforced
+		SecurityRelevant: rule.IsDirective || controlStrength(rule.Control) == 2 || rule.Control.Complex != nil || isIncludeControl(rule.Control),
+	}
+}
+
+// addedChange builds the change for a rule that only exists in the new configuration
+func addedChange(rule Rule, index int) RuleChange {
+	r := rule
+	return RuleChange{
+		Kind:        ChangeAdded,
+		Description: "added " + describeRule(rule),
+		New:         &r,
+		OldIndex:    -1,
+		NewIndex:    index,
+		// A new sufficient module or include can let authentication succeed early
+		SecurityRelevant: rule.IsDirective || controlStrength(rule.Control) == 1 || rule.Control.Complex != nil || isIncludeControl(rule.Control),
+	}
+}
+
+// pairChanges compares two matched rules
+func pairChanges(oldRule, newRule Rule, oldIdx, newIdx int, moved bool) []RuleChange {
+	var changes []RuleChange
+	o, n := oldRule, newRule
+	base := RuleChange{Old: &o, New: &n, OldIndex: oldIdx, NewIndex: newIdx}
+	label := describeRuleKey(newRule)
+
+	if oldTarget, newTarget := includeTarget(oldRule), includeTarget(newRule); oldTarget != newTarget {
+		change := base
+		change.Kind = ChangeInclude
+		change.Description = fmt.Sprintf("%s: include target %s -> %s", label, oldTarget, newTarget)
+		change.SecurityRelevant = true
+		changes = append(changes, change)
+	}
+
+	if !Equivalent(oldRule.Control, newRule.Control) {
+		w := NewWriter()
+		change := base
+		change.Kind = ChangeControl
+		change.Description = fmt.Sprintf("%s: control %s -> %s", label, w.formatControl(oldRule.Control), w.formatControl(newRule.Control))
+		oldStrength, newStrength := controlStrength(oldRule.Control), controlStrength(newRule.Control)
+		change.SecurityRelevant = oldStrength < 0 || newStrength < 0 || newStrength < oldStrength ||
+			(!oldRule.Control.Optional && newRule.Control.Optional)
+		changes = append(changes, change)
+	}
+
+	if !isIncludeControl(newRule.Control) && oldRule.ModulePath != newRule.ModulePath {
+		change := base
+		change.Kind = ChangeModule
+		change.Description = fmt.Sprintf("%s: module path %s -> %s", label, oldRule.ModulePath, newRule.ModulePath)
+		change.SecurityRelevant = true
+		changes = append(changes, change)
+	}
+
+	added, removed := argumentDelta(oldRule.Arguments, newRule.Arguments)
+	if len(added) > 0 || len(removed) > 0 {
+		change := base
+		change.Kind = ChangeArguments
+		change.AddedArguments = added
+		change.RemovedArguments = removed
+		var parts []string
+		if len(added) > 0 {
+			parts = append(parts, "+"+strings.Join(added, " +"))
+		}
+		if len(removed) > 0 {
+			parts = append(parts, "-"+strings.Join(removed, " -"))
+		}
+		change.Description = fmt.Sprintf("%s: arguments %s", label, strings.Join(parts, " "))
+		change.SecurityRelevant = argumentsWeakened(added, removed)
+		changes = append(changes, change)
+	}
+
+	if oldRule.Comment != newRule.Comment {
+		change := base
+		change.Kind = ChangeComment
+		change.Description = fmt.Sprintf("%s: comment %q -> %q", label, oldRule.Comment, newRule.Comment)
+		changes = append(changes, change)
+	}
+
+	if moved {
+		change := base
+		change.Kind = ChangeMoved
+		change.Description = fmt.Sprintf("%s: moved from position %d to %d", label, oldIdx, newIdx)
+		// Order decides which sufficient/requisite module short-circuits first
+		change.SecurityRelevant = !newRule.IsDirective && GetNormalizedModuleType(newRule.Type) != ModuleTypeSession
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// describeRuleKey returns a short label for a matched rule
+func describeRuleKey(rule Rule) string {
+	if rule.IsDirective {
+		return "@" + rule.DirectiveType
+	}
+	label := string(rule.Type) + " " + rule.ModuleName()
+	if rule.Service != "" {
+		label = rule.Service + " " + label
+	}
+	return label
+}
+
+// argumentDelta returns arguments present only in b (added) and only in a (removed)
+func argumentDelta(a, b []string) (added, removed []string) {
+	for _, arg := range b {
+		if !slices.Contains(a, arg) {
+			added = append(added, arg)
+		}
+	}
+	for _, arg := range a {
+		if !slices.Contains(b, arg) {
+			removed = append(removed, arg)
+		}
+	}
+	return added, removed
+}
+
+// argumentName returns the name part of a name=value argument
+func argumentName(arg string) string {
+	name, _, _ := strings.Cut(arg, "=")
+	return name
+}
+
+// argumentsWeakened reports whether an argument change is likely to relax security
+func argumentsWeakened(added, removed []string) bool {
+	for _, arg := range added {
+		if slices.Contains(weakeningArguments, argumentName(arg)) {
+			return true
+		}
+	}
+	for _, arg := range removed {
+		if slices.Contains(hardeningArguments, argumentName(arg)) {
+			return true
+		}
+	}
+	// a changed value for a policy setting (e.g. deny=3 -> deny=10) shows up as both
+	for _, arg := range added {
+		if strings.Contains(arg, "=") && slices.Contains(hardeningArguments, argumentName(arg)) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasChanges reports whether the configurations differ
+func (d *ConfigDiff) HasChanges() bool {
+	return len(d.Changes) > 0
+}
+
+// SecurityRelevant returns the changes flagged as security-relevant
+func (d *ConfigDiff) SecurityRelevant() []RuleChange {
+	var relevant []RuleChange
+	for _, change := range d.Changes {
+		if change.SecurityRelevant {
+			relevant = append(relevant, change)
+		}
+	}
+	return relevant
+}
+
+// Text renders the diff as a human-readable change list
+func (d *ConfigDiff) Text() string {
+	var b strings.Builder
+
+	if d.OldPath != "" || d.NewPath != "" {
+		fmt.Fprintf(&b, "%s -> %s\n", d.OldPath, d.NewPath)
+	}
+	if !d.HasChanges() {
+		b.WriteString("no changes\n")
+		return b.String()
+	}
+
+	for _, change := range d.Changes {
+		marker := " "
+		if change.SecurityRelevant {
+			marker = "!"
+		}
+		fmt.Fprintf(&b, "%s %-17s %s\n", marker, change.Kind, change.Description)
+	}
+
+	if relevant := len(d.SecurityRelevant()); relevant > 0 {
+		fmt.Fprintf(&b, "%d change(s), %d security-relevant\n", len(d.Changes), relevant)
+	} else {
+		fmt.Fprintf(&b, "%d change(s)\n", len(d.Changes))
+	}
+
+	return b.String()
+}
+
+// JSON renders the diff as indented JSON
+func (d *ConfigDiff) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// formatRuleLines formats each rule of a configuration in its current order
+func formatRuleLines(config *Config) []string {
+	w := NewWriter()
+	w.MaxLineLength = 0
+	lines := make([]string, 0, len(config.Rules))
+	for _, rule := range config.Rules {
+		lines = append(lines, w.formatRule(rule))
+	}
+	return lines
+}
+
+// Unified renders the diff as a unified diff of the formatted rules with three lines of context
+func (d *ConfigDiff) Unified() string {
+	return unifiedDiff(d.oldLines, d.newLines, d.OldPath, d.NewPath, 3)
+}
+
+// diffOp is a single line operation in an edit script
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// lineEditScript computes a minimal line edit script using the longest common subsequence
+func lineEditScript(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// unifiedDiff renders two line slices as a unified diff
+func unifiedDiff(a, b []string, oldName, newName string, context int) string {
+	ops := lineEditScript(a, b)
+
+	changed := false
+	for _, op := range ops {
+		if op.kind != ' ' {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	if oldName == "" {
+		oldName = "a"
+	}
+	if newName == "" {
+		newName = "b"
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+
+	// positions of each op in the old and new files
+	oldPos := make([]int, len(ops)+1)
+	newPos := make([]int, len(ops)+1)
+	for k, op := range ops {
+		oldPos[k+1], newPos[k+1] = oldPos[k], newPos[k]
+		if op.kind != '+' {
+			oldPos[k+1]++
+		}
+		if op.kind != '-' {
+			newPos[k+1]++
+		}
+	}
+
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+
+		// extend the hunk while changes are within 2*context lines of each other
+		start := max(0, k-context)
+		end := k
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*context {
+				end = min(len(ops), end+context)
+				break
+			}
+			end = next
+		}
+
+		oldCount := oldPos[end] - oldPos[start]
+		newCount := newPos[end] - newPos[start]
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(oldPos[start], oldCount), hunkRange(newPos[start], newCount))
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.text)
+			out.WriteByte('\n')
+		}
+		k = end
+	}
+
+	return out.String()
+}
+
+// hunkRange formats a unified diff hunk range
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// DiffFiles loads two PAM configuration files and computes their structural difference
+func (fm *FileManager) DiffFiles(oldPath, newPath string) (*ConfigDiff, error) {
+	oldConfig, err := fm.LoadFromFile(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newConfig, err := fm.LoadFromFile(newPath)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(oldConfig, newConfig), nil
+}
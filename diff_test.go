@@ -0,0 +1,216 @@
+package pamparser
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func mustParsePamD(t *testing.T, content string) *Config {
+	t.Helper()
+	config, err := NewParser().Parse(strings.NewReader(content), true)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	return config
+}
+
+func findChange(changes []RuleChange, kind ChangeKind) *RuleChange {
+	for i := range changes {
+		if changes[i].Kind == kind {
+			return &changes[i]
+		}
+	}
+	return nil
+}
+
+func TestDiff_NoChanges(t *testing.T) {
+	content := `auth required pam_unix.so nullok
+account required pam_unix.so
+@include common-session
+`
+	diff := Diff(mustParsePamD(t, content), mustParsePamD(t, content))
+	if diff.HasChanges() {
+		t.Errorf("expected no changes, got %v", diff.Changes)
+	}
+	if diff.Unified() != "" {
+		t.Errorf("expected empty unified diff, got %q", diff.Unified())
+	}
+	if !strings.Contains(diff.Text(), "no changes") {
+		t.Errorf("unexpected text output: %s", diff.Text())
+	}
+}
+
+func TestDiff_Classification(t *testing.T) {
+	oldConfig := mustParsePamD(t, `auth required pam_env.so
+auth required pam_unix.so try_first_pass
+auth required pam_ldap.so
+account required pam_unix.so
+@include common-session
+`)
+	newConfig := mustParsePamD(t, `auth required pam_faillock.so preauth
+auth sufficient pam_unix.so try_first_pass nullok
+auth required pam_env.so
+account required pam_unix.so
+@include common-session-local
+`)
+
+	diff := Diff(oldConfig, newConfig)
+
+	tests := []struct {
+		kind     ChangeKind
+		relevant bool
+		contains string
+	}{
+		{ChangeRemoved, true, "pam_ldap.so"},
+		{ChangeAdded, false, "pam_faillock.so"},
+		{ChangeControl, true, "required -> sufficient"},
+		{ChangeArguments, true, "+nullok"},
+		{ChangeInclude, true, "common-session -> common-session-local"},
+		{ChangeMoved, true, "pam_env.so"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.kind), func(t *testing.T) {
+			change := findChange(diff.Changes, tt.kind)
+			if change == nil {
+				t.Fatalf("expected a %s change, got %v", tt.kind, diff.Changes)
+			}
+			if change.SecurityRelevant != tt.relevant {
+				t.Errorf("expected security relevance %v for %s", tt.relevant, change.Description)
+			}
+			if !strings.Contains(change.Description, tt.contains) {
+				t.Errorf("expected description to contain %q, got %q", tt.contains, change.Description)
+			}
+		})
+	}
+
+	args := findChange(diff.Changes, ChangeArguments)
+	if len(args.AddedArguments) != 1 || args.AddedArguments[0] != "nullok" || len(args.RemovedArguments) != 0 {
+		t.Errorf("unexpected argument delta: +%v -%v", args.AddedArguments, args.RemovedArguments)
+	}
+}
+
+func TestDiff_ModulePath(t *testing.T) {
+	oldConfig := mustParsePamD(t, "auth required /lib64/security/pam_unix.so try_first_pass\n")
+	newConfig := mustParsePamD(t, "auth required /tmp/pam_unix.so try_first_pass\n")
+
+	diff := Diff(oldConfig, newConfig)
+	if len(diff.Changes) != 1 {
+		t.Fatalf("expected 1 change, got %v", diff.Changes)
+	}
+	change := diff.Changes[0]
+	if change.Kind != ChangeModule || !change.SecurityRelevant || len(change.AddedArguments) != 0 {
+		t.Errorf("unexpected change %+v", change)
+	}
+	if !strings.Contains(change.Description, "/lib64/security/pam_unix.so -> /tmp/pam_unix.so") {
+		t.Errorf("unexpected description %q", change.Description)
+	}
+}
+
+func TestDiff_MatchesByPosition(t *testing.T) {
+	oldConfig := mustParsePamD(t, `auth [success=1 default=ignore] pam_unix.so
+auth [success=1 default=ignore] pam_sss.so
+auth requisite pam_deny.so
+`)
+	newConfig := mustParsePamD(t, `auth [success=2 default=ignore] pam_unix.so
+auth [success=1 default=ignore] pam_sss.so
+auth requisite pam_deny.so
+`)
+
+	diff := Diff(oldConfig, newConfig)
+	if len(diff.Changes) != 1 {
+		t.Fatalf("expected 1 change, got %d: %v", len(diff.Changes), diff.Changes)
+	}
+	change := diff.Changes[0]
+	if change.Kind != ChangeControl || change.OldIndex != 0 || change.NewIndex != 0 {
+		t.Errorf("unexpected change %+v", change)
+	}
+	if !change.SecurityRelevant {
+		t.Error("expected complex control change to be security-relevant")
+	}
+}
+
+func TestDiff_Renderers(t *testing.T) {
+	oldConfig := mustParsePamD(t, `auth required pam_env.so
+auth required pam_unix.so
+account required pam_unix.so
+`)
+	oldConfig.FilePath = "a/sshd"
+	newConfig := mustParsePamD(t, `auth required pam_env.so
+auth required pam_unix.so nullok
+account required pam_unix.so
+`)
+	newConfig.FilePath = "b/sshd"
+
+	diff := Diff(oldConfig, newConfig)
+
+	unified := diff.Unified()
+	expected := `--- a/sshd
++++ b/sshd
+@@ -1,3 +1,3 @@
+ auth required pam_env.so
+-auth required pam_unix.so
++auth required pam_unix.so nullok
+ account required pam_unix.so
+`
+	if unified != expected {
+		t.Errorf("unexpected unified diff:\n%s\nwant:\n%s", unified, expected)
+	}
+
+	text := diff.Text()
+	if !strings.Contains(text, "a/sshd -> b/sshd") || !strings.Contains(text, "1 security-relevant") {
+		t.Errorf("unexpected text output:\n%s", text)
+	}
+
+	data, err := diff.JSON()
+	if err != nil {
+		t.Fatalf("unexpected JSON error: %v", err)
+	}
+	var decoded ConfigDiff
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to decode JSON: %v", err)
+	}
+	if len(decoded.Changes) != 1 || decoded.Changes[0].Kind != ChangeArguments {
+		t.Errorf("unexpected decoded changes %+v", decoded.Changes)
+	}
+}
+
+func TestUnifiedDiff_Hunks(t *testing.T) {
+	a := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"}
+	b := []string{"1", "2x", "3", "4", "5", "6", "7", "8", "9", "10", "11x", "12"}
+
+	out := unifiedDiff(a, b, "old", "new", 1)
+	if strings.Count(out, "@@ -") != 2 {
+		t.Errorf("expected two hunks, got:\n%s", out)
+	}
+	if !strings.Contains(out, "@@ -1,3 +1,3 @@") || !strings.Contains(out, "@@ -10,3 +10,3 @@") {
+		t.Errorf("unexpected hunk headers:\n%s", out)
+	}
+}
+
+func TestFileManager_DiffFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldPath := tmpDir + "/old"
+	newPath := tmpDir + "/new"
+	fm := NewFileManager()
+
+	if err := fm.SaveToFile(mustParsePamD(t, "auth required pam_unix.so\n"), oldPath); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+	if err := fm.SaveToFile(mustParsePamD(t, "auth sufficient pam_unix.so\n"), newPath); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+
+	diff, err := fm.DiffFiles(oldPath, newPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(diff.SecurityRelevant()) != 1 {
+		t.Errorf("expected one security-relevant change, got %v", diff.Changes)
+	}
+
+	if _, err := fm.DiffFiles(tmpDir+"/missing", newPath); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
@@ -2,14 +2,14 @@ package pamparser
 
 import (
 	"fmt"
-	"path/filepath"
 	"slices"
 	"strings"
 )
 
 // Editor provides functionality to modify PAM configurations
 type Editor struct {
-	config *Config
+	config  *Config
+	history editHistory
 }
 
 // NewEditor creates a new editor for a PAM configuration
@@ -77,26 +77,23 @@ func (e *Editor) GetRule(index int) (*Rule, error) {
 		return nil, fmt.Errorf("rule index %d out of range [0, %d)", index, len(e.config.Rules))
 	}
 
-	rule := e.config.Rules[index]
 	// Return a copy to prevent accidental modifications
-	return &Rule{
-		Service:      rule.Service,
-		Type:         rule.Type,
-		Control:      rule.Control,
-		ModulePath:   rule.ModulePath,
-		Arguments:    append([]string(nil), rule.Arguments...),
-		Comment:      rule.Comment,
-		LineNumber:   rule.LineNumber,
-		Continuation: rule.Continuation,
-	}, nil
+	rule := e.config.Rules[index]
+	rule.Arguments = append([]string(nil), rule.Arguments...)
+	return &rule, nil
 }
 
 // AddRule adds a new rule to the configuration in the correct position based on module type
-func (e *Editor) AddRule(rule Rule) {
+// and returns the rule's ID
+func (e *Editor) AddRule(rule Rule) RuleID {
+	defer e.track(EditAddRule, "add %s", describeRule(rule))()
+
+	e.claimID(&rule)
+
 	// For directives, add at the end to preserve their order
 	if rule.IsDirective {
 		e.config.Rules = append(e.config.Rules, rule)
-		return
+		return rule.ID
 	}
 
 	// Find the correct position to insert the rule based on module type ordering
@@ -106,6 +103,7 @@ func (e *Editor) AddRule(rule Rule) {
 	e.config.Rules = append(e.config.Rules, Rule{})
 	copy(e.config.Rules[insertPos+1:], e.config.Rules[insertPos:])
 	e.config.Rules[insertPos] = rule
+	return rule.ID
 }
 
 // findInsertPosition finds the correct position to insert a rule of the given type
@@ -125,9 +123,12 @@ func (e *Editor) findInsertPosition(moduleType ModuleType) int {
 
 // InsertRule inserts a rule at the specified position
 func (e *Editor) InsertRule(index int, rule Rule) error {
+	defer e.track(EditInsertRule, "insert %s at %d", describeRule(rule), index)()
+
 	if index < 0 || index > len(e.config.Rules) {
 		return fmt.Errorf("insert index %d out of range [0, %d]", index, len(e.config.Rules))
 	}
+	e.claimID(&rule)
 
 	// Expand slice and insert
 	e.config.Rules = append(e.config.Rules, Rule{})
@@ -139,6 +140,8 @@ func (e *Editor) InsertRule(index int, rule Rule) error {
 
 // InsertRuleBefore inserts a rule before the first rule matching the filter
 func (e *Editor) InsertRuleBefore(rule Rule, filter RuleFilter) error {
+	defer e.track(EditInsertRule, "insert %s before matching rule", describeRule(rule))()
+
 	for i, existingRule := range e.config.Rules {
 		if filter(existingRule) {
 			return e.InsertRule(i, rule)
@@ -149,6 +152,8 @@ func (e *Editor) InsertRuleBefore(rule Rule, filter RuleFilter) error {
 
 // InsertRuleAfter inserts a rule after the last rule matching the filter
 func (e *Editor) InsertRuleAfter(rule Rule, filter RuleFilter) error {
+	defer e.track(EditInsertRule, "insert %s after matching rule", describeRule(rule))()
+
 	lastMatchIndex := -1
 
 	// Find the last matching rule
@@ -165,18 +170,23 @@ func (e *Editor) InsertRuleAfter(rule Rule, filter RuleFilter) error {
 	return e.InsertRule(lastMatchIndex+1, rule)
 }
 
-// UpdateRule updates the rule at the specified index
+// UpdateRule updates the rule at the specified index, keeping its ID
 func (e *Editor) UpdateRule(index int, rule Rule) error {
+	defer e.track(EditUpdateRule, "update rule %d to %s", index, describeRule(rule))()
+
 	if index < 0 || index >= len(e.config.Rules) {
 		return fmt.Errorf("rule index %d out of range [0, %d)", index, len(e.config.Rules))
 	}
 
+	rule.ID = e.config.Rules[index].ID
 	e.config.Rules[index] = rule
 	return nil
 }
 
 // RemoveRule removes the rule at the specified index
 func (e *Editor) RemoveRule(index int) error {
+	defer e.track(EditRemoveRule, "remove rule %d", index)()
+
 	if index < 0 || index >= len(e.config.Rules) {
 		return fmt.Errorf("rule index %d out of range [0, %d)", index, len(e.config.Rules))
 	}
@@ -187,6 +197,8 @@ func (e *Editor) RemoveRule(index int) error {
 
 // RemoveRules removes all rules matching the given filter
 func (e *Editor) RemoveRules(filter RuleFilter) int {
+	defer e.track(EditRemoveRules, "remove matching rules")()
+
 	var newRules []Rule
 	removed := 0
 
@@ -204,6 +216,8 @@ func (e *Editor) RemoveRules(filter RuleFilter) int {
 
 // UpdateArgument updates or adds a module argument
 func (e *Editor) UpdateArgument(ruleIndex int, argName, argValue string) error {
+	defer e.track(EditUpdateArgument, "rule %d: set %s=%s", ruleIndex, argName, argValue)()
+
 	if ruleIndex < 0 || ruleIndex >= len(e.config.Rules) {
 		return fmt.Errorf("rule index %d out of range [0, %d)", ruleIndex, len(e.config.Rules))
 	}
@@ -229,6 +243,8 @@ func (e *Editor) UpdateArgument(ruleIndex int, argName, argValue string) error {
 
 // RemoveArgument removes a module argument
 func (e *Editor) RemoveArgument(ruleIndex int, argName string) error {
+	defer e.track(EditRemoveArgument, "rule %d: remove %s", ruleIndex, argName)()
+
 	if ruleIndex < 0 || ruleIndex >= len(e.config.Rules) {
 		return fmt.Errorf("rule index %d out of range [0, %d)", ruleIndex, len(e.config.Rules))
 	}
@@ -248,6 +264,8 @@ func (e *Editor) RemoveArgument(ruleIndex int, argName string) error {
 
 // SetControl sets the control field for a rule
 func (e *Editor) SetControl(ruleIndex int, control Control) error {
+	defer e.track(EditSetControl, "rule %d: set control %s", ruleIndex, NewWriter().formatControl(control))()
+
 	if ruleIndex < 0 || ruleIndex >= len(e.config.Rules) {
 		return fmt.Errorf("rule index %d out of range [0, %d)", ruleIndex, len(e.config.Rules))
 	}
@@ -258,6 +276,8 @@ func (e *Editor) SetControl(ruleIndex int, control Control) error {
 
 // MoveRule moves a rule from one position to another
 func (e *Editor) MoveRule(fromIndex, toIndex int) error {
+	defer e.track(EditMoveRule, "move rule %d to %d", fromIndex, toIndex)()
+
 	if fromIndex < 0 || fromIndex >= len(e.config.Rules) {
 		return fmt.Errorf("from index %d out of range [0, %d)", fromIndex, len(e.config.Rules))
 	}
@@ -287,8 +307,189 @@ func (e *Editor) MoveRule(fromIndex, toIndex int) error {
 	return nil
 }
 
+// FilterByEquivalent creates a filter for rules of the same type and module as the given rule,
+// and with the same control when matchControl is set
+func FilterByEquivalent(rule Rule, matchControl bool) RuleFilter {
+	return func(existing Rule) bool {
+		if existing.IsDirective || rule.IsDirective {
+			return existing.IsDirective && rule.IsDirective &&
+				existing.DirectiveType == rule.DirectiveType && existing.DirectiveTarget == rule.DirectiveTarget
+		}
+		if rule.Service != "" && existing.Service != "" && !strings.EqualFold(rule.Service, existing.Service) {
+			return false
+		}
+		if GetNormalizedModuleType(existing.Type) != GetNormalizedModuleType(rule.Type) {
+			return false
+		}
+		if existing.ModuleName() != rule.ModuleName() {
+			return false
+		}
+		return !matchControl || Equivalent(existing.Control, rule.Control)
+	}
+}
+
+// EnsureRule makes sure a rule equivalent to the given one exists, adding it with AddRule if
+// none does. Otherwise the first equivalent rule gets the rule's control and arguments:
+// name=value arguments replace the value of the same name and flags are added if missing,
+// while other arguments the site added (such as debug or audit) are kept. pam_succeed_if
+// arguments are conditions whose tokens only make sense together, so they are replaced as a
+// whole. It reports whether the configuration changed.
+func (e *Editor) EnsureRule(rule Rule, matchControl bool) bool {
+	defer e.track(EditEnsureRule, "ensure %s", describeRule(rule))()
+
+	indices := e.FindRules(FilterByEquivalent(rule, matchControl))
+	if len(indices) == 0 {
+		e.AddRule(rule)
+		return true
+	}
+
+	existing := &e.config.Rules[indices[0]]
+	if rule.IsDirective {
+		return false
+	}
+
+	changed := false
+	if !Equivalent(existing.Control, rule.Control) {
+		existing.Control = rule.Control
+		changed = true
+	}
+	arguments := ensureArguments(existing.Arguments, rule.Arguments)
+	if rule.IsModule(SucceedIfModule) {
+		arguments = slices.Clone(rule.Arguments)
+	}
+	if !slices.Equal(existing.Arguments, arguments) {
+		existing.Arguments = arguments
+		changed = true
+	}
+	return changed
+}
+
+// ensureArguments returns existing with every requested argument present: a name=value
+// argument replaces the first argument of the same name, and anything else is appended if
+// it is missing
+func ensureArguments(existing, requested []string) []string {
+	arguments := slices.Clone(existing)
+	for _, arg := range requested {
+		if slices.Contains(arguments, arg) {
+			continue
+		}
+		if isKeyValueArgument(arg) {
+			name := argumentName(arg)
+			index := slices.IndexFunc(arguments, func(a string) bool { return isKeyValueArgument(a) && argumentName(a) == name })
+			if index >= 0 {
+				arguments[index] = arg
+				continue
+			}
+		}
+		arguments = append(arguments, arg)
+	}
+	return arguments
+}
+
+// EnsureAbsent removes all rules matching the filter and reports whether any were removed
+func (e *Editor) EnsureAbsent(filter RuleFilter) bool {
+	defer e.track(EditEnsureAbsent, "ensure matching rules are absent")()
+
+	return e.RemoveRules(filter) > 0
+}
+
+// EnsureArgument makes sure every rule matching the filter carries the argument. An empty
+// value means a flag argument; otherwise the argument is set to name=value. It reports
+// whether the configuration changed and returns an error if no rule matches.
+func (e *Editor) EnsureArgument(filter RuleFilter, argName, argValue string) (bool, error) {
+	defer e.track(EditEnsureArgument, "ensure argument %s on matching rules", argName)()
+
+	indices := e.FindRules(filter)
+	if len(indices) == 0 {
+		return false, fmt.Errorf("no rule found matching the pattern for argument %s", argName)
+	}
+
+	changed := false
+	for _, i := range indices {
+		rule := &e.config.Rules[i]
+		if argValue == "" {
+			if slices.Contains(rule.Arguments, argName) {
+				continue
+			}
+			rule.Arguments = append(rule.Arguments, argName)
+			changed = true
+			continue
+		}
+
+		if value, ok := rule.ArgumentValue(argName); ok && value == argValue {
+			continue
+		}
+		if err := e.UpdateArgument(i, argName, argValue); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// EnsureOrder makes sure every rule matching first comes before the first rule matching second,
+// moving offending rules directly in front of it. It reports whether the configuration changed
+// and returns an error if either filter matches nothing.
+func (e *Editor) EnsureOrder(first, second RuleFilter) (bool, error) {
+	defer e.track(EditEnsureOrder, "ensure rule order")()
+
+	if len(e.FindRules(first)) == 0 {
+		return false, fmt.Errorf("no rule found matching the pattern to order first")
+	}
+	if len(e.FindRules(second)) == 0 {
+		return false, fmt.Errorf("no rule found matching the pattern to order second")
+	}
+
+	// rules matching both filters constrain nothing
+	onlyFirst := CombineFilters(first, func(rule Rule) bool { return !second(rule) })
+	onlySecond := CombineFilters(second, func(rule Rule) bool { return !first(rule) })
+
+	changed := false
+	for {
+		anchors := e.FindRules(onlySecond)
+		if len(anchors) == 0 {
+			return changed, nil
+		}
+		misplaced := -1
+		for _, i := range e.FindRules(onlyFirst) {
+			if i > anchors[0] {
+				misplaced = i
+				break
+			}
+		}
+		if misplaced < 0 {
+			return changed, nil
+		}
+		if err := e.MoveRule(misplaced, anchors[0]); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+}
+
+// RemoveDuplicateRules removes rules that repeat an earlier rule with the same service, type,
+// module and arguments and an equivalent control, and returns the number removed
+func (e *Editor) RemoveDuplicateRules() int {
+	defer e.track(EditRemoveDuplicates, "remove duplicate rules")()
+
+	var kept []Rule
+	removed := 0
+	for _, rule := range e.config.Rules {
+		if slices.ContainsFunc(kept, func(k Rule) bool { return rulesIdentical(k, rule, true) }) {
+			removed++
+			continue
+		}
+		kept = append(kept, rule)
+	}
+
+	e.config.Rules = kept
+	return removed
+}
+
 // AddComment adds a standalone comment to the configuration
 func (e *Editor) AddComment(comment string) {
+	defer e.track(EditAddComment, "add comment %q", comment)()
+
 	e.config.Comments = append(e.config.Comments, comment)
 }
 
@@ -300,10 +501,14 @@ func (e *Editor) GetConfig() *Config {
 		Comments: append([]string(nil), e.config.Comments...),
 		FilePath: e.config.FilePath,
 		IsPamD:   e.config.IsPamD,
+		lastID:   e.config.lastID,
+
+		libpamCompat: e.config.libpamCompat,
 	}
 
 	for i, rule := range e.config.Rules {
 		newConfig.Rules[i] = Rule{
+			ID:           rule.ID,
 			Service:      rule.Service,
 			Type:         rule.Type,
 			Control:      rule.Control,
@@ -312,6 +517,7 @@ func (e *Editor) GetConfig() *Config {
 			Comment:      rule.Comment,
 			LineNumber:   rule.LineNumber,
 			Continuation: rule.Continuation,
+			Fragments:    append([]LineFragment(nil), rule.Fragments...),
 
 			// Directive fields
 			IsDirective:     rule.IsDirective,
@@ -325,6 +531,7 @@ func (e *Editor) GetConfig() *Config {
 			for k, v := range rule.Control.Complex {
 				newConfig.Rules[i].Control.Complex[k] = v
 			}
+			newConfig.Rules[i].Control.Order = append([]ReturnValue(nil), rule.Control.Order...)
 		}
 	}
 
@@ -334,64 +541,82 @@ func (e *Editor) GetConfig() *Config {
 // Validate checks the configuration for common issues
 func (e *Editor) Validate() []string {
 	var warnings []string
+	for _, d := range e.validationDiagnostics() {
+		warnings = append(warnings, fmt.Sprintf("Rule %d: %s", d.RuleIndex, d.Message))
+	}
+	return warnings
+}
+
+// validationDiagnostics returns the problems Validate reports
+func (e *Editor) validationDiagnostics() []Diagnostic {
+	var diagnostics []Diagnostic
 
 	for i, rule := range e.config.Rules {
 		// Skip validation for directives - they have different structure
 		if rule.IsDirective {
 			// Only validate directive-specific fields
 			if rule.DirectiveType == "" {
-				warnings = append(warnings, fmt.Sprintf("Rule %d: directive missing type", i))
+				diagnostics = append(diagnostics, e.diagnostic("directive-missing-type", i, "directive missing type"))
 			}
 			if rule.DirectiveType == "include" && rule.DirectiveTarget == "" {
-				warnings = append(warnings, fmt.Sprintf("Rule %d: @include directive missing target", i))
+				diagnostics = append(diagnostics, e.diagnostic("directive-missing-target", i, "@include directive missing target"))
 			}
 			continue
 		}
 
 		// Check for missing required fields in regular rules
 		if rule.Type == "" {
-			warnings = append(warnings, fmt.Sprintf("Rule %d: missing module type", i))
+			diagnostics = append(diagnostics, e.diagnostic("missing-module-type", i, "missing module type"))
 		}
 		if rule.ModulePath == "" {
-			warnings = append(warnings, fmt.Sprintf("Rule %d: missing module path", i))
+			diagnostics = append(diagnostics, e.diagnostic("missing-module-path", i, "missing module path"))
 		}
 
 		// Check for valid module type
 		if !IsValidModuleType(string(rule.Type)) {
-			warnings = append(warnings, fmt.Sprintf("Rule %d: invalid module type '%s'", i, rule.Type))
+			diagnostics = append(diagnostics, e.diagnostic("invalid-module-type", i, "invalid module type '%s'", rule.Type))
 		}
 
 		// Check control field
 		if rule.Control.Simple == nil && rule.Control.Complex == nil {
-			warnings = append(warnings, fmt.Sprintf("Rule %d: missing control field", i))
+			diagnostics = append(diagnostics, e.diagnostic("missing-control", i, "missing control field"))
 		}
 
 		if rule.Control.Simple != nil && !IsValidControlType(string(*rule.Control.Simple)) {
-			warnings = append(warnings, fmt.Sprintf("Rule %d: invalid control type '%s'", i, *rule.Control.Simple))
+			diagnostics = append(diagnostics, e.diagnostic("invalid-control", i, "invalid control type '%s'", *rule.Control.Simple))
+		}
+		for _, problem := range complexControlProblems(rule.Control) {
+			diagnostics = append(diagnostics, e.diagnostic("invalid-complex-control", i, "invalid complex control: %s", problem))
+		}
+
+		// Check pam_succeed_if conditions
+		if rule.IsModule(SucceedIfModule) {
+			if _, err := ParseSucceedIf(rule.Arguments); err != nil {
+				diagnostics = append(diagnostics, e.diagnostic("invalid-succeed-if", i, "%s: %v", SucceedIfModule, err))
+			}
 		}
 
 		// Check for service field inconsistencies
 		if e.config.IsPamD {
 			// For pam.d format, service field can be present (auto-extracted from filename)
 			// but if present, it should be consistent
-			expectedService := ""
-			if e.config.FilePath != "" && strings.Contains(e.config.FilePath, "/pam.d/") {
-				expectedService = filepath.Base(e.config.FilePath)
-			}
+			expectedService := pamDServiceName(e.config.FilePath)
 			if rule.Service != "" && expectedService != "" && rule.Service != expectedService {
-				warnings = append(warnings, fmt.Sprintf("Rule %d: service field '%s' doesn't match expected service '%s' for pam.d format", i, rule.Service, expectedService))
+				diagnostics = append(diagnostics, e.diagnostic("service-mismatch", i, "service field '%s' doesn't match expected service '%s' for pam.d format", rule.Service, expectedService))
 			}
 		} else if rule.Service == "" {
 			// Check for missing service field in pam.conf format
-			warnings = append(warnings, fmt.Sprintf("Rule %d: missing service field in pam.conf format", i))
+			diagnostics = append(diagnostics, e.diagnostic("missing-service", i, "missing service field in pam.conf format"))
 		}
 	}
 
-	return warnings
+	return diagnostics
 }
 
 // SortRulesByType sorts rules by module type while preserving relative order within each type
 func (e *Editor) SortRulesByType() {
+	defer e.track(EditSortRules, "sort rules by type")()
+
 	// Group rules by normalized type while preserving original order within each type
 	typeGroups := make(map[ModuleType][]Rule)
 	typeOrder := []ModuleType{ModuleTypeAccount, ModuleTypeAuth, ModuleTypePassword, ModuleTypeSession, ModuleTypeSessionNoninteractive}
@@ -0,0 +1,205 @@
+package pamparser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEditor_EnsureRule(t *testing.T) {
+	required := ControlRequired
+	sufficient := ControlSufficient
+
+	tests := []struct {
+		name         string
+		initial      string
+		rule         Rule
+		matchControl bool
+		wantChanged  bool
+		expected     []string
+	}{
+		{
+			name:        "adds missing rule",
+			initial:     "auth required pam_unix.so\n",
+			rule:        Rule{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_faillock.so", Arguments: []string{"authfail"}},
+			wantChanged: true,
+			expected:    []string{"auth required pam_unix.so", "auth required pam_faillock.so authfail"},
+		},
+		{
+			name:        "existing identical rule is left alone",
+			initial:     "auth required pam_unix.so nullok\n",
+			rule:        Rule{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "/lib/security/pam_unix.so", Arguments: []string{"nullok"}},
+			wantChanged: false,
+			expected:    []string{"auth required pam_unix.so nullok"},
+		},
+		{
+			name:        "updates control and adds arguments",
+			initial:     "auth sufficient pam_unix.so nullok\n",
+			rule:        Rule{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_unix.so", Arguments: []string{"try_first_pass"}},
+			wantChanged: true,
+			expected:    []string{"auth required pam_unix.so nullok try_first_pass"},
+		},
+		{
+			name:        "keeps site arguments and updates values",
+			initial:     "auth required pam_faillock.so preauth audit deny=5 debug\n",
+			rule:        Rule{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_faillock.so", Arguments: []string{"preauth", "deny=3", "unlock_time=900"}},
+			wantChanged: true,
+			expected:    []string{"auth required pam_faillock.so preauth audit deny=3 debug unlock_time=900"},
+		},
+		{
+			name:        "requested arguments already present",
+			initial:     "auth required pam_faillock.so preauth audit deny=3\n",
+			rule:        Rule{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_faillock.so", Arguments: []string{"deny=3"}},
+			wantChanged: false,
+			expected:    []string{"auth required pam_faillock.so preauth audit deny=3"},
+		},
+		{
+			name:        "replaces pam_succeed_if conditions",
+			initial:     "auth required pam_succeed_if.so uid >= 500 quiet\n",
+			rule:        Rule{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_succeed_if.so", Arguments: []string{"uid", ">=", "1000"}},
+			wantChanged: true,
+			expected:    []string{"auth required pam_succeed_if.so uid >= 1000"},
+		},
+		{
+			name:         "matching on control adds a second rule",
+			initial:      "auth sufficient pam_unix.so\n",
+			rule:         Rule{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_unix.so"},
+			matchControl: true,
+			wantChanged:  true,
+			expected:     []string{"auth sufficient pam_unix.so", "auth required pam_unix.so"},
+		},
+		{
+			name:         "matching on control finds existing rule",
+			initial:      "auth required pam_env.so\nauth sufficient pam_unix.so\n",
+			rule:         Rule{Type: ModuleTypeAuth, Control: Control{Simple: &sufficient}, ModulePath: "pam_unix.so"},
+			matchControl: true,
+			wantChanged:  false,
+			expected:     []string{"auth required pam_env.so", "auth sufficient pam_unix.so"},
+		},
+		{
+			name:        "directives match on type and target",
+			initial:     "@include common-auth\n",
+			rule:        Rule{IsDirective: true, DirectiveType: "include", DirectiveTarget: "common-auth"},
+			wantChanged: false,
+			expected:    []string{"@include common-auth"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := mustParsePamD(t, tt.initial)
+			editor := NewEditor(config)
+
+			if changed := editor.EnsureRule(tt.rule, tt.matchControl); changed != tt.wantChanged {
+				t.Errorf("EnsureRule() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if got := ruleLines(config); strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("unexpected rules:\n%s", strings.Join(got, "\n"))
+			}
+
+			// a second run never changes anything
+			if editor.EnsureRule(tt.rule, tt.matchControl) {
+				t.Error("expected second EnsureRule to be a no-op")
+			}
+		})
+	}
+}
+
+func TestEditor_EnsureAbsent(t *testing.T) {
+	config := mustParsePamD(t, "auth sufficient pam_rootok.so\nauth required pam_unix.so\n")
+	editor := NewEditor(config)
+
+	if !editor.EnsureAbsent(FilterByModulePath("pam_rootok")) {
+		t.Error("expected first EnsureAbsent to remove the rule")
+	}
+	if editor.EnsureAbsent(FilterByModulePath("pam_rootok")) {
+		t.Error("expected second EnsureAbsent to be a no-op")
+	}
+	if len(config.Rules) != 1 {
+		t.Errorf("expected 1 rule, got %d", len(config.Rules))
+	}
+}
+
+func TestEditor_EnsureArgument(t *testing.T) {
+	config := mustParsePamD(t, `auth required pam_faillock.so preauth deny=3
+auth required pam_faillock.so authfail deny=5
+`)
+	editor := NewEditor(config)
+	faillock := FilterByModulePath("pam_faillock")
+
+	tests := []struct {
+		name        string
+		filter      RuleFilter
+		argName     string
+		argValue    string
+		wantChanged bool
+		wantErr     bool
+	}{
+		{"sets value on rules that differ", faillock, "deny", "5", true, false},
+		{"already set", faillock, "deny", "5", false, false},
+		{"adds flag", faillock, "audit", "", true, false},
+		{"flag already present", faillock, "audit", "", false, false},
+		{"no matching rule", FilterByModulePath("pam_tally2"), "deny", "5", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed, err := editor.EnsureArgument(tt.filter, tt.argName, tt.argValue)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EnsureArgument() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("EnsureArgument() changed = %v, want %v", changed, tt.wantChanged)
+			}
+		})
+	}
+
+	expected := []string{
+		"auth required pam_faillock.so preauth deny=5 audit",
+		"auth required pam_faillock.so authfail deny=5 audit",
+	}
+	if got := ruleLines(config); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected rules:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestEditor_EnsureOrder(t *testing.T) {
+	config := mustParsePamD(t, `auth required pam_env.so
+auth required pam_unix.so
+auth required pam_faillock.so preauth
+auth required pam_deny.so
+`)
+	editor := NewEditor(config)
+	faillock := FilterByModulePath("pam_faillock")
+	unix := FilterByModulePath("pam_unix")
+
+	changed, err := editor.EnsureOrder(faillock, unix)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed {
+		t.Error("expected EnsureOrder to move the rule")
+	}
+
+	expected := []string{
+		"auth required pam_env.so",
+		"auth required pam_faillock.so preauth",
+		"auth required pam_unix.so",
+		"auth required pam_deny.so",
+	}
+	if got := ruleLines(config); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected rules:\n%s", strings.Join(got, "\n"))
+	}
+
+	if changed, err := editor.EnsureOrder(faillock, unix); err != nil || changed {
+		t.Errorf("expected second EnsureOrder to be a no-op, got changed=%v err=%v", changed, err)
+	}
+	if changed, err := editor.EnsureOrder(faillock, faillock); err != nil || changed {
+		t.Errorf("overlapping filters should not reorder, got changed=%v err=%v", changed, err)
+	}
+	if _, err := editor.EnsureOrder(FilterByModulePath("pam_tally2"), unix); err == nil {
+		t.Error("expected error when the first filter matches nothing")
+	}
+	if _, err := editor.EnsureOrder(faillock, FilterByModulePath("pam_tally2")); err == nil {
+		t.Error("expected error when the second filter matches nothing")
+	}
+}
@@ -0,0 +1,626 @@
+package pamparser
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// EnvModule is the module name of pam_env
+const EnvModule = "pam_env.so"
+
+// Default locations of the files read by pam_env
+const (
+	// DefaultEnvConfFile is the VAR DEFAULT=... OVERRIDE=... file, unless conffile= is given
+	DefaultEnvConfFile = "/etc/security/pam_env.conf"
+	// DefaultEnvFile is the KEY=VAL file, unless envfile= is given or readenv=0
+	DefaultEnvFile = "/etc/environment"
+	// DefaultUserEnvFile is read from the user's home directory when user_readenv=1
+	DefaultUserEnvFile = ".pam_environment"
+)
+
+// envItems are the names pam_env expands in @{...}: PAM items and passwd fields
+var envItems = []string{"PAM_USER", "PAM_USER_PROMPT", "PAM_TTY", "PAM_RUSER", "PAM_RHOST", "HOME", "SHELL"}
+
+// EnvVariable is one VARIABLE [DEFAULT=value] [OVERRIDE=value] line of pam_env.conf
+type EnvVariable struct {
+	Name       string `json:"name"`
+	Default    string `json:"default,omitempty"`
+	Override   string `json:"override,omitempty"`
+	LineNumber int    `json:"line_number,omitempty"`
+}
+
+// EnvConfig represents pam_env.conf, or a user's .pam_environment which uses the same syntax
+type EnvConfig struct {
+	FilePath  string        `json:"file_path,omitempty"`
+	Variables []EnvVariable `json:"variables"`
+	Comments  []string      `json:"comments,omitempty"`
+}
+
+// EnvFileEntry is one KEY=VAL line of /etc/environment. A line without '=' unsets KEY.
+type EnvFileEntry struct {
+	Name       string `json:"name"`
+	Value      string `json:"value,omitempty"`
+	Export     bool   `json:"export,omitempty"` // written with a leading "export "
+	Unset      bool   `json:"unset,omitempty"`
+	LineNumber int    `json:"line_number,omitempty"`
+}
+
+// EnvFile represents /etc/environment or another envfile= file
+type EnvFile struct {
+	FilePath string         `json:"file_path,omitempty"`
+	Entries  []EnvFileEntry `json:"entries"`
+	Comments []string       `json:"comments,omitempty"`
+}
+
+// scanContinuedLines calls fn with each logical line of a module configuration file, joining
+// lines that end in a backslash, and collects comment-only lines
+func scanContinuedLines(reader io.Reader, fn func(line string, lineNum int) error) ([]string, error) {
+	var comments []string
+	var pending strings.Builder
+	start := 0
+
+	scanner := bufio.NewScanner(reader)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if pending.Len() == 0 {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			if comment, ok := strings.CutPrefix(line, "#"); ok {
+				comments = append(comments, strings.TrimSpace(comment))
+				continue
+			}
+			start = lineNum
+		}
+		if joined, ok := strings.CutSuffix(line, "\\"); ok {
+			pending.WriteString(joined)
+			continue
+		}
+		pending.WriteString(line)
+		if err := fn(strings.TrimSpace(pending.String()), start); err != nil {
+			return nil, err
+		}
+		pending.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading input: %w", err)
+	}
+	if pending.Len() > 0 {
+		if err := fn(strings.TrimSpace(pending.String()), start); err != nil {
+			return nil, err
+		}
+	}
+	return comments, nil
+}
+
+// splitEnvFields splits a pam_env.conf line at whitespace outside double quotes
+func splitEnvFields(line string) ([]string, error) {
+	var fields []string
+	var current strings.Builder
+	inQuotes := false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			current.WriteRune(r)
+		case (r == ' ' || r == '\t') && !inQuotes:
+			if current.Len() > 0 {
+				fields = append(fields, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if current.Len() > 0 {
+		fields = append(fields, current.String())
+	}
+	return fields, nil
+}
+
+// unquoteEnvValue removes one pair of matching quotes around a value
+func unquoteEnvValue(value, quotes string) string {
+	if len(value) >= 2 && strings.ContainsRune(quotes, rune(value[0])) && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// quoteEnvValue quotes a value that contains whitespace
+func quoteEnvValue(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+// ParseEnvConf parses pam_env.conf syntax. Comment-only lines are kept in Comments and lines
+// ending in a backslash continue on the next line.
+func ParseEnvConf(reader io.Reader) (*EnvConfig, error) {
+	config := &EnvConfig{}
+
+	comments, err := scanContinuedLines(reader, func(line string, lineNum int) error {
+		fields, err := splitEnvFields(line)
+		if err != nil {
+			return fmt.Errorf("%w at line %d", err, lineNum)
+		}
+
+		variable := EnvVariable{Name: fields[0], LineNumber: lineNum}
+		seen := map[string]bool{}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok || (key != "DEFAULT" && key != "OVERRIDE") {
+				return fmt.Errorf("expected DEFAULT= or OVERRIDE= at line %d, got '%s'", lineNum, field)
+			}
+			if seen[key] {
+				return fmt.Errorf("duplicate %s for %s at line %d", key, variable.Name, lineNum)
+			}
+			seen[key] = true
+			if key == "DEFAULT" {
+				variable.Default = unquoteEnvValue(value, `"`)
+			} else {
+				variable.Override = unquoteEnvValue(value, `"`)
+			}
+		}
+		config.Variables = append(config.Variables, variable)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	config.Comments = comments
+	return config, nil
+}
+
+// LoadEnvConfFile loads a pam_env.conf file
+func LoadEnvConfFile(filePath string) (*EnvConfig, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	config, err := ParseEnvConf(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file %s: %w", filePath, err)
+	}
+	config.FilePath = filePath
+	return config, nil
+}
+
+// ParseEnvFile parses /etc/environment syntax: KEY=VAL lines with an optional "export "
+// prefix, where one pair of single or double quotes around VAL is removed
+func ParseEnvFile(reader io.Reader) (*EnvFile, error) {
+	file := &EnvFile{}
+
+	comments, err := scanContinuedLines(reader, func(line string, lineNum int) error {
+		entry := EnvFileEntry{LineNumber: lineNum}
+		if rest, ok := strings.CutPrefix(line, "export "); ok {
+			entry.Export = true
+			line = strings.TrimSpace(rest)
+		}
+		name, value, ok := strings.Cut(line, "=")
+		entry.Name = name
+		entry.Unset = !ok
+		if ok {
+			entry.Value = unquoteEnvValue(value, `"'`)
+		}
+		if entry.Name == "" {
+			return fmt.Errorf("missing variable name at line %d", lineNum)
+		}
+		file.Entries = append(file.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	file.Comments = comments
+	return file, nil
+}
+
+// LoadEnvFile loads an /etc/environment style file
+func LoadEnvFile(filePath string) (*EnvFile, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	env, err := ParseEnvFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file %s: %w", filePath, err)
+	}
+	env.FilePath = filePath
+	return env, nil
+}
+
+// Set replaces the last definition of variable.Name or appends one, and reports whether
+// anything changed
+func (c *EnvConfig) Set(variable EnvVariable) bool {
+	for i := len(c.Variables) - 1; i >= 0; i-- {
+		if existing := &c.Variables[i]; existing.Name == variable.Name {
+			if existing.Default == variable.Default && existing.Override == variable.Override {
+				return false
+			}
+			existing.Default, existing.Override = variable.Default, variable.Override
+			return true
+		}
+	}
+	c.Variables = append(c.Variables, variable)
+	return true
+}
+
+// Remove deletes every definition of a variable and returns how many were removed
+func (c *EnvConfig) Remove(name string) int {
+	before := len(c.Variables)
+	c.Variables = slices.DeleteFunc(c.Variables, func(v EnvVariable) bool { return v.Name == name })
+	return before - len(c.Variables)
+}
+
+// String returns the configuration in pam_env.conf syntax with the variable names aligned,
+// standalone comments first
+func (c *EnvConfig) String() string {
+	width := 0
+	for _, variable := range c.Variables {
+		width = max(width, len(variable.Name))
+	}
+
+	var b strings.Builder
+	for _, comment := range c.Comments {
+		b.WriteString("# " + comment + "\n")
+	}
+	for _, variable := range c.Variables {
+		line := variable.Name
+		if variable.Default != "" || variable.Override != "" {
+			line = fmt.Sprintf("%-*s", width, variable.Name)
+		}
+		if variable.Default != "" {
+			line += " DEFAULT=" + quoteEnvValue(variable.Default)
+		}
+		if variable.Override != "" {
+			line += " OVERRIDE=" + quoteEnvValue(variable.Override)
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// Write writes the configuration in pam_env.conf syntax
+func (c *EnvConfig) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, c.String()); err != nil {
+		return fmt.Errorf("error writing pam_env configuration: %w", err)
+	}
+	return nil
+}
+
+// Set gives a variable a value, updating its last entry or appending one, and reports
+// whether anything changed
+func (f *EnvFile) Set(name, value string) bool {
+	for i := len(f.Entries) - 1; i >= 0; i-- {
+		if existing := &f.Entries[i]; existing.Name == name {
+			if existing.Value == value && !existing.Unset {
+				return false
+			}
+			existing.Value, existing.Unset = value, false
+			return true
+		}
+	}
+	f.Entries = append(f.Entries, EnvFileEntry{Name: name, Value: value})
+	return true
+}
+
+// Remove deletes every entry for a variable and returns how many were removed
+func (f *EnvFile) Remove(name string) int {
+	before := len(f.Entries)
+	f.Entries = slices.DeleteFunc(f.Entries, func(e EnvFileEntry) bool { return e.Name == name })
+	return before - len(f.Entries)
+}
+
+// String returns the file in KEY=VAL syntax, standalone comments first
+func (f *EnvFile) String() string {
+	var b strings.Builder
+	for _, comment := range f.Comments {
+		b.WriteString("# " + comment + "\n")
+	}
+	for _, entry := range f.Entries {
+		if entry.Export {
+			b.WriteString("export ")
+		}
+		b.WriteString(entry.Name)
+		if !entry.Unset {
+			b.WriteString("=" + quoteEnvValue(entry.Value))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Write writes the file in KEY=VAL syntax
+func (f *EnvFile) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, f.String()); err != nil {
+		return fmt.Errorf("error writing environment file: %w", err)
+	}
+	return nil
+}
+
+// isEnvName reports whether name is a portable environment variable name
+func isEnvName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, r := range name {
+		if r != '_' && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks variable names, expansions and values that cannot be written back
+func (c *EnvConfig) Validate() []string {
+	var warnings []string
+	for i, variable := range c.Variables {
+		prefix := fmt.Sprintf("Variable %d (line %d)", i, variable.LineNumber)
+		if !isEnvName(variable.Name) {
+			warnings = append(warnings, fmt.Sprintf("%s: invalid variable name '%s'", prefix, variable.Name))
+		}
+		for _, value := range []string{variable.Default, variable.Override} {
+			if strings.Contains(value, `"`) {
+				warnings = append(warnings, fmt.Sprintf("%s: value '%s' cannot contain a double quote", prefix, value))
+			}
+			for _, problem := range envExpansionProblems(value) {
+				warnings = append(warnings, fmt.Sprintf("%s: %s", prefix, problem))
+			}
+		}
+	}
+	return warnings
+}
+
+// Validate checks variable names
+func (f *EnvFile) Validate() []string {
+	var warnings []string
+	for i, entry := range f.Entries {
+		if !isEnvName(entry.Name) {
+			warnings = append(warnings, fmt.Sprintf("Entry %d (line %d): invalid variable name '%s'", i, entry.LineNumber, entry.Name))
+		}
+	}
+	return warnings
+}
+
+// envExpansionProblems reports unterminated expansions and unknown @{} names in a value
+func envExpansionProblems(value string) []string {
+	var problems []string
+	_, warnings, err := ExpandEnvValue(value, EnvContext{}, nil)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, warning := range warnings {
+		if strings.HasPrefix(warning, "unknown") {
+			problems = append(problems, warning)
+		}
+	}
+	return problems
+}
+
+// EnvContext is the user and PAM state a pam_env simulation runs with
+type EnvContext struct {
+	User        string            `json:"user,omitempty"`
+	Home        string            `json:"home,omitempty"`
+	Shell       string            `json:"shell,omitempty"`
+	Items       map[string]string `json:"items,omitempty"`       // PAM items such as PAM_RHOST and PAM_TTY
+	Environment map[string]string `json:"environment,omitempty"` // environment before pam_env runs
+}
+
+// item returns what @{name} expands to and whether pam_env knows name
+func (ctx EnvContext) item(name string) (string, bool) {
+	switch name {
+	case "PAM_USER":
+		return ctx.User, true
+	case "HOME":
+		return ctx.Home, true
+	case "SHELL":
+		return ctx.Shell, true
+	}
+	return ctx.Items[name], slices.Contains(envItems, name)
+}
+
+// ExpandEnvValue expands ${VAR} from env and @{ITEM} from ctx the way pam_env does. \$ and
+// \@ are literal. Unset variables and items expand to "" with a warning; an unterminated
+// expansion is an error, for which pam_env skips the variable.
+func ExpandEnvValue(value string, ctx EnvContext, env map[string]string) (string, []string, error) {
+	var b strings.Builder
+	var warnings []string
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' && i+1 < len(value) && strings.IndexByte(`$@\`, value[i+1]) >= 0:
+			i++
+			b.WriteByte(value[i])
+		case (c == '$' || c == '@') && i+1 < len(value) && value[i+1] == '{':
+			end := strings.IndexByte(value[i+2:], '}')
+			if end < 0 {
+				return "", warnings, fmt.Errorf("unterminated expansion '%s'", value[i:])
+			}
+			name := value[i+2 : i+2+end]
+			i += 2 + end
+			if c == '$' {
+				v, ok := env[name]
+				if !ok {
+					warnings = append(warnings, fmt.Sprintf("${%s} is not set", name))
+				}
+				b.WriteString(v)
+				continue
+			}
+			v, known := ctx.item(name)
+			if !known {
+				warnings = append(warnings, fmt.Sprintf("unknown item @{%s}", name))
+			} else if v == "" {
+				warnings = append(warnings, fmt.Sprintf("@{%s} is empty", name))
+			}
+			b.WriteString(v)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), warnings, nil
+}
+
+// EnvAssignment is one change pam_env makes to the environment
+type EnvAssignment struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+	Unset bool   `json:"unset,omitempty"`
+	File  string `json:"file,omitempty"`
+	Line  int    `json:"line,omitempty"`
+}
+
+// EnvPreview is the environment pam_env would produce and how it got there
+type EnvPreview struct {
+	Environment map[string]string `json:"environment"`
+	Assignments []EnvAssignment   `json:"assignments,omitempty"`
+	Files       []string          `json:"files,omitempty"` // files read, in order
+	Warnings    []string          `json:"warnings,omitempty"`
+}
+
+// NewEnvPreview starts a preview from the environment of ctx
+func NewEnvPreview(ctx EnvContext) *EnvPreview {
+	env := maps.Clone(ctx.Environment)
+	if env == nil {
+		env = make(map[string]string)
+	}
+	return &EnvPreview{Environment: env}
+}
+
+// record applies one assignment
+func (p *EnvPreview) record(assignment EnvAssignment) {
+	if assignment.Unset {
+		delete(p.Environment, assignment.Name)
+	} else {
+		p.Environment[assignment.Name] = assignment.Value
+	}
+	p.Assignments = append(p.Assignments, assignment)
+}
+
+// ApplyConf applies pam_env.conf variables in order: OVERRIDE if it expands to a non-empty
+// value, otherwise DEFAULT, and the variable is unset when both are empty
+func (p *EnvPreview) ApplyConf(config *EnvConfig, ctx EnvContext) {
+	p.Files = append(p.Files, config.FilePath)
+	for _, variable := range config.Variables {
+		where := fmt.Sprintf("%s line %d", config.FilePath, variable.LineNumber)
+		value, err := p.expand(variable.Override, ctx, where)
+		if err == nil && value == "" {
+			value, err = p.expand(variable.Default, ctx, where)
+		}
+		if err != nil {
+			p.Warnings = append(p.Warnings, fmt.Sprintf("%s: %s skipped: %v", where, variable.Name, err))
+			continue
+		}
+		p.record(EnvAssignment{Name: variable.Name, Value: value, Unset: value == "", File: config.FilePath, Line: variable.LineNumber})
+	}
+}
+
+// expand expands a value against the preview's current environment, keeping the warnings
+func (p *EnvPreview) expand(value string, ctx EnvContext, where string) (string, error) {
+	expanded, warnings, err := ExpandEnvValue(value, ctx, p.Environment)
+	for _, warning := range warnings {
+		p.Warnings = append(p.Warnings, fmt.Sprintf("%s: %s", where, warning))
+	}
+	return expanded, err
+}
+
+// ApplyFile applies /etc/environment entries in order, without expansion
+func (p *EnvPreview) ApplyFile(file *EnvFile) {
+	p.Files = append(p.Files, file.FilePath)
+	for _, entry := range file.Entries {
+		p.record(EnvAssignment{Name: entry.Name, Value: entry.Value, Unset: entry.Unset, File: file.FilePath, Line: entry.LineNumber})
+	}
+}
+
+// ApplyRule applies the files a pam_env rule reads, in pam_env's order: the conffile=
+// (default pam_env.conf), the envfile= (default /etc/environment) unless readenv=0, then the
+// user's user_envfile= (default .pam_environment) in ctx.Home if user_readenv=1. Missing
+// default and user files are skipped; a missing file named by an argument is an error.
+// root is prepended to every path.
+func (p *EnvPreview) ApplyRule(rule Rule, ctx EnvContext, root string) error {
+	if !rule.IsModule(EnvModule) {
+		return fmt.Errorf("rule module %s is not %s", rule.ModulePath, EnvModule)
+	}
+
+	path, explicit := rule.ArgumentValue("conffile")
+	if !explicit {
+		path = DefaultEnvConfFile
+	}
+	config, err := LoadEnvConfFile(filepath.Join(root, path))
+	if err := skipMissing(err, explicit); err != nil {
+		return err
+	}
+	if config != nil {
+		p.ApplyConf(config, ctx)
+	}
+
+	if readenv, _ := rule.ArgumentValue("readenv"); readenv != "0" {
+		path, explicit := rule.ArgumentValue("envfile")
+		if !explicit {
+			path = DefaultEnvFile
+		}
+		file, err := LoadEnvFile(filepath.Join(root, path))
+		if err := skipMissing(err, explicit); err != nil {
+			return err
+		}
+		if file != nil {
+			p.ApplyFile(file)
+		}
+	}
+
+	if userReadenv, _ := rule.ArgumentValue("user_readenv"); userReadenv == "1" && ctx.Home != "" {
+		path, ok := rule.ArgumentValue("user_envfile")
+		if !ok {
+			path = DefaultUserEnvFile
+		}
+		config, err := LoadEnvConfFile(filepath.Join(root, ctx.Home, path))
+		if err := skipMissing(err, false); err != nil {
+			return err
+		}
+		if config != nil {
+			p.ApplyConf(config, ctx)
+		}
+	}
+	return nil
+}
+
+// skipMissing drops a file-not-found error for files the module reads only if present
+func skipMissing(err error, required bool) error {
+	if err != nil && !required && errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// PreviewEnv simulates every pam_env rule of moduleType in order (all rules if moduleType is
+// empty) and returns the environment a session for ctx would receive
+func (e *Editor) PreviewEnv(moduleType ModuleType, ctx EnvContext, root string) (*EnvPreview, error) {
+	preview := NewEnvPreview(ctx)
+	for i, rule := range e.config.Rules {
+		if !rule.IsModule(EnvModule) || (moduleType != "" && rule.Type != moduleType) {
+			continue
+		}
+		if err := preview.ApplyRule(rule, ctx, root); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return preview, nil
+}
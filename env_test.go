@@ -0,0 +1,185 @@
+package pamparser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleEnvConf = `# pam_env.conf
+REMOTEHOST	DEFAULT=localhost OVERRIDE=@{PAM_RHOST}
+DISPLAY		DEFAULT=${REMOTEHOST}:0.0 OVERRIDE=${DISPLAY}
+XDG_DATA_DIRS	DEFAULT="@{HOME}/.local/share /usr/share"
+EDITOR \
+	DEFAULT=vi
+PAGER		DEFAULT=
+`
+
+func TestParseEnvConf(t *testing.T) {
+	config, err := ParseEnvConf(strings.NewReader(sampleEnvConf))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []EnvVariable{
+		{Name: "REMOTEHOST", Default: "localhost", Override: "@{PAM_RHOST}", LineNumber: 2},
+		{Name: "DISPLAY", Default: "${REMOTEHOST}:0.0", Override: "${DISPLAY}", LineNumber: 3},
+		{Name: "XDG_DATA_DIRS", Default: "@{HOME}/.local/share /usr/share", LineNumber: 4},
+		{Name: "EDITOR", Default: "vi", LineNumber: 5},
+		{Name: "PAGER", LineNumber: 7},
+	}
+	if !reflect.DeepEqual(config.Variables, want) {
+		t.Errorf("variables = %+v, want %+v", config.Variables, want)
+	}
+	if warnings := config.Validate(); len(warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+
+	reparsed, err := ParseEnvConf(strings.NewReader(config.String()))
+	if err != nil {
+		t.Fatalf("written output does not parse back: %v", err)
+	}
+	for i := range reparsed.Variables {
+		reparsed.Variables[i].LineNumber = want[i].LineNumber
+	}
+	if !reflect.DeepEqual(reparsed.Variables, want) {
+		t.Errorf("round trip = %+v, want %+v", reparsed.Variables, want)
+	}
+
+	for _, bad := range []string{"FOO BAR=1\n", "FOO DEFAULT=1 DEFAULT=2\n", "FOO DEFAULT=\"open\n"} {
+		if _, err := ParseEnvConf(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+
+	bad, err := ParseEnvConf(strings.NewReader("1FOO DEFAULT=${BAR\nFOO DEFAULT=@{UID}\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if warnings := bad.Validate(); len(warnings) != 3 {
+		t.Errorf("expected 3 warnings, got %v", warnings)
+	}
+}
+
+func TestParseEnvFile(t *testing.T) {
+	input := `# /etc/environment
+PATH="/usr/local/bin:/usr/bin:/bin"
+export LANG=en_US.UTF-8
+GREETING='hello world'
+OLDVAR
+`
+	file, err := ParseEnvFile(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []EnvFileEntry{
+		{Name: "PATH", Value: "/usr/local/bin:/usr/bin:/bin", LineNumber: 2},
+		{Name: "LANG", Value: "en_US.UTF-8", Export: true, LineNumber: 3},
+		{Name: "GREETING", Value: "hello world", LineNumber: 4},
+		{Name: "OLDVAR", Unset: true, LineNumber: 5},
+	}
+	if !reflect.DeepEqual(file.Entries, want) {
+		t.Errorf("entries = %+v, want %+v", file.Entries, want)
+	}
+
+	if !file.Set("LANG", "C.UTF-8") || file.Set("LANG", "C.UTF-8") {
+		t.Error("expected Set to change LANG once")
+	}
+	if file.Remove("OLDVAR") != 1 {
+		t.Error("expected OLDVAR to be removed")
+	}
+	wantOutput := "# /etc/environment\nPATH=/usr/local/bin:/usr/bin:/bin\nexport LANG=C.UTF-8\nGREETING=\"hello world\"\n"
+	if got := file.String(); got != wantOutput {
+		t.Errorf("String() = %q, want %q", got, wantOutput)
+	}
+}
+
+func TestExpandEnvValue(t *testing.T) {
+	ctx := EnvContext{User: "alice", Home: "/home/alice", Items: map[string]string{"PAM_RHOST": "ws1"}}
+	env := map[string]string{"LANG": "C"}
+
+	tests := []struct {
+		value    string
+		want     string
+		warnings int
+		wantErr  bool
+	}{
+		{value: "@{HOME}/bin", want: "/home/alice/bin"},
+		{value: "${LANG}-@{PAM_USER}@@{PAM_RHOST}", want: "C-alice@ws1"},
+		{value: `\${LANG} costs \@{HOME}`, want: "${LANG} costs @{HOME}"},
+		{value: "$LANG @HOME", want: "$LANG @HOME"},
+		{value: "${MISSING}x", want: "x", warnings: 1},
+		{value: "@{SHELL}", want: "", warnings: 1},
+		{value: "@{UID}", want: "", warnings: 1},
+		{value: "${LANG", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, warnings, err := ExpandEnvValue(tt.value, ctx, env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandEnvValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || len(warnings) != tt.warnings {
+				t.Errorf("ExpandEnvValue() = %q %v, want %q with %d warnings", got, warnings, tt.want, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestEditor_PreviewEnv(t *testing.T) {
+	root := writeSettingsFiles(t, map[string]string{
+		DefaultEnvConfFile:             sampleEnvConf + "BROKEN DEFAULT=${OOPS\n",
+		DefaultEnvFile:                 "LANG=en_US.UTF-8\nEDITOR=nano\n",
+		"/etc/security/site_env.conf":  "SITE DEFAULT=lab\n",
+		"/home/alice/.pam_environment": "EDITOR OVERRIDE=emacs\n",
+	})
+
+	config := mustParsePamD(t, `auth required pam_env.so
+session required pam_env.so user_readenv=1
+session required pam_env.so conffile=/etc/security/site_env.conf readenv=0
+`)
+	ctx := EnvContext{
+		User:        "alice",
+		Home:        "/home/alice",
+		Items:       map[string]string{"PAM_RHOST": "ws1"},
+		Environment: map[string]string{"PAGER": "less"},
+	}
+
+	preview, err := NewEditor(config).PreviewEnv(ModuleTypeSession, ctx, root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"REMOTEHOST":    "ws1",
+		"DISPLAY":       "ws1:0.0",
+		"XDG_DATA_DIRS": "/home/alice/.local/share /usr/share",
+		"LANG":          "en_US.UTF-8",
+		"EDITOR":        "emacs",
+		"SITE":          "lab",
+	}
+	if !reflect.DeepEqual(preview.Environment, want) {
+		t.Errorf("environment = %v, want %v", preview.Environment, want)
+	}
+	if len(preview.Files) != 4 {
+		t.Errorf("expected 4 files read, got %v", preview.Files)
+	}
+	if ctx.Environment["PAGER"] != "less" {
+		t.Error("expected the context environment not to be modified")
+	}
+
+	var skipped bool
+	for _, warning := range preview.Warnings {
+		skipped = skipped || strings.Contains(warning, "BROKEN skipped")
+	}
+	if !skipped {
+		t.Errorf("expected a warning for the unterminated expansion, got %v", preview.Warnings)
+	}
+
+	config = mustParsePamD(t, "session required pam_env.so envfile=/nonexistent\n")
+	if _, err := NewEditor(config).PreviewEnv("", ctx, root); err == nil {
+		t.Error("expected error for a missing envfile= file")
+	}
+}
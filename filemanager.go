@@ -35,15 +35,8 @@ func (fm *FileManager) LoadFromFile(filePath string) (*Config, error) {
 	isPamD := strings.Contains(filePath, "/pam.d/") ||
 		(!strings.HasSuffix(filePath, "pam.conf") && filepath.Dir(filePath) != "/etc")
 
-	// Extract service name for pam.d format files
-	var serviceName string
-	if strings.Contains(filePath, "/pam.d/") {
-		// Extract service name from /path/to/pam.d/servicename
-		basename := filepath.Base(filePath)
-		serviceName = basename
-	}
-
-	config, err := fm.parser.ParseWithService(file, isPamD, serviceName)
+	// Extract service name from /path/to/pam.d/servicename for pam.d format files
+	config, err := fm.parser.ParseWithService(file, isPamD, pamDServiceName(filePath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse file %s: %w", filePath, err)
 	}
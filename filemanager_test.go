@@ -121,6 +121,33 @@ session optional pam_motd.so
 	}
 }
 
+func TestFileManager_LoadUpgradeSibling(t *testing.T) {
+	fm := NewFileManager()
+	pamD := filepath.Join(t.TempDir(), "pam.d")
+	if err := os.MkdirAll(pamD, 0o755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+
+	for _, name := range []string{"sshd", "sshd.rpmnew", "sshd.dpkg-dist", "sshd.ucf-dist"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(pamD, name)
+			if err := os.WriteFile(path, []byte("auth required pam_unix.so\n"), 0o644); err != nil {
+				t.Fatalf("failed to create test file: %v", err)
+			}
+			config, err := fm.LoadFromFile(path)
+			if err != nil {
+				t.Fatalf("unexpected error loading file: %v", err)
+			}
+			if config.Rules[0].Service != "sshd" {
+				t.Errorf("expected service sshd, got %q", config.Rules[0].Service)
+			}
+			if diagnostics := NewEditor(config).Validate(); len(diagnostics) != 0 {
+				t.Errorf("unexpected validation problems: %v", diagnostics)
+			}
+		})
+	}
+}
+
 func TestFileManager_BackupAndRestore(t *testing.T) {
 	fm := NewFileManager()
 
@@ -0,0 +1,259 @@
+package pamparser
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FixAction is the kind of Editor operation a fix performs
+type FixAction string
+
+const (
+	// FixRemoveArgument removes Argument from the target rule
+	FixRemoveArgument FixAction = "remove_argument"
+	// FixReplaceArgument replaces the target rule's Argument with Value, in place
+	FixReplaceArgument FixAction = "replace_argument"
+	// FixInsertAfter inserts Rule directly after the target rule
+	FixInsertAfter FixAction = "insert_after"
+	// FixAppendRule inserts Rule after the last rule of its type and service, so it ends the stack
+	FixAppendRule FixAction = "append_rule"
+)
+
+// FixOperation is one Editor operation of a fix. Rules are addressed by ID rather than index,
+// so the operations of several fixes can be applied one after another.
+type FixOperation struct {
+	Action   FixAction `json:"action"`
+	Target   RuleID    `json:"target,omitempty"`
+	Argument string    `json:"argument,omitempty"`
+	Value    string    `json:"value,omitempty"`
+	Rule     *Rule     `json:"rule,omitempty"`
+}
+
+// apply performs the operation with the editor
+func (op FixOperation) apply(editor *Editor) error {
+	if (op.Action == FixInsertAfter || op.Action == FixAppendRule) && op.Rule == nil {
+		return fmt.Errorf("fix action '%s' needs a rule", op.Action)
+	}
+
+	switch op.Action {
+	case FixRemoveArgument:
+		return editor.RemoveArgumentByID(op.Target, op.Argument)
+	case FixReplaceArgument:
+		rule, err := editor.GetRuleByID(op.Target)
+		if err != nil {
+			return err
+		}
+		index := slices.Index(rule.Arguments, op.Argument)
+		if index < 0 {
+			return fmt.Errorf("rule %d has no argument %s", op.Target, op.Argument)
+		}
+		rule.Arguments = slices.Clone(rule.Arguments)
+		rule.Arguments[index] = op.Value
+		return editor.UpdateRuleByID(op.Target, *rule)
+	case FixInsertAfter:
+		_, err := editor.InsertRuleAfterID(op.Target, *op.Rule)
+		return err
+	case FixAppendRule:
+		last := -1
+		for i, rule := range editor.config.Rules {
+			if !rule.IsDirective && rule.Service == op.Rule.Service &&
+				GetNormalizedModuleType(rule.Type) == GetNormalizedModuleType(op.Rule.Type) {
+				last = i
+			}
+		}
+		if last < 0 {
+			return fmt.Errorf("no %s rules to append to", op.Rule.Type)
+		}
+		return editor.InsertRule(last+1, *op.Rule)
+	default:
+		return fmt.Errorf("unknown fix action '%s'", op.Action)
+	}
+}
+
+// Apply performs the fix's operations, in order, with the editor
+func (f *SuggestedFix) Apply(editor *Editor) error {
+	for i, op := range f.Operations {
+		if err := op.apply(editor); err != nil {
+			return fmt.Errorf("operation %d (%s): %w", i+1, op.Action, err)
+		}
+	}
+	return nil
+}
+
+// FixPlan is the combined effect of a set of lint fixes
+type FixPlan struct {
+	Fixes     []Diagnostic `json:"fixes"`     // diagnostics whose fixes the plan applies, in order
+	Remaining []Diagnostic `json:"remaining"` // diagnostics left once the fixes are applied
+	Before    *Config      `json:"-"`
+	After     *Config      `json:"-"`
+}
+
+// PlanFixes lints the configuration and applies the fixes of the selected diagnostics to a
+// copy of it. checks selects diagnostics by check ID; with none, every fixable diagnostic is
+// selected, and an unknown ID is an error. The plan is rejected if a fix fails, does not
+// resolve its diagnostic, adds a validation problem or leaves a credential module that could
+// make its auth stack succeed unable to. The configuration itself is not modified.
+func (e *Editor) PlanFixes(checks ...string) (*FixPlan, error) {
+	for _, check := range checks {
+		if _, ok := lintCheck(check); !ok {
+			return nil, fmt.Errorf("unknown check '%s'", check)
+		}
+	}
+
+	diagnostics := e.Lint()
+	plan := &FixPlan{Fixes: []Diagnostic{}, Before: e.GetConfig()}
+	work := NewEditor(e.GetConfig())
+	problems := len(work.validationDiagnostics())
+	credentials := work.succeedingCredentials()
+
+	for _, d := range diagnostics {
+		if d.Fix == nil || len(d.Fix.Operations) == 0 || (len(checks) > 0 && !slices.Contains(checks, d.Check)) {
+			continue
+		}
+		if err := d.Fix.Apply(work); err != nil {
+			return nil, fmt.Errorf("fix for %s: %w", d, err)
+		}
+		plan.Fixes = append(plan.Fixes, d)
+	}
+
+	remaining, err := plan.check(work, problems, credentials)
+	if err != nil {
+		return nil, err
+	}
+	plan.Remaining = remaining
+	plan.After = work.GetConfig()
+	return plan, nil
+}
+
+// ApplyFixes plans the fixes of the selected checks and applies them, as PlanFixes and Apply
+func (e *Editor) ApplyFixes(checks ...string) (*FixPlan, error) {
+	plan, err := e.PlanFixes(checks...)
+	if err != nil {
+		return nil, err
+	}
+	if err := plan.Apply(e); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// check re-validates and re-lints an editor the fixes were applied to. credentials are the
+// credential modules that could make their auth stack succeed before the fixes.
+func (p *FixPlan) check(editor *Editor, problems int, credentials map[RuleID]bool) ([]Diagnostic, error) {
+	if after := editor.validationDiagnostics(); len(after) > problems {
+		return nil, fmt.Errorf("fixes introduce validation problems: %s", after[len(after)-1])
+	}
+	after := editor.succeedingCredentials()
+	for _, rule := range editor.config.Rules {
+		if credentials[rule.ID] && !after[rule.ID] {
+			return nil, fmt.Errorf("fixes leave %s at line %d unable to make the auth stack succeed",
+				rule.ModuleName(), rule.LineNumber)
+		}
+	}
+	remaining := editor.Lint()
+	for _, fixed := range p.Fixes {
+		if slices.ContainsFunc(remaining, func(d Diagnostic) bool {
+			return d.Check == fixed.Check && d.RuleID == fixed.RuleID
+		}) {
+			return nil, fmt.Errorf("fix did not resolve %s", fixed)
+		}
+	}
+	if remaining == nil {
+		remaining = []Diagnostic{}
+	}
+	return remaining, nil
+}
+
+// succeedingCredentials returns the credential modules, by rule ID, whose success can make
+// their service's auth stack succeed. A stack with more credential modules than there are
+// marks only has its first 64 considered.
+func (e *Editor) succeedingCredentials() map[RuleID]bool {
+	e.ensureIDs()
+	result := make(map[RuleID]bool)
+	for _, indices := range e.serviceStacks() {
+		var rules []StackRule
+		var credentials []RuleID
+		for _, i := range e.authRules(indices) {
+			rule := e.config.Rules[i]
+			rules = append(rules, StackRule{Rule: rule})
+			if authFactorModules[rule.ModuleName()] != "" && len(credentials) < 64 {
+				credentials = append(credentials, rule.ID)
+			}
+		}
+		nodes := authNodes(rules, func(rule Rule) uint64 {
+			if index := slices.Index(credentials, rule.ID); index >= 0 {
+				return 1 << index
+			}
+			return 0
+		})
+		for _, marks := range authSuccessMarks(nodes) {
+			for i, id := range credentials {
+				if marks&(1<<i) != 0 {
+					result[id] = true
+				}
+			}
+		}
+	}
+	return result
+}
+
+// HasChanges reports whether the plan applies any fix
+func (p *FixPlan) HasChanges() bool {
+	return len(p.Fixes) > 0
+}
+
+// Apply performs the plan's fixes with the editor, which must hold the configuration the
+// plan was computed for. The result is re-validated and re-linted; if a fix fails or the
+// checks do not pass, the editor is rolled back to where it was.
+func (p *FixPlan) Apply(editor *Editor) error {
+	problems := len(editor.validationDiagnostics())
+	credentials := editor.succeedingCredentials()
+	checkpoint := editor.Checkpoint()
+
+	var err error
+	for _, d := range p.Fixes {
+		if err = d.Fix.Apply(editor); err != nil {
+			err = fmt.Errorf("fix for %s: %w", d, err)
+			break
+		}
+	}
+	var remaining []Diagnostic
+	if err == nil {
+		remaining, err = p.check(editor, problems, credentials)
+	}
+	if err != nil {
+		if rollbackErr := editor.RollbackTo(checkpoint); rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	p.Remaining = remaining
+	p.After = editor.GetConfig()
+	return nil
+}
+
+// Report renders the plan as a list of fixes followed by the diagnostics left over
+func (p *FixPlan) Report() string {
+	var b strings.Builder
+	if !p.HasChanges() {
+		b.WriteString("no fixes\n")
+	}
+	for _, d := range p.Fixes {
+		fmt.Fprintf(&b, "fix: %s\n  %s\n", d, d.Fix.Description)
+	}
+	if p.HasChanges() {
+		fmt.Fprintf(&b, "%d fix(es)\n", len(p.Fixes))
+	}
+	for _, d := range p.Remaining {
+		fmt.Fprintf(&b, "remaining: %s\n", d)
+	}
+	return b.String()
+}
+
+// Diff returns the structural difference the plan makes
+func (p *FixPlan) Diff() *ConfigDiff {
+	return Diff(p.Before, p.After)
+}
@@ -0,0 +1,208 @@
+package pamparser
+
+import (
+	"strings"
+	"testing"
+)
+
+const fixableConfig = `auth     required   pam_env.so
+auth     required   pam_faillock.so preauth
+auth     sufficient pam_unix.so nullok \
+                    try_first_pass
+auth     optional   pam_gnome_keyring.so
+password required   pam_unix.so md5 use_authtok
+`
+
+func TestEditor_PlanFixes(t *testing.T) {
+	tests := []struct {
+		name      string
+		checks    []string
+		fixes     int
+		remaining []string
+		expected  []string
+	}{
+		{
+			name:  "all checks",
+			fixes: 4,
+			expected: []string{
+				"auth required pam_env.so",
+				"auth required pam_faillock.so preauth",
+				"auth sufficient pam_unix.so try_first_pass",
+				"auth [default=die] pam_faillock.so authfail",
+				"auth optional pam_gnome_keyring.so",
+				"auth required pam_deny.so",
+				"password required pam_unix.so sha512 use_authtok",
+			},
+		},
+		{
+			name:      "selected checks",
+			checks:    []string{"nullok", "weak-hash"},
+			fixes:     2,
+			remaining: []string{"faillock-no-authfail", "auth-no-deny"},
+			expected: []string{
+				"auth required pam_env.so",
+				"auth required pam_faillock.so preauth",
+				"auth sufficient pam_unix.so try_first_pass",
+				"auth optional pam_gnome_keyring.so",
+				"password required pam_unix.so sha512 use_authtok",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := mustParsePamD(t, fixableConfig)
+			original := ruleLines(config)
+			editor := NewEditor(config)
+
+			plan, err := editor.PlanFixes(tt.checks...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(plan.Fixes) != tt.fixes || plan.HasChanges() != (tt.fixes > 0) {
+				t.Errorf("expected %d fixes, got %v", tt.fixes, plan.Fixes)
+			}
+			var remaining []string
+			for _, d := range plan.Remaining {
+				remaining = append(remaining, d.Check)
+			}
+			if strings.Join(remaining, ",") != strings.Join(tt.remaining, ",") {
+				t.Errorf("remaining = %v, want %v", remaining, tt.remaining)
+			}
+			if got := ruleLines(config); strings.Join(got, "\n") != strings.Join(original, "\n") {
+				t.Errorf("planning modified the configuration:\n%s", strings.Join(got, "\n"))
+			}
+			if tt.expected == nil {
+				return
+			}
+
+			if err := plan.Apply(editor); err != nil {
+				t.Fatalf("unexpected error applying: %v", err)
+			}
+			if got := ruleLines(config); strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("unexpected rules:\n%s", strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestEditor_PlanFixes_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		checks []string
+		err    string
+	}{
+		{
+			name:   "unknown check",
+			text:   fixableConfig,
+			checks: []string{"nullok", "no-such-check"},
+			err:    "unknown check 'no-such-check'",
+		},
+		{
+			// pam_deny after the optional pam_unix would fail every password login
+			name: "fix locks out a credential module",
+			text: "auth sufficient pam_rootok.so\nauth optional pam_unix.so\n",
+			err:  "fixes leave pam_unix.so at line 2 unable to make the auth stack succeed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor := NewEditor(mustParsePamD(t, tt.text))
+			if _, err := editor.PlanFixes(tt.checks...); err == nil || err.Error() != tt.err {
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestEditor_ApplyFixes(t *testing.T) {
+	editor := NewEditor(mustParsePamD(t, fixableConfig))
+	plan, err := editor.ApplyFixes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Remaining) != 0 {
+		t.Errorf("expected no remaining diagnostics, got %v", plan.Remaining)
+	}
+	if diagnostics := editor.Lint(); len(diagnostics) != 0 {
+		t.Errorf("expected a clean lint after fixing, got %v", diagnostics)
+	}
+
+	// Fixing a clean configuration plans nothing
+	plan, err = editor.PlanFixes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plan.HasChanges() || plan.Report() != "no fixes\n" || plan.Diff().HasChanges() {
+		t.Errorf("expected an empty plan, got %q", plan.Report())
+	}
+}
+
+func TestFixPlan_ApplyRollsBack(t *testing.T) {
+	config := mustParsePamD(t, fixableConfig)
+	original := ruleLines(config)
+	editor := NewEditor(config)
+	plan, err := editor.PlanFixes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The last fix targets a rule that no longer exists, after the others have been applied
+	plan.Fixes[len(plan.Fixes)-1].Fix.Operations = []FixOperation{{Action: FixRemoveArgument, Target: 999, Argument: "nullok"}}
+	if err := plan.Apply(editor); err == nil {
+		t.Fatal("expected error applying a broken fix")
+	}
+	if got := ruleLines(config); strings.Join(got, "\n") != strings.Join(original, "\n") {
+		t.Errorf("expected the configuration to be rolled back, got:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestFixOperation_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		op   FixOperation
+	}{
+		{"unknown action", FixOperation{Action: "rewrite", Target: 1}},
+		{"insert without rule", FixOperation{Action: FixInsertAfter, Target: 1}},
+		{"replace missing argument", FixOperation{Action: FixReplaceArgument, Target: 1, Argument: "md5", Value: "sha512"}},
+		{"append with no stack", FixOperation{Action: FixAppendRule, Rule: &Rule{Type: ModuleTypeSession, ModulePath: "pam_deny.so"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor := NewEditor(mustParsePamD(t, "auth required pam_env.so\n"))
+			if err := tt.op.apply(editor); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestFixPlan_ReportAndDiff(t *testing.T) {
+	config := mustParsePamD(t, fixableConfig)
+	config.FilePath = "/etc/pam.d/login"
+	plan, err := NewEditor(config).PlanFixes("nullok", "auth-no-deny")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	report := plan.Report()
+	for _, want := range []string{
+		"fix: /etc/pam.d/login:3: warning: pam_unix.so allows empty passwords [nullok]\n",
+		"2 fix(es)\n",
+		"remaining: /etc/pam.d/login:6: warning: pam_unix.so hashes passwords with md5 [weak-hash]\n",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report is missing %q:\n%s", want, report)
+		}
+	}
+
+	unified := plan.Diff().Unified()
+	for _, want := range []string{"-auth sufficient pam_unix.so nullok try_first_pass", "+auth sufficient pam_unix.so try_first_pass", "+auth required pam_deny.so"} {
+		if !strings.Contains(unified, want) {
+			t.Errorf("diff is missing %q:\n%s", want, unified)
+		}
+	}
+}
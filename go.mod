@@ -1,3 +1,5 @@
 module github.com/StephenBrown2/pamparser
 
 go 1.22
+
+require gopkg.in/yaml.v3 v3.0.1
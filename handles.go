@@ -0,0 +1,182 @@
+package pamparser
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ensureIDs gives every rule a unique ID, assigning fresh IDs to rules that have none
+// or share one with an earlier rule (e.g. configurations built by hand or merged)
+func (e *Editor) ensureIDs() {
+	for _, rule := range e.config.Rules {
+		e.config.lastID = max(e.config.lastID, rule.ID)
+	}
+
+	seen := make(map[RuleID]bool, len(e.config.Rules))
+	for i := range e.config.Rules {
+		if id := e.config.Rules[i].ID; id == 0 || seen[id] {
+			e.config.lastID++
+			e.config.Rules[i].ID = e.config.lastID
+		}
+		seen[e.config.Rules[i].ID] = true
+	}
+}
+
+// claimID gives a rule about to be inserted an ID. A rule keeps its ID if no other rule
+// in the configuration uses it, so a rule removed and inserted again keeps its handle.
+func (e *Editor) claimID(rule *Rule) {
+	e.ensureIDs()
+	if rule.ID != 0 && !slices.ContainsFunc(e.config.Rules, func(r Rule) bool { return r.ID == rule.ID }) {
+		e.config.lastID = max(e.config.lastID, rule.ID)
+		return
+	}
+	e.config.lastID++
+	rule.ID = e.config.lastID
+}
+
+// FindRuleIDs finds the IDs of all rules matching the given filter
+func (e *Editor) FindRuleIDs(filter RuleFilter) []RuleID {
+	e.ensureIDs()
+	var ids []RuleID
+	for _, rule := range e.config.Rules {
+		if filter(rule) {
+			ids = append(ids, rule.ID)
+		}
+	}
+	return ids
+}
+
+// IndexOf returns the current index of the rule with the given ID
+func (e *Editor) IndexOf(id RuleID) (int, error) {
+	e.ensureIDs()
+	for i, rule := range e.config.Rules {
+		if rule.ID == id {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("no rule with ID %d", id)
+}
+
+// GetRuleByID returns a copy of the rule with the given ID
+func (e *Editor) GetRuleByID(id RuleID) (*Rule, error) {
+	index, err := e.IndexOf(id)
+	if err != nil {
+		return nil, err
+	}
+	return e.GetRule(index)
+}
+
+// UpdateRuleByID replaces the rule with the given ID, keeping the ID
+func (e *Editor) UpdateRuleByID(id RuleID, rule Rule) error {
+	index, err := e.IndexOf(id)
+	if err != nil {
+		return err
+	}
+	return e.UpdateRule(index, rule)
+}
+
+// RemoveRuleByID removes the rule with the given ID
+func (e *Editor) RemoveRuleByID(id RuleID) error {
+	index, err := e.IndexOf(id)
+	if err != nil {
+		return err
+	}
+	return e.RemoveRule(index)
+}
+
+// RemoveRulesByID removes all rules with the given IDs in a single pass and returns the number
+// removed. Unlike removing by index in a loop, earlier removals cannot shift later targets.
+func (e *Editor) RemoveRulesByID(ids ...RuleID) int {
+	defer e.track(EditRemoveRules, "remove rules %v", ids)()
+
+	e.ensureIDs()
+	return e.RemoveRules(func(rule Rule) bool {
+		return slices.Contains(ids, rule.ID)
+	})
+}
+
+// InsertRuleBeforeID inserts a rule directly before the rule with the given ID and returns the new rule's ID
+func (e *Editor) InsertRuleBeforeID(anchor RuleID, rule Rule) (RuleID, error) {
+	index, err := e.IndexOf(anchor)
+	if err != nil {
+		return 0, err
+	}
+	return e.insertRuleAt(index, rule)
+}
+
+// InsertRuleAfterID inserts a rule directly after the rule with the given ID and returns the new rule's ID
+func (e *Editor) InsertRuleAfterID(anchor RuleID, rule Rule) (RuleID, error) {
+	index, err := e.IndexOf(anchor)
+	if err != nil {
+		return 0, err
+	}
+	return e.insertRuleAt(index+1, rule)
+}
+
+// insertRuleAt inserts a rule and returns the ID it was given
+func (e *Editor) insertRuleAt(index int, rule Rule) (RuleID, error) {
+	if err := e.InsertRule(index, rule); err != nil {
+		return 0, err
+	}
+	return e.config.Rules[index].ID, nil
+}
+
+// UpdateArgumentByID updates or adds a module argument on the rule with the given ID
+func (e *Editor) UpdateArgumentByID(id RuleID, argName, argValue string) error {
+	index, err := e.IndexOf(id)
+	if err != nil {
+		return err
+	}
+	return e.UpdateArgument(index, argName, argValue)
+}
+
+// RemoveArgumentByID removes a module argument from the rule with the given ID
+func (e *Editor) RemoveArgumentByID(id RuleID, argName string) error {
+	index, err := e.IndexOf(id)
+	if err != nil {
+		return err
+	}
+	return e.RemoveArgument(index, argName)
+}
+
+// SetControlByID sets the control field of the rule with the given ID
+func (e *Editor) SetControlByID(id RuleID, control Control) error {
+	index, err := e.IndexOf(id)
+	if err != nil {
+		return err
+	}
+	return e.SetControl(index, control)
+}
+
+// MoveRuleBeforeID moves the rule with the given ID directly before the anchor rule
+func (e *Editor) MoveRuleBeforeID(id, anchor RuleID) error {
+	return e.moveRuleByID(id, anchor, 0)
+}
+
+// MoveRuleAfterID moves the rule with the given ID directly after the anchor rule
+func (e *Editor) MoveRuleAfterID(id, anchor RuleID) error {
+	return e.moveRuleByID(id, anchor, 1)
+}
+
+// moveRuleByID removes a rule and reinserts it at the anchor's index plus offset
+func (e *Editor) moveRuleByID(id, anchor RuleID, offset int) error {
+	defer e.track(EditMoveRule, "move rule ID %d next to rule ID %d", id, anchor)()
+
+	if id == anchor {
+		return fmt.Errorf("cannot move rule %d relative to itself", id)
+	}
+	index, err := e.IndexOf(id)
+	if err != nil {
+		return err
+	}
+	if _, err := e.IndexOf(anchor); err != nil {
+		return err
+	}
+
+	rule := e.config.Rules[index]
+	if err := e.RemoveRule(index); err != nil {
+		return err
+	}
+	target, _ := e.IndexOf(anchor)
+	return e.InsertRule(target+offset, rule)
+}
@@ -0,0 +1,173 @@
+package pamparser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParser_AssignsRuleIDs(t *testing.T) {
+	config := mustParsePamD(t, `auth required pam_env.so
+# comment
+auth required pam_unix.so
+@include common-account
+`)
+	for i, rule := range config.Rules {
+		if rule.ID != RuleID(i+1) {
+			t.Errorf("rule %d: expected ID %d, got %d", i, i+1, rule.ID)
+		}
+	}
+}
+
+func TestEditor_RuleIDsStable(t *testing.T) {
+	required := ControlRequired
+	config := mustParsePamD(t, `auth required pam_env.so
+auth sufficient pam_ldap.so
+auth sufficient pam_sss.so
+auth required pam_unix.so
+`)
+	editor := NewEditor(config)
+	unix := config.Rules[3].ID
+
+	newID := editor.AddRule(Rule{Type: ModuleTypeAccount, Control: Control{Simple: &required}, ModulePath: "pam_unix.so"})
+	if newID != 5 {
+		t.Errorf("expected new rule ID 5, got %d", newID)
+	}
+
+	envIndex, err := editor.IndexOf(1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := editor.RemoveRule(envIndex); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rule, err := editor.GetRuleByID(unix)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rule.ModulePath != "pam_unix.so" || rule.ID != unix {
+		t.Errorf("handle resolved to the wrong rule: %+v", rule)
+	}
+
+	// removed IDs are never handed out again
+	again := editor.AddRule(Rule{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_env.so"})
+	if again != 6 {
+		t.Errorf("expected ID 6, got %d", again)
+	}
+
+	// UpdateRule keeps the slot's ID
+	index, _ := editor.IndexOf(unix)
+	if err := editor.UpdateRule(index, Rule{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_unix.so", ID: 99}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Rules[index].ID != unix {
+		t.Errorf("UpdateRule changed the ID to %d", config.Rules[index].ID)
+	}
+
+	if _, err := editor.IndexOf(1); err == nil {
+		t.Error("expected error for removed rule ID")
+	}
+}
+
+func TestEditor_RemoveRulesByID(t *testing.T) {
+	config := mustParsePamD(t, `auth sufficient pam_ldap.so
+auth sufficient pam_ldap.so use_first_pass
+auth required pam_unix.so
+account sufficient pam_ldap.so
+`)
+	editor := NewEditor(config)
+
+	ids := editor.FindRuleIDs(FilterByModulePath("ldap"))
+	if len(ids) != 3 {
+		t.Fatalf("expected 3 IDs, got %v", ids)
+	}
+	if removed := editor.RemoveRulesByID(ids...); removed != 3 {
+		t.Errorf("expected 3 rules removed, got %d", removed)
+	}
+	if got := ruleLines(config); strings.Join(got, "\n") != "auth required pam_unix.so" {
+		t.Errorf("unexpected rules:\n%s", strings.Join(got, "\n"))
+	}
+
+	// removing one by one is just as safe
+	config = mustParsePamD(t, "auth sufficient pam_ldap.so\nauth sufficient pam_ldap.so\nauth required pam_unix.so\n")
+	editor = NewEditor(config)
+	for _, id := range editor.FindRuleIDs(FilterByModulePath("ldap")) {
+		if err := editor.RemoveRuleByID(id); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(config.Rules) != 1 {
+		t.Errorf("expected 1 rule, got %d", len(config.Rules))
+	}
+}
+
+func TestEditor_HandleOperations(t *testing.T) {
+	required := ControlRequired
+	requisite := ControlRequisite
+	config := mustParsePamD(t, `auth required pam_env.so
+auth required pam_unix.so nullok
+auth required pam_deny.so
+`)
+	editor := NewEditor(config)
+	env, unix, deny := config.Rules[0].ID, config.Rules[1].ID, config.Rules[2].ID
+
+	preauth, err := editor.InsertRuleBeforeID(unix, Rule{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_faillock.so", Arguments: []string{"preauth"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := editor.InsertRuleAfterID(unix, Rule{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_faillock.so", Arguments: []string{"authfail"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := editor.UpdateArgumentByID(unix, "try_first_pass", "1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := editor.RemoveArgumentByID(unix, "nullok"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := editor.SetControlByID(env, Control{Simple: &requisite}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := editor.MoveRuleAfterID(env, preauth); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := editor.MoveRuleBeforeID(deny, preauth); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := editor.MoveRuleAfterID(deny, deny); err == nil {
+		t.Error("expected error moving a rule relative to itself")
+	}
+	if err := editor.UpdateRuleByID(999, Rule{}); err == nil {
+		t.Error("expected error for unknown ID")
+	}
+
+	expected := []string{
+		"auth required pam_deny.so",
+		"auth required pam_faillock.so preauth",
+		"auth requisite pam_env.so",
+		"auth required pam_unix.so try_first_pass=1",
+		"auth required pam_faillock.so authfail",
+	}
+	if got := ruleLines(config); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected rules:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestEditor_EnsureIDsForHandBuiltConfig(t *testing.T) {
+	required := ControlRequired
+	config := &Config{Rules: []Rule{
+		{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_env.so"},
+		{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_unix.so", ID: 7},
+		{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_deny.so", ID: 7},
+	}}
+
+	ids := NewEditor(config).FindRuleIDs(func(Rule) bool { return true })
+	seen := map[RuleID]bool{}
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			t.Errorf("expected unique non-zero IDs, got %v", ids)
+		}
+		seen[id] = true
+	}
+	if ids[1] != 7 {
+		t.Errorf("expected existing ID to be kept, got %v", ids)
+	}
+}
@@ -0,0 +1,264 @@
+package pamparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+)
+
+// EditOperation names the kind of Editor mutation recorded in the journal
+type EditOperation string
+
+const (
+	// EditAddRule records AddRule
+	EditAddRule EditOperation = "add_rule"
+	// EditInsertRule records InsertRule, InsertRuleBefore and InsertRuleAfter
+	EditInsertRule EditOperation = "insert_rule"
+	// EditUpdateRule records UpdateRule
+	EditUpdateRule EditOperation = "update_rule"
+	// EditRemoveRule records RemoveRule
+	EditRemoveRule EditOperation = "remove_rule"
+	// EditRemoveRules records RemoveRules and RemoveRulesByID
+	EditRemoveRules EditOperation = "remove_rules"
+	// EditUpdateArgument records UpdateArgument
+	EditUpdateArgument EditOperation = "update_argument"
+	// EditRemoveArgument records RemoveArgument
+	EditRemoveArgument EditOperation = "remove_argument"
+	// EditSetControl records SetControl
+	EditSetControl EditOperation = "set_control"
+	// EditRemoveDuplicates records RemoveDuplicateRules
+	EditRemoveDuplicates EditOperation = "remove_duplicates"
+	// EditMoveRule records MoveRule, MoveRuleBeforeID and MoveRuleAfterID
+	EditMoveRule EditOperation = "move_rule"
+	// EditAddComment records AddComment
+	EditAddComment EditOperation = "add_comment"
+	// EditSortRules records SortRulesByType
+	EditSortRules EditOperation = "sort_rules"
+	// EditEnsureRule records EnsureRule
+	EditEnsureRule EditOperation = "ensure_rule"
+	// EditEnsureAbsent records EnsureAbsent
+	EditEnsureAbsent EditOperation = "ensure_absent"
+	// EditEnsureArgument records EnsureArgument
+	EditEnsureArgument EditOperation = "ensure_argument"
+	// EditEnsureOrder records EnsureOrder
+	EditEnsureOrder EditOperation = "ensure_order"
+	// EditUndo records Undo
+	EditUndo EditOperation = "undo"
+	// EditRedo records Redo
+	EditRedo EditOperation = "redo"
+	// EditRollback records RollbackTo
+	EditRollback EditOperation = "rollback"
+)
+
+// JournalEntry describes one change made through an Editor
+type JournalEntry struct {
+	Sequence    int           `json:"sequence"`
+	Time        time.Time     `json:"time"`
+	Operation   EditOperation `json:"operation"`
+	Description string        `json:"description"`
+	Changes     []string      `json:"changes,omitempty"`
+}
+
+// Checkpoint marks a point in an Editor's history that RollbackTo can return to
+type Checkpoint struct {
+	position int
+	sequence int
+}
+
+// journalRecord is a change with the configuration before and after it. after stays nil
+// until the next snapshot of the configuration is taken, and the entry's Changes are only
+// computed when the journal is read, so tracking a mutation costs a single copy.
+type journalRecord struct {
+	entry  JournalEntry
+	before *Config
+	after  *Config
+	diffed bool
+}
+
+// editHistory holds an Editor's undo stack and audit journal
+type editHistory struct {
+	entries  []*journalRecord // undoable changes, shared with journal
+	cursor   int              // number of entries currently applied
+	depth    int              // nesting of tracked calls; only the outermost is recorded
+	journal  []*journalRecord
+	sequence int
+}
+
+// track starts recording a mutation. The returned function must be deferred; it records
+// the mutation if the configuration changed. Calls made while another tracked call is
+// running are folded into the outer one.
+func (e *Editor) track(op EditOperation, format string, args ...any) func() {
+	e.history.depth++
+	if e.history.depth > 1 {
+		return func() { e.history.depth-- }
+	}
+
+	before := e.snapshot()
+	return func() {
+		e.history.depth--
+		if sameState(before, e.config) {
+			return
+		}
+
+		record := e.logEntry(op, fmt.Sprintf(format, args...), before, nil)
+		e.history.entries = append(e.history.entries[:e.history.cursor], record)
+		e.history.cursor++
+	}
+}
+
+// snapshot copies the current configuration. The copy is also the state after every
+// journal record still waiting for one.
+func (e *Editor) snapshot() *Config {
+	current := e.GetConfig()
+	for i := len(e.history.journal) - 1; i >= 0 && e.history.journal[i].after == nil; i-- {
+		e.history.journal[i].after = current
+	}
+	return current
+}
+
+// logEntry appends a journal record of the change from before to after. A nil after is
+// filled in by the next snapshot.
+func (e *Editor) logEntry(op EditOperation, description string, before, after *Config) *journalRecord {
+	e.history.sequence++
+	record := &journalRecord{
+		entry: JournalEntry{
+			Sequence:    e.history.sequence,
+			Time:        time.Now(),
+			Operation:   op,
+			Description: description,
+		},
+		before: before,
+		after:  after,
+	}
+	e.history.journal = append(e.history.journal, record)
+	return record
+}
+
+// sameState reports whether the configuration still matches a snapshot of it
+func sameState(snapshot, config *Config) bool {
+	return slices.Equal(snapshot.Comments, config.Comments) && slices.EqualFunc(snapshot.Rules, config.Rules, sameRule)
+}
+
+// sameRule reports whether two rules are equal field by field
+func sameRule(a, b Rule) bool {
+	return a.ID == b.ID && a.Service == b.Service && a.Type == b.Type && a.ModulePath == b.ModulePath &&
+		a.Comment == b.Comment && a.DirectiveType == b.DirectiveType && a.DirectiveTarget == b.DirectiveTarget &&
+		a.LineNumber == b.LineNumber && a.Continuation == b.Continuation && a.IsDirective == b.IsDirective &&
+		slices.Equal(a.Arguments, b.Arguments) && slices.Equal(a.Fragments, b.Fragments) &&
+		(a.Control.Simple == nil) == (b.Control.Simple == nil) &&
+		(a.Control.Simple == nil || *a.Control.Simple == *b.Control.Simple) &&
+		maps.Equal(a.Control.Complex, b.Control.Complex) && slices.Equal(a.Control.Order, b.Control.Order)
+}
+
+// restore replaces the configuration's rules and comments with a copy of the snapshot
+func (e *Editor) restore(snapshot *Config) {
+	restored := NewEditor(snapshot).GetConfig()
+	e.config.Rules = restored.Rules
+	e.config.Comments = restored.Comments
+	e.config.lastID = max(e.config.lastID, restored.lastID)
+}
+
+// CanUndo reports whether there is a change to undo
+func (e *Editor) CanUndo() bool {
+	return e.history.cursor > 0
+}
+
+// CanRedo reports whether there is an undone change to redo
+func (e *Editor) CanRedo() bool {
+	return e.history.cursor < len(e.history.entries)
+}
+
+// Undo reverts the most recent change
+func (e *Editor) Undo() error {
+	if !e.CanUndo() {
+		return fmt.Errorf("nothing to undo")
+	}
+
+	current := e.snapshot()
+	record := e.history.entries[e.history.cursor-1]
+	e.restore(record.before)
+	e.history.cursor--
+	e.logEntry(EditUndo, "undo "+record.entry.Description, current, record.before)
+	return nil
+}
+
+// Redo reapplies the most recently undone change
+func (e *Editor) Redo() error {
+	if !e.CanRedo() {
+		return fmt.Errorf("nothing to redo")
+	}
+
+	current := e.snapshot()
+	record := e.history.entries[e.history.cursor]
+	e.restore(record.after)
+	e.history.cursor++
+	e.logEntry(EditRedo, "redo "+record.entry.Description, current, record.after)
+	return nil
+}
+
+// Checkpoint returns a marker for the current state
+func (e *Editor) Checkpoint() Checkpoint {
+	cp := Checkpoint{position: e.history.cursor}
+	if cp.position > 0 {
+		cp.sequence = e.history.entries[cp.position-1].entry.Sequence
+	}
+	return cp
+}
+
+// RollbackTo returns the configuration to the state at the checkpoint. Changes made since
+// can be redone as long as no new change is made. A checkpoint taken on a branch of history
+// that has since been discarded by new changes after Undo is rejected.
+func (e *Editor) RollbackTo(cp Checkpoint) error {
+	if cp.position > len(e.history.entries) ||
+		(cp.position > 0 && e.history.entries[cp.position-1].entry.Sequence != cp.sequence) {
+		return fmt.Errorf("checkpoint is no longer part of the editor history")
+	}
+	if cp.position == e.history.cursor {
+		return nil
+	}
+
+	// Every entry but the last applied one was followed by a snapshot, and the snapshot
+	// taken here completes that one
+	current := e.snapshot()
+	target := e.history.entries[0].before
+	if cp.position > 0 {
+		target = e.history.entries[cp.position-1].after
+	}
+	e.restore(target)
+	e.history.cursor = cp.position
+	e.logEntry(EditRollback, fmt.Sprintf("roll back to checkpoint %d", cp.sequence), current, target)
+	return nil
+}
+
+// Journal returns every change made through the editor, including undo, redo and rollback
+func (e *Editor) Journal() []JournalEntry {
+	if n := len(e.history.journal); n > 0 && e.history.journal[n-1].after == nil {
+		e.snapshot()
+	}
+
+	entries := make([]JournalEntry, len(e.history.journal))
+	for i, record := range e.history.journal {
+		if !record.diffed {
+			for _, change := range Diff(record.before, record.after).Changes {
+				record.entry.Changes = append(record.entry.Changes, change.Description)
+			}
+			record.diffed = true
+		}
+		entries[i] = record.entry
+	}
+	return entries
+}
+
+// WriteJournal writes the journal as JSON lines, one entry per line, for audit logs
+func (e *Editor) WriteJournal(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range e.Journal() {
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("failed to write journal entry %d: %w", entry.Sequence, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package pamparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEditor_UndoRedo(t *testing.T) {
+	required := ControlRequired
+	sufficient := ControlSufficient
+	config := mustParsePamD(t, `auth required pam_env.so
+auth required pam_unix.so nullok
+account required pam_unix.so
+`)
+	original := ruleLines(config)
+	editor := NewEditor(config)
+
+	if editor.CanUndo() || editor.CanRedo() {
+		t.Fatal("expected empty history")
+	}
+	if err := editor.Undo(); err == nil {
+		t.Error("expected error undoing with empty history")
+	}
+
+	editor.AddRule(Rule{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_faillock.so"})
+	afterAdd := ruleLines(config)
+	if err := editor.UpdateArgument(1, "try_first_pass", "1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	afterArgument := ruleLines(config)
+	if err := editor.SetControl(0, Control{Simple: &sufficient}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	afterControl := ruleLines(config)
+
+	steps := []struct {
+		name     string
+		action   func() error
+		expected []string
+	}{
+		{"undo control", editor.Undo, afterArgument},
+		{"undo argument", editor.Undo, afterAdd},
+		{"undo add", editor.Undo, original},
+		{"redo add", editor.Redo, afterAdd},
+		{"redo argument", editor.Redo, afterArgument},
+		{"redo control", editor.Redo, afterControl},
+	}
+	for _, step := range steps {
+		if err := step.action(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if got := ruleLines(config); strings.Join(got, "\n") != strings.Join(step.expected, "\n") {
+			t.Errorf("%s: unexpected rules:\n%s", step.name, strings.Join(got, "\n"))
+		}
+	}
+	if err := editor.Redo(); err == nil {
+		t.Error("expected error redoing past the end of history")
+	}
+
+	// a new change discards the redo tail
+	_ = editor.Undo()
+	editor.SortRulesByType()
+	if editor.CanRedo() {
+		t.Error("expected redo history to be discarded after a new change")
+	}
+}
+
+func TestEditor_HistorySkipsNoOps(t *testing.T) {
+	config := mustParsePamD(t, "auth required pam_unix.so nullok\n")
+	editor := NewEditor(config)
+
+	if err := editor.RemoveRule(5); err == nil {
+		t.Error("expected out of range error")
+	}
+	if _, err := editor.EnsureArgument(FilterByModulePath("pam_unix"), "nullok", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if editor.CanUndo() || len(editor.Journal()) != 0 {
+		t.Errorf("failed and no-op calls should not be recorded, got %v", editor.Journal())
+	}
+
+	// nested calls are recorded once, as the outer operation
+	if _, err := editor.EnsureOrder(FilterByModulePath("pam_unix"), FilterByModulePath("pam_unix")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	required := ControlRequired
+	editor.EnsureRule(Rule{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_faillock.so"}, false)
+	journal := editor.Journal()
+	if len(journal) != 1 || journal[0].Operation != EditEnsureRule {
+		t.Errorf("expected a single ensure_rule entry, got %v", journal)
+	}
+}
+
+func TestEditor_CheckpointRollback(t *testing.T) {
+	config := mustParsePamD(t, `auth required pam_env.so
+auth sufficient pam_ldap.so
+auth required pam_unix.so
+`)
+	editor := NewEditor(config)
+	start := editor.Checkpoint()
+
+	_ = editor.RemoveRule(1)
+	middle := editor.Checkpoint()
+	afterRemove := ruleLines(config)
+	_ = editor.UpdateArgument(1, "nullok", "1")
+	_ = editor.MoveRule(1, 0)
+
+	if err := editor.RollbackTo(middle); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := ruleLines(config); strings.Join(got, "\n") != strings.Join(afterRemove, "\n") {
+		t.Errorf("unexpected rules after rollback:\n%s", strings.Join(got, "\n"))
+	}
+	if !editor.CanRedo() {
+		t.Error("expected rolled back changes to be redoable")
+	}
+
+	if err := editor.RollbackTo(start); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(config.Rules) != 3 {
+		t.Errorf("expected original 3 rules, got %d", len(config.Rules))
+	}
+
+	// branching history invalidates checkpoints on the discarded branch
+	editor.AddComment("# new branch")
+	if err := editor.RollbackTo(middle); err == nil {
+		t.Error("expected error for checkpoint on discarded branch")
+	}
+	if err := editor.RollbackTo(start); err != nil {
+		t.Errorf("expected start checkpoint to stay valid: %v", err)
+	}
+}
+
+func TestEditor_Journal(t *testing.T) {
+	config := mustParsePamD(t, "auth required pam_unix.so\n")
+	editor := NewEditor(config)
+
+	_ = editor.UpdateArgument(0, "nullok", "1")
+	_ = editor.Undo()
+	_ = editor.Redo()
+
+	journal := editor.Journal()
+	want := []EditOperation{EditUpdateArgument, EditUndo, EditRedo}
+	if len(journal) != len(want) {
+		t.Fatalf("expected %d entries, got %v", len(want), journal)
+	}
+	for i, entry := range journal {
+		if entry.Operation != want[i] || entry.Sequence != i+1 {
+			t.Errorf("entry %d: expected %s #%d, got %s #%d", i, want[i], i+1, entry.Operation, entry.Sequence)
+		}
+		if len(entry.Changes) == 0 {
+			t.Errorf("entry %d: expected change descriptions", i)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := editor.WriteJournal(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 JSON lines, got %d", len(lines))
+	}
+	var entry JournalEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("invalid JSON line: %v", err)
+	}
+	if entry.Description != "rule 0: set nullok=1" {
+		t.Errorf("unexpected description %q", entry.Description)
+	}
+}
+
+func TestEditor_JournalDiffsLazily(t *testing.T) {
+	required := ControlRequired
+	editor := NewEditor(mustParsePamD(t, "auth required pam_unix.so\n"))
+	for _, module := range []string{"pam_env.so", "pam_faillock.so", "pam_deny.so"} {
+		editor.AddRule(Rule{Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: module})
+	}
+
+	// Each record's after state is the snapshot the next mutation took; nothing is diffed yet
+	records := editor.history.journal
+	if len(records) != 3 || records[2].after != nil {
+		t.Fatalf("expected 3 records with the last one open, got %d", len(records))
+	}
+	for i, record := range records[:2] {
+		if record.after != records[i+1].before || record.diffed {
+			t.Errorf("record %d: expected the next record's snapshot and no diff yet", i)
+		}
+	}
+
+	journal := editor.Journal()
+	for i, module := range []string{"pam_env.so", "pam_faillock.so", "pam_deny.so"} {
+		if len(journal[i].Changes) != 1 || !strings.Contains(journal[i].Changes[0], module) {
+			t.Errorf("entry %d: expected one change adding %s, got %v", i, module, journal[i].Changes)
+		}
+	}
+
+	// Undoing after the journal was read still restores the right state
+	if err := editor.Undo(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := editor.Redo(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := ruleLines(editor.config); len(got) != 4 || !strings.Contains(got[3], "pam_deny.so") {
+		t.Errorf("unexpected rules after redo:\n%s", strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,179 @@
+package pamparser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// libpamSeparators are the characters libpam's _pam_StrTok splits configuration lines on
+const libpamSeparators = " \t\n"
+
+// LibpamToken is one field of a configuration line as libpam's _pam_StrTok returns it
+type LibpamToken struct {
+	Text      string `json:"text"`                // token text; brackets removed and \] unescaped if Bracketed
+	Bracketed bool   `json:"bracketed,omitempty"` // true if the token was written as [...]
+	Column    int    `json:"column"`              // 1-based column of the token's first character
+}
+
+// TokenizeLibpam splits one logical configuration line exactly as libpam does:
+//   - everything from the first '#' on is a comment, even inside brackets
+//   - tokens are separated by spaces, tabs and newlines only
+//   - a token starting with '[' runs to the first ']' not preceded by a backslash; the
+//     brackets are removed, \] becomes ] and any other backslash is kept
+//   - the next token starts right after that ']', even without a separator
+//   - a '[' inside a token is an ordinary character
+func TokenizeLibpam(line string) []LibpamToken {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+
+	var tokens []LibpamToken
+	pos := 0
+	for {
+		// look for the first non-separator character
+		for pos < len(line) && strings.IndexByte(libpamSeparators, line[pos]) >= 0 {
+			pos++
+		}
+		if pos >= len(line) {
+			return tokens
+		}
+
+		start := pos
+		if line[pos] == '[' {
+			var text strings.Builder
+			for pos++; pos < len(line) && line[pos] != ']'; pos++ {
+				if line[pos] == '\\' && pos+1 < len(line) && line[pos+1] == ']' {
+					pos++
+				}
+				text.WriteByte(line[pos])
+			}
+			pos++ // skip the closing bracket
+			tokens = append(tokens, LibpamToken{Text: text.String(), Bracketed: true, Column: start + 1})
+			continue
+		}
+
+		for pos < len(line) && strings.IndexByte(libpamSeparators, line[pos]) < 0 {
+			pos++
+		}
+		tokens = append(tokens, LibpamToken{Text: line[start:pos], Column: start + 1})
+	}
+}
+
+// continuesLibpam reports whether libpam's _pam_assemble_line continues a physical line
+// onto the next one: the line must end with a backslash and contain no '#'
+func continuesLibpam(line string) bool {
+	if strings.Contains(line, "#") {
+		return false
+	}
+	return strings.HasSuffix(strings.TrimRight(line, libpamSeparators), "\\")
+}
+
+// scanLibpamLines is a bufio.SplitFunc that splits on newlines only. Unlike bufio.ScanLines
+// it keeps a carriage return, which libpam treats as part of the last token.
+func scanLibpamLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// SetLibpamCompat switches the parser to libpam's own tokenizer (see TokenizeLibpam) instead
+// of the more forgiving default one, so parsed rules match what libpam will execute. In
+// this mode a control cannot carry a '-' prefix, which libpam only accepts on the type.
+func (p *Parser) SetLibpamCompat(enabled bool) *Parser {
+	p.libpamCompat = enabled
+	return p
+}
+
+// parseLibpamLine parses a logical line with libpam's tokenizer
+func (p *Parser) parseLibpamLine(line string, lineNum int, isPamD bool, serviceName string) (*Rule, string, error) {
+	trimmed := strings.TrimLeft(line, libpamSeparators)
+	if strings.HasPrefix(trimmed, "#") {
+		return nil, strings.TrimSpace(trimmed[1:]), nil
+	}
+
+	tokens := TokenizeLibpam(line)
+	if len(tokens) == 0 {
+		return nil, "", nil
+	}
+
+	rule := Rule{LineNumber: lineNum}
+	if _, comment, ok := strings.Cut(line, "#"); ok {
+		rule.Comment = strings.TrimSpace(comment)
+	}
+	if isPamD && serviceName != "" {
+		rule.Service = serviceName
+	}
+
+	texts := make([]string, len(tokens))
+	for i, token := range tokens {
+		texts[i] = token.Text
+	}
+
+	// Check for directive (e.g., @include)
+	if !tokens[0].Bracketed && strings.HasPrefix(texts[0], "@") {
+		return p.parseDirective(texts, &rule, lineNum)
+	}
+
+	tokenIdx := 0
+	if !isPamD {
+		rule.Service = texts[tokenIdx]
+		tokenIdx++
+	}
+
+	// Parse type
+	if len(tokens) <= tokenIdx {
+		return nil, "", fmt.Errorf("missing type field at line %d", lineNum)
+	}
+	if !IsValidModuleType(texts[tokenIdx]) {
+		return nil, "", fmt.Errorf("invalid module type '%s' at line %d", texts[tokenIdx], lineNum)
+	}
+	rule.Type = ModuleType(strings.ToLower(texts[tokenIdx]))
+	tokenIdx++
+
+	// Parse control
+	if len(tokens) <= tokenIdx {
+		return nil, "", fmt.Errorf("missing control field at line %d", lineNum)
+	}
+	control := tokens[tokenIdx]
+	if control.Bracketed {
+		parsed, problems := p.parseComplexControl("["+control.Text+"]", false)
+		if len(problems) > 0 {
+			for i := range problems {
+				problems[i].Line = lineNum
+				problems[i].Column += control.Column - 1
+			}
+			if !p.lenient {
+				return nil, "", problems
+			}
+			p.warnings = append(p.warnings, problems...)
+		}
+		rule.Control = parsed
+	} else {
+		controlType := ControlType(strings.ToLower(control.Text))
+		if !IsValidControlType(string(controlType)) {
+			return nil, "", fmt.Errorf("error parsing control at line %d: invalid control type: %s", lineNum, control.Text)
+		}
+		rule.Control = Control{Simple: &controlType}
+	}
+	tokenIdx++
+
+	// Parse module path
+	if len(tokens) <= tokenIdx {
+		return nil, "", fmt.Errorf("missing module path at line %d", lineNum)
+	}
+	rule.ModulePath = texts[tokenIdx]
+	tokenIdx++
+
+	if tokenIdx < len(tokens) {
+		rule.Arguments = texts[tokenIdx:]
+	}
+	return &rule, "", nil
+}
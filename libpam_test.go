@@ -0,0 +1,203 @@
+package pamparser
+
+import (
+	"bufio"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type libpamCorpusCase struct {
+	line   string
+	tokens []LibpamToken
+}
+
+// loadLibpamCorpus reads testdata/libpam_tokens.txt
+func loadLibpamCorpus(t *testing.T) []libpamCorpusCase {
+	t.Helper()
+	file, err := os.Open("testdata/libpam_tokens.txt")
+	if err != nil {
+		t.Fatalf("failed to open corpus: %v", err)
+	}
+	defer file.Close()
+
+	var cases []libpamCorpusCase
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, quoted, ok := strings.Cut(text, ": ")
+		value, err := strconv.Unquote(quoted)
+		if !ok || err != nil {
+			t.Fatalf("corpus line %d: malformed entry %q", lineNum, text)
+		}
+
+		switch key {
+		case "line":
+			cases = append(cases, libpamCorpusCase{line: value})
+		case "token", "bracketed":
+			if len(cases) == 0 {
+				t.Fatalf("corpus line %d: token before first line", lineNum)
+			}
+			c := &cases[len(cases)-1]
+			c.tokens = append(c.tokens, LibpamToken{Text: value, Bracketed: key == "bracketed"})
+		default:
+			t.Fatalf("corpus line %d: unknown key %q", lineNum, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("failed to read corpus: %v", err)
+	}
+	return cases
+}
+
+func TestTokenizeLibpam_Corpus(t *testing.T) {
+	cases := loadLibpamCorpus(t)
+	if len(cases) < 20 {
+		t.Fatalf("expected at least 20 corpus cases, got %d", len(cases))
+	}
+
+	for _, c := range cases {
+		t.Run(strconv.Quote(c.line), func(t *testing.T) {
+			var got []LibpamToken
+			for _, token := range TokenizeLibpam(c.line) {
+				got = append(got, LibpamToken{Text: token.Text, Bracketed: token.Bracketed})
+			}
+			if !reflect.DeepEqual(got, c.tokens) {
+				t.Errorf("TokenizeLibpam() = %+v, want %+v", got, c.tokens)
+			}
+		})
+	}
+}
+
+func TestTokenizeLibpam_Columns(t *testing.T) {
+	tokens := TokenizeLibpam("auth\t[success=ok]pam_unix.so  nullok")
+	var columns []int
+	for _, token := range tokens {
+		columns = append(columns, token.Column)
+	}
+	if want := []int{1, 6, 18, 31}; !reflect.DeepEqual(columns, want) {
+		t.Errorf("columns = %v, want %v", columns, want)
+	}
+}
+
+func TestParser_LibpamCompatCorpus(t *testing.T) {
+	for _, c := range loadLibpamCorpus(t) {
+		config, err := NewParser().SetLibpamCompat(true).Parse(strings.NewReader(c.line), true)
+		if err != nil || len(config.Rules) == 0 || config.Rules[0].IsDirective {
+			continue
+		}
+		t.Run(strconv.Quote(c.line), func(t *testing.T) {
+			rule := config.Rules[0]
+			var want []string
+			for _, token := range c.tokens[3:] {
+				want = append(want, token.Text)
+			}
+			if rule.ModulePath != c.tokens[2].Text || !reflect.DeepEqual(rule.Arguments, want) {
+				t.Errorf("parsed module %q arguments %q, want %q %q", rule.ModulePath, rule.Arguments, c.tokens[2].Text, want)
+			}
+		})
+	}
+}
+
+func TestParser_LibpamCompat(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		defaultArgs []string
+		compatArgs  []string
+		compatErr   bool
+	}{
+		{
+			name:        "hash inside brackets starts a comment",
+			input:       "auth required pam_x.so [a#b] c",
+			defaultArgs: []string{"a#b", "c"},
+			compatArgs:  []string{"a"},
+		},
+		{
+			name:        "bracket inside a plain token",
+			input:       "auth required pam_x.so foo[bar baz]",
+			defaultArgs: []string{"foo", "bar baz"},
+			compatArgs:  []string{"foo[bar", "baz]"},
+		},
+		{
+			name:        "first closing bracket ends the token",
+			input:       "auth required pam_x.so [a [b] c]",
+			defaultArgs: []string{"a [b] c"},
+			compatArgs:  []string{"a [b", "c]"},
+		},
+		{
+			name:        "only closing brackets are unescaped",
+			input:       `auth required pam_x.so [a\[b]`,
+			defaultArgs: []string{"a[b"},
+			compatArgs:  []string{`a\[b`},
+		},
+		{
+			name:        "dash before the control is not libpam syntax",
+			input:       "session -optional pam_systemd.so",
+			defaultArgs: nil,
+			compatErr:   true,
+		},
+		{
+			name:        "types and controls are case-insensitive",
+			input:       "AUTH Required pam_x.so",
+			defaultArgs: nil,
+			compatArgs:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewParser().Parse(strings.NewReader(tt.input), true)
+			if err != nil {
+				t.Fatalf("default mode: unexpected error: %v", err)
+			}
+			if got := config.Rules[0].Arguments; !reflect.DeepEqual(got, tt.defaultArgs) {
+				t.Errorf("default mode arguments = %q, want %q", got, tt.defaultArgs)
+			}
+
+			config, err = NewParser().SetLibpamCompat(true).Parse(strings.NewReader(tt.input), true)
+			if tt.compatErr {
+				if err == nil {
+					t.Error("libpam mode: expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("libpam mode: unexpected error: %v", err)
+			}
+			if got := config.Rules[0].Arguments; !reflect.DeepEqual(got, tt.compatArgs) {
+				t.Errorf("libpam mode arguments = %q, want %q", got, tt.compatArgs)
+			}
+		})
+	}
+}
+
+func TestParser_LibpamCompatContinuation(t *testing.T) {
+	input := "auth required pam_x.so [a \\\n  b] \\\n  c # done \\\nsession required pam_unix.so\n"
+
+	config, err := NewParser().SetLibpamCompat(true).Parse(strings.NewReader(input), true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(config.Rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(config.Rules))
+	}
+	if got, want := config.Rules[0].Arguments, []string{"a  b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("arguments = %q, want %q", got, want)
+	}
+	if config.Rules[0].Comment != `done \` {
+		t.Errorf("comment = %q", config.Rules[0].Comment)
+	}
+}
+
+func TestParser_LibpamCompatControlProblems(t *testing.T) {
+	_, err := NewParser().SetLibpamCompat(true).Parse(strings.NewReader("auth  [sucess=ok] pam_x.so"), true)
+	if err == nil || err.Error() != `line 1, column 8: unknown return value "sucess"` {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,454 @@
+package pamparser
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LimitsModule is the module name of pam_limits
+const LimitsModule = "pam_limits.so"
+
+// Default locations pam_limits reads its configuration from
+const (
+	// DefaultLimitsFile is read unless a conf= argument names another file
+	DefaultLimitsFile = "/etc/security/limits.conf"
+	// DefaultLimitsDir holds *.conf files read after DefaultLimitsFile, unless conf= is given
+	DefaultLimitsDir = "/etc/security/limits.d"
+)
+
+// LimitType is the type field of a limits.conf entry
+type LimitType string
+
+const (
+	// LimitSoft sets the soft limit, the default users can raise up to the hard limit
+	LimitSoft LimitType = "soft"
+	// LimitHard sets the hard limit, which only root can raise
+	LimitHard LimitType = "hard"
+	// LimitBoth sets both the soft and the hard limit
+	LimitBoth LimitType = "-"
+)
+
+// LimitItem is the resource a limits.conf entry limits
+type LimitItem string
+
+const (
+	// LimitCore limits the core file size (KB)
+	LimitCore LimitItem = "core"
+	// LimitData limits the data size (KB)
+	LimitData LimitItem = "data"
+	// LimitFsize limits the file size (KB)
+	LimitFsize LimitItem = "fsize"
+	// LimitMemlock limits the locked-in-memory address space (KB)
+	LimitMemlock LimitItem = "memlock"
+	// LimitNofile limits the number of open file descriptors
+	LimitNofile LimitItem = "nofile"
+	// LimitRss limits the resident set size (KB)
+	LimitRss LimitItem = "rss"
+	// LimitStack limits the stack size (KB)
+	LimitStack LimitItem = "stack"
+	// LimitCPU limits the CPU time (minutes)
+	LimitCPU LimitItem = "cpu"
+	// LimitNproc limits the number of processes
+	LimitNproc LimitItem = "nproc"
+	// LimitAs limits the address space (KB)
+	LimitAs LimitItem = "as"
+	// LimitMaxlogins limits the number of logins of a user or group
+	LimitMaxlogins LimitItem = "maxlogins"
+	// LimitMaxsyslogins limits the number of logins on the system
+	LimitMaxsyslogins LimitItem = "maxsyslogins"
+	// LimitNonewprivs disables acquiring new privileges when set to 1
+	LimitNonewprivs LimitItem = "nonewprivs"
+	// LimitPriority sets the priority user processes run with
+	LimitPriority LimitItem = "priority"
+	// LimitLocks limits the number of file locks
+	LimitLocks LimitItem = "locks"
+	// LimitSigpending limits the number of pending signals
+	LimitSigpending LimitItem = "sigpending"
+	// LimitMsgqueue limits the memory used by POSIX message queues (bytes)
+	LimitMsgqueue LimitItem = "msgqueue"
+	// LimitNice limits the nice priority users may raise to, in [-20, 19]
+	LimitNice LimitItem = "nice"
+	// LimitRtprio limits the realtime priority
+	LimitRtprio LimitItem = "rtprio"
+)
+
+// limitItems lists the items documented in limits.conf(5)
+var limitItems = []LimitItem{
+	LimitCore, LimitData, LimitFsize, LimitMemlock, LimitNofile, LimitRss, LimitStack, LimitCPU,
+	LimitNproc, LimitAs, LimitMaxlogins, LimitMaxsyslogins, LimitNonewprivs, LimitPriority,
+	LimitLocks, LimitSigpending, LimitMsgqueue, LimitNice, LimitRtprio,
+}
+
+// LimitDomainKind classifies the domain field of a limits.conf entry
+type LimitDomainKind string
+
+const (
+	// LimitDomainUser matches a user name
+	LimitDomainUser LimitDomainKind = "user"
+	// LimitDomainGroup matches members of a group (@group)
+	LimitDomainGroup LimitDomainKind = "group"
+	// LimitDomainLoginGroup counts the logins of a whole group (%group, %:gid or %), maxlogins only
+	LimitDomainLoginGroup LimitDomainKind = "login_group"
+	// LimitDomainWildcard matches everyone (*)
+	LimitDomainWildcard LimitDomainKind = "wildcard"
+	// LimitDomainUIDRange matches a uid range (min:max)
+	LimitDomainUIDRange LimitDomainKind = "uid_range"
+	// LimitDomainGIDRange matches a gid range (@min:max)
+	LimitDomainGIDRange LimitDomainKind = "gid_range"
+)
+
+// LimitDomain is the parsed domain field of a limits.conf entry. For ranges, Min and Max are
+// -1 when open-ended; a range written without a minimum (:max) matches max exactly.
+type LimitDomain struct {
+	Kind LimitDomainKind `json:"kind"`
+	Name string          `json:"name,omitempty"`
+	Min  int             `json:"min,omitempty"`
+	Max  int             `json:"max,omitempty"`
+}
+
+// LimitEntry is one <domain> <type> <item> <value> line of limits.conf
+type LimitEntry struct {
+	Domain     string    `json:"domain"`
+	Type       LimitType `json:"type"`
+	Item       LimitItem `json:"item"`
+	Value      string    `json:"value"`
+	Comment    string    `json:"comment,omitempty"`
+	LineNumber int       `json:"line_number,omitempty"`
+}
+
+// LimitsConfig represents a limits.conf file or a file in limits.d
+type LimitsConfig struct {
+	FilePath string       `json:"file_path,omitempty"`
+	Entries  []LimitEntry `json:"entries"`
+	Comments []string     `json:"comments,omitempty"`
+}
+
+// IsValidLimitItem checks if the given string is an item documented in limits.conf(5)
+func IsValidLimitItem(item string) bool {
+	return slices.Contains(limitItems, LimitItem(item))
+}
+
+// IsValidLimitType checks if the given string is soft, hard or -
+func IsValidLimitType(t string) bool {
+	switch LimitType(t) {
+	case LimitSoft, LimitHard, LimitBoth:
+		return true
+	default:
+		return false
+	}
+}
+
+// splitConfigComment splits a line of a module configuration file at the first '#'
+func splitConfigComment(line string) (content, comment string) {
+	content, comment, _ = strings.Cut(line, "#")
+	return strings.TrimSpace(content), strings.TrimSpace(comment)
+}
+
+// ParseLimits parses limits.conf syntax. Comment-only lines are kept in Comments and
+// trailing comments on entry lines in the entry's Comment.
+func ParseLimits(reader io.Reader) (*LimitsConfig, error) {
+	config := &LimitsConfig{}
+
+	scanner := bufio.NewScanner(reader)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		content, comment := splitConfigComment(scanner.Text())
+		if content == "" {
+			if comment != "" {
+				config.Comments = append(config.Comments, comment)
+			}
+			continue
+		}
+
+		fields := strings.Fields(content)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("expected <domain> <type> <item> <value> at line %d, got %d fields", lineNum, len(fields))
+		}
+		config.Entries = append(config.Entries, LimitEntry{
+			Domain:     fields[0],
+			Type:       LimitType(fields[1]),
+			Item:       LimitItem(fields[2]),
+			Value:      fields[3],
+			Comment:    comment,
+			LineNumber: lineNum,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading input: %w", err)
+	}
+	return config, nil
+}
+
+// LoadLimitsFile loads a limits.conf file
+func LoadLimitsFile(filePath string) (*LimitsConfig, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	config, err := ParseLimits(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file %s: %w", filePath, err)
+	}
+	config.FilePath = filePath
+	return config, nil
+}
+
+// LimitsFilesForRule returns the files a pam_limits rule reads, in the order pam_limits reads
+// them: the conf= file alone if given, otherwise DefaultLimitsFile followed by the *.conf
+// files of DefaultLimitsDir in C locale order. root is prepended to every path, for
+// inspecting a mounted image; pass "" for the running system.
+func LimitsFilesForRule(rule Rule, root string) ([]string, error) {
+	if !rule.IsModule(LimitsModule) {
+		return nil, fmt.Errorf("rule module %s is not %s", rule.ModulePath, LimitsModule)
+	}
+	if conf, ok := rule.ArgumentValue("conf"); ok {
+		return []string{filepath.Join(root, conf)}, nil
+	}
+
+	files := []string{filepath.Join(root, DefaultLimitsFile)}
+	dropIns, err := filepath.Glob(filepath.Join(root, DefaultLimitsDir, "*.conf"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", DefaultLimitsDir, err)
+	}
+	slices.Sort(dropIns)
+	return append(files, dropIns...), nil
+}
+
+// LoadLimitsForRule loads every file a pam_limits rule reads, in reading order. A missing
+// DefaultLimitsFile is skipped as pam_limits does; a missing conf= file is an error.
+func LoadLimitsForRule(rule Rule, root string) ([]*LimitsConfig, error) {
+	files, err := LimitsFilesForRule(rule, root)
+	if err != nil {
+		return nil, err
+	}
+	_, explicit := rule.ArgumentValue("conf")
+
+	var configs []*LimitsConfig
+	for _, file := range files {
+		config, err := LoadLimitsFile(file)
+		if err != nil {
+			if !explicit && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+// ParseLimitDomain parses the domain field of a limits.conf entry
+func ParseLimitDomain(domain string) (LimitDomain, error) {
+	switch {
+	case domain == "":
+		return LimitDomain{}, fmt.Errorf("empty domain")
+	case domain == "*":
+		return LimitDomain{Kind: LimitDomainWildcard}, nil
+	case domain == "%":
+		return LimitDomain{Kind: LimitDomainLoginGroup}, nil
+	case strings.HasPrefix(domain, "%:"):
+		gid, err := strconv.Atoi(domain[2:])
+		if err != nil || gid < 0 {
+			return LimitDomain{}, fmt.Errorf("invalid gid in domain '%s'", domain)
+		}
+		return LimitDomain{Kind: LimitDomainLoginGroup, Min: gid, Max: gid}, nil
+	case strings.HasPrefix(domain, "%"):
+		return LimitDomain{Kind: LimitDomainLoginGroup, Name: domain[1:]}, nil
+	case strings.HasPrefix(domain, "@") && strings.Contains(domain, ":"):
+		return parseLimitRange(domain, domain[1:], LimitDomainGIDRange)
+	case strings.HasPrefix(domain, "@"):
+		if len(domain) == 1 {
+			return LimitDomain{}, fmt.Errorf("missing group name in domain '%s'", domain)
+		}
+		return LimitDomain{Kind: LimitDomainGroup, Name: domain[1:]}, nil
+	case strings.Contains(domain, ":"):
+		return parseLimitRange(domain, domain, LimitDomainUIDRange)
+	default:
+		return LimitDomain{Kind: LimitDomainUser, Name: domain}, nil
+	}
+}
+
+// parseLimitRange parses a min:max id range; a missing minimum means an exact match on max
+func parseLimitRange(domain, spec string, kind LimitDomainKind) (LimitDomain, error) {
+	minStr, maxStr, _ := strings.Cut(spec, ":")
+	parsed := LimitDomain{Kind: kind, Min: -1, Max: -1}
+
+	parse := func(s string) (int, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid id range in domain '%s'", domain)
+		}
+		return n, nil
+	}
+
+	var err error
+	switch {
+	case minStr == "" && maxStr == "":
+		return LimitDomain{}, fmt.Errorf("empty id range in domain '%s'", domain)
+	case minStr == "":
+		if parsed.Max, err = parse(maxStr); err != nil {
+			return LimitDomain{}, err
+		}
+		parsed.Min = parsed.Max
+	default:
+		if parsed.Min, err = parse(minStr); err != nil {
+			return LimitDomain{}, err
+		}
+		if maxStr != "" {
+			if parsed.Max, err = parse(maxStr); err != nil {
+				return LimitDomain{}, err
+			}
+			if parsed.Max < parsed.Min {
+				return LimitDomain{}, fmt.Errorf("id range in domain '%s' ends before it starts", domain)
+			}
+		}
+	}
+	return parsed, nil
+}
+
+// Validate checks the entry's domain, type, item and value against limits.conf(5)
+func (e LimitEntry) Validate() error {
+	domain, err := ParseLimitDomain(e.Domain)
+	if err != nil {
+		return err
+	}
+	if domain.Kind == LimitDomainLoginGroup && e.Item != LimitMaxlogins {
+		return fmt.Errorf("domain '%s' only applies to %s", e.Domain, LimitMaxlogins)
+	}
+	if !IsValidLimitType(string(e.Type)) {
+		return fmt.Errorf("unknown type '%s', expected soft, hard or -", e.Type)
+	}
+	if !IsValidLimitItem(string(e.Item)) {
+		return fmt.Errorf("unknown item '%s'", e.Item)
+	}
+	return validateLimitValue(e.Item, e.Value)
+}
+
+// validateLimitValue checks a value for an item. Every item but priority, nice and
+// nonewprivs accepts -1, unlimited or infinity for no limit.
+func validateLimitValue(item LimitItem, value string) error {
+	n, err := strconv.Atoi(value)
+
+	switch item {
+	case LimitPriority:
+		if err != nil {
+			return fmt.Errorf("%s requires an integer value, got '%s'", item, value)
+		}
+	case LimitNice:
+		if err != nil || n < -20 || n > 19 {
+			return fmt.Errorf("%s requires an integer in [-20, 19], got '%s'", item, value)
+		}
+	case LimitNonewprivs:
+		if err != nil || (n != 0 && n != 1) {
+			return fmt.Errorf("%s requires 0 or 1, got '%s'", item, value)
+		}
+	default:
+		if value == "unlimited" || value == "infinity" || value == "-1" {
+			return nil
+		}
+		if err != nil || n < 0 {
+			return fmt.Errorf("%s requires a non-negative integer, -1, unlimited or infinity, got '%s'", item, value)
+		}
+	}
+	return nil
+}
+
+// Validate checks every entry, returning one warning per invalid entry
+func (c *LimitsConfig) Validate() []string {
+	var warnings []string
+	for i, entry := range c.Entries {
+		if err := entry.Validate(); err != nil {
+			warnings = append(warnings, fmt.Sprintf("Entry %d (line %d): %v", i, entry.LineNumber, err))
+		}
+	}
+	return warnings
+}
+
+// Find returns the indices of entries for a domain and item; an empty item matches any item
+func (c *LimitsConfig) Find(domain string, item LimitItem) []int {
+	var indices []int
+	for i, entry := range c.Entries {
+		if entry.Domain == domain && (item == "" || entry.Item == item) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// Set makes domain have value for item and type, updating the first matching entry or
+// appending a new one. It reports whether anything changed.
+func (c *LimitsConfig) Set(domain string, limitType LimitType, item LimitItem, value string) (bool, error) {
+	entry := LimitEntry{Domain: domain, Type: limitType, Item: item, Value: value}
+	if err := entry.Validate(); err != nil {
+		return false, err
+	}
+
+	for i := range c.Entries {
+		existing := &c.Entries[i]
+		if existing.Domain == domain && existing.Type == limitType && existing.Item == item {
+			if existing.Value == value {
+				return false, nil
+			}
+			existing.Value = value
+			return true, nil
+		}
+	}
+	c.Entries = append(c.Entries, entry)
+	return true, nil
+}
+
+// Remove deletes the entries for a domain, type and item and returns how many were removed.
+// An empty type or item matches any.
+func (c *LimitsConfig) Remove(domain string, limitType LimitType, item LimitItem) int {
+	before := len(c.Entries)
+	c.Entries = slices.DeleteFunc(c.Entries, func(entry LimitEntry) bool {
+		return entry.Domain == domain &&
+			(limitType == "" || entry.Type == limitType) &&
+			(item == "" || entry.Item == item)
+	})
+	return before - len(c.Entries)
+}
+
+// Write writes the configuration in limits.conf syntax: standalone comments first, then
+// the entries with aligned columns
+func (c *LimitsConfig) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, c.String()); err != nil {
+		return fmt.Errorf("error writing limits configuration: %w", err)
+	}
+	return nil
+}
+
+// String returns the configuration in limits.conf syntax
+func (c *LimitsConfig) String() string {
+	var b strings.Builder
+	for _, comment := range c.Comments {
+		b.WriteString("# " + comment + "\n")
+	}
+
+	var widths [3]int
+	for _, entry := range c.Entries {
+		widths[0] = max(widths[0], len(entry.Domain))
+		widths[1] = max(widths[1], len(entry.Type))
+		widths[2] = max(widths[2], len(entry.Item))
+	}
+	for _, entry := range c.Entries {
+		line := fmt.Sprintf("%-*s %-*s %-*s %s", widths[0], entry.Domain, widths[1], entry.Type, widths[2], entry.Item, entry.Value)
+		if entry.Comment != "" {
+			line += " # " + entry.Comment
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
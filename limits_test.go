@@ -0,0 +1,203 @@
+package pamparser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleLimits = `# /etc/security/limits.conf
+#<domain>      <type>  <item>         <value>
+*               soft    core            0
+@student        hard    nproc           20 # classroom machines
+%faculty        -       maxlogins       4
+1000:           hard    nofile          unlimited
+`
+
+func TestParseLimits(t *testing.T) {
+	config, err := ParseLimits(strings.NewReader(sampleLimits))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(config.Comments) != 2 {
+		t.Errorf("expected 2 comments, got %d", len(config.Comments))
+	}
+	want := []LimitEntry{
+		{Domain: "*", Type: LimitSoft, Item: LimitCore, Value: "0", LineNumber: 3},
+		{Domain: "@student", Type: LimitHard, Item: LimitNproc, Value: "20", Comment: "classroom machines", LineNumber: 4},
+		{Domain: "%faculty", Type: LimitBoth, Item: LimitMaxlogins, Value: "4", LineNumber: 5},
+		{Domain: "1000:", Type: LimitHard, Item: LimitNofile, Value: "unlimited", LineNumber: 6},
+	}
+	if !reflect.DeepEqual(config.Entries, want) {
+		t.Errorf("entries = %+v, want %+v", config.Entries, want)
+	}
+	if warnings := config.Validate(); len(warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+
+	if _, err := ParseLimits(strings.NewReader("* soft core\n")); err == nil {
+		t.Error("expected error for missing value")
+	}
+}
+
+func TestParseLimitDomain(t *testing.T) {
+	tests := []struct {
+		domain  string
+		want    LimitDomain
+		wantErr bool
+	}{
+		{domain: "alice", want: LimitDomain{Kind: LimitDomainUser, Name: "alice"}},
+		{domain: "@wheel", want: LimitDomain{Kind: LimitDomainGroup, Name: "wheel"}},
+		{domain: "%wheel", want: LimitDomain{Kind: LimitDomainLoginGroup, Name: "wheel"}},
+		{domain: "%", want: LimitDomain{Kind: LimitDomainLoginGroup}},
+		{domain: "%:100", want: LimitDomain{Kind: LimitDomainLoginGroup, Min: 100, Max: 100}},
+		{domain: "*", want: LimitDomain{Kind: LimitDomainWildcard}},
+		{domain: "1000:2000", want: LimitDomain{Kind: LimitDomainUIDRange, Min: 1000, Max: 2000}},
+		{domain: "1000:", want: LimitDomain{Kind: LimitDomainUIDRange, Min: 1000, Max: -1}},
+		{domain: ":0", want: LimitDomain{Kind: LimitDomainUIDRange, Min: 0, Max: 0}},
+		{domain: "@500:", want: LimitDomain{Kind: LimitDomainGIDRange, Min: 500, Max: -1}},
+		{domain: "2000:1000", wantErr: true},
+		{domain: "abc:", wantErr: true},
+		{domain: ":", wantErr: true},
+		{domain: "@", wantErr: true},
+		{domain: "%:x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			got, err := ParseLimitDomain(tt.domain)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLimitDomain() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseLimitDomain() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitEntry_Validate(t *testing.T) {
+	tests := []struct {
+		entry   LimitEntry
+		wantErr bool
+	}{
+		{LimitEntry{Domain: "*", Type: LimitSoft, Item: LimitNofile, Value: "1024"}, false},
+		{LimitEntry{Domain: "*", Type: LimitHard, Item: LimitAs, Value: "infinity"}, false},
+		{LimitEntry{Domain: "*", Type: LimitHard, Item: LimitAs, Value: "-1"}, false},
+		{LimitEntry{Domain: "*", Type: LimitBoth, Item: LimitNice, Value: "-20"}, false},
+		{LimitEntry{Domain: "*", Type: LimitBoth, Item: LimitPriority, Value: "-5"}, false},
+		{LimitEntry{Domain: "*", Type: LimitBoth, Item: LimitNonewprivs, Value: "1"}, false},
+		{LimitEntry{Domain: "*", Type: "medium", Item: LimitNofile, Value: "1024"}, true},
+		{LimitEntry{Domain: "*", Type: LimitSoft, Item: "nofiles", Value: "1024"}, true},
+		{LimitEntry{Domain: "*", Type: LimitSoft, Item: LimitNofile, Value: "lots"}, true},
+		{LimitEntry{Domain: "*", Type: LimitSoft, Item: LimitNofile, Value: "-2"}, true},
+		{LimitEntry{Domain: "*", Type: LimitSoft, Item: LimitNice, Value: "20"}, true},
+		{LimitEntry{Domain: "*", Type: LimitSoft, Item: LimitNice, Value: "unlimited"}, true},
+		{LimitEntry{Domain: "*", Type: LimitSoft, Item: LimitNonewprivs, Value: "2"}, true},
+		{LimitEntry{Domain: "%admins", Type: LimitHard, Item: LimitNproc, Value: "10"}, true},
+	}
+
+	for _, tt := range tests {
+		name := strings.Join([]string{tt.entry.Domain, string(tt.entry.Type), string(tt.entry.Item), tt.entry.Value}, " ")
+		t.Run(name, func(t *testing.T) {
+			if err := tt.entry.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLimitsConfig_Edit(t *testing.T) {
+	config, err := ParseLimits(strings.NewReader(sampleLimits))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if changed, err := config.Set("@student", LimitHard, LimitNproc, "30"); err != nil || !changed {
+		t.Errorf("Set() = %v, %v; want update", changed, err)
+	}
+	if changed, _ := config.Set("@student", LimitHard, LimitNproc, "30"); changed {
+		t.Error("expected repeated Set to be a no-op")
+	}
+	if changed, err := config.Set("@student", LimitSoft, LimitNproc, "10"); err != nil || !changed {
+		t.Errorf("Set() = %v, %v; want append", changed, err)
+	}
+	if _, err := config.Set("@student", LimitSoft, LimitNproc, "many"); err == nil {
+		t.Error("expected invalid value to be rejected")
+	}
+	if got := config.Find("@student", LimitNproc); len(got) != 2 {
+		t.Errorf("expected 2 nproc entries for @student, got %v", got)
+	}
+
+	if removed := config.Remove("@student", "", LimitNproc); removed != 2 {
+		t.Errorf("expected 2 entries removed, got %d", removed)
+	}
+
+	output := config.String()
+	wantOutput := `# /etc/security/limits.conf
+# <domain>      <type>  <item>         <value>
+*        soft core      0
+%faculty -    maxlogins 4
+1000:    hard nofile    unlimited
+`
+	if output != wantOutput {
+		t.Errorf("String() =\n%s\nwant\n%s", output, wantOutput)
+	}
+
+	reparsed, err := ParseLimits(strings.NewReader(output))
+	if err != nil || len(reparsed.Entries) != 3 {
+		t.Errorf("written output does not parse back: %v", err)
+	}
+}
+
+func TestLoadLimitsForRule(t *testing.T) {
+	root := t.TempDir()
+	write := func(path, content string) {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(DefaultLimitsFile, "* soft core 0\n")
+	write(filepath.Join(DefaultLimitsDir, "90-nproc.conf"), "* soft nproc 4096\n")
+	write(filepath.Join(DefaultLimitsDir, "10-nofile.conf"), "* soft nofile 1024\n")
+	write(filepath.Join(DefaultLimitsDir, "README"), "not a conf file\n")
+	write("/etc/security/custom.conf", "* hard nofile 2048\n")
+
+	config := mustParsePamD(t, "session required pam_limits.so\nsession required /lib/security/pam_limits.so conf=/etc/security/custom.conf\n")
+
+	configs, err := LoadLimitsForRule(config.Rules[0], root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var items []LimitItem
+	for _, c := range configs {
+		items = append(items, c.Entries[0].Item)
+	}
+	if want := []LimitItem{LimitCore, LimitNofile, LimitNproc}; !reflect.DeepEqual(items, want) {
+		t.Errorf("loaded items %v, want %v", items, want)
+	}
+
+	configs, err = LoadLimitsForRule(config.Rules[1], root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(configs) != 1 || configs[0].Entries[0].Value != "2048" {
+		t.Errorf("expected only the conf= file, got %+v", configs)
+	}
+
+	configs, err = LoadLimitsForRule(config.Rules[0], t.TempDir())
+	if err != nil || len(configs) != 0 {
+		t.Errorf("expected a missing limits.conf to be skipped, got %v, %v", configs, err)
+	}
+
+	if _, err := LoadLimitsForRule(Rule{Type: ModuleTypeSession, ModulePath: "pam_unix.so"}, root); err == nil {
+		t.Error("expected error for a rule that is not pam_limits")
+	}
+}
@@ -0,0 +1,314 @@
+package pamparser
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// Severity is how serious a diagnostic is. The values match SARIF result levels.
+type Severity string
+
+const (
+	// SeverityError is a problem that breaks the configuration or makes libpam reject a rule
+	SeverityError Severity = "error"
+	// SeverityWarning is a likely mistake or a weakness in the configuration
+	SeverityWarning Severity = "warning"
+	// SeverityNote is a suggestion
+	SeverityNote Severity = "note"
+)
+
+// LintCheck describes one kind of diagnostic
+type LintCheck struct {
+	ID          string   `json:"id"`
+	Severity    Severity `json:"severity"`
+	Summary     string   `json:"summary"`
+	Description string   `json:"description"`
+}
+
+// TextEdit replaces the lines StartLine to EndLine of a file with Text. An EndLine of
+// StartLine-1 inserts Text before StartLine without removing anything.
+type TextEdit struct {
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Text      string `json:"text"`
+}
+
+// SuggestedFix is a change that resolves a diagnostic, both as Editor operations and as
+// edits to the file. Edits is empty when the rules involved have no line numbers, such as
+// rules that were added programmatically.
+type SuggestedFix struct {
+	Description string         `json:"description"`
+	Operations  []FixOperation `json:"operations"`
+	Edits       []TextEdit     `json:"edits,omitempty"`
+}
+
+// Diagnostic is a problem found in a configuration
+type Diagnostic struct {
+	Check     string        `json:"check"` // ID of the LintCheck or compliance control
+	Severity  Severity      `json:"severity"`
+	Message   string        `json:"message"`
+	File      string        `json:"file,omitempty"`
+	Line      int           `json:"line,omitempty"`
+	RuleIndex int           `json:"rule_index"` // -1 if the diagnostic is not about a rule
+	RuleID    RuleID        `json:"rule_id,omitempty"`
+	Fix       *SuggestedFix `json:"fix,omitempty"`
+}
+
+// String renders the diagnostic as file:line: severity: message [check]
+func (d Diagnostic) String() string {
+	location := d.File
+	if location == "" {
+		location = "<config>"
+	}
+	if d.Line > 0 {
+		location += ":" + strconv.Itoa(d.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s [%s]", location, d.Severity, d.Message, d.Check)
+}
+
+// lintCatalogue lists every check Editor.Lint runs, structural checks first
+var lintCatalogue = []LintCheck{
+	{"directive-missing-type", SeverityError, "Directive has no type", "An @ directive must name its type, such as @include."},
+	{"directive-missing-target", SeverityError, "@include has no target", "@include needs the name of the file to include."},
+	{"missing-module-type", SeverityError, "Rule has no module type", "Every rule needs one of account, auth, password or session."},
+	{"missing-module-path", SeverityError, "Rule has no module path", "Every rule needs the module to load."},
+	{"invalid-module-type", SeverityError, "Unknown module type", "libpam only knows the account, auth, password and session types, optionally prefixed with '-'."},
+	{"missing-control", SeverityError, "Rule has no control", "Every rule needs a control such as required or [success=ok default=bad]."},
+	{"invalid-control", SeverityError, "Unknown control", "Simple controls are required, requisite, sufficient, optional, include and substack."},
+	{"invalid-complex-control", SeverityError, "Invalid bracketed control", "Bracketed controls map PAM return values to actions or jump counts."},
+	{"invalid-succeed-if", SeverityError, "Invalid pam_succeed_if condition", "pam_succeed_if conditions are field, operator and value triples joined by 'or'."},
+	{"service-mismatch", SeverityWarning, "Service does not match the file", "In pam.d files the service is the file name."},
+	{"missing-service", SeverityError, "Rule has no service", "Rules in pam.conf start with the service they apply to."},
+	{"nullok", SeverityWarning, "Empty passwords are allowed", "nullok lets accounts with an empty password log in without a password."},
+	{"weak-hash", SeverityWarning, "Weak password hash", "md5 and bigcrypt hashes are fast to crack; use sha512 or yescrypt."},
+	{"faillock-no-authfail", SeverityWarning, "pam_faillock does not count failures", "pam_faillock preauth only checks the tally; failures are only recorded by an authfail rule after the password check."},
+	{"auth-no-deny", SeverityWarning, "auth stack can fall through", "When every sufficient module fails and no required module follows them, the result is left to the modules before them; end the stack in pam_deny.so."},
+}
+
+// LintChecks returns the checks Editor.Lint runs
+func LintChecks() []LintCheck {
+	return slices.Clone(lintCatalogue)
+}
+
+// lintCheck returns the check with an ID
+func lintCheck(id string) (LintCheck, bool) {
+	index := slices.IndexFunc(lintCatalogue, func(c LintCheck) bool { return c.ID == id })
+	if index < 0 {
+		return LintCheck{}, false
+	}
+	return lintCatalogue[index], true
+}
+
+// diagnostic builds a diagnostic about the rule at index
+func (e *Editor) diagnostic(check string, index int, format string, args ...any) Diagnostic {
+	lint, _ := lintCheck(check)
+	d := Diagnostic{
+		Check:     check,
+		Severity:  lint.Severity,
+		Message:   fmt.Sprintf(format, args...),
+		File:      e.config.FilePath,
+		RuleIndex: index,
+	}
+	if index >= 0 && index < len(e.config.Rules) {
+		d.Line = e.config.Rules[index].LineNumber
+		d.RuleID = e.config.Rules[index].ID
+	}
+	return d
+}
+
+// Lint returns the Validate problems followed by security findings, as diagnostics
+func (e *Editor) Lint() []Diagnostic {
+	e.ensureIDs()
+	diagnostics := e.validationDiagnostics()
+	for _, indices := range e.serviceStacks() {
+		for _, i := range indices {
+			diagnostics = append(diagnostics, e.lintRule(i)...)
+		}
+		diagnostics = append(diagnostics, e.lintFaillock(indices)...)
+		diagnostics = append(diagnostics, e.lintAuthDeny(indices)...)
+	}
+	return diagnostics
+}
+
+// serviceStacks groups rule indices by service, in order of first appearance. A pam.d
+// configuration is a single group.
+func (e *Editor) serviceStacks() [][]int {
+	var groups [][]int
+	index := make(map[string]int)
+	for i, rule := range e.config.Rules {
+		g, ok := index[rule.Service]
+		if !ok {
+			g = len(groups)
+			index[rule.Service] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+// ruleSpan returns the first and last physical line of a rule
+func ruleSpan(rule Rule) (int, int) {
+	if len(rule.Fragments) > 0 {
+		return rule.LineNumber, rule.Fragments[len(rule.Fragments)-1].Line
+	}
+	return rule.LineNumber, rule.LineNumber
+}
+
+// replaceRuleFix builds a fix that rewrites a rule in place
+func replaceRuleFix(description string, old, updated Rule, ops ...FixOperation) *SuggestedFix {
+	fix := &SuggestedFix{Description: description, Operations: ops}
+	if start, end := ruleSpan(old); start > 0 {
+		fix.Edits = []TextEdit{{StartLine: start, EndLine: end, Text: describeRule(updated) + "\n"}}
+	}
+	return fix
+}
+
+// insertRuleFix builds a fix that adds a rule after another one
+func insertRuleFix(description string, after, added Rule, op FixOperation) *SuggestedFix {
+	fix := &SuggestedFix{Description: description, Operations: []FixOperation{op}}
+	if _, end := ruleSpan(after); end > 0 {
+		fix.Edits = []TextEdit{{StartLine: end + 1, EndLine: end, Text: describeRule(added) + "\n"}}
+	}
+	return fix
+}
+
+// lintRule runs the checks that concern a single rule
+func (e *Editor) lintRule(i int) []Diagnostic {
+	rule := e.config.Rules[i]
+	if rule.IsDirective || !rule.IsModule("pam_unix.so") {
+		return nil
+	}
+
+	var diagnostics []Diagnostic
+	if rule.HasArgument("nullok") || rule.HasArgument("nullok_secure") {
+		var ops []FixOperation
+		for _, arg := range []string{"nullok", "nullok_secure"} {
+			if rule.HasArgument(arg) {
+				ops = append(ops, FixOperation{Action: FixRemoveArgument, Target: rule.ID, Argument: arg})
+			}
+		}
+		updated := rule
+		updated.Arguments = slices.DeleteFunc(slices.Clone(rule.Arguments), func(arg string) bool {
+			return arg == "nullok" || arg == "nullok_secure"
+		})
+		d := e.diagnostic("nullok", i, "pam_unix.so allows empty passwords")
+		d.Fix = replaceRuleFix("Remove nullok", rule, updated, ops...)
+		diagnostics = append(diagnostics, d)
+	}
+
+	if GetNormalizedModuleType(rule.Type) == ModuleTypePassword {
+		for _, hash := range []string{"md5", "bigcrypt"} {
+			if !rule.HasArgument(hash) {
+				continue
+			}
+			updated := rule
+			updated.Arguments = slices.Clone(rule.Arguments)
+			updated.Arguments[slices.Index(updated.Arguments, hash)] = "sha512"
+			d := e.diagnostic("weak-hash", i, "pam_unix.so hashes passwords with %s", hash)
+			op := FixOperation{Action: FixReplaceArgument, Target: rule.ID, Argument: hash, Value: "sha512"}
+			d.Fix = replaceRuleFix("Replace "+hash+" with sha512", rule, updated, op)
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	return diagnostics
+}
+
+// authRules returns the indices of the auth rules among indices
+func (e *Editor) authRules(indices []int) []int {
+	var auth []int
+	for _, i := range indices {
+		rule := e.config.Rules[i]
+		if !rule.IsDirective && GetNormalizedModuleType(rule.Type) == ModuleTypeAuth {
+			auth = append(auth, i)
+		}
+	}
+	return auth
+}
+
+// lintFaillock reports a pam_faillock preauth rule without an authfail rule. The fix adds
+// the authfail rule after the first module that checks a password.
+func (e *Editor) lintFaillock(indices []int) []Diagnostic {
+	auth := e.authRules(indices)
+	preauth := -1
+	for _, i := range auth {
+		rule := e.config.Rules[i]
+		if !rule.IsModule(FaillockModule) {
+			continue
+		}
+		if rule.HasArgument("authfail") {
+			return nil
+		}
+		if preauth < 0 && rule.HasArgument("preauth") {
+			preauth = i
+		}
+	}
+	if preauth < 0 {
+		return nil
+	}
+
+	after := preauth
+	for _, i := range auth {
+		if i > preauth && authFactorModules[e.config.Rules[i].ModuleName()] == FactorPassword {
+			after = i
+			break
+		}
+	}
+	die := Control{Complex: map[ReturnValue]any{ReturnDefault: ActionDie}, Order: []ReturnValue{ReturnDefault}}
+	added := Rule{
+		Service:    e.config.Rules[preauth].Service,
+		Type:       ModuleTypeAuth,
+		Control:    die,
+		ModulePath: e.config.Rules[preauth].ModulePath,
+		Arguments:  []string{"authfail"},
+	}
+
+	d := e.diagnostic("faillock-no-authfail", preauth, "pam_faillock.so preauth has no matching authfail rule")
+	op := FixOperation{Action: FixInsertAfter, Target: e.config.Rules[after].ID, Rule: &added}
+	d.Fix = insertRuleFix("Add pam_faillock.so authfail", e.config.Rules[after], added, op)
+	return []Diagnostic{d}
+}
+
+// lintAuthDeny reports an auth stack whose result depends on its sufficient modules: one
+// where no module after the last sufficient (or success=done) one fails the stack, so that
+// when they all fail the result is left to the modules before them. Stacks with includes are
+// skipped because the included file may end in pam_deny.so.
+func (e *Editor) lintAuthDeny(indices []int) []Diagnostic {
+	auth := e.authRules(indices)
+	if len(auth) == 0 {
+		return nil
+	}
+	lastSufficient := -1
+	for n, i := range auth {
+		rule := e.config.Rules[i]
+		if isIncludeControl(rule.Control) {
+			return nil
+		}
+		if _, sufficient := controlBlocks(rule.Control); sufficient {
+			lastSufficient = n
+		}
+	}
+	for _, i := range indices {
+		if e.config.Rules[i].IsDirective {
+			return nil
+		}
+	}
+	if lastSufficient < 0 {
+		return nil
+	}
+	for _, i := range auth[lastSufficient+1:] {
+		if required, _ := controlBlocks(e.config.Rules[i].Control); required {
+			return nil
+		}
+	}
+
+	last := e.config.Rules[auth[len(auth)-1]]
+	required := ControlRequired
+	added := Rule{Service: last.Service, Type: ModuleTypeAuth, Control: Control{Simple: &required}, ModulePath: "pam_deny.so"}
+
+	d := e.diagnostic("auth-no-deny", auth[len(auth)-1], "auth stack has sufficient modules but does not end in pam_deny.so")
+	op := FixOperation{Action: FixAppendRule, Rule: &added}
+	d.Fix = insertRuleFix("Add auth required pam_deny.so", last, added, op)
+	return []Diagnostic{d}
+}
@@ -0,0 +1,109 @@
+package pamparser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEditor_Lint(t *testing.T) {
+	config := mustParsePamD(t, `auth     required   pam_env.so
+auth     required   pam_faillock.so preauth
+auth     sufficient pam_unix.so nullok \
+                    try_first_pass
+auth     optional   pam_gnome_keyring.so
+password required   pam_unix.so md5 use_authtok
+`)
+	config.FilePath = "/etc/pam.d/login"
+	diagnostics := NewEditor(config).Lint()
+
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"/etc/pam.d/login:3: warning: pam_unix.so allows empty passwords [nullok]",
+		"/etc/pam.d/login:6: warning: pam_unix.so hashes passwords with md5 [weak-hash]",
+		"/etc/pam.d/login:2: warning: pam_faillock.so preauth has no matching authfail rule [faillock-no-authfail]",
+		"/etc/pam.d/login:5: warning: auth stack has sufficient modules but does not end in pam_deny.so [auth-no-deny]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("diagnostics =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	wantEdits := [][]TextEdit{
+		{{StartLine: 3, EndLine: 4, Text: "auth sufficient pam_unix.so try_first_pass\n"}},
+		{{StartLine: 6, EndLine: 6, Text: "password required pam_unix.so sha512 use_authtok\n"}},
+		{{StartLine: 5, EndLine: 4, Text: "auth [default=die] pam_faillock.so authfail\n"}},
+		{{StartLine: 6, EndLine: 5, Text: "auth required pam_deny.so\n"}},
+	}
+	for i, d := range diagnostics {
+		if d.Fix == nil || !reflect.DeepEqual(d.Fix.Edits, wantEdits[i]) {
+			t.Errorf("%s: fix = %+v, want edits %+v", d.Check, d.Fix, wantEdits[i])
+		}
+	}
+}
+
+func TestEditor_Lint_Clean(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"hardened", `auth required pam_faillock.so preauth
+auth sufficient pam_unix.so
+auth [default=die] pam_faillock.so authfail
+auth required pam_deny.so
+password sufficient pam_unix.so yescrypt
+`},
+		{"no sufficient modules", "auth required pam_unix.so\n"},
+		{"required module after sufficient", "auth sufficient pam_rootok.so\nauth required pam_unix.so\n"},
+		{"jump over requisite deny", "auth [success=1 default=ignore] pam_unix.so\nauth requisite pam_deny.so\nauth required pam_permit.so\n"},
+		{"include may end in deny", "auth sufficient pam_rootok.so\nauth include system-auth\n"},
+		{"@include may end in deny", "auth sufficient pam_rootok.so\n@include common-auth\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diagnostics := NewEditor(mustParsePamD(t, tt.text)).Lint(); len(diagnostics) != 0 {
+				t.Errorf("unexpected diagnostics: %v", diagnostics)
+			}
+		})
+	}
+}
+
+func TestEditor_Lint_PamConf(t *testing.T) {
+	config, err := NewParser().Parse(strings.NewReader(`login auth sufficient pam_unix.so
+login auth required   pam_deny.so
+sshd  auth sufficient pam_unix.so
+sshd  auth optional   pam_succeed_if.so uid
+`), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	diagnostics := NewEditor(config).Lint()
+	var checks []string
+	for _, d := range diagnostics {
+		checks = append(checks, d.Check)
+	}
+	// Only sshd falls through; validation problems come first
+	if want := []string{"invalid-succeed-if", "auth-no-deny"}; !reflect.DeepEqual(checks, want) {
+		t.Fatalf("checks = %v, want %v", checks, want)
+	}
+	if d := diagnostics[0]; d.Severity != SeverityError || d.RuleIndex != 3 || !strings.HasPrefix(d.Message, "pam_succeed_if.so: ") {
+		t.Errorf("validation diagnostic = %+v", d)
+	}
+	if text := diagnostics[1].Fix.Edits[0].Text; text != "sshd auth required pam_deny.so\n" {
+		t.Errorf("fix text = %q", text)
+	}
+}
+
+func TestEditor_Lint_AddedRules(t *testing.T) {
+	editor := NewEditor(&Config{IsPamD: true})
+	editor.AddRule(Rule{Type: ModuleTypeAuth, Control: Control{Simple: ptrControlType(ControlRequired)}, ModulePath: "pam_unix.so", Arguments: []string{"nullok"}})
+
+	diagnostics := editor.Lint()
+	if len(diagnostics) != 1 || diagnostics[0].Fix == nil || len(diagnostics[0].Fix.Edits) != 0 {
+		t.Errorf("expected a fix without edits for a rule with no line number, got %+v", diagnostics)
+	}
+}
@@ -0,0 +1,464 @@
+package pamparser
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// UpgradeSuffixes lists the suffixes package managers use for new versions of locally modified files
+var UpgradeSuffixes = []string{".rpmnew", ".dpkg-dist", ".ucf-dist"}
+
+// MergeConflictKind classifies a three-way merge conflict
+type MergeConflictKind string
+
+const (
+	// ConflictControl means both sides changed a rule's control differently
+	ConflictControl MergeConflictKind = "control"
+	// ConflictModulePath means both sides changed a rule's module path or include target differently
+	ConflictModulePath MergeConflictKind = "module_path"
+	// ConflictArgument means both sides changed the same module argument differently
+	ConflictArgument MergeConflictKind = "argument"
+	// ConflictModifiedRemoved means one side modified a rule the other side removed
+	ConflictModifiedRemoved MergeConflictKind = "modified_removed"
+)
+
+// MergeConflict describes a change that could not be merged automatically.
+// The merged configuration keeps the local (ours) version of the conflicting rule or field.
+type MergeConflict struct {
+	Kind        MergeConflictKind `json:"kind"`
+	Description string            `json:"description"`
+	Argument    string            `json:"argument,omitempty"`
+	Base        *Rule             `json:"base,omitempty"`
+	Ours        *Rule             `json:"ours,omitempty"`
+	Theirs      *Rule             `json:"theirs,omitempty"`
+	Index       int               `json:"index"` // position of the affected rule in the merged configuration
+}
+
+// MergeResult is the outcome of a three-way merge
+type MergeResult struct {
+	Config    *Config         `json:"config"`
+	Conflicts []MergeConflict `json:"conflicts,omitempty"`
+}
+
+// HasConflicts reports whether the merge produced any conflicts
+func (r *MergeResult) HasConflicts() bool {
+	return len(r.Conflicts) > 0
+}
+
+// UpgradeCandidate pairs a live configuration file with a package-shipped new version
+type UpgradeCandidate struct {
+	Path    string `json:"path"`     // the locally modified file, e.g. /etc/pam.d/sshd
+	NewPath string `json:"new_path"` // the shipped file, e.g. /etc/pam.d/sshd.rpmnew
+	Suffix  string `json:"suffix"`
+}
+
+// mergeEntry is a rule in the merged output together with the base rule it derives from
+type mergeEntry struct {
+	rule    Rule
+	baseIdx int
+	id      int
+}
+
+// pendingConflict is a conflict whose merged position is resolved after assembly
+type pendingConflict struct {
+	conflict MergeConflict
+	entryID  int
+}
+
+// merger holds the state of a three-way merge
+type merger struct {
+	base, ours, theirs []Rule
+	conflicts          []pendingConflict
+	nextID             int
+	withService        bool
+}
+
+// Merge performs a three-way merge of PAM configurations at rule granularity.
+// Base is the configuration both sides started from, ours holds local edits and theirs is
+// the new upstream version. Upstream ordering is kept; locally added rules are placed after
+// the rule that precedes them locally, and local argument tweaks are preserved.
+func Merge(base, ours, theirs *Config) *MergeResult {
+	if base == nil {
+		base = &Config{}
+	}
+	if ours == nil {
+		ours = &Config{}
+	}
+	if theirs == nil {
+		theirs = &Config{}
+	}
+
+	m := &merger{
+		base:        base.Rules,
+		ours:        ours.Rules,
+		theirs:      theirs.Rules,
+		withService: !base.IsPamD && !ours.IsPamD && !theirs.IsPamD,
+	}
+
+	baseToOurs := matchRules(m.base, m.ours, m.withService)
+	baseToTheirs := matchRules(m.base, m.theirs, m.withService)
+	oursToBase := invertPairs(baseToOurs)
+	theirsToBase := invertPairs(baseToTheirs)
+
+	var entries []mergeEntry
+	consumedOurs := make(map[int]bool)
+
+	// Walk upstream in order, merging rules that exist in base
+	for j, theirRule := range m.theirs {
+		bi, inBase := theirsToBase[j]
+		if !inBase {
+			// Added upstream; skip an identical local addition
+			for oi, ourRule := range m.ours {
+				if _, ok := oursToBase[oi]; !ok && !consumedOurs[oi] && rulesIdentical(ourRule, theirRule, m.withService) {
+					consumedOurs[oi] = true
+					break
+				}
+			}
+			entries = append(entries, m.newEntry(theirRule, -1))
+			continue
+		}
+
+		baseRule := m.base[bi]
+		oi, inOurs := baseToOurs[bi]
+		if !inOurs {
+			if rulesIdentical(baseRule, theirRule, m.withService) {
+				continue // removed locally, unchanged upstream
+			}
+			entry := m.newEntry(theirRule, bi)
+			m.addConflict(entry.id, MergeConflict{
+				Kind:        ConflictModifiedRemoved,
+				Description: fmt.Sprintf("%s: removed locally but modified upstream", describeRuleKey(baseRule)),
+				Base:        rulePtr(baseRule),
+				Theirs:      rulePtr(theirRule),
+			})
+			entries = append(entries, entry)
+			continue
+		}
+
+		entry := m.newEntry(Rule{}, bi)
+		entry.rule = m.mergeRule(entry.id, baseRule, m.ours[oi], theirRule)
+		entries = append(entries, entry)
+	}
+
+	present := make(map[int]bool)
+	for _, entry := range entries {
+		if entry.baseIdx >= 0 {
+			present[entry.baseIdx] = true
+		}
+	}
+
+	// Collect local rules to place: local additions and rules upstream removed but we modified
+	pending := make(map[int][]mergeEntry) // keyed by anchor base index, -1 for the start
+	anchor := -1
+	for oi, ourRule := range m.ours {
+		bi, inBase := oursToBase[oi]
+		if inBase && present[bi] {
+			anchor = bi
+			continue
+		}
+		if consumedOurs[oi] {
+			continue
+		}
+		if inBase {
+			// upstream removed this rule
+			if rulesIdentical(m.base[bi], ourRule, m.withService) {
+				continue
+			}
+			entry := m.newEntry(ourRule, -1)
+			m.addConflict(entry.id, MergeConflict{
+				Kind:        ConflictModifiedRemoved,
+				Description: fmt.Sprintf("%s: modified locally but removed upstream", describeRuleKey(ourRule)),
+				Base:        rulePtr(m.base[bi]),
+				Ours:        rulePtr(ourRule),
+			})
+			pending[anchor] = append(pending[anchor], entry)
+			continue
+		}
+		pending[anchor] = append(pending[anchor], m.newEntry(ourRule, -1))
+	}
+
+	// Assemble
+	final := append([]mergeEntry(nil), pending[-1]...)
+	for _, entry := range entries {
+		final = append(final, entry)
+		if entry.baseIdx >= 0 {
+			final = append(final, pending[entry.baseIdx]...)
+		}
+	}
+
+	merged := &Config{
+		FilePath: ours.FilePath,
+		Comments: mergeComments(base.Comments, ours.Comments, theirs.Comments),
+		IsPamD:   theirs.IsPamD || ours.IsPamD,
+		Rules:    make([]Rule, 0, len(final)),
+	}
+	positions := make(map[int]int, len(final))
+	for i, entry := range final {
+		merged.Rules = append(merged.Rules, entry.rule)
+		positions[entry.id] = i
+	}
+
+	result := &MergeResult{Config: merged}
+	for _, p := range m.conflicts {
+		p.conflict.Index = positions[p.entryID]
+		result.Conflicts = append(result.Conflicts, p.conflict)
+	}
+	return result
+}
+
+// newEntry creates a merge entry with a unique id
+func (m *merger) newEntry(rule Rule, baseIdx int) mergeEntry {
+	m.nextID++
+	return mergeEntry{rule: rule, baseIdx: baseIdx, id: m.nextID}
+}
+
+// addConflict records a conflict for the given entry
+func (m *merger) addConflict(entryID int, conflict MergeConflict) {
+	m.conflicts = append(m.conflicts, pendingConflict{conflict: conflict, entryID: entryID})
+}
+
+// mergeRule merges a rule that exists on all three sides, field by field
+func (m *merger) mergeRule(entryID int, base, ours, theirs Rule) Rule {
+	merged := theirs
+
+	conflict := func(kind MergeConflictKind, argument, format string, args ...any) {
+		m.addConflict(entryID, MergeConflict{
+			Kind:        kind,
+			Description: fmt.Sprintf(format, args...),
+			Argument:    argument,
+			Base:        rulePtr(base),
+			Ours:        rulePtr(ours),
+			Theirs:      rulePtr(theirs),
+		})
+	}
+	label := describeRuleKey(ours)
+
+	w := NewWriter()
+	switch {
+	case Equivalent(ours.Control, base.Control):
+		merged.Control = theirs.Control
+	case Equivalent(theirs.Control, base.Control), Equivalent(ours.Control, theirs.Control):
+		merged.Control = ours.Control
+	default:
+		merged.Control = ours.Control
+		conflict(ConflictControl, "", "%s: control changed to %s locally and %s upstream",
+			label, w.formatControl(ours.Control), w.formatControl(theirs.Control))
+	}
+
+	pick := func(b, o, t string) (string, bool) {
+		switch {
+		case o == b:
+			return t, false
+		case t == b, o == t:
+			return o, false
+		default:
+			return o, true
+		}
+	}
+
+	var conflicted bool
+	if merged.ModulePath, conflicted = pick(base.ModulePath, ours.ModulePath, theirs.ModulePath); conflicted {
+		conflict(ConflictModulePath, "", "%s: module path changed to %s locally and %s upstream", label, ours.ModulePath, theirs.ModulePath)
+	}
+	if merged.DirectiveTarget, conflicted = pick(base.DirectiveTarget, ours.DirectiveTarget, theirs.DirectiveTarget); conflicted {
+		conflict(ConflictModulePath, "", "%s: target changed to %s locally and %s upstream", label, ours.DirectiveTarget, theirs.DirectiveTarget)
+	}
+	merged.Comment, _ = pick(base.Comment, ours.Comment, theirs.Comment)
+
+	arguments, argConflicts, positionalConflict := mergeArguments(base.Arguments, ours.Arguments, theirs.Arguments)
+	merged.Arguments = arguments
+	if positionalConflict {
+		conflict(ConflictArgument, "", "%s: arguments changed to '%s' locally and '%s' upstream", label,
+			strings.Join(positionalArguments(ours.Arguments), " "), strings.Join(positionalArguments(theirs.Arguments), " "))
+	}
+	for _, name := range argConflicts {
+		conflict(ConflictArgument, name, "%s: argument %s changed differently locally and upstream", label, name)
+	}
+
+	return merged
+}
+
+// isKeyValueArgument reports whether an argument is a name=value setting, which can be
+// merged by name wherever it appears in the list
+func isKeyValueArgument(arg string) bool {
+	name, _, ok := strings.Cut(arg, "=")
+	return ok && name != ""
+}
+
+// argumentIndex maps the names of name=value arguments to their full argument text
+func argumentIndex(args []string) map[string]string {
+	index := make(map[string]string, len(args))
+	for _, arg := range args {
+		if !isKeyValueArgument(arg) {
+			continue
+		}
+		name := argumentName(arg)
+		if _, exists := index[name]; !exists {
+			index[name] = arg
+		}
+	}
+	return index
+}
+
+// positionalArguments returns the arguments that are not name=value settings, in order
+func positionalArguments(args []string) []string {
+	return slices.DeleteFunc(slices.Clone(args), isKeyValueArgument)
+}
+
+// mergeArguments merges module arguments. Arguments that are not name=value, such as flags
+// and pam_succeed_if conditions, can depend on their position, so they are merged as one
+// list: the side that changed them wins, and a change on both sides is a conflict that keeps
+// the local list. name=value arguments are then merged by name on top of that list. It
+// returns the names of conflicting name=value arguments and whether the rest conflicted.
+func mergeArguments(base, ours, theirs []string) ([]string, []string, bool) {
+	basePos, oursPos, theirsPos := positionalArguments(base), positionalArguments(ours), positionalArguments(theirs)
+	merged := slices.Clone(theirs)
+	positionalConflict := false
+	switch {
+	case slices.Equal(oursPos, basePos):
+	case slices.Equal(theirsPos, basePos), slices.Equal(oursPos, theirsPos):
+		merged = slices.Clone(ours)
+	default:
+		merged = slices.Clone(ours)
+		positionalConflict = true
+	}
+
+	baseIdx, oursIdx, theirsIdx := argumentIndex(base), argumentIndex(ours), argumentIndex(theirs)
+	var names []string
+	for _, args := range [][]string{ours, theirs, base} {
+		for _, arg := range args {
+			if name := argumentName(arg); isKeyValueArgument(arg) && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	var conflicts []string
+	for _, name := range names {
+		// an absent argument is "", so additions and removals are changes like any other
+		value := theirsIdx[name]
+		switch b, o, t := baseIdx[name], oursIdx[name], theirsIdx[name]; {
+		case o == b:
+		case t == b, o == t:
+			value = o
+		default:
+			value = o
+			conflicts = append(conflicts, name)
+		}
+
+		index := slices.IndexFunc(merged, func(arg string) bool {
+			return isKeyValueArgument(arg) && argumentName(arg) == name
+		})
+		switch {
+		case index >= 0 && value == "":
+			merged = slices.Delete(merged, index, index+1)
+		case index >= 0:
+			merged[index] = value
+		case value != "":
+			merged = append(merged, value)
+		}
+	}
+	return merged, conflicts, positionalConflict
+}
+
+// mergeComments merges standalone comments, keeping upstream comments and local additions
+func mergeComments(base, ours, theirs []string) []string {
+	merged := append([]string(nil), theirs...)
+	for _, comment := range ours {
+		if !slices.Contains(base, comment) && !slices.Contains(merged, comment) {
+			merged = append(merged, comment)
+		}
+	}
+	return slices.DeleteFunc(merged, func(comment string) bool {
+		return slices.Contains(base, comment) && !slices.Contains(ours, comment)
+	})
+}
+
+// invertPairs reverses an index mapping
+func invertPairs(pairs map[int]int) map[int]int {
+	inverse := make(map[int]int, len(pairs))
+	for k, v := range pairs {
+		inverse[v] = k
+	}
+	return inverse
+}
+
+// rulePtr returns a pointer to a copy of the rule
+func rulePtr(rule Rule) *Rule {
+	return &rule
+}
+
+// FindUpgradeCandidates lists files in a pam.d directory that have a package-shipped
+// sibling (.rpmnew, .dpkg-dist or .ucf-dist) waiting to be merged
+func FindUpgradeCandidates(pamDDir string) ([]UpgradeCandidate, error) {
+	files, err := ListPamDFiles(pamDDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []UpgradeCandidate
+	for _, file := range files {
+		for _, suffix := range UpgradeSuffixes {
+			live, ok := strings.CutSuffix(file, suffix)
+			if !ok || filepath.Base(live) == "" {
+				continue
+			}
+			if !slices.Contains(files, live) {
+				continue // no local file to merge into
+			}
+			candidates = append(candidates, UpgradeCandidate{Path: live, NewPath: file, Suffix: suffix})
+		}
+	}
+
+	return candidates, nil
+}
+
+// isUpgradeSibling reports whether the file name carries a package manager upgrade suffix
+func isUpgradeSibling(path string) bool {
+	for _, suffix := range UpgradeSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// pamDServiceName returns the service a file in a pam.d directory configures: its name,
+// without the suffix of a package-shipped sibling such as sshd.rpmnew. It returns "" for
+// files outside a pam.d directory.
+func pamDServiceName(filePath string) string {
+	if !strings.Contains(filePath, "/pam.d/") {
+		return ""
+	}
+	name := filepath.Base(filePath)
+	for _, suffix := range UpgradeSuffixes {
+		if service, ok := strings.CutSuffix(name, suffix); ok {
+			return service
+		}
+	}
+	return name
+}
+
+// MergeFiles performs a three-way merge of PAM configuration files. The base file is the
+// previously shipped version, ours is the locally modified file and theirs is the new shipped
+// version (typically the .rpmnew, .dpkg-dist or .ucf-dist sibling).
+func (fm *FileManager) MergeFiles(basePath, oursPath, theirsPath string) (*MergeResult, error) {
+	base, err := fm.LoadFromFile(basePath)
+	if err != nil {
+		return nil, err
+	}
+	ours, err := fm.LoadFromFile(oursPath)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := fm.LoadFromFile(theirsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := Merge(base, ours, theirs)
+	result.Config.FilePath = oursPath
+	return result, nil
+}
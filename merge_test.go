@@ -0,0 +1,248 @@
+package pamparser
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func ruleLines(config *Config) []string {
+	w := NewWriter()
+	w.MaxLineLength = 0
+	lines := make([]string, 0, len(config.Rules))
+	for _, rule := range config.Rules {
+		lines = append(lines, w.formatRule(rule))
+	}
+	return lines
+}
+
+func TestMerge_Clean(t *testing.T) {
+	base := mustParsePamD(t, `auth required pam_env.so
+auth required pam_unix.so try_first_pass
+account required pam_unix.so
+session required pam_limits.so
+`)
+	ours := mustParsePamD(t, `auth required pam_env.so envfile=/etc/environment.local
+auth required pam_faillock.so preauth deny=5
+auth required pam_unix.so try_first_pass audit
+account required pam_unix.so
+session required pam_limits.so
+`)
+	theirs := mustParsePamD(t, `auth required pam_env.so readenv=1
+auth required pam_unix.so try_first_pass
+account required pam_unix.so
+account required pam_nologin.so
+session optional pam_limits.so
+`)
+
+	result := Merge(base, ours, theirs)
+	if result.HasConflicts() {
+		t.Fatalf("unexpected conflicts: %+v", result.Conflicts)
+	}
+
+	expected := []string{
+		"auth required pam_env.so readenv=1 envfile=/etc/environment.local",
+		"auth required pam_faillock.so preauth deny=5",
+		"auth required pam_unix.so try_first_pass audit",
+		"account required pam_unix.so",
+		"account required pam_nologin.so",
+		"session optional pam_limits.so",
+	}
+	if got := ruleLines(result.Config); !slices.Equal(got, expected) {
+		t.Errorf("unexpected merge result:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestMerge_LocalRemovals(t *testing.T) {
+	base := mustParsePamD(t, `auth required pam_unix.so nullok try_first_pass
+auth optional pam_gnome_keyring.so
+`)
+	ours := mustParsePamD(t, `auth required pam_unix.so try_first_pass
+`)
+	theirs := mustParsePamD(t, `auth required pam_unix.so nullok try_first_pass
+auth optional pam_gnome_keyring.so
+`)
+
+	result := Merge(base, ours, theirs)
+	if result.HasConflicts() {
+		t.Fatalf("unexpected conflicts: %+v", result.Conflicts)
+	}
+	expected := []string{"auth required pam_unix.so try_first_pass"}
+	if got := ruleLines(result.Config); !slices.Equal(got, expected) {
+		t.Errorf("unexpected merge result: %v", got)
+	}
+}
+
+func TestMerge_Conflicts(t *testing.T) {
+	base := mustParsePamD(t, `auth required pam_unix.so rounds=5000
+auth required pam_env.so
+account required pam_unix.so
+password required pam_pwquality.so retry=3
+`)
+	ours := mustParsePamD(t, `auth sufficient pam_unix.so rounds=10000
+auth required pam_env.so readenv=1
+account required pam_unix.so
+`)
+	theirs := mustParsePamD(t, `auth requisite pam_unix.so rounds=8000
+account required pam_unix.so
+password required pam_pwquality.so retry=5
+`)
+
+	result := Merge(base, ours, theirs)
+
+	kinds := make(map[MergeConflictKind]int)
+	for _, conflict := range result.Conflicts {
+		kinds[conflict.Kind]++
+	}
+	if kinds[ConflictControl] != 1 || kinds[ConflictArgument] != 1 || kinds[ConflictModifiedRemoved] != 2 {
+		t.Fatalf("unexpected conflicts: %+v", result.Conflicts)
+	}
+
+	// Local versions win in the merged output
+	lines := ruleLines(result.Config)
+	if lines[0] != "auth sufficient pam_unix.so rounds=10000" {
+		t.Errorf("expected local control and argument to be kept, got %q", lines[0])
+	}
+	if !slices.Contains(lines, "auth required pam_env.so readenv=1") {
+		t.Errorf("expected locally modified rule removed upstream to be kept, got %v", lines)
+	}
+	if !slices.Contains(lines, "password required pam_pwquality.so retry=5") {
+		t.Errorf("expected upstream-modified rule removed locally to be kept, got %v", lines)
+	}
+
+	for _, conflict := range result.Conflicts {
+		rule := result.Config.Rules[conflict.Index]
+		if conflict.Kind == ConflictArgument && (!rule.IsModule("pam_unix.so") || conflict.Argument != "rounds") {
+			t.Errorf("argument conflict points at wrong rule or argument: %+v", conflict)
+		}
+	}
+}
+
+func TestMergeArguments(t *testing.T) {
+	tests := []struct {
+		name       string
+		base       string
+		ours       string
+		theirs     string
+		expected   string
+		conflicts  []string
+		positional bool
+	}{
+		{
+			name: "condition changed on both sides", base: "uid >= 1000 quiet",
+			ours: "uid >= 500 quiet", theirs: "uid >= 1000 quiet_success",
+			expected: "uid >= 500 quiet", positional: true,
+		},
+		{
+			name: "condition changed locally", base: "uid >= 1000 quiet",
+			ours: "uid >= 500 quiet", theirs: "uid >= 1000 quiet",
+			expected: "uid >= 500 quiet",
+		},
+		{
+			name: "condition changed upstream keeps positions", base: "uid >= 1000 quiet",
+			ours: "uid >= 1000 quiet", theirs: "uid >= 1000 quiet_success",
+			expected: "uid >= 1000 quiet_success",
+		},
+		{
+			name: "settings merged by name", base: "try_first_pass rounds=5000",
+			ours: "try_first_pass rounds=5000 remember=5", theirs: "use_authtok try_first_pass rounds=8000",
+			expected: "use_authtok try_first_pass rounds=8000 remember=5",
+		},
+		{
+			name: "setting removed locally", base: "deny=3 unlock_time=600",
+			ours: "deny=3", theirs: "deny=3 unlock_time=600",
+			expected: "deny=3",
+		},
+		{
+			name: "setting changed on both sides", base: "rounds=5000",
+			ours: "rounds=10000", theirs: "rounds=8000",
+			expected: "rounds=10000", conflicts: []string{"rounds"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, conflicts, positional := mergeArguments(strings.Fields(tt.base), strings.Fields(tt.ours), strings.Fields(tt.theirs))
+			if got := strings.Join(merged, " "); got != tt.expected {
+				t.Errorf("merged = %q, want %q", got, tt.expected)
+			}
+			if !slices.Equal(conflicts, tt.conflicts) || positional != tt.positional {
+				t.Errorf("conflicts = %v, positional = %v, want %v, %v", conflicts, positional, tt.conflicts, tt.positional)
+			}
+		})
+	}
+
+	// Through Merge, the positional conflict is reported on the rule
+	result := Merge(
+		mustParsePamD(t, "auth required pam_succeed_if.so uid >= 1000 quiet\n"),
+		mustParsePamD(t, "auth required pam_succeed_if.so uid >= 500 quiet\n"),
+		mustParsePamD(t, "auth required pam_succeed_if.so uid >= 1000 quiet_success\n"),
+	)
+	if len(result.Conflicts) != 1 || result.Conflicts[0].Kind != ConflictArgument {
+		t.Fatalf("unexpected conflicts: %+v", result.Conflicts)
+	}
+	if got := ruleLines(result.Config); !slices.Equal(got, []string{"auth required pam_succeed_if.so uid >= 500 quiet"}) {
+		t.Errorf("unexpected merge result: %v", got)
+	}
+}
+
+func TestFindUpgradeCandidates(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"sshd", "sshd.rpmnew", "login", "login.dpkg-dist", "su.ucf-dist", "sudo"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("auth required pam_unix.so\n"), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	candidates, err := FindUpgradeCandidates(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("expected 2 candidates, got %+v", candidates)
+	}
+	for _, c := range candidates {
+		if c.NewPath != c.Path+c.Suffix {
+			t.Errorf("unexpected candidate %+v", c)
+		}
+	}
+
+	if _, err := FindUpgradeCandidates(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error for missing directory")
+	}
+}
+
+func TestFileManager_MergeFiles(t *testing.T) {
+	root := t.TempDir()
+	pamD := filepath.Join(root, "pam.d")
+	files := map[string]string{
+		"base":        "auth required pam_unix.so\n",
+		"sshd":        "auth required pam_unix.so nullok\n",
+		"sshd.rpmnew": "auth required pam_unix.so\nauth required pam_faildelay.so\n",
+	}
+	if err := os.MkdirAll(pamD, 0o755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(pamD, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	fm := NewFileManager()
+	result, err := fm.MergeFiles(filepath.Join(pamD, "base"), filepath.Join(pamD, "sshd"), filepath.Join(pamD, "sshd.rpmnew"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.HasConflicts() || len(result.Config.Rules) != 2 {
+		t.Fatalf("unexpected merge result %+v", result)
+	}
+	if !result.Config.Rules[0].HasArgument("nullok") {
+		t.Error("expected local nullok argument to be kept")
+	}
+	if result.Config.Rules[1].Service != "sshd" {
+		t.Errorf("expected rpmnew rules to use service sshd, got %q", result.Config.Rules[1].Service)
+	}
+}
@@ -0,0 +1,418 @@
+package pamparser
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// DefaultModuleDirs lists the directories libpam searches for modules on common distributions
+var DefaultModuleDirs = []string{
+	"/lib/security",
+	"/lib64/security",
+	"/usr/lib/security",
+	"/usr/lib64/security",
+	"/lib/x86_64-linux-gnu/security",
+	"/usr/lib/x86_64-linux-gnu/security",
+	"/lib/aarch64-linux-gnu/security",
+	"/usr/lib/aarch64-linux-gnu/security",
+}
+
+// moduleTypeSymbols maps each module type to the service functions libpam calls for it
+var moduleTypeSymbols = map[ModuleType][]string{
+	ModuleTypeAuth:                  {SymbolAuthenticate, SymbolSetcred},
+	ModuleTypeAccount:               {SymbolAcctMgmt},
+	ModuleTypePassword:              {SymbolChauthtok},
+	ModuleTypeSession:               {SymbolOpenSession, SymbolCloseSession},
+	ModuleTypeSessionNoninteractive: {SymbolOpenSession, SymbolCloseSession},
+}
+
+// PAM service function names a module may export
+const (
+	// SymbolAuthenticate is called by pam_authenticate for auth rules
+	SymbolAuthenticate = "pam_sm_authenticate"
+	// SymbolSetcred is called by pam_setcred for auth rules
+	SymbolSetcred = "pam_sm_setcred"
+	// SymbolAcctMgmt is called by pam_acct_mgmt for account rules
+	SymbolAcctMgmt = "pam_sm_acct_mgmt"
+	// SymbolOpenSession is called by pam_open_session for session rules
+	SymbolOpenSession = "pam_sm_open_session"
+	// SymbolCloseSession is called by pam_close_session for session rules
+	SymbolCloseSession = "pam_sm_close_session"
+	// SymbolChauthtok is called by pam_chauthtok for password rules
+	SymbolChauthtok = "pam_sm_chauthtok"
+)
+
+// RequiredModuleSymbols returns the service functions libpam calls for rules of the given type
+func RequiredModuleSymbols(moduleType ModuleType) []string {
+	return moduleTypeSymbols[GetNormalizedModuleType(moduleType)]
+}
+
+// ModuleCapabilities records which PAM service functions a module exports
+type ModuleCapabilities struct {
+	Authenticate bool `json:"pam_sm_authenticate"`
+	Setcred      bool `json:"pam_sm_setcred"`
+	AcctMgmt     bool `json:"pam_sm_acct_mgmt"`
+	OpenSession  bool `json:"pam_sm_open_session"`
+	CloseSession bool `json:"pam_sm_close_session"`
+	Chauthtok    bool `json:"pam_sm_chauthtok"`
+}
+
+// Exports reports whether the named service function is exported
+func (c ModuleCapabilities) Exports(symbol string) bool {
+	switch symbol {
+	case SymbolAuthenticate:
+		return c.Authenticate
+	case SymbolSetcred:
+		return c.Setcred
+	case SymbolAcctMgmt:
+		return c.AcctMgmt
+	case SymbolOpenSession:
+		return c.OpenSession
+	case SymbolCloseSession:
+		return c.CloseSession
+	case SymbolChauthtok:
+		return c.Chauthtok
+	default:
+		return false
+	}
+}
+
+// MissingSymbols returns the service functions required for the module type that are not exported
+func (c ModuleCapabilities) MissingSymbols(moduleType ModuleType) []string {
+	var missing []string
+	for _, symbol := range RequiredModuleSymbols(moduleType) {
+		if !c.Exports(symbol) {
+			missing = append(missing, symbol)
+		}
+	}
+	return missing
+}
+
+// Implements reports whether the module exports any service function for the module type
+func (c ModuleCapabilities) Implements(moduleType ModuleType) bool {
+	required := RequiredModuleSymbols(moduleType)
+	return len(c.MissingSymbols(moduleType)) < len(required)
+}
+
+// Supports reports whether the module exports every service function for the module type
+func (c ModuleCapabilities) Supports(moduleType ModuleType) bool {
+	return len(RequiredModuleSymbols(moduleType)) > 0 && len(c.MissingSymbols(moduleType)) == 0
+}
+
+// Types returns the module types the module fully supports, in standard order
+func (c ModuleCapabilities) Types() []ModuleType {
+	var types []ModuleType
+	for _, moduleType := range []ModuleType{ModuleTypeAccount, ModuleTypeAuth, ModuleTypePassword, ModuleTypeSession} {
+		if c.Supports(moduleType) {
+			types = append(types, moduleType)
+		}
+	}
+	return types
+}
+
+// ModuleIssueKind classifies a problem found while resolving a rule's module
+type ModuleIssueKind string
+
+const (
+	// ModuleIssueMissing means the module could not be found in any search directory
+	ModuleIssueMissing ModuleIssueKind = "missing"
+	// ModuleIssueNotELF means the module exists but is not a readable ELF shared object
+	ModuleIssueNotELF ModuleIssueKind = "not_elf"
+	// ModuleIssueArchMismatch means the module was built for a different architecture
+	ModuleIssueArchMismatch ModuleIssueKind = "arch_mismatch"
+	// ModuleIssueWrongType means the module does not export any function for the rule's type
+	ModuleIssueWrongType ModuleIssueKind = "wrong_type"
+	// ModuleIssueMissingSymbol means the module implements the rule's type but does not export
+	// every function libpam calls for it
+	ModuleIssueMissingSymbol ModuleIssueKind = "missing_symbol"
+)
+
+// ModuleInfo describes a PAM module shared object
+type ModuleInfo struct {
+	Path    string      `json:"path"`
+	Symbols []string    `json:"symbols,omitempty"` // exported pam_sm_* functions
+	Machine elf.Machine `json:"machine"`
+	Class   elf.Class   `json:"class"`
+}
+
+// Capabilities returns the PAM service functions the module exports
+func (m *ModuleInfo) Capabilities() ModuleCapabilities {
+	return ModuleCapabilities{
+		Authenticate: slices.Contains(m.Symbols, SymbolAuthenticate),
+		Setcred:      slices.Contains(m.Symbols, SymbolSetcred),
+		AcctMgmt:     slices.Contains(m.Symbols, SymbolAcctMgmt),
+		OpenSession:  slices.Contains(m.Symbols, SymbolOpenSession),
+		CloseSession: slices.Contains(m.Symbols, SymbolCloseSession),
+		Chauthtok:    slices.Contains(m.Symbols, SymbolChauthtok),
+	}
+}
+
+// ModuleIssue describes a problem with the module referenced by a rule. Code is the PAM return
+// code libpam would produce for it: ReturnOpenErr when the module cannot be loaded and
+// ReturnSymbolErr when the service function named by Symbol is missing.
+type ModuleIssue struct {
+	Kind         ModuleIssueKind `json:"kind"`
+	Code         ReturnValue     `json:"code"`
+	Symbol       string          `json:"symbol,omitempty"`
+	ModulePath   string          `json:"module_path"`
+	ResolvedPath string          `json:"resolved_path,omitempty"`
+	Message      string          `json:"message"`
+	Rule         Rule            `json:"rule"`
+	RuleIndex    int             `json:"rule_index"`
+}
+
+// String returns a human-readable description of the issue
+func (i ModuleIssue) String() string {
+	return fmt.Sprintf("Rule %d: %s: %s: %s", i.RuleIndex, i.Code, i.ModulePath, i.Message)
+}
+
+// ModuleResolver locates PAM modules on disk the way libpam does
+type ModuleResolver struct {
+	// Root is prepended to every search directory and absolute module path,
+	// allowing inspection of a mounted image or chroot
+	Root string
+	// SearchDirs are the directories searched for modules given by bare name
+	SearchDirs []string
+	// Machine is the expected architecture; zero means the architecture of the running binary
+	Machine elf.Machine
+	// Class is the expected ELF class; zero means the class of the running binary
+	Class elf.Class
+}
+
+// NewModuleResolver creates a resolver using the default module directories
+func NewModuleResolver() *ModuleResolver {
+	return &ModuleResolver{
+		SearchDirs: append([]string(nil), DefaultModuleDirs...),
+	}
+}
+
+// SetRoot sets the root directory under which modules are resolved
+func (r *ModuleResolver) SetRoot(root string) *ModuleResolver {
+	r.Root = root
+	return r
+}
+
+// SetSearchDirs replaces the directories searched for modules given by bare name
+func (r *ModuleResolver) SetSearchDirs(dirs ...string) *ModuleResolver {
+	r.SearchDirs = dirs
+	return r
+}
+
+// SetArchitecture sets the expected ELF machine and class of modules
+func (r *ModuleResolver) SetArchitecture(machine elf.Machine, class elf.Class) *ModuleResolver {
+	r.Machine = machine
+	r.Class = class
+	return r
+}
+
+// expectedArchitecture returns the configured architecture or the host's
+func (r *ModuleResolver) expectedArchitecture() (elf.Machine, elf.Class) {
+	machine, class := r.Machine, r.Class
+	if machine == elf.EM_NONE {
+		machine = hostMachine()
+	}
+	if class == elf.ELFCLASSNONE {
+		class = hostClass()
+	}
+	return machine, class
+}
+
+// hostMachine returns the ELF machine matching the running binary
+func hostMachine() elf.Machine {
+	switch runtime.GOARCH {
+	case "amd64":
+		return elf.EM_X86_64
+	case "386":
+		return elf.EM_386
+	case "arm64":
+		return elf.EM_AARCH64
+	case "arm":
+		return elf.EM_ARM
+	case "ppc64", "ppc64le":
+		return elf.EM_PPC64
+	case "s390x":
+		return elf.EM_S390
+	case "riscv64":
+		return elf.EM_RISCV
+	case "loong64":
+		return elf.EM_LOONGARCH
+	default:
+		return elf.EM_NONE
+	}
+}
+
+// hostClass returns the ELF class matching the running binary
+func hostClass() elf.Class {
+	switch runtime.GOARCH {
+	case "386", "arm":
+		return elf.ELFCLASS32
+	default:
+		return elf.ELFCLASS64
+	}
+}
+
+// Candidates returns the paths, in search order, where the module may be found
+func (r *ModuleResolver) Candidates(modulePath string) []string {
+	if modulePath == "" {
+		return nil
+	}
+	if filepath.IsAbs(modulePath) {
+		return []string{filepath.Join(r.Root, modulePath)}
+	}
+
+	candidates := make([]string, 0, len(r.SearchDirs))
+	for _, dir := range r.SearchDirs {
+		candidates = append(candidates, filepath.Join(r.Root, dir, modulePath))
+	}
+	return candidates
+}
+
+// Resolve returns the path of the first existing file for the module
+func (r *ModuleResolver) Resolve(modulePath string) (string, error) {
+	candidates := r.Candidates(modulePath)
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("empty module path")
+	}
+
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate)
+		if err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("module %s not found in %s", modulePath, strings.Join(candidates, ", "))
+}
+
+// Inspect reads the ELF header and exported pam_sm_* functions of a module file
+func (r *ModuleResolver) Inspect(path string) (*ModuleInfo, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ELF file %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	info := &ModuleInfo{
+		Path:    path,
+		Machine: f.Machine,
+		Class:   f.Class,
+	}
+
+	symbols, err := f.DynamicSymbols()
+	if err != nil && !errors.Is(err, elf.ErrNoSymbols) {
+		return nil, fmt.Errorf("failed to read dynamic symbols of %s: %w", path, err)
+	}
+	for _, sym := range symbols {
+		if !strings.HasPrefix(sym.Name, "pam_sm_") || sym.Section == elf.SHN_UNDEF {
+			continue
+		}
+		if elf.ST_TYPE(sym.Info) != elf.STT_FUNC {
+			continue
+		}
+		if bind := elf.ST_BIND(sym.Info); bind != elf.STB_GLOBAL && bind != elf.STB_WEAK {
+			continue
+		}
+		if !slices.Contains(info.Symbols, sym.Name) {
+			info.Symbols = append(info.Symbols, sym.Name)
+		}
+	}
+	slices.Sort(info.Symbols)
+
+	return info, nil
+}
+
+// namesModule reports whether the rule's module path refers to a shared object.
+// Directives and include/substack controls name a configuration file instead.
+func namesModule(rule Rule) bool {
+	if rule.IsDirective || rule.ModulePath == "" {
+		return false
+	}
+	return rule.Control.Simple == nil || (*rule.Control.Simple != ControlInclude && *rule.Control.Simple != ControlSubstack)
+}
+
+// archMismatch describes how the module's architecture differs from the expected one
+func (r *ModuleResolver) archMismatch(info *ModuleInfo) (string, bool) {
+	machine, class := r.expectedArchitecture()
+	if (machine != elf.EM_NONE && info.Machine != machine) || (class != elf.ELFCLASSNONE && info.Class != class) {
+		return fmt.Sprintf("module is built for %s/%s, expected %s/%s", info.Machine, info.Class, machine, class), true
+	}
+	return "", false
+}
+
+// CheckRule resolves and inspects the module of a single rule, returning any issues found.
+// A module that cannot be resolved, read or loaded on this architecture yields a single issue;
+// otherwise each service function the rule's type needs but the module does not export yields
+// one.
+func (r *ModuleResolver) CheckRule(rule Rule) []ModuleIssue {
+	if !namesModule(rule) {
+		return nil
+	}
+
+	newIssue := func(kind ModuleIssueKind, code ReturnValue, resolved, format string, args ...any) ModuleIssue {
+		return ModuleIssue{
+			Kind:         kind,
+			Code:         code,
+			ModulePath:   rule.ModulePath,
+			ResolvedPath: resolved,
+			Message:      fmt.Sprintf(format, args...),
+			Rule:         rule,
+		}
+	}
+
+	resolved, err := r.Resolve(rule.ModulePath)
+	if err != nil {
+		return []ModuleIssue{newIssue(ModuleIssueMissing, ReturnOpenErr, "", "%v", err)}
+	}
+
+	info, err := r.Inspect(resolved)
+	if err != nil {
+		return []ModuleIssue{newIssue(ModuleIssueNotELF, ReturnOpenErr, resolved, "%v", err)}
+	}
+
+	if msg, mismatch := r.archMismatch(info); mismatch {
+		return []ModuleIssue{newIssue(ModuleIssueArchMismatch, ReturnOpenErr, resolved, "%s", msg)}
+	}
+
+	var issues []ModuleIssue
+	moduleType := GetNormalizedModuleType(rule.Type)
+	kind := ModuleIssueMissingSymbol
+	if !info.Capabilities().Implements(moduleType) {
+		kind = ModuleIssueWrongType
+	}
+	for _, symbol := range info.Capabilities().MissingSymbols(moduleType) {
+		issue := newIssue(kind, ReturnSymbolErr, resolved, "module does not export %s needed for %s rules", symbol, moduleType)
+		issue.Symbol = symbol
+		issues = append(issues, issue)
+	}
+
+	return issues
+}
+
+// Check resolves the modules of every rule in the configuration and reports missing modules,
+// non-ELF files, architecture mismatches and service functions the modules do not export
+func (r *ModuleResolver) Check(config *Config) []ModuleIssue {
+	var issues []ModuleIssue
+	for i, rule := range config.Rules {
+		for _, issue := range r.CheckRule(rule) {
+			issue.RuleIndex = i
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// ValidateModules checks the configuration's modules on disk and returns warnings in the same
+// form as Validate, one per issue Check reports
+func (e *Editor) ValidateModules(resolver *ModuleResolver) []string {
+	var warnings []string
+	for _, issue := range resolver.Check(e.config) {
+		warnings = append(warnings, issue.String())
+	}
+	return warnings
+}
@@ -0,0 +1,236 @@
+package pamparser
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestModule writes a minimal 64-bit little-endian ELF shared object exporting the given functions
+func writeTestModule(t *testing.T, path string, machine elf.Machine, symbols ...string) {
+	t.Helper()
+
+	// .dynstr: leading NUL then each symbol name
+	dynstr := []byte{0}
+	nameOffsets := make([]uint32, len(symbols))
+	for i, name := range symbols {
+		nameOffsets[i] = uint32(len(dynstr))
+		dynstr = append(dynstr, name...)
+		dynstr = append(dynstr, 0)
+	}
+
+	// .dynsym: null symbol followed by one global function per name
+	var dynsym bytes.Buffer
+	dynsym.Write(make([]byte, 24))
+	for i := range symbols {
+		_ = binary.Write(&dynsym, binary.LittleEndian, elf.Sym64{
+			Name:  nameOffsets[i],
+			Info:  elf.ST_INFO(elf.STB_GLOBAL, elf.STT_FUNC),
+			Shndx: 4, // any defined section
+			Value: 0x1000,
+		})
+	}
+
+	shstrtab := []byte("\x00.dynstr\x00.dynsym\x00.shstrtab\x00.text\x00")
+
+	const headerSize = 64
+	dynstrOff := uint64(headerSize)
+	dynsymOff := dynstrOff + uint64(len(dynstr))
+	shstrtabOff := dynsymOff + uint64(dynsym.Len())
+	shOff := shstrtabOff + uint64(len(shstrtab))
+
+	var buf bytes.Buffer
+	ident := [elf.EI_NIDENT]byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)}
+	_ = binary.Write(&buf, binary.LittleEndian, elf.Header64{
+		Ident:     ident,
+		Type:      uint16(elf.ET_DYN),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     shOff,
+		Ehsize:    headerSize,
+		Shentsize: 64,
+		Shnum:     5,
+		Shstrndx:  3,
+	})
+	buf.Write(dynstr)
+	buf.Write(dynsym.Bytes())
+	buf.Write(shstrtab)
+
+	sections := []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_STRTAB), Off: dynstrOff, Size: uint64(len(dynstr)), Addralign: 1},
+		{Name: 9, Type: uint32(elf.SHT_DYNSYM), Off: dynsymOff, Size: uint64(dynsym.Len()), Link: 1, Info: 1, Addralign: 8, Entsize: 24},
+		{Name: 17, Type: uint32(elf.SHT_STRTAB), Off: shstrtabOff, Size: uint64(len(shstrtab)), Addralign: 1},
+		{Name: 27, Type: uint32(elf.SHT_PROGBITS), Flags: uint64(elf.SHF_ALLOC | elf.SHF_EXECINSTR), Addralign: 16},
+	}
+	for _, section := range sections {
+		_ = binary.Write(&buf, binary.LittleEndian, section)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create module directory: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("failed to write test module: %v", err)
+	}
+}
+
+func TestModuleResolver_Resolve(t *testing.T) {
+	root := t.TempDir()
+	writeTestModule(t, filepath.Join(root, "lib64/security/pam_unix.so"), elf.EM_X86_64, "pam_sm_authenticate")
+	writeTestModule(t, filepath.Join(root, "opt/pam/pam_custom.so"), elf.EM_X86_64, "pam_sm_authenticate")
+
+	resolver := NewModuleResolver().SetRoot(root)
+
+	resolved, err := resolver.Resolve("pam_unix.so")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolved != filepath.Join(root, "lib64/security/pam_unix.so") {
+		t.Errorf("unexpected resolved path %s", resolved)
+	}
+
+	if _, err := resolver.Resolve("/opt/pam/pam_custom.so"); err != nil {
+		t.Errorf("expected absolute path to resolve under root: %v", err)
+	}
+
+	if _, err := resolver.Resolve("pam_missing.so"); err == nil {
+		t.Error("expected error for missing module")
+	}
+
+	if _, err := resolver.Resolve(""); err == nil {
+		t.Error("expected error for empty module path")
+	}
+}
+
+func TestModuleResolver_Inspect(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pam_test.so")
+	writeTestModule(t, path, elf.EM_AARCH64, "pam_sm_open_session", "pam_sm_close_session", "helper")
+
+	info, err := NewModuleResolver().Inspect(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Machine != elf.EM_AARCH64 || info.Class != elf.ELFCLASS64 {
+		t.Errorf("unexpected architecture %s/%s", info.Machine, info.Class)
+	}
+	if strings.Join(info.Symbols, ",") != "pam_sm_close_session,pam_sm_open_session" {
+		t.Errorf("unexpected symbols %v", info.Symbols)
+	}
+}
+
+func TestModuleResolver_Check(t *testing.T) {
+	root := t.TempDir()
+	securityDir := filepath.Join(root, "usr/lib/x86_64-linux-gnu/security")
+	writeTestModule(t, filepath.Join(securityDir, "pam_unix.so"), elf.EM_X86_64,
+		"pam_sm_authenticate", "pam_sm_setcred", "pam_sm_acct_mgmt", "pam_sm_chauthtok", "pam_sm_open_session", "pam_sm_close_session")
+	writeTestModule(t, filepath.Join(securityDir, "pam_authonly.so"), elf.EM_X86_64, "pam_sm_authenticate", "pam_sm_setcred")
+	writeTestModule(t, filepath.Join(securityDir, "pam_arm.so"), elf.EM_AARCH64, "pam_sm_authenticate")
+	if err := os.WriteFile(filepath.Join(securityDir, "pam_text.so"), []byte("not an elf file"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	content := `auth required pam_unix.so
+auth required pam_arm.so
+auth required pam_text.so
+password required pam_authonly.so
+account required pam_missing.so
+session include common-session
+@include common-auth
+`
+	config, err := NewParser().Parse(strings.NewReader(content), true)
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	resolver := NewModuleResolver().SetRoot(root).SetArchitecture(elf.EM_X86_64, elf.ELFCLASS64)
+	issues := resolver.Check(config)
+
+	expected := map[int]ModuleIssueKind{
+		1: ModuleIssueArchMismatch,
+		2: ModuleIssueNotELF,
+		3: ModuleIssueWrongType,
+		4: ModuleIssueMissing,
+	}
+	if len(issues) != len(expected) {
+		t.Fatalf("expected %d issues, got %d: %v", len(expected), len(issues), issues)
+	}
+	for _, issue := range issues {
+		if expected[issue.RuleIndex] != issue.Kind {
+			t.Errorf("rule %d: expected %s, got %s (%s)", issue.RuleIndex, expected[issue.RuleIndex], issue.Kind, issue.Message)
+		}
+	}
+}
+
+func TestModuleCapabilities(t *testing.T) {
+	info := &ModuleInfo{Symbols: []string{SymbolAuthenticate, SymbolSetcred, SymbolOpenSession}}
+	caps := info.Capabilities()
+
+	if !caps.Supports(ModuleTypeAuth) {
+		t.Error("expected auth to be supported")
+	}
+	if caps.Supports(ModuleTypeSession) || !caps.Implements(ModuleTypeSession) {
+		t.Error("expected session to be implemented but not fully supported")
+	}
+	if caps.Implements(ModuleTypePassword) {
+		t.Error("expected password not to be implemented")
+	}
+	if missing := caps.MissingSymbols("-session"); len(missing) != 1 || missing[0] != SymbolCloseSession {
+		t.Errorf("expected pam_sm_close_session to be missing, got %v", missing)
+	}
+	if types := caps.Types(); len(types) != 1 || types[0] != ModuleTypeAuth {
+		t.Errorf("expected only auth to be supported, got %v", types)
+	}
+}
+
+func TestModuleResolver_CheckSymbols(t *testing.T) {
+	root := t.TempDir()
+	securityDir := filepath.Join(root, "lib/security")
+	writeTestModule(t, filepath.Join(securityDir, "pam_authonly.so"), elf.EM_X86_64, SymbolAuthenticate)
+	writeTestModule(t, filepath.Join(securityDir, "pam_arm.so"), elf.EM_AARCH64, SymbolAcctMgmt)
+
+	content := `auth required pam_authonly.so
+password required pam_authonly.so
+account required pam_arm.so
+session optional pam_missing.so
+`
+	config, err := NewParser().Parse(strings.NewReader(content), true)
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	resolver := NewModuleResolver().SetRoot(root).SetArchitecture(elf.EM_X86_64, elf.ELFCLASS64)
+	issues := resolver.Check(config)
+
+	expected := []struct {
+		kind   ModuleIssueKind
+		code   ReturnValue
+		symbol string
+		index  int
+	}{
+		{ModuleIssueMissingSymbol, ReturnSymbolErr, SymbolSetcred, 0},
+		{ModuleIssueWrongType, ReturnSymbolErr, SymbolChauthtok, 1},
+		{ModuleIssueArchMismatch, ReturnOpenErr, "", 2},
+		{ModuleIssueMissing, ReturnOpenErr, "", 3},
+	}
+	if len(issues) != len(expected) {
+		t.Fatalf("expected %d issues, got %d: %v", len(expected), len(issues), issues)
+	}
+	for i, want := range expected {
+		got := issues[i]
+		if got.Kind != want.kind || got.Code != want.code || got.Symbol != want.symbol || got.RuleIndex != want.index {
+			t.Errorf("issue %d: expected %s %s %s at rule %d, got %s %s %s at rule %d",
+				i, want.kind, want.code, want.symbol, want.index, got.Kind, got.Code, got.Symbol, got.RuleIndex)
+		}
+	}
+
+	warnings := NewEditor(config).ValidateModules(resolver)
+	if len(warnings) != len(expected) || !strings.Contains(warnings[0], "symbol_err") {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+}
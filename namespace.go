@@ -0,0 +1,338 @@
+package pamparser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// NamespaceModule is the module name of pam_namespace
+const NamespaceModule = "pam_namespace.so"
+
+// Default locations of the files read by pam_namespace
+const (
+	// DefaultNamespaceFile is the main namespace.conf file
+	DefaultNamespaceFile = "/etc/security/namespace.conf"
+	// DefaultNamespaceDir holds *.conf files read after DefaultNamespaceFile
+	DefaultNamespaceDir = "/etc/security/namespace.d"
+)
+
+// NamespaceMethod is the polyinstantiation method of a namespace.conf entry
+type NamespaceMethod string
+
+const (
+	// NamespaceUser makes one instance per user
+	NamespaceUser NamespaceMethod = "user"
+	// NamespaceLevel makes one instance per user and MLS level
+	NamespaceLevel NamespaceMethod = "level"
+	// NamespaceContext makes one instance per user and SELinux context
+	NamespaceContext NamespaceMethod = "context"
+	// NamespaceTmpdir makes a temporary directory under the instance prefix for each session
+	NamespaceTmpdir NamespaceMethod = "tmpdir"
+	// NamespaceTmpfs mounts a fresh tmpfs for each session; the instance prefix is unused
+	NamespaceTmpfs NamespaceMethod = "tmpfs"
+)
+
+// namespaceMethods lists the methods documented in namespace.conf(5)
+var namespaceMethods = []NamespaceMethod{NamespaceUser, NamespaceLevel, NamespaceContext, NamespaceTmpdir, NamespaceTmpfs}
+
+// namespaceOptions lists the flags that may follow the method, separated by ':'
+var namespaceOptions = []string{"create", "iscript", "noinit", "shared", "mntopts"}
+
+// NamespaceEntry is one polydir instance_prefix method[:flags] [list_of_users] line of
+// namespace.conf. Users are exempt from polyinstantiation, or with Inverse set (a leading
+// '~' in the file) the only users polyinstantiated.
+type NamespaceEntry struct {
+	Polydir        string          `json:"polydir"`
+	InstancePrefix string          `json:"instance_prefix"`
+	Method         NamespaceMethod `json:"method"`
+	Options        []string        `json:"options,omitempty"`
+	Users          []string        `json:"users,omitempty"`
+	Inverse        bool            `json:"inverse,omitempty"`
+	Comment        string          `json:"comment,omitempty"`
+	LineNumber     int             `json:"line_number,omitempty"`
+}
+
+// NamespaceConfig represents a namespace.conf file or a file in namespace.d
+type NamespaceConfig struct {
+	FilePath string           `json:"file_path,omitempty"`
+	Entries  []NamespaceEntry `json:"entries"`
+	Comments []string         `json:"comments,omitempty"`
+}
+
+// IsValidNamespaceMethod checks if the given string is a method documented in namespace.conf(5)
+func IsValidNamespaceMethod(method string) bool {
+	return slices.Contains(namespaceMethods, NamespaceMethod(method))
+}
+
+// ParseNamespace parses namespace.conf syntax. Comment-only lines are kept in Comments and
+// trailing comments on entry lines in the entry's Comment.
+func ParseNamespace(reader io.Reader) (*NamespaceConfig, error) {
+	config := &NamespaceConfig{}
+
+	comments, err := scanContinuedLines(reader, func(line string, lineNum int) error {
+		content, comment := splitConfigComment(line)
+		if content == "" {
+			return nil
+		}
+
+		fields := strings.Fields(content)
+		if len(fields) < 3 || len(fields) > 4 {
+			return fmt.Errorf("expected <polydir> <instance_prefix> <method> [<users>] at line %d, got %d fields", lineNum, len(fields))
+		}
+		method, options, _ := strings.Cut(fields[2], ":")
+		entry := NamespaceEntry{
+			Polydir:        fields[0],
+			InstancePrefix: fields[1],
+			Method:         NamespaceMethod(method),
+			Comment:        comment,
+			LineNumber:     lineNum,
+		}
+		if options != "" {
+			entry.Options = strings.Split(options, ":")
+		}
+		if len(fields) == 4 {
+			users, inverse := strings.CutPrefix(fields[3], "~")
+			entry.Users = strings.Split(users, ",")
+			entry.Inverse = inverse
+		}
+		config.Entries = append(config.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	config.Comments = comments
+	return config, nil
+}
+
+// LoadNamespaceFile loads a namespace.conf file
+func LoadNamespaceFile(filePath string) (*NamespaceConfig, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	config, err := ParseNamespace(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file %s: %w", filePath, err)
+	}
+	config.FilePath = filePath
+	return config, nil
+}
+
+// LoadNamespaceForRule loads every file a pam_namespace rule reads, in reading order:
+// DefaultNamespaceFile, then the *.conf files of DefaultNamespaceDir in C locale order.
+// Missing files are skipped. root is prepended to every path.
+func LoadNamespaceForRule(rule Rule, root string) ([]*NamespaceConfig, error) {
+	if !rule.IsModule(NamespaceModule) {
+		return nil, fmt.Errorf("rule module %s is not %s", rule.ModulePath, NamespaceModule)
+	}
+
+	dropIns, err := filepath.Glob(filepath.Join(root, DefaultNamespaceDir, "*.conf"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", DefaultNamespaceDir, err)
+	}
+	slices.Sort(dropIns)
+
+	var configs []*NamespaceConfig
+	for _, file := range append([]string{filepath.Join(root, DefaultNamespaceFile)}, dropIns...) {
+		config, err := LoadNamespaceFile(file)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+// Option returns the value of a method flag such as create=0700,root,root, and whether the
+// flag is present
+func (e NamespaceEntry) Option(name string) (string, bool) {
+	for _, option := range e.Options {
+		key, value, _ := strings.Cut(option, "=")
+		if key == name {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// hasNamespaceVariables reports whether a path uses $USER or $HOME and so differs per user
+func hasNamespaceVariables(path string) bool {
+	return strings.Contains(path, "$")
+}
+
+// Validate checks the method, its flags, the paths and the user list
+func (e NamespaceEntry) Validate() error {
+	if !IsValidNamespaceMethod(string(e.Method)) {
+		return fmt.Errorf("unknown method '%s'", e.Method)
+	}
+	paths := []string{e.Polydir}
+	if e.Method != NamespaceTmpfs {
+		paths = append(paths, e.InstancePrefix)
+	}
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "$HOME") {
+			return fmt.Errorf("path '%s' is not absolute", path)
+		}
+	}
+	if e.Polydir == "/" {
+		return fmt.Errorf("cannot polyinstantiate /")
+	}
+	for _, option := range e.Options {
+		key, value, _ := strings.Cut(option, "=")
+		if !slices.Contains(namespaceOptions, key) {
+			return fmt.Errorf("unknown flag '%s'", key)
+		}
+		if key == "mntopts" && e.Method != NamespaceTmpfs {
+			return fmt.Errorf("mntopts is only valid with the tmpfs method")
+		}
+		if mode, _, _ := strings.Cut(value, ","); key == "create" && mode != "" {
+			if _, err := strconv.ParseUint(mode, 8, 32); err != nil {
+				return fmt.Errorf("invalid create mode '%s'", mode)
+			}
+		}
+	}
+	if slices.Contains(e.Users, "") {
+		return fmt.Errorf("empty name in user list")
+	}
+	return nil
+}
+
+// Validate checks every entry, returning one warning per invalid entry
+func (c *NamespaceConfig) Validate() []string {
+	var warnings []string
+	for i, entry := range c.Entries {
+		if err := entry.Validate(); err != nil {
+			warnings = append(warnings, fmt.Sprintf("Entry %d (line %d): %v", i, entry.LineNumber, err))
+		}
+	}
+	return warnings
+}
+
+// CheckDirs checks the directories of every entry under root, returning one warning per
+// problem. A polydir must exist unless a create flag is given. The instance prefix of
+// every method except tmpfs must be a directory, which pam_namespace requires to have mode
+// 0000 unless ignoreParentMode (the ignore_instance_parent_mode argument) is set. Paths
+// using $USER or $HOME are skipped.
+func (c *NamespaceConfig) CheckDirs(root string, ignoreParentMode bool) []string {
+	var warnings []string
+	for i, entry := range c.Entries {
+		prefix := fmt.Sprintf("Entry %d (line %d)", i, entry.LineNumber)
+
+		if _, create := entry.Option("create"); !create && !hasNamespaceVariables(entry.Polydir) {
+			if _, problem := checkNamespaceDir(filepath.Join(root, entry.Polydir)); problem != "" {
+				warnings = append(warnings, fmt.Sprintf("%s: polyinstantiated directory %s", prefix, problem))
+			}
+		}
+
+		if entry.Method == NamespaceTmpfs || hasNamespaceVariables(entry.InstancePrefix) {
+			continue
+		}
+		info, problem := checkNamespaceDir(filepath.Join(root, entry.InstancePrefix))
+		if problem != "" {
+			warnings = append(warnings, fmt.Sprintf("%s: instance parent %s", prefix, problem))
+			continue
+		}
+		if !ignoreParentMode && info.Mode().Perm() != 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: instance parent %s has mode %04o, pam_namespace requires 0000",
+				prefix, entry.InstancePrefix, info.Mode().Perm()))
+		}
+	}
+	return warnings
+}
+
+// checkNamespaceDir stats a directory, describing why it is not usable if it is not
+func checkNamespaceDir(path string) (fs.FileInfo, string) {
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, path + " does not exist"
+	case err != nil:
+		return nil, fmt.Sprintf("%s cannot be checked: %v", path, err)
+	case !info.IsDir():
+		return nil, path + " is not a directory"
+	}
+	return info, ""
+}
+
+// String returns the configuration in namespace.conf syntax with aligned columns,
+// standalone comments first
+func (c *NamespaceConfig) String() string {
+	var b strings.Builder
+	for _, comment := range c.Comments {
+		b.WriteString("# " + comment + "\n")
+	}
+
+	methods := make([]string, len(c.Entries))
+	var widths [3]int
+	for i, entry := range c.Entries {
+		methods[i] = strings.Join(append([]string{string(entry.Method)}, entry.Options...), ":")
+		widths[0] = max(widths[0], len(entry.Polydir))
+		widths[1] = max(widths[1], len(entry.InstancePrefix))
+		widths[2] = max(widths[2], len(methods[i]))
+	}
+	for i, entry := range c.Entries {
+		line := fmt.Sprintf("%-*s %-*s %-*s", widths[0], entry.Polydir, widths[1], entry.InstancePrefix, widths[2], methods[i])
+		if len(entry.Users) > 0 {
+			users := strings.Join(entry.Users, ",")
+			if entry.Inverse {
+				users = "~" + users
+			}
+			line += " " + users
+		}
+		if entry.Comment != "" {
+			line += " # " + entry.Comment
+		}
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return b.String()
+}
+
+// Write writes the configuration in namespace.conf syntax
+func (c *NamespaceConfig) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, c.String()); err != nil {
+		return fmt.Errorf("error writing namespace configuration: %w", err)
+	}
+	return nil
+}
+
+// CheckNamespace validates the namespace.conf files of every pam_namespace rule in the
+// configuration and checks their directories under root, keyed by rule ID. Rules that are
+// not session rules are reported, since pam_namespace only provides a session module.
+func (e *Editor) CheckNamespace(root string) (map[RuleID][]string, error) {
+	e.ensureIDs()
+
+	results := make(map[RuleID][]string)
+	for _, i := range e.FindRules(func(rule Rule) bool { return rule.IsModule(NamespaceModule) }) {
+		rule := e.config.Rules[i]
+		warnings := []string{}
+		if rule.Type != ModuleTypeSession {
+			warnings = append(warnings, fmt.Sprintf("%s only provides a session module, not %s", NamespaceModule, rule.Type))
+		}
+
+		configs, err := LoadNamespaceForRule(rule, root)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		for _, config := range configs {
+			problems := append(config.Validate(), config.CheckDirs(root, rule.HasArgument("ignore_instance_parent_mode"))...)
+			for _, problem := range problems {
+				warnings = append(warnings, config.FilePath+": "+problem)
+			}
+		}
+		results[rule.ID] = warnings
+	}
+	return results, nil
+}
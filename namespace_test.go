@@ -0,0 +1,137 @@
+package pamparser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleNamespace = `# /etc/security/namespace.conf
+$HOME     $HOME/$USER.inst/ level
+/tmp      /tmp-inst/        level:create=1777,root,root root,adm
+/var/tmp  /var/tmp/tmp-inst/ user ~alice,bob
+/run/user none              tmpfs:mntopts=size=10M # per-session tmpfs
+`
+
+func TestParseNamespace(t *testing.T) {
+	config, err := ParseNamespace(strings.NewReader(sampleNamespace))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []NamespaceEntry{
+		{Polydir: "$HOME", InstancePrefix: "$HOME/$USER.inst/", Method: NamespaceLevel, LineNumber: 2},
+		{Polydir: "/tmp", InstancePrefix: "/tmp-inst/", Method: NamespaceLevel, Options: []string{"create=1777,root,root"}, Users: []string{"root", "adm"}, LineNumber: 3},
+		{Polydir: "/var/tmp", InstancePrefix: "/var/tmp/tmp-inst/", Method: NamespaceUser, Users: []string{"alice", "bob"}, Inverse: true, LineNumber: 4},
+		{Polydir: "/run/user", InstancePrefix: "none", Method: NamespaceTmpfs, Options: []string{"mntopts=size=10M"}, Comment: "per-session tmpfs", LineNumber: 5},
+	}
+	if !reflect.DeepEqual(config.Entries, want) {
+		t.Errorf("entries = %+v, want %+v", config.Entries, want)
+	}
+	if warnings := config.Validate(); len(warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+	if mode, ok := config.Entries[1].Option("create"); !ok || mode != "1777,root,root" {
+		t.Errorf("Option(create) = %q, %v", mode, ok)
+	}
+
+	reparsed, err := ParseNamespace(strings.NewReader(config.String()))
+	if err != nil {
+		t.Fatalf("written output does not parse back: %v", err)
+	}
+	for i := range reparsed.Entries {
+		reparsed.Entries[i].LineNumber = want[i].LineNumber
+	}
+	if !reflect.DeepEqual(reparsed.Entries, want) {
+		t.Errorf("round trip = %+v, want %+v", reparsed.Entries, want)
+	}
+
+	if _, err := ParseNamespace(strings.NewReader("/tmp /tmp-inst/\n")); err == nil {
+		t.Error("expected error for a missing method")
+	}
+}
+
+func TestNamespaceEntry_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   NamespaceEntry
+		wantErr bool
+	}{
+		{"user", NamespaceEntry{Polydir: "/tmp", InstancePrefix: "/tmp-inst/", Method: NamespaceUser}, false},
+		{"tmpfs ignores prefix", NamespaceEntry{Polydir: "/tmp", InstancePrefix: "none", Method: NamespaceTmpfs}, false},
+		{"unknown method", NamespaceEntry{Polydir: "/tmp", InstancePrefix: "/tmp-inst/", Method: "session"}, true},
+		{"relative polydir", NamespaceEntry{Polydir: "tmp", InstancePrefix: "/tmp-inst/", Method: NamespaceUser}, true},
+		{"relative prefix", NamespaceEntry{Polydir: "/tmp", InstancePrefix: "tmp-inst", Method: NamespaceUser}, true},
+		{"root polydir", NamespaceEntry{Polydir: "/", InstancePrefix: "/inst/", Method: NamespaceUser}, true},
+		{"unknown flag", NamespaceEntry{Polydir: "/tmp", InstancePrefix: "/tmp-inst/", Method: NamespaceUser, Options: []string{"fast"}}, true},
+		{"mntopts without tmpfs", NamespaceEntry{Polydir: "/tmp", InstancePrefix: "/tmp-inst/", Method: NamespaceUser, Options: []string{"mntopts=size=1M"}}, true},
+		{"bad create mode", NamespaceEntry{Polydir: "/tmp", InstancePrefix: "/tmp-inst/", Method: NamespaceUser, Options: []string{"create=0999"}}, true},
+		{"empty user", NamespaceEntry{Polydir: "/tmp", InstancePrefix: "/tmp-inst/", Method: NamespaceUser, Users: []string{"root", ""}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.entry.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNamespaceConfig_CheckDirs(t *testing.T) {
+	root := t.TempDir()
+	for path, mode := range map[string]os.FileMode{"tmp": 0o1777, "tmp-inst": 0o000, "var/tmp": 0o1777, "var/tmp/tmp-inst": 0o755} {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(full, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(full, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, err := ParseNamespace(strings.NewReader(sampleNamespace + "/srv /srv-inst/ user\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// /var/tmp/tmp-inst has the wrong mode, /run/user is missing, /srv and /srv-inst are missing
+	warnings := config.CheckDirs(root, false)
+	if len(warnings) != 4 {
+		t.Errorf("expected 4 warnings, got %v", warnings)
+	}
+	if warnings := config.CheckDirs(root, true); len(warnings) != 3 {
+		t.Errorf("expected ignore_instance_parent_mode to drop the mode warning, got %v", warnings)
+	}
+}
+
+func TestEditor_CheckNamespace(t *testing.T) {
+	root := writeSettingsFiles(t, map[string]string{
+		DefaultNamespaceFile:                              "/tmp /tmp-inst/ user\n",
+		filepath.Join(DefaultNamespaceDir, "90-var.conf"): "/var/tmp /var/tmp-inst/ bogus\n",
+	})
+	for _, dir := range []string{"tmp", "tmp-inst", "var/tmp", "var/tmp-inst"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := mustParsePamD(t, `session required pam_namespace.so ignore_instance_parent_mode
+auth required pam_namespace.so
+`)
+	editor := NewEditor(config)
+	results, err := editor.CheckNamespace(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rules := editor.GetConfig().Rules
+	if got := results[rules[0].ID]; len(got) != 1 || !strings.Contains(got[0], "unknown method 'bogus'") {
+		t.Errorf("session rule warnings = %v", got)
+	}
+	if got := results[rules[1].ID]; len(got) != 4 || !strings.Contains(got[0], "only provides a session module") {
+		t.Errorf("auth rule warnings = %v", got)
+	}
+}
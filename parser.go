@@ -6,7 +6,10 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -138,22 +141,69 @@ const (
 type Control struct {
 	Simple   *ControlType        `json:"simple,omitempty"`
 	Complex  map[ReturnValue]any `json:"complex,omitempty"`  // any can be ActionType or int (for jump)
+	Order    []ReturnValue       `json:"order,omitempty"`    // written order of Complex keys, as parsed
 	Optional bool                `json:"optional,omitempty"` // true if prepended with '-'
 }
 
+// RuleID is a stable handle for a rule within a configuration. IDs are assigned when a
+// configuration is parsed or a rule is inserted and do not change as other rules move.
+type RuleID uint64
+
 // Rule represents a single PAM configuration rule or directive
 type Rule struct {
-	Control         Control    `json:"control,omitempty"`
-	Service         string     `json:"service,omitempty"`
-	Type            ModuleType `json:"type,omitempty"`
-	ModulePath      string     `json:"module_path,omitempty"`
-	Comment         string     `json:"comment,omitempty"`
-	DirectiveType   string     `json:"directive_type,omitempty"`
-	DirectiveTarget string     `json:"directive_target,omitempty"`
-	Arguments       []string   `json:"arguments,omitempty"`
-	LineNumber      int        `json:"line_number,omitempty"`
-	Continuation    bool       `json:"continuation,omitempty"`
-	IsDirective     bool       `json:"is_directive,omitempty"`
+	Control         Control        `json:"control,omitempty"`
+	ID              RuleID         `json:"id,omitempty"`
+	Service         string         `json:"service,omitempty"`
+	Type            ModuleType     `json:"type,omitempty"`
+	ModulePath      string         `json:"module_path,omitempty"`
+	Comment         string         `json:"comment,omitempty"`
+	DirectiveType   string         `json:"directive_type,omitempty"`
+	DirectiveTarget string         `json:"directive_target,omitempty"`
+	Arguments       []string       `json:"arguments,omitempty"`
+	LineNumber      int            `json:"line_number,omitempty"`
+	Continuation    bool           `json:"continuation,omitempty"`
+	Fragments       []LineFragment `json:"fragments,omitempty"` // physical lines of a continued rule
+	IsDirective     bool           `json:"is_directive,omitempty"`
+}
+
+// LineFragment is one physical line of a rule written across several lines with a trailing
+// backslash. The writer reproduces the fragments verbatim while the rule is unchanged.
+type LineFragment struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// ModuleName returns the base name of the rule's module path (e.g. pam_unix.so for /lib/security/pam_unix.so)
+func (r Rule) ModuleName() string {
+	if r.ModulePath == "" {
+		return ""
+	}
+	return filepath.Base(r.ModulePath)
+}
+
+// IsModule reports whether the rule invokes the named module, ignoring any directory component
+func (r Rule) IsModule(name string) bool {
+	return !r.IsDirective && r.ModuleName() == name
+}
+
+// ArgumentValue returns the value of a name=value module argument and whether it was present
+func (r Rule) ArgumentValue(name string) (string, bool) {
+	for _, arg := range r.Arguments {
+		if value, ok := strings.CutPrefix(arg, name+"="); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// HasArgument reports whether the rule has a flag argument or a name=value argument with the given name
+func (r Rule) HasArgument(name string) bool {
+	for _, arg := range r.Arguments {
+		if arg == name || strings.HasPrefix(arg, name+"=") {
+			return true
+		}
+	}
+	return false
 }
 
 // Config represents a PAM configuration file
@@ -162,6 +212,11 @@ type Config struct {
 	Rules    []Rule   `json:"rules"`
 	Comments []string `json:"comments,omitempty"`
 	IsPamD   bool     `json:"is_pam_d,omitempty"`
+	lastID   RuleID   // highest rule ID handed out, so removed IDs are never reused
+
+	// libpamCompat records that the configuration was parsed with libpam's tokenizer, so the
+	// writer reads continued rules back the same way
+	libpamCompat bool
 }
 
 // Parser handles PAM configuration parsing
@@ -171,6 +226,13 @@ type Parser struct {
 	commentPattern  *regexp.Regexp
 	controlPattern  *regexp.Regexp
 	argumentPattern *regexp.Regexp
+
+	// lenient records complex control problems as warnings instead of failing the parse
+	lenient  bool
+	warnings []ControlProblem
+
+	// libpamCompat tokenizes lines exactly as libpam does
+	libpamCompat bool
 }
 
 // NewParser creates a new PAM configuration parser
@@ -183,6 +245,18 @@ func NewParser() *Parser {
 	}
 }
 
+// SetLenient controls whether invalid complex control entries, such as unknown return values
+// or actions, fail the parse (the default) or are kept as written and reported by Warnings
+func (p *Parser) SetLenient(enabled bool) *Parser {
+	p.lenient = enabled
+	return p
+}
+
+// Warnings returns the complex control problems tolerated by the last parse in lenient mode
+func (p *Parser) Warnings() []ControlProblem {
+	return append([]ControlProblem(nil), p.warnings...)
+}
+
 // IsValidModuleType checks if the given string is a valid module type
 func IsValidModuleType(t string) bool {
 	// Handle negative module types (e.g., -session, -auth)
@@ -207,6 +281,22 @@ func IsValidControlType(c string) bool {
 	}
 }
 
+// IsValidReturnValue checks if the given string is a PAM return value usable in complex
+// control syntax, including default
+func IsValidReturnValue(v string) bool {
+	return ReturnValue(v) == ReturnDefault || slices.Contains(knownReturnValues, ReturnValue(v))
+}
+
+// IsValidAction checks if the given string is a complex control action keyword
+func IsValidAction(a string) bool {
+	switch ActionType(a) {
+	case ActionIgnore, ActionBad, ActionDie, ActionOK, ActionDone, ActionReset:
+		return true
+	default:
+		return false
+	}
+}
+
 // GetModuleTypeOrder returns the standard ordering index for a module type
 func GetModuleTypeOrder(moduleType ModuleType) int {
 	// Handle negative module types by stripping the prefix for ordering
@@ -236,8 +326,22 @@ func GetNormalizedModuleType(moduleType ModuleType) ModuleType {
 	return ModuleType(typeStr)
 }
 
-// parseControl parses a control field which can be either simple or complex
+// parseControl parses a control field which can be either simple or complex. Problems found
+// in a complex control are returned as ControlProblems.
 func (p *Parser) parseControl(controlStr string) (Control, error) {
+	control, problems, err := p.parseControlField(controlStr)
+	if err != nil {
+		return control, err
+	}
+	if len(problems) > 0 {
+		return control, problems
+	}
+	return control, nil
+}
+
+// parseControlField parses a control field, returning problems in a complex control with
+// their 1-based column within controlStr
+func (p *Parser) parseControlField(controlStr string) (Control, ControlProblems, error) {
 	control := Control{}
 
 	// Check if it's optional (starts with -)
@@ -249,53 +353,82 @@ func (p *Parser) parseControl(controlStr string) (Control, error) {
 
 	// Check if it's complex control syntax [value=action ...]
 	if p.controlPattern.MatchString(controlStr) {
-		return p.parseComplexControl(controlStr, optional)
+		control, problems := p.parseComplexControl(controlStr, optional)
+		if optional {
+			for i := range problems {
+				problems[i].Column++
+			}
+		}
+		return control, problems, nil
 	}
 
 	// Simple control
 	controlType := ControlType(strings.ToLower(controlStr))
 	if !IsValidControlType(string(controlType)) {
-		return control, fmt.Errorf("invalid control type: %s", controlStr)
+		return control, nil, fmt.Errorf("invalid control type: %s", controlStr)
 	}
 
 	control.Simple = &controlType
 	control.Optional = optional
-	return control, nil
+	return control, nil, nil
 }
 
-// parseComplexControl parses complex control syntax like [success=ok default=bad]
-func (p *Parser) parseComplexControl(controlStr string, optional bool) (Control, error) {
+// parseComplexControl parses complex control syntax like [success=ok default=bad]. Every
+// entry is checked against the known return values and actions; problems are returned with
+// their 1-based column within controlStr and the offending entries are kept as written.
+func (p *Parser) parseComplexControl(controlStr string, optional bool) (Control, ControlProblems) {
 	control := Control{
 		Complex:  make(map[ReturnValue]any),
 		Optional: optional,
 	}
+	var problems ControlProblems
+	report := func(column int, format string, args ...any) {
+		problems = append(problems, ControlProblem{Column: column, Message: fmt.Sprintf(format, args...)})
+	}
 
-	// Remove brackets
+	// Walk the value=action pairs between the brackets, tracking their offsets
 	inner := strings.TrimPrefix(strings.TrimSuffix(controlStr, "]"), "[")
+	pos := 0
+	for _, pair := range strings.Fields(inner) {
+		index := pos + strings.Index(inner[pos:], pair)
+		pos = index + len(pair)
+		column := index + 2 // 1-based, after the opening bracket
 
-	// Split by spaces and parse value=action pairs
-	pairs := strings.Fields(inner)
-	for _, pair := range pairs {
 		parts := strings.SplitN(pair, "=", 2)
-		if len(parts) != 2 {
-			return control, fmt.Errorf("invalid control pair: %s", pair)
+		if len(parts) != 2 || parts[0] == "" {
+			report(column, "invalid control pair %q, expected value=action", pair)
+			continue
 		}
 
 		returnVal := ReturnValue(parts[0])
 		actionStr := parts[1]
+		if !IsValidReturnValue(string(returnVal)) {
+			report(column, "unknown return value %q", returnVal)
+		}
+		if _, ok := control.Complex[returnVal]; ok {
+			report(column, "duplicate return value %q", returnVal)
+		} else {
+			control.Order = append(control.Order, returnVal)
+		}
 
 		// Check if action is a number (jump)
-		var jumpNum int
-		if n, err := fmt.Sscanf(actionStr, "%d", &jumpNum); n == 1 && err == nil {
+		actionColumn := column + len(parts[0]) + 1
+		if jumpNum, err := strconv.Atoi(actionStr); err == nil {
+			if err := checkAction(jumpNum); err != nil {
+				report(actionColumn, "%v for %q", err, returnVal)
+			}
 			control.Complex[returnVal] = jumpNum
 		} else {
 			// It's an action type
 			action := ActionType(actionStr)
+			if err := checkAction(action); err != nil {
+				report(actionColumn, "%v for %q", err, returnVal)
+			}
 			control.Complex[returnVal] = action
 		}
 	}
 
-	return control, nil
+	return control, problems
 }
 
 // parseArguments parses module arguments, handling square bracket escaping
@@ -451,16 +584,30 @@ func tokenizeLine(line string) []string {
 	return tokens
 }
 
+// tokenColumn returns the 1-based column at which tokens[idx] starts in line
+func tokenColumn(line string, tokens []string, idx int) int {
+	pos := 0
+	for i := 0; i <= idx; i++ {
+		index := strings.Index(line[pos:], tokens[i])
+		if index < 0 {
+			return 1
+		}
+		if i == idx {
+			return pos + index + 1
+		}
+		pos += index + len(tokens[i])
+	}
+	return 1
+}
+
 // parseLine parses a single line of PAM configuration
 func (p *Parser) parseLine(line string, lineNum int, isPamD bool, serviceName string) (*Rule, string, error) {
-	originalLine := line
+	if p.libpamCompat {
+		return p.parseLibpamLine(line, lineNum, isPamD, serviceName)
+	}
 
-	// Handle line continuation
+	originalLine := line
 	line = strings.TrimRight(line, " \t\n\r")
-	continuation := strings.HasSuffix(line, "\\")
-	if continuation {
-		line = strings.TrimSuffix(line, "\\")
-	}
 
 	// Check for comment-only line
 	if commentMatch := p.commentPattern.FindStringSubmatch(originalLine); commentMatch != nil {
@@ -474,8 +621,7 @@ func (p *Parser) parseLine(line string, lineNum int, isPamD bool, serviceName st
 
 	// Parse rule line
 	rule := Rule{
-		LineNumber:   lineNum,
-		Continuation: continuation,
+		LineNumber: lineNum,
 	}
 
 	// Set service name for pam.d format files
@@ -536,10 +682,21 @@ func (p *Parser) parseLine(line string, lineNum int, isPamD bool, serviceName st
 		return nil, "", fmt.Errorf("missing control field at line %d", lineNum)
 	}
 
-	control, err := p.parseControl(tokens[tokenIdx])
+	control, problems, err := p.parseControlField(tokens[tokenIdx])
 	if err != nil {
 		return nil, "", fmt.Errorf("error parsing control at line %d: %w", lineNum, err)
 	}
+	if len(problems) > 0 {
+		column := tokenColumn(line, tokens, tokenIdx)
+		for i := range problems {
+			problems[i].Line = lineNum
+			problems[i].Column += column - 1
+		}
+		if !p.lenient {
+			return nil, "", problems
+		}
+		p.warnings = append(p.warnings, problems...)
+	}
 	rule.Control = control
 	tokenIdx++
 
@@ -559,30 +716,75 @@ func (p *Parser) parseLine(line string, lineNum int, isPamD bool, serviceName st
 	return &rule, "", nil
 }
 
-// handleContinuation processes line continuation logic
-func (p *Parser) handleContinuation(currentRule *Rule, currentLine *strings.Builder, line string, isPamD bool, serviceName string, config *Config) error {
-	currentLine.WriteString(" ")
-	currentLine.WriteString(strings.TrimSpace(line))
+// continues reports whether a physical line ends with a continuation backslash. As in
+// libpam, a comment ends the logical line, so a backslash before or inside it does not count.
+func (p *Parser) continues(line string) bool {
+	if p.libpamCompat {
+		return continuesLibpam(line)
+	}
+	tokens := tokenizeLine(line)
+	if len(tokens) == 0 {
+		return false
+	}
+	last := tokens[len(tokens)-1]
+	return !strings.HasPrefix(last, "#") && strings.HasSuffix(last, "\\")
+}
 
-	// Check if this line continues
-	if !strings.HasSuffix(strings.TrimSpace(line), "\\") {
-		// End of continuation, parse the complete line
-		completeLine := currentLine.String()
-		rule, comment, err := p.parseLine(completeLine, currentRule.LineNumber, isPamD, serviceName)
-		if err != nil {
-			return err
+// parseFragments parses a rule continued across several physical lines. Blank and comment
+// lines inside the continuation are skipped as libpam does. Control problems are reported
+// at the physical line and column they were found on.
+func (p *Parser) parseFragments(fragments []LineFragment, isPamD bool, serviceName string) (*Rule, error) {
+	type segment struct{ start, line, column int }
+	var joined strings.Builder
+	var segments []segment
+	for _, fragment := range fragments {
+		text := strings.TrimRight(fragment.Text, " \t\r")
+		trimmed := strings.TrimLeft(text, " \t")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
 		}
+		if joined.Len() > 0 {
+			joined.WriteString(" ")
+		}
+		segments = append(segments, segment{start: joined.Len(), line: fragment.Line, column: len(text) - len(trimmed)})
+		if p.continues(fragment.Text) {
+			trimmed = strings.TrimSuffix(trimmed, "\\")
+		}
+		joined.WriteString(trimmed)
+	}
+	if len(segments) == 0 {
+		return nil, nil
+	}
 
-		if rule != nil {
-			config.Rules = append(config.Rules, *rule)
-		} else if comment != "" {
-			config.Comments = append(config.Comments, comment)
+	// locate maps a 1-based column in the joined line back to its physical line
+	locate := func(problem *ControlProblem) {
+		for i := len(segments) - 1; i >= 0; i-- {
+			if problem.Column-1 >= segments[i].start {
+				problem.Line = segments[i].line
+				problem.Column += segments[i].column - segments[i].start
+				return
+			}
 		}
+	}
 
-		currentRule = nil
-		currentLine.Reset()
+	warnings := len(p.warnings)
+	rule, _, err := p.parseLine(joined.String(), fragments[0].Line, isPamD, serviceName)
+	if problems, ok := err.(ControlProblems); ok {
+		for i := range problems {
+			locate(&problems[i])
+		}
+		return nil, problems
+	}
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	for i := warnings; i < len(p.warnings); i++ {
+		locate(&p.warnings[i])
+	}
+
+	rule.Continuation = true
+	rule.Fragments = fragments
+	return rule, nil
 }
 
 // Parse parses a PAM configuration from a reader
@@ -594,22 +796,42 @@ func (p *Parser) Parse(reader io.Reader, isPamD bool) (*Config, error) {
 // For pam.d format files, if serviceName is provided, it will be set on all rules
 func (p *Parser) ParseWithService(reader io.Reader, isPamD bool, serviceName string) (*Config, error) {
 	config := &Config{
-		IsPamD: isPamD,
+		IsPamD:       isPamD,
+		libpamCompat: p.libpamCompat,
 	}
+	p.warnings = nil
 
 	scanner := bufio.NewScanner(reader)
+	if p.libpamCompat {
+		scanner.Split(scanLibpamLines)
+	}
 	lineNum := 0
-	var currentRule *Rule
-	var currentLine strings.Builder
+	var pending []LineFragment
+
+	// finish parses the pending fragments of a continued rule
+	finish := func() error {
+		rule, err := p.parseFragments(pending, isPamD, serviceName)
+		pending = nil
+		if err != nil {
+			return err
+		}
+		if rule != nil {
+			config.Rules = append(config.Rules, *rule)
+		}
+		return nil
+	}
 
 	for scanner.Scan() {
 		lineNum++
 		line := scanner.Text()
 
-		// Handle continuation from previous line
-		if currentRule != nil {
-			err := p.handleContinuation(currentRule, &currentLine, line, isPamD, serviceName, config)
-			if err != nil {
+		// Collect the physical lines of a continued rule
+		if len(pending) > 0 || p.continues(line) {
+			pending = append(pending, LineFragment{Line: lineNum, Text: line})
+			if p.continues(line) || strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+				continue
+			}
+			if err := finish(); err != nil {
 				return nil, err
 			}
 			continue
@@ -621,21 +843,27 @@ func (p *Parser) ParseWithService(reader io.Reader, isPamD bool, serviceName str
 		}
 
 		if rule != nil {
-			if rule.Continuation {
-				// Start of a continuation
-				currentRule = rule
-				currentLine.WriteString(line[:len(line)-1]) // Remove the \ at the end
-			} else {
-				config.Rules = append(config.Rules, *rule)
-			}
+			config.Rules = append(config.Rules, *rule)
 		} else if comment != "" {
 			config.Comments = append(config.Comments, comment)
 		}
 	}
 
+	// A continuation on the last line ends with the input
+	if len(pending) > 0 {
+		if err := finish(); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("error reading input: %w", err)
 	}
 
+	for i := range config.Rules {
+		config.Rules[i].ID = RuleID(i + 1)
+	}
+	config.lastID = RuleID(len(config.Rules))
+
 	return config, nil
 }
@@ -169,14 +169,18 @@ func TestParser_ComplexControlEdgeCases(t *testing.T) {
 		}
 	})
 
-	// Test invalid complex control - actually this doesn't fail
+	// Test invalid complex control
 	t.Run("invalid complex control", func(t *testing.T) {
 		input := `auth [invalid=action] pam_unix.so`
-		config, err := parser.Parse(strings.NewReader(input), true)
+		if _, err := parser.Parse(strings.NewReader(input), true); err == nil {
+			t.Error("expected error for invalid complex control")
+		}
+
+		// Lenient mode keeps the entry and records warnings
+		config, err := NewParser().SetLenient(true).Parse(strings.NewReader(input), true)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
-		// Should parse successfully but with invalid return value
 		rule := config.Rules[0]
 		if rule.Control.Complex == nil {
 			t.Fatal("expected complex control")
@@ -254,3 +258,32 @@ func TestParser_ArgumentEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestRule_ArgumentHelpers(t *testing.T) {
+	rule := Rule{
+		Type:       ModuleTypeAuth,
+		ModulePath: "/lib/security/pam_faillock.so",
+		Arguments:  []string{"preauth", "deny=5", "unlock_time=900"},
+	}
+
+	if rule.ModuleName() != "pam_faillock.so" {
+		t.Errorf("ModuleName() = %q, want pam_faillock.so", rule.ModuleName())
+	}
+	if !rule.IsModule("pam_faillock.so") {
+		t.Error("expected IsModule to ignore the directory component")
+	}
+	if value, ok := rule.ArgumentValue("deny"); !ok || value != "5" {
+		t.Errorf("ArgumentValue(deny) = %q, %v, want 5, true", value, ok)
+	}
+	if _, ok := rule.ArgumentValue("preauth"); ok {
+		t.Error("expected ArgumentValue to ignore flag arguments")
+	}
+	if !rule.HasArgument("preauth") || !rule.HasArgument("unlock_time") || rule.HasArgument("audit") {
+		t.Error("HasArgument returned unexpected results")
+	}
+
+	directive := Rule{IsDirective: true, DirectiveType: "include", DirectiveTarget: "pam_faillock.so"}
+	if directive.IsModule("pam_faillock.so") {
+		t.Error("directives should never match IsModule")
+	}
+}
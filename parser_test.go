@@ -1,6 +1,7 @@
 package pamparser
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -320,6 +321,55 @@ func TestParser_ParseLineContinuation(t *testing.T) {
 	}
 }
 
+func TestParser_ContinuationFragments(t *testing.T) {
+	content := "# header\n" +
+		"auth required pam_mysql.so user=test \\\n" +
+		"\n" +
+		"    # skipped like libpam does\n" +
+		"    db=testdb \\\n" +
+		"    [query=select user from users]\n" +
+		"account required pam_unix.so # not continued \\\n" +
+		"session required pam_unix.so\n"
+
+	config, err := NewParser().Parse(strings.NewReader(content), true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(config.Rules) != 3 {
+		t.Fatalf("Expected 3 rules, got %d", len(config.Rules))
+	}
+
+	rule := config.Rules[0]
+	wantArgs := []string{"user=test", "db=testdb", "query=select user from users"}
+	if !reflect.DeepEqual(rule.Arguments, wantArgs) {
+		t.Errorf("Expected arguments %q, got %q", wantArgs, rule.Arguments)
+	}
+	if !rule.Continuation || rule.LineNumber != 2 {
+		t.Errorf("Expected continued rule at line 2, got continuation=%v line=%d", rule.Continuation, rule.LineNumber)
+	}
+	var lines []int
+	for _, fragment := range rule.Fragments {
+		lines = append(lines, fragment.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{2, 3, 4, 5, 6}) {
+		t.Errorf("Expected fragments on lines 2-6, got %v", lines)
+	}
+
+	if config.Rules[1].LineNumber != 7 || config.Rules[1].Continuation || config.Rules[2].LineNumber != 8 {
+		t.Errorf("Expected a comment to end the logical line, got %+v", config.Rules[1:])
+	}
+}
+
+func TestParser_ContinuationProblemPosition(t *testing.T) {
+	content := "auth \\\n  [success=ok \\\n   defualt=bad] pam_unix.so\n"
+
+	_, err := NewParser().Parse(strings.NewReader(content), true)
+	want := `line 3, column 4: unknown return value "defualt"`
+	if err == nil || err.Error() != want {
+		t.Errorf("Expected error %q, got %v", want, err)
+	}
+}
+
 // Helper function to create pointer to ControlType
 func ptrControlType(ct ControlType) *ControlType {
 	return &ct
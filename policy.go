@@ -0,0 +1,534 @@
+package pamparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyState is the desired state of a rule in a policy
+type PolicyState string
+
+const (
+	// PolicyPresent means a matching rule must exist with the declared control and arguments
+	PolicyPresent PolicyState = "present"
+	// PolicyAbsent means no matching rule may exist
+	PolicyAbsent PolicyState = "absent"
+)
+
+// PolicyAction is a single kind of edit computed by the planner
+type PolicyAction string
+
+const (
+	// PolicyActionAdd inserts a new rule
+	PolicyActionAdd PolicyAction = "add"
+	// PolicyActionRemove removes a rule
+	PolicyActionRemove PolicyAction = "remove"
+	// PolicyActionSetControl replaces a rule's control
+	PolicyActionSetControl PolicyAction = "set_control"
+	// PolicyActionSetArgument adds or updates a name=value argument
+	PolicyActionSetArgument PolicyAction = "set_argument"
+	// PolicyActionAddFlag adds a flag argument
+	PolicyActionAddFlag PolicyAction = "add_flag"
+	// PolicyActionRemoveArgument removes an argument by name
+	PolicyActionRemoveArgument PolicyAction = "remove_argument"
+	// PolicyActionMove moves a rule to satisfy an ordering constraint
+	PolicyActionMove PolicyAction = "move"
+)
+
+// PolicyRule declares the desired state of the rules for one module within a module type
+type PolicyRule struct {
+	Type            ModuleType  `json:"type" yaml:"type"`
+	Module          string      `json:"module" yaml:"module"`
+	State           PolicyState `json:"state,omitempty" yaml:"state,omitempty"`
+	Control         string      `json:"control,omitempty" yaml:"control,omitempty"`
+	Comment         string      `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Before          string      `json:"before,omitempty" yaml:"before,omitempty"` // module that must come after this rule
+	After           string      `json:"after,omitempty" yaml:"after,omitempty"`   // module that must come before this rule
+	Match           []string    `json:"match,omitempty" yaml:"match,omitempty"`   // arguments that identify which instance of the module is meant
+	Arguments       []string    `json:"arguments,omitempty" yaml:"arguments,omitempty"`
+	AbsentArguments []string    `json:"absent_arguments,omitempty" yaml:"absent_arguments,omitempty"`
+}
+
+// Policy is a set of rule constraints, optionally scoped to a single service
+type Policy struct {
+	Name    string       `json:"name,omitempty" yaml:"name,omitempty"`
+	Service string       `json:"service,omitempty" yaml:"service,omitempty"`
+	Rules   []PolicyRule `json:"rules" yaml:"rules"`
+}
+
+// PolicyDocument is a YAML or JSON document declaring desired PAM stack state
+type PolicyDocument struct {
+	Policies []Policy `json:"policies" yaml:"policies"`
+}
+
+// PolicyOperation is one Editor operation computed by the planner. Indices refer to the
+// configuration as it is after all previous operations of the plan have been applied.
+type PolicyOperation struct {
+	Action      PolicyAction `json:"action"`
+	Description string       `json:"description"`
+	Policy      string       `json:"policy,omitempty"`
+	Rule        Rule         `json:"rule"`
+	Argument    string       `json:"argument,omitempty"`
+	Value       string       `json:"value,omitempty"`
+	Index       int          `json:"index"`
+	ToIndex     int          `json:"to_index,omitempty"`
+}
+
+// PolicyPlan is the ordered list of operations that converge a configuration to a policy
+type PolicyPlan struct {
+	Operations []PolicyOperation `json:"operations"`
+	Before     *Config           `json:"-"`
+	After      *Config           `json:"-"`
+}
+
+// ParsePolicyDocument parses a policy document in JSON or YAML format
+func ParsePolicyDocument(data []byte) (*PolicyDocument, error) {
+	doc := &PolicyDocument{}
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(doc); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON policy: %w", err)
+		}
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(trimmed))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(doc); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML policy: %w", err)
+		}
+	}
+
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// LoadPolicyFile loads a policy document from a .json, .yaml or .yml file
+func LoadPolicyFile(path string) (*PolicyDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file %s: %w", path, err)
+	}
+	doc, err := ParsePolicyDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// Validate checks the document for missing or invalid fields
+func (d *PolicyDocument) Validate() error {
+	parser := NewParser()
+	for pi, policy := range d.Policies {
+		name := policy.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", pi)
+		}
+		for ri, rule := range policy.Rules {
+			prefix := fmt.Sprintf("policy %s rule %d", name, ri)
+			if !IsValidModuleType(string(rule.Type)) {
+				return fmt.Errorf("%s: invalid module type '%s'", prefix, rule.Type)
+			}
+			if rule.Module == "" {
+				return fmt.Errorf("%s: missing module", prefix)
+			}
+			switch rule.State {
+			case "", PolicyPresent, PolicyAbsent:
+			default:
+				return fmt.Errorf("%s: invalid state '%s'", prefix, rule.State)
+			}
+			if rule.Control != "" {
+				if _, err := parser.parseControl(rule.Control); err != nil {
+					return fmt.Errorf("%s: %w", prefix, err)
+				}
+			} else if rule.State != PolicyAbsent {
+				return fmt.Errorf("%s: present rules need a control", prefix)
+			}
+			if rule.Before != "" && rule.After != "" && rule.Before == rule.After {
+				return fmt.Errorf("%s: cannot be both before and after %s", prefix, rule.Before)
+			}
+		}
+	}
+	return nil
+}
+
+// configService returns the service a configuration applies to, if known
+func configService(config *Config) string {
+	if !config.IsPamD {
+		return ""
+	}
+	if config.FilePath != "" {
+		return filepath.Base(config.FilePath)
+	}
+	for _, rule := range config.Rules {
+		if rule.Service != "" {
+			return rule.Service
+		}
+	}
+	return ""
+}
+
+// appliesTo reports whether a policy applies to the configuration
+func (p *Policy) appliesTo(config *Config) bool {
+	if p.Service == "" || !config.IsPamD {
+		return true
+	}
+	service := configService(config)
+	return service == "" || strings.EqualFold(service, p.Service)
+}
+
+// matches reports whether an existing rule is the one a policy rule refers to
+func (pr PolicyRule) matches(rule Rule, service string) bool {
+	if rule.IsDirective || !rule.IsModule(filepath.Base(pr.Module)) {
+		return false
+	}
+	if GetNormalizedModuleType(rule.Type) != GetNormalizedModuleType(pr.Type) {
+		return false
+	}
+	if service != "" && rule.Service != "" && !strings.EqualFold(rule.Service, service) {
+		return false
+	}
+	for _, arg := range pr.Match {
+		if !slices.Contains(rule.Arguments, arg) {
+			return false
+		}
+	}
+	return true
+}
+
+// description returns a short label for the policy rule
+func (pr PolicyRule) description() string {
+	label := string(pr.Type) + " " + pr.Module
+	if len(pr.Match) > 0 {
+		label += " [" + strings.Join(pr.Match, " ") + "]"
+	}
+	return label
+}
+
+// planner simulates operations on a working copy of a configuration
+type planner struct {
+	editor *Editor
+	plan   *PolicyPlan
+	parser *Parser
+}
+
+// record appends an operation to the plan and applies it to the working copy
+func (pl *planner) record(op PolicyOperation) error {
+	if err := op.apply(pl.editor); err != nil {
+		return err
+	}
+	pl.plan.Operations = append(pl.plan.Operations, op)
+	return nil
+}
+
+// Plan computes the minimal operations that converge the configuration to every applicable policy.
+// The configuration itself is not modified.
+func (d *PolicyDocument) Plan(config *Config) (*PolicyPlan, error) {
+	pl := &planner{
+		editor: NewEditor(NewEditor(config).GetConfig()),
+		plan:   &PolicyPlan{Before: NewEditor(config).GetConfig()},
+		parser: NewParser(),
+	}
+
+	for _, policy := range d.Policies {
+		if !policy.appliesTo(config) {
+			continue
+		}
+		for _, rule := range policy.Rules {
+			if err := pl.planRule(policy, rule, config.IsPamD); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	pl.plan.After = pl.editor.GetConfig()
+	return pl.plan, nil
+}
+
+// planRule computes the operations for a single policy rule
+func (pl *planner) planRule(policy Policy, pr PolicyRule, isPamD bool) error {
+	service := ""
+	if !isPamD {
+		service = policy.Service
+	}
+	rules := func() []Rule { return pl.editor.config.Rules }
+	find := func() int {
+		for i, rule := range rules() {
+			if pr.matches(rule, service) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	if pr.State == PolicyAbsent {
+		for i := find(); i >= 0; i = find() {
+			if err := pl.record(PolicyOperation{
+				Action:      PolicyActionRemove,
+				Description: "remove " + describeRule(rules()[i]),
+				Policy:      policy.Name,
+				Rule:        rules()[i],
+				Index:       i,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	control, err := pl.parser.parseControl(pr.Control)
+	if err != nil {
+		return fmt.Errorf("policy %s: %s: %w", policy.Name, pr.description(), err)
+	}
+
+	index := find()
+	if index < 0 {
+		rule := Rule{
+			Service:    service,
+			Type:       pr.Type,
+			Control:    control,
+			ModulePath: pr.Module,
+			Arguments:  mergePolicyArguments(pr.Match, pr.Arguments),
+			Comment:    pr.Comment,
+		}
+		position := pl.insertPosition(pr, service)
+		return pl.record(PolicyOperation{
+			Action:      PolicyActionAdd,
+			Description: fmt.Sprintf("add %s at position %d", describeRule(rule), position),
+			Policy:      policy.Name,
+			Rule:        rule,
+			Index:       position,
+		})
+	}
+
+	if !Equivalent(rules()[index].Control, control) {
+		w := NewWriter()
+		if err := pl.record(PolicyOperation{
+			Action: PolicyActionSetControl,
+			Description: fmt.Sprintf("%s: control %s -> %s", pr.description(),
+				w.formatControl(rules()[index].Control), w.formatControl(control)),
+			Policy: policy.Name,
+			Rule:   Rule{Control: control},
+			Index:  index,
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, arg := range pr.Arguments {
+		name, value, hasValue := strings.Cut(arg, "=")
+		current := rules()[index]
+		op := PolicyOperation{Policy: policy.Name, Index: index, Argument: name, Value: value}
+		switch {
+		case hasValue:
+			if existing, ok := current.ArgumentValue(name); ok && existing == value {
+				continue
+			}
+			op.Action = PolicyActionSetArgument
+			op.Description = fmt.Sprintf("%s: set %s", pr.description(), arg)
+		default:
+			if slices.Contains(current.Arguments, arg) {
+				continue
+			}
+			op.Action = PolicyActionAddFlag
+			op.Description = fmt.Sprintf("%s: add %s", pr.description(), arg)
+		}
+		if err := pl.record(op); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range pr.AbsentArguments {
+		if !rules()[index].HasArgument(name) {
+			continue
+		}
+		if err := pl.record(PolicyOperation{
+			Action:      PolicyActionRemoveArgument,
+			Description: fmt.Sprintf("%s: remove %s", pr.description(), name),
+			Policy:      policy.Name,
+			Argument:    name,
+			Index:       index,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return pl.planOrder(policy, pr, index, service)
+}
+
+// planOrder moves a rule to satisfy its before/after constraints
+func (pl *planner) planOrder(policy Policy, pr PolicyRule, index int, service string) error {
+	rules := pl.editor.config.Rules
+	rule := rules[index]
+
+	if pr.Before != "" {
+		if first := pl.findModule(pr.Type, pr.Before, service, false); first >= 0 && index > first {
+			return pl.record(PolicyOperation{
+				Action:      PolicyActionMove,
+				Description: fmt.Sprintf("%s: move before %s", pr.description(), pr.Before),
+				Policy:      policy.Name,
+				Rule:        rule,
+				Index:       index,
+				ToIndex:     first,
+			})
+		}
+	}
+
+	if pr.After != "" {
+		if last := pl.findModule(pr.Type, pr.After, service, true); last >= 0 && index < last {
+			// once the rule is removed the anchor shifts up by one, so inserting at its old
+			// index places the rule directly after it
+			return pl.record(PolicyOperation{
+				Action:      PolicyActionMove,
+				Description: fmt.Sprintf("%s: move after %s", pr.description(), pr.After),
+				Policy:      policy.Name,
+				Rule:        rule,
+				Index:       index,
+				ToIndex:     last,
+			})
+		}
+	}
+
+	return nil
+}
+
+// findModule returns the first (or last) rule of the type invoking the module
+func (pl *planner) findModule(moduleType ModuleType, module, service string, last bool) int {
+	found := -1
+	for i, rule := range pl.editor.config.Rules {
+		if rule.IsDirective || GetNormalizedModuleType(rule.Type) != GetNormalizedModuleType(moduleType) {
+			continue
+		}
+		if service != "" && rule.Service != "" && !strings.EqualFold(rule.Service, service) {
+			continue
+		}
+		if rule.IsModule(filepath.Base(module)) {
+			found = i
+			if !last {
+				return found
+			}
+		}
+	}
+	return found
+}
+
+// insertPosition chooses where a new rule goes: before/after its anchors if present,
+// otherwise at the end of its module type group as AddRule would
+func (pl *planner) insertPosition(pr PolicyRule, service string) int {
+	if pr.Before != "" {
+		if first := pl.findModule(pr.Type, pr.Before, service, false); first >= 0 {
+			return first
+		}
+	}
+	if pr.After != "" {
+		if last := pl.findModule(pr.Type, pr.After, service, true); last >= 0 {
+			return last + 1
+		}
+	}
+	return pl.editor.findInsertPosition(pr.Type)
+}
+
+// mergePolicyArguments combines identifying and declared arguments without duplicates
+func mergePolicyArguments(match, args []string) []string {
+	merged := append([]string(nil), match...)
+	for _, arg := range args {
+		if !slices.Contains(merged, arg) {
+			merged = append(merged, arg)
+		}
+	}
+	return merged
+}
+
+// apply performs the operation with the editor
+func (op PolicyOperation) apply(editor *Editor) error {
+	switch op.Action {
+	case PolicyActionAdd:
+		return editor.InsertRule(op.Index, op.Rule)
+	case PolicyActionRemove:
+		return editor.RemoveRule(op.Index)
+	case PolicyActionSetControl:
+		return editor.SetControl(op.Index, op.Rule.Control)
+	case PolicyActionSetArgument:
+		return editor.UpdateArgument(op.Index, op.Argument, op.Value)
+	case PolicyActionAddFlag:
+		if op.Index < 0 || op.Index >= len(editor.config.Rules) {
+			return fmt.Errorf("rule index %d out of range [0, %d)", op.Index, len(editor.config.Rules))
+		}
+		rule := editor.config.Rules[op.Index]
+		rule.Arguments = append(slices.Clone(rule.Arguments), op.Argument)
+		return editor.UpdateRule(op.Index, rule)
+	case PolicyActionRemoveArgument:
+		return editor.RemoveArgument(op.Index, op.Argument)
+	case PolicyActionMove:
+		if op.Index < 0 || op.Index >= len(editor.config.Rules) {
+			return fmt.Errorf("rule index %d out of range [0, %d)", op.Index, len(editor.config.Rules))
+		}
+		rule := editor.config.Rules[op.Index]
+		if err := editor.RemoveRule(op.Index); err != nil {
+			return err
+		}
+		return editor.InsertRule(op.ToIndex, rule)
+	default:
+		return fmt.Errorf("unknown policy action '%s'", op.Action)
+	}
+}
+
+// HasChanges reports whether the plan contains any operations
+func (p *PolicyPlan) HasChanges() bool {
+	return len(p.Operations) > 0
+}
+
+// Apply performs the plan's operations, in order, with the editor.
+// The editor must hold the configuration the plan was computed for.
+func (p *PolicyPlan) Apply(editor *Editor) error {
+	for i, op := range p.Operations {
+		if err := op.apply(editor); err != nil {
+			return fmt.Errorf("operation %d (%s): %w", i+1, op.Description, err)
+		}
+	}
+	return nil
+}
+
+// Report renders the plan as a human-readable list of changes
+func (p *PolicyPlan) Report() string {
+	if !p.HasChanges() {
+		return "no changes\n"
+	}
+
+	var b strings.Builder
+	for _, op := range p.Operations {
+		if op.Policy != "" {
+			fmt.Fprintf(&b, "[%s] ", op.Policy)
+		}
+		fmt.Fprintf(&b, "%s: %s\n", op.Action, op.Description)
+	}
+	fmt.Fprintf(&b, "%d operation(s)\n", len(p.Operations))
+	return b.String()
+}
+
+// Diff returns the structural difference the plan would make
+func (p *PolicyPlan) Diff() *ConfigDiff {
+	return Diff(p.Before, p.After)
+}
+
+// Converge plans and applies the document to the editor's configuration, returning the applied plan
+func (d *PolicyDocument) Converge(editor *Editor) (*PolicyPlan, error) {
+	plan, err := d.Plan(editor.config)
+	if err != nil {
+		return nil, err
+	}
+	if err := plan.Apply(editor); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
@@ -0,0 +1,200 @@
+package pamparser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const faillockPolicyYAML = `policies:
+  - name: faillock
+    service: sshd
+    rules:
+      - type: auth
+        module: pam_faillock.so
+        control: required
+        match: [preauth]
+        arguments: [deny=5]
+        before: pam_unix.so
+      - type: auth
+        module: pam_faillock.so
+        control: "[default=die]"
+        match: [authfail]
+        arguments: [deny=5]
+        after: pam_unix.so
+      - type: auth
+        module: pam_rootok.so
+        state: absent
+`
+
+func TestParsePolicyDocument(t *testing.T) {
+	jsonPolicy := `{"policies": [{"service": "sshd", "rules": [
+		{"type": "auth", "module": "pam_faillock.so", "control": "required", "match": ["preauth"]}
+	]}]}`
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"yaml", faillockPolicyYAML, false},
+		{"json", jsonPolicy, false},
+		{"invalid type", "policies:\n  - rules:\n      - {type: bogus, module: pam_unix.so, control: required}\n", true},
+		{"missing module", "policies:\n  - rules:\n      - {type: auth, control: required}\n", true},
+		{"missing control", "policies:\n  - rules:\n      - {type: auth, module: pam_unix.so}\n", true},
+		{"invalid control", "policies:\n  - rules:\n      - {type: auth, module: pam_unix.so, control: \"[bogus]\"}\n", true},
+		{"invalid state", "policies:\n  - rules:\n      - {type: auth, module: pam_unix.so, state: maybe}\n", true},
+		{"unknown field", `{"policies": [{"rulez": []}]}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParsePolicyDocument([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePolicyDocument() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(doc.Policies) != 1 {
+				t.Errorf("expected 1 policy, got %d", len(doc.Policies))
+			}
+		})
+	}
+}
+
+func TestPolicyDocument_PlanAndApply(t *testing.T) {
+	doc, err := ParsePolicyDocument([]byte(faillockPolicyYAML))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	config := mustParsePamD(t, `auth sufficient pam_rootok.so
+auth [default=die] pam_faillock.so authfail deny=3
+auth required pam_unix.so nullok
+account required pam_unix.so
+`)
+	config.FilePath = "/etc/pam.d/sshd"
+	original := ruleLines(config)
+
+	plan, err := doc.Plan(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(ruleLines(config), "\n") != strings.Join(original, "\n") {
+		t.Error("Plan must not modify the configuration")
+	}
+
+	var actions []PolicyAction
+	for _, op := range plan.Operations {
+		actions = append(actions, op.Action)
+	}
+	wantActions := []PolicyAction{PolicyActionAdd, PolicyActionSetArgument, PolicyActionMove, PolicyActionRemove}
+	if strings.Join(policyActionStrings(actions), ",") != strings.Join(policyActionStrings(wantActions), ",") {
+		t.Fatalf("expected actions %v, got %v\n%s", wantActions, actions, plan.Report())
+	}
+
+	editor := NewEditor(config)
+	if err := plan.Apply(editor); err != nil {
+		t.Fatalf("unexpected apply error: %v", err)
+	}
+
+	expected := []string{
+		"auth required pam_faillock.so preauth deny=5",
+		"auth required pam_unix.so nullok",
+		"auth [default=die] pam_faillock.so authfail deny=5",
+		"account required pam_unix.so",
+	}
+	if got := ruleLines(config); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected result:\n%s", strings.Join(got, "\n"))
+	}
+	if strings.Join(ruleLines(plan.After), "\n") != strings.Join(expected, "\n") {
+		t.Error("plan.After should match the applied configuration")
+	}
+	if !plan.Diff().HasChanges() {
+		t.Error("expected plan diff to report changes")
+	}
+
+	// converging again is a no-op
+	again, err := doc.Converge(editor)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if again.HasChanges() {
+		t.Errorf("expected no changes on second run, got:\n%s", again.Report())
+	}
+	if again.Report() != "no changes\n" {
+		t.Errorf("unexpected report %q", again.Report())
+	}
+}
+
+func TestPolicyDocument_ServiceScope(t *testing.T) {
+	doc, err := ParsePolicyDocument([]byte(faillockPolicyYAML))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	config := mustParsePamD(t, "auth required pam_unix.so\n")
+	config.FilePath = "/etc/pam.d/login"
+
+	plan, err := doc.Plan(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plan.HasChanges() {
+		t.Errorf("policy for sshd should not apply to login:\n%s", plan.Report())
+	}
+}
+
+func TestPolicyDocument_ControlAndArguments(t *testing.T) {
+	doc, err := ParsePolicyDocument([]byte(`policies:
+  - rules:
+      - type: password
+        module: pam_unix.so
+        control: required
+        arguments: [sha512, rounds=65536]
+        absent_arguments: [nullok, md5]
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	config := mustParsePamD(t, "password sufficient pam_unix.so md5 nullok rounds=5000\n")
+	plan, err := doc.Converge(NewEditor(config))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(plan.Operations) != 5 {
+		t.Errorf("expected 5 operations, got %d:\n%s", len(plan.Operations), plan.Report())
+	}
+	if got := ruleLines(config)[0]; got != "password required pam_unix.so rounds=65536 sha512" {
+		t.Errorf("unexpected rule %q", got)
+	}
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(path, []byte(faillockPolicyYAML), 0o644); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+
+	doc, err := LoadPolicyFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(doc.Policies[0].Rules) != 3 {
+		t.Errorf("expected 3 rules, got %d", len(doc.Policies[0].Rules))
+	}
+
+	if _, err := LoadPolicyFile(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func policyActionStrings(actions []PolicyAction) []string {
+	out := make([]string, len(actions))
+	for i, action := range actions {
+		out[i] = string(action)
+	}
+	return out
+}
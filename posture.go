@@ -0,0 +1,505 @@
+package pamparser
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// AuthFactorKind classifies what an auth module verifies
+type AuthFactorKind string
+
+const (
+	// FactorPassword is a password checked locally or against a directory service
+	FactorPassword AuthFactorKind = "password"
+	// FactorOTP is a one-time code from an authenticator app, token or RADIUS server
+	FactorOTP AuthFactorKind = "otp"
+	// FactorPush is an out-of-band approval on another device
+	FactorPush AuthFactorKind = "push"
+	// FactorSecurityKey is a FIDO/U2F security key
+	FactorSecurityKey AuthFactorKind = "security_key"
+	// FactorSmartcard is a PKCS#11 smartcard or certificate
+	FactorSmartcard AuthFactorKind = "smartcard"
+	// FactorBiometric is a fingerprint or face scan
+	FactorBiometric AuthFactorKind = "biometric"
+)
+
+// authFactorModules maps auth modules to the factor they verify
+var authFactorModules = map[string]AuthFactorKind{
+	"pam_unix.so":                 FactorPassword,
+	"pam_sss.so":                  FactorPassword,
+	"pam_ldap.so":                 FactorPassword,
+	"pam_krb5.so":                 FactorPassword,
+	"pam_winbind.so":              FactorPassword,
+	"pam_userdb.so":               FactorPassword,
+	"pam_pwdfile.so":              FactorPassword,
+	"pam_google_authenticator.so": FactorOTP,
+	"pam_oath.so":                 FactorOTP,
+	"pam_radius_auth.so":          FactorOTP,
+	"pam_yubico.so":               FactorOTP,
+	"pam_duo.so":                  FactorPush,
+	"pam_u2f.so":                  FactorSecurityKey,
+	"pam_pkcs11.so":               FactorSmartcard,
+	"pam_p11.so":                  FactorSmartcard,
+	"pam_fprintd.so":              FactorBiometric,
+}
+
+// unixHashes are the pam_unix arguments that select a password hash
+var unixHashes = []string{"md5", "bigcrypt", "sha256", "sha512", "blowfish", "gost_yescrypt", "yescrypt"}
+
+// cracklibDefaults are pam_cracklib's built-in settings (see pam_cracklib(8))
+var cracklibDefaults = map[string]string{
+	"minlen": "9", "dcredit": "1", "ucredit": "1", "lcredit": "1", "ocredit": "1",
+	"minclass": "0", "difok": "5", "retry": "1",
+}
+
+// DefaultLoginDefsFile holds ENCRYPT_METHOD, which pam_unix uses when no hash argument is given
+const DefaultLoginDefsFile = "/etc/login.defs"
+
+// AuthStep is one module of a service's auth stack as it bears on authentication strength
+type AuthStep struct {
+	Module     string         `json:"module"`
+	Kind       AuthFactorKind `json:"kind,omitempty"` // empty for modules that verify no credential
+	Control    string         `json:"control"`
+	Required   bool           `json:"required"`   // failure fails the stack
+	Sufficient bool           `json:"sufficient"` // success ends the stack
+	File       string         `json:"file"`
+	Line       int            `json:"line"`
+}
+
+// LockoutPolicy is the account lockout applied after failed logins
+type LockoutPolicy struct {
+	Module       string `json:"module"`
+	Deny         int    `json:"deny"`        // failures before lockout, 0 for never
+	UnlockTime   int    `json:"unlock_time"` // seconds, 0 for manual unlock only
+	FailInterval int    `json:"fail_interval,omitempty"`
+	EvenDenyRoot bool   `json:"even_deny_root"`
+}
+
+// PasswordPolicy is the password quality and storage policy applied on password change
+type PasswordPolicy struct {
+	QualityModule  string `json:"quality_module,omitempty"`
+	MinLen         int    `json:"minlen,omitempty"`
+	DCredit        int    `json:"dcredit"`
+	UCredit        int    `json:"ucredit"`
+	LCredit        int    `json:"lcredit"`
+	OCredit        int    `json:"ocredit"`
+	MinClass       int    `json:"minclass,omitempty"`
+	Retry          int    `json:"retry,omitempty"`
+	EnforceForRoot bool   `json:"enforce_for_root,omitempty"`
+	Remember       int    `json:"remember,omitempty"`        // previous passwords that may not be reused
+	RememberSource string `json:"remember_source,omitempty"` // argument, default, or the file it was read from
+	Hash           string `json:"hash,omitempty"`
+	HashSource     string `json:"hash_source,omitempty"`   // argument, or the file the hash was read from
+	Rounds         int    `json:"rounds,omitempty"`        // sha256/sha512 rounds, 0 if not configured
+	RoundsSource   string `json:"rounds_source,omitempty"` // argument, or the file the rounds were read from
+
+	evidence map[string]ComplianceEvidence // where remember, hash and rounds were set
+}
+
+// setEvidence records where a policy value was set
+func (pw *PasswordPolicy) setEvidence(key string, evidence ComplianceEvidence) {
+	if pw.evidence == nil {
+		pw.evidence = make(map[string]ComplianceEvidence)
+	}
+	pw.evidence[key] = evidence
+}
+
+// ServicePosture is the effective security posture of one service
+type ServicePosture struct {
+	Service         string           `json:"service"`
+	Files           []string         `json:"files"`
+	Auth            []AuthStep       `json:"auth"`
+	RequiredFactors []AuthFactorKind `json:"required_factors"`
+	Bypasses        []string         `json:"bypasses,omitempty"` // sufficient modules that verify no credential
+	EmptyPasswords  bool             `json:"empty_passwords"`
+	Lockout         *LockoutPolicy   `json:"lockout,omitempty"`
+	Password        *PasswordPolicy  `json:"password,omitempty"`
+	Session         []string         `json:"session"`
+	Warnings        []string         `json:"warnings,omitempty"`
+}
+
+// PostureReport is the posture of every service on a host
+type PostureReport struct {
+	Root     string            `json:"root,omitempty"`
+	Services []*ServicePosture `json:"services"`
+}
+
+// controlLabel renders a control the way it is written in a rule
+func controlLabel(control Control) string {
+	return NewWriter().formatControl(control)
+}
+
+// controlBlocks reports whether a module failing makes the stack fail, and whether a module
+// succeeding ends the stack
+func controlBlocks(control Control) (required, sufficient bool) {
+	actions, ok := control.actions()
+	if !ok {
+		return false, false
+	}
+	effective := effectiveActions(actions)
+	failure := effectiveAction(effective, ReturnAuthErr)
+	required = failure == string(ActionBad) || failure == string(ActionDie)
+	sufficient = effectiveAction(effective, ReturnSuccess) == string(ActionDone)
+	return required, sufficient
+}
+
+// AssessService resolves a service's stack under root and reports its security posture.
+// root is prepended to every path; pass "" for the running system.
+func AssessService(root, service string) (*ServicePosture, error) {
+	stack, err := ResolveService(root, service)
+	if err != nil {
+		return nil, err
+	}
+	return assessStack(stack, root), nil
+}
+
+// assessStack reports the posture of a resolved stack
+func assessStack(stack *ServiceStack, root string) *ServicePosture {
+	posture := &ServicePosture{
+		Service:         stack.Service,
+		Files:           stack.Files,
+		Auth:            []AuthStep{},
+		RequiredFactors: []AuthFactorKind{},
+		Session:         []string{},
+		Warnings:        slices.Clone(stack.Warnings),
+	}
+	posture.assessAuth(stack, root)
+	posture.assessPassword(stack, root)
+	for _, rule := range stack.OfType(ModuleTypeSession) {
+		posture.Session = append(posture.Session, controlLabel(rule.Control)+" "+rule.ModuleName())
+	}
+	return posture
+}
+
+// assessAuth fills in the auth steps, factors, empty password and lockout findings
+func (p *ServicePosture) assessAuth(stack *ServiceStack, root string) {
+	var faillock []StackRule
+	rules := stack.OfType(ModuleTypeAuth)
+	for _, rule := range rules {
+		required, sufficient := controlBlocks(rule.Control)
+		step := AuthStep{
+			Module:     rule.ModuleName(),
+			Kind:       authFactorModules[rule.ModuleName()],
+			Control:    controlLabel(rule.Control),
+			Required:   required,
+			Sufficient: sufficient,
+			File:       rule.File,
+			Line:       rule.LineNumber,
+		}
+		p.Auth = append(p.Auth, step)
+
+		if step.Kind == "" && step.Sufficient {
+			p.Bypasses = append(p.Bypasses, step.Control+" "+step.Module)
+		}
+		if rule.IsModule("pam_unix.so") && (rule.HasArgument("nullok") || rule.HasArgument("nullok_secure")) {
+			p.EmptyPasswords = true
+		}
+		if rule.IsModule(FaillockModule) {
+			faillock = append(faillock, rule)
+		}
+		if rule.IsModule("pam_tally2.so") && p.Lockout == nil {
+			p.Lockout = tallyLockout(rule.Rule)
+		}
+	}
+
+	factors, canSucceed := requiredFactors(rules)
+	p.RequiredFactors = factors
+	switch {
+	case !canSucceed && len(rules) > 0:
+		p.Warnings = append(p.Warnings, "the auth stack can never succeed")
+	case canSucceed && len(factors) == 0:
+		p.Warnings = append(p.Warnings, "no authentication factor is required to succeed")
+	}
+	if p.EmptyPasswords {
+		p.Warnings = append(p.Warnings, "pam_unix allows empty passwords (nullok)")
+	}
+	if len(faillock) > 0 {
+		p.Lockout = p.faillockLockout(faillock, root)
+	}
+}
+
+// requiredFactors returns the factors that every way through the auth stack to PAM_SUCCESS
+// verifies, in stack order: a factor is required when no path succeeds without one of its
+// modules succeeding. The second result is false if the stack can never succeed.
+func requiredFactors(rules []StackRule) ([]AuthFactorKind, bool) {
+	var kinds []AuthFactorKind
+	for _, rule := range rules {
+		if kind := authFactorModules[rule.ModuleName()]; kind != "" && !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	nodes := authNodes(rules, func(rule Rule) uint64 {
+		if index := slices.Index(kinds, authFactorModules[rule.ModuleName()]); index >= 0 {
+			return 1 << index
+		}
+		return 0
+	})
+
+	paths := authSuccessMarks(nodes)
+	factors := []AuthFactorKind{}
+	if len(paths) == 0 {
+		return factors, false
+	}
+	required := ^uint64(0)
+	for _, marks := range paths {
+		required &= marks
+	}
+	for i, kind := range kinds {
+		if required&(1<<i) != 0 {
+			factors = append(factors, kind)
+		}
+	}
+	return factors, true
+}
+
+// faillockLockout reads the lockout policy from the pam_faillock rule that records failures
+func (p *ServicePosture) faillockLockout(rules []StackRule, root string) *LockoutPolicy {
+	rule := rules[0]
+	index := slices.IndexFunc(rules, func(r StackRule) bool { return r.HasArgument("authfail") })
+	if index < 0 {
+		p.Warnings = append(p.Warnings, "pam_faillock has no authfail rule, so failures are not counted")
+	} else {
+		rule = rules[index]
+	}
+
+	settings, err := EffectiveFaillockSettings(rule.Rule, root)
+	if err != nil {
+		p.Warnings = append(p.Warnings, fmt.Sprintf("%s line %d: %v", rule.File, rule.LineNumber, err))
+		return nil
+	}
+	lockout := &LockoutPolicy{Module: FaillockModule, EvenDenyRoot: settings.Enabled("even_deny_root")}
+	lockout.Deny, _ = settings.Int("deny")
+	lockout.UnlockTime, _ = settings.Int("unlock_time")
+	lockout.FailInterval, _ = settings.Int("fail_interval")
+	return lockout
+}
+
+// tallyLockout reads the lockout policy of the legacy pam_tally2 module from its arguments
+func tallyLockout(rule Rule) *LockoutPolicy {
+	lockout := &LockoutPolicy{Module: rule.ModuleName(), EvenDenyRoot: rule.HasArgument("even_deny_root")}
+	if deny, ok := rule.ArgumentValue("deny"); ok {
+		lockout.Deny, _ = strconv.Atoi(deny)
+	}
+	if unlock, ok := rule.ArgumentValue("unlock_time"); ok {
+		lockout.UnlockTime, _ = strconv.Atoi(unlock)
+	}
+	return lockout
+}
+
+// assessPassword fills in the password policy from the password stack
+func (p *ServicePosture) assessPassword(stack *ServiceStack, root string) {
+	rules := stack.OfType(ModuleTypePassword)
+	if len(rules) == 0 {
+		return
+	}
+	policy := &PasswordPolicy{}
+
+	for _, rule := range rules {
+		var settings *EffectiveSettings
+		switch {
+		case rule.IsModule(PwqualityModule) && policy.QualityModule == "":
+			var err error
+			if settings, err = EffectivePwqualitySettings(rule.Rule, root); err != nil {
+				p.Warnings = append(p.Warnings, fmt.Sprintf("%s line %d: %v", rule.File, rule.LineNumber, err))
+			}
+		case rule.IsModule("pam_cracklib.so") && policy.QualityModule == "":
+			settings = newEffectiveSettings(rule.ModuleName(), cracklibDefaults)
+			settings.applyArguments(rule.Rule, nil)
+		case rule.IsModule(PwhistoryModule):
+			history, err := EffectivePwhistorySettings(rule.Rule, root)
+			if err != nil {
+				p.Warnings = append(p.Warnings, fmt.Sprintf("%s line %d: %v", rule.File, rule.LineNumber, err))
+				break
+			}
+			if remember, _ := history.Int("remember"); remember > policy.Remember {
+				setting := history.Settings["remember"]
+				policy.Remember, policy.RememberSource = remember, string(setting.Source)
+				if setting.Source == SettingFromFile {
+					policy.RememberSource = rootRelative(root, setting.File)
+				}
+				policy.setEvidence("remember", settingEvidence(root, setting, rule))
+			}
+		case rule.IsModule("pam_unix.so"):
+			for _, hash := range unixHashes {
+				if rule.HasArgument(hash) {
+					policy.Hash, policy.HashSource = hash, "argument"
+					policy.setEvidence("hash", ruleEvidence(rule))
+				}
+			}
+			if rounds, ok := rule.ArgumentValue("rounds"); ok {
+				policy.Rounds, _ = strconv.Atoi(rounds)
+				policy.RoundsSource = "argument"
+				policy.setEvidence("rounds", ruleEvidence(rule))
+			}
+			if value, ok := rule.ArgumentValue("remember"); ok {
+				if remember, _ := strconv.Atoi(value); remember > policy.Remember {
+					policy.Remember, policy.RememberSource = remember, "argument"
+					policy.setEvidence("remember", ruleEvidence(rule))
+				}
+			}
+		}
+
+		if settings != nil {
+			policy.QualityModule = settings.Module
+			policy.MinLen, _ = settings.Int("minlen")
+			policy.DCredit, _ = settings.Int("dcredit")
+			policy.UCredit, _ = settings.Int("ucredit")
+			policy.LCredit, _ = settings.Int("lcredit")
+			policy.OCredit, _ = settings.Int("ocredit")
+			policy.MinClass, _ = settings.Int("minclass")
+			policy.Retry, _ = settings.Int("retry")
+			policy.EnforceForRoot = settings.Enabled("enforce_for_root")
+		}
+	}
+
+	if policy.Hash == "" {
+		if method, line := loginDefsValue(root, "ENCRYPT_METHOD"); method != "" {
+			policy.Hash, policy.HashSource = strings.ToLower(method), DefaultLoginDefsFile
+			policy.setEvidence("hash", ComplianceEvidence{File: DefaultLoginDefsFile, Line: line, Rule: "ENCRYPT_METHOD " + method})
+		}
+	}
+	if policy.RoundsSource == "" && (policy.Hash == "sha256" || policy.Hash == "sha512") {
+		// without rounds=, the hash is generated with the login.defs minimum
+		if rounds, line := loginDefsValue(root, "SHA_CRYPT_MIN_ROUNDS"); rounds != "" {
+			policy.Rounds, _ = strconv.Atoi(rounds)
+			policy.RoundsSource = DefaultLoginDefsFile
+			policy.setEvidence("rounds", ComplianceEvidence{File: DefaultLoginDefsFile, Line: line, Rule: "SHA_CRYPT_MIN_ROUNDS " + rounds})
+		}
+	}
+	switch {
+	case policy.Hash == "":
+		p.Warnings = append(p.Warnings, "no password hash is configured")
+	case policy.Hash == "md5" || policy.Hash == "bigcrypt":
+		p.Warnings = append(p.Warnings, fmt.Sprintf("passwords are hashed with weak %s", policy.Hash))
+	}
+	if policy.QualityModule == "" {
+		p.Warnings = append(p.Warnings, "no password quality module is configured")
+	}
+	p.Password = policy
+}
+
+// loginDefsValue returns a setting of root/etc/login.defs and its line number, or "" if it
+// is not set
+func loginDefsValue(root, key string) (string, int) {
+	file, err := os.Open(filepath.Join(root, DefaultLoginDefsFile))
+	if err != nil {
+		return "", 0
+	}
+	defer func() { _ = file.Close() }()
+
+	value, line := "", 0
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		content, _ := splitConfigComment(scanner.Text())
+		fields := strings.Fields(content)
+		if len(fields) >= 2 && fields[0] == key {
+			value, line = fields[1], lineNum
+		}
+	}
+	return value, line
+}
+
+// AssessHost reports the posture of every service in root/etc/pam.d, as resolved by
+// FileManager.ResolveHost
+func AssessHost(root string) (*PostureReport, error) {
+	stacks, err := NewFileManager().ResolveHost(root)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PostureReport{Root: root, Services: []*ServicePosture{}}
+	for _, stack := range stacks {
+		report.Services = append(report.Services, assessStack(stack, root))
+	}
+	return report, nil
+}
+
+// Text renders the posture as a human-readable summary
+func (p *ServicePosture) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Service: %s\n", p.Service)
+	fmt.Fprintf(&b, "  Files: %s\n", strings.Join(p.Files, ", "))
+
+	factors := make([]string, len(p.RequiredFactors))
+	for i, factor := range p.RequiredFactors {
+		factors[i] = string(factor)
+	}
+	fmt.Fprintf(&b, "  Required factors: %s\n", listOrNone(factors))
+	if len(p.Bypasses) > 0 {
+		fmt.Fprintf(&b, "  Bypasses: %s\n", strings.Join(p.Bypasses, ", "))
+	}
+	fmt.Fprintf(&b, "  Empty passwords: %s\n", yesNo(p.EmptyPasswords))
+
+	if p.Lockout != nil {
+		fmt.Fprintf(&b, "  Lockout: %s deny=%d unlock_time=%d even_deny_root=%s\n",
+			p.Lockout.Module, p.Lockout.Deny, p.Lockout.UnlockTime, yesNo(p.Lockout.EvenDenyRoot))
+	} else {
+		b.WriteString("  Lockout: none\n")
+	}
+
+	if pw := p.Password; pw != nil {
+		quality := "none"
+		if pw.QualityModule != "" {
+			quality = fmt.Sprintf("%s minlen=%d dcredit=%d ucredit=%d lcredit=%d ocredit=%d",
+				pw.QualityModule, pw.MinLen, pw.DCredit, pw.UCredit, pw.LCredit, pw.OCredit)
+		}
+		fmt.Fprintf(&b, "  Password quality: %s\n", quality)
+		hash := "unset"
+		if pw.Hash != "" {
+			hash = fmt.Sprintf("%s (from %s)", pw.Hash, pw.HashSource)
+		}
+		fmt.Fprintf(&b, "  Password hash: %s\n", hash)
+		if pw.Remember > 0 {
+			fmt.Fprintf(&b, "  Password history: %d\n", pw.Remember)
+		}
+	} else {
+		b.WriteString("  Password: no password stack\n")
+	}
+
+	fmt.Fprintf(&b, "  Session modules: %s\n", listOrNone(p.Session))
+	for _, warning := range p.Warnings {
+		fmt.Fprintf(&b, "  Warning: %s\n", warning)
+	}
+	return b.String()
+}
+
+// listOrNone joins items with commas, or returns "none"
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
+
+// yesNo renders a boolean for the text report
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
+
+// JSON renders the posture as indented JSON
+func (p *ServicePosture) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// Text renders the report as one summary per service
+func (r *PostureReport) Text() string {
+	parts := make([]string, len(r.Services))
+	for i, service := range r.Services {
+		parts[i] = service.Text()
+	}
+	return strings.Join(parts, "\n")
+}
+
+// JSON renders the report as indented JSON
+func (r *PostureReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
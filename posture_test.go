@@ -0,0 +1,247 @@
+package pamparser
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// postureHost is a small RHEL-style host: sshd and login share system-auth
+var postureHost = map[string]string{
+	"/etc/pam.d/sshd": `auth       required     pam_google_authenticator.so
+auth       include      system-auth
+account    include      system-auth
+password   include      system-auth
+session    include      system-auth
+`,
+	"/etc/pam.d/login": `auth       sufficient   pam_rootok.so
+auth       include      system-auth
+session    optional     pam_keyinit.so force revoke
+`,
+	"/etc/pam.d/system-auth": `auth        required      pam_faillock.so preauth
+auth        sufficient    pam_unix.so nullok try_first_pass
+auth        [default=die] pam_faillock.so authfail
+auth        required      pam_deny.so
+account     required      pam_unix.so
+password    requisite     pam_pwquality.so retry=3
+password    required      pam_pwhistory.so use_authtok
+password    sufficient    pam_unix.so try_first_pass use_authtok
+password    required      pam_deny.so
+session     required      pam_limits.so
+session     required      pam_unix.so
+`,
+	"/etc/pam.d/sshd.rpmnew": "auth required pam_unix.so\n",
+	DefaultFaillockFile:      "deny = 5\nunlock_time = 900\n",
+	DefaultPwqualityFile:     "minlen = 14\ndcredit = -1\n",
+	DefaultPwhistoryFile:     "remember = 5\n",
+	DefaultLoginDefsFile:     "# shadow settings\nENCRYPT_METHOD SHA512\nSHA_CRYPT_MIN_ROUNDS 5000\n",
+}
+
+func TestAssessService(t *testing.T) {
+	root := writeSettingsFiles(t, postureHost)
+
+	posture, err := AssessService(root, "sshd")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// pam_unix is sufficient, but pam_faillock authfail and pam_deny fail every path without it
+	if want := []AuthFactorKind{FactorOTP, FactorPassword}; !reflect.DeepEqual(posture.RequiredFactors, want) {
+		t.Errorf("required factors = %v, want %v", posture.RequiredFactors, want)
+	}
+	if len(posture.Auth) != 5 || !posture.Auth[2].Sufficient || posture.Auth[2].Kind != FactorPassword {
+		t.Errorf("auth steps = %+v", posture.Auth)
+	}
+	if !posture.EmptyPasswords {
+		t.Error("expected nullok to allow empty passwords")
+	}
+
+	wantLockout := &LockoutPolicy{Module: FaillockModule, Deny: 5, UnlockTime: 900, FailInterval: 900}
+	if !reflect.DeepEqual(posture.Lockout, wantLockout) {
+		t.Errorf("lockout = %+v, want %+v", posture.Lockout, wantLockout)
+	}
+
+	pw := posture.Password
+	if pw == nil || pw.QualityModule != PwqualityModule || pw.MinLen != 14 || pw.DCredit != -1 || pw.Retry != 3 {
+		t.Fatalf("password policy = %+v", pw)
+	}
+	if pw.Remember != 5 || pw.RememberSource != DefaultPwhistoryFile || pw.Hash != "sha512" || pw.HashSource != DefaultLoginDefsFile {
+		t.Errorf("password storage = %+v", pw)
+	}
+	if pw.Rounds != 5000 || pw.RoundsSource != DefaultLoginDefsFile {
+		t.Errorf("rounds = %d from %q, want 5000 from login.defs", pw.Rounds, pw.RoundsSource)
+	}
+
+	if want := []string{"required pam_limits.so", "required pam_unix.so"}; !reflect.DeepEqual(posture.Session, want) {
+		t.Errorf("session = %v, want %v", posture.Session, want)
+	}
+
+	text := posture.Text()
+	for _, want := range []string{"Service: sshd", "Required factors: otp, password", "Empty passwords: yes", "deny=5 unlock_time=900", "minlen=14 dcredit=-1", "sha512 (from /etc/login.defs)"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Text() missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestAssessService_RequiredFactors(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected []AuthFactorKind
+		warning  string
+	}{
+		{
+			name: "sufficient then deny",
+			files: map[string]string{"/etc/pam.d/svc": `auth required   pam_env.so
+auth sufficient pam_unix.so
+auth required   pam_deny.so
+`},
+			expected: []AuthFactorKind{FactorPassword},
+		},
+		{
+			name: "jump over requisite deny",
+			files: map[string]string{"/etc/pam.d/svc": `auth [success=1 default=ignore] pam_unix.so nullok
+auth requisite pam_deny.so
+auth required  pam_permit.so
+`},
+			expected: []AuthFactorKind{FactorPassword},
+		},
+		{
+			name: "root bypass",
+			files: map[string]string{"/etc/pam.d/svc": `auth sufficient pam_rootok.so
+auth required   pam_unix.so
+`},
+			expected: []AuthFactorKind{},
+			warning:  "no authentication factor is required to succeed",
+		},
+		{
+			name: "permit after sufficient",
+			files: map[string]string{"/etc/pam.d/svc": `auth sufficient pam_unix.so
+auth required   pam_permit.so
+`},
+			expected: []AuthFactorKind{},
+			warning:  "no authentication factor is required to succeed",
+		},
+		{
+			name: "either factor",
+			files: map[string]string{"/etc/pam.d/svc": `auth sufficient pam_u2f.so
+auth sufficient pam_unix.so
+auth required   pam_deny.so
+`},
+			expected: []AuthFactorKind{},
+			warning:  "no authentication factor is required to succeed",
+		},
+		{
+			name: "done inside a substack",
+			files: map[string]string{
+				"/etc/pam.d/svc": `auth substack password-auth
+auth required pam_oath.so
+`,
+				"/etc/pam.d/password-auth": `auth sufficient pam_unix.so
+auth required   pam_deny.so
+`,
+			},
+			expected: []AuthFactorKind{FactorPassword, FactorOTP},
+		},
+		{
+			name: "done inside an include",
+			files: map[string]string{
+				"/etc/pam.d/svc": `auth include password-auth
+auth required pam_oath.so
+`,
+				"/etc/pam.d/password-auth": `auth sufficient pam_unix.so
+auth required   pam_deny.so
+`,
+			},
+			expected: []AuthFactorKind{FactorPassword},
+		},
+		{
+			name:     "never succeeds",
+			files:    map[string]string{"/etc/pam.d/svc": "auth required pam_unix.so\nauth required pam_deny.so\n"},
+			expected: []AuthFactorKind{},
+			warning:  "the auth stack can never succeed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posture, err := AssessService(writeSettingsFiles(t, tt.files), "svc")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(posture.RequiredFactors, tt.expected) {
+				t.Errorf("required factors = %v, want %v", posture.RequiredFactors, tt.expected)
+			}
+			hasWarning := slices.ContainsFunc(posture.Warnings, func(w string) bool { return strings.Contains(w, "succeed") })
+			if (tt.warning == "") == hasWarning || (tt.warning != "" && !slices.Contains(posture.Warnings, tt.warning)) {
+				t.Errorf("warnings = %v, want %q", posture.Warnings, tt.warning)
+			}
+		})
+	}
+}
+
+func TestAssessService_Findings(t *testing.T) {
+	root := writeSettingsFiles(t, map[string]string{
+		"/etc/pam.d/legacy": `auth     sufficient pam_permit.so
+auth     required   pam_tally2.so deny=3 unlock_time=60
+password required   pam_unix.so md5
+session  required   pam_unix.so
+`,
+	})
+
+	posture, err := AssessService(root, "legacy")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(posture.RequiredFactors) != 0 || !reflect.DeepEqual(posture.Bypasses, []string{"sufficient pam_permit.so"}) {
+		t.Errorf("factors = %v, bypasses = %v", posture.RequiredFactors, posture.Bypasses)
+	}
+	if posture.Lockout == nil || posture.Lockout.Module != "pam_tally2.so" || posture.Lockout.Deny != 3 {
+		t.Errorf("lockout = %+v", posture.Lockout)
+	}
+	if posture.Password.Hash != "md5" || posture.Password.HashSource != "argument" {
+		t.Errorf("password = %+v", posture.Password)
+	}
+
+	warnings := strings.Join(posture.Warnings, "\n")
+	for _, want := range []string{"no authentication factor", "weak md5", "no password quality module"} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("warnings missing %q: %v", want, posture.Warnings)
+		}
+	}
+}
+
+func TestAssessHost(t *testing.T) {
+	root := writeSettingsFiles(t, postureHost)
+
+	report, err := AssessHost(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var services []string
+	for _, service := range report.Services {
+		services = append(services, service.Service)
+	}
+	if want := []string{"login", "sshd"}; !reflect.DeepEqual(services, want) {
+		t.Errorf("services = %v, want %v", services, want)
+	}
+	if login := report.Services[0]; !reflect.DeepEqual(login.Bypasses, []string{"sufficient pam_rootok.so"}) || login.Password != nil {
+		t.Errorf("login posture = %+v", login)
+	}
+
+	data, err := report.JSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded PostureReport
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded.Services) != 2 {
+		t.Errorf("JSON does not round trip: %v", err)
+	}
+	if text := report.Text(); !strings.Contains(text, "Service: login") || !strings.Contains(text, "Password: no password stack") {
+		t.Errorf("Text() = %s", text)
+	}
+}
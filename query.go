@@ -0,0 +1,429 @@
+package pamparser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// OrFilters combines multiple filters with OR logic
+func OrFilters(filters ...RuleFilter) RuleFilter {
+	return func(rule Rule) bool {
+		for _, filter := range filters {
+			if filter(rule) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// NotFilter negates a filter
+func NotFilter(filter RuleFilter) RuleFilter {
+	return func(rule Rule) bool {
+		return !filter(rule)
+	}
+}
+
+// ParseQuery compiles a rule query into a RuleFilter.
+//
+// A query is a boolean expression of predicates joined with and, or, not and parentheses.
+// A predicate is either a comparison "field op value" or a bare keyword. Fields are
+// type, service, module (base name, or full path if the value contains '/'), path, control,
+// control.<return value> (e.g. control.success), arg:<name>, directive, target, line, id and
+// comment. Operators are = != ~ !~ (regular expression) and < <= > >= (numeric); line also
+// accepts ranges such as line=10..20. Keywords are directive, optional (a '-' prefix on the
+// type or control), complex, comment and arg:<name> (argument present). Values containing
+// spaces, parentheses or operator characters must be double-quoted.
+//
+//	type=auth and module~"pam_(sss|ldap)" and (control=sufficient or control.success=done) and arg:nullok
+func ParseQuery(query string) (RuleFilter, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+
+	qp := &queryParser{tokens: tokens}
+	filter, err := qp.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if qp.pos < len(qp.tokens) {
+		return nil, fmt.Errorf("unexpected %q at position %d", qp.tokens[qp.pos].text, qp.tokens[qp.pos].offset)
+	}
+	return filter, nil
+}
+
+// FindRulesByQuery finds all rules matching a query string (see ParseQuery)
+func (e *Editor) FindRulesByQuery(query string) ([]int, error) {
+	filter, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return e.FindRules(filter), nil
+}
+
+// queryTokenKind classifies query tokens
+type queryTokenKind int
+
+const (
+	queryWord queryTokenKind = iota
+	queryString
+	queryOperator
+	queryLParen
+	queryRParen
+)
+
+// queryToken is a lexical token with its position in the query
+type queryToken struct {
+	kind   queryTokenKind
+	text   string
+	offset int
+}
+
+// isQueryOperatorChar reports whether r can be part of a comparison operator
+func isQueryOperatorChar(r rune) bool {
+	return strings.ContainsRune("=!~<>", r)
+}
+
+// tokenizeQuery splits a query into words, quoted strings, operators and parentheses
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{queryLParen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{queryRParen, ")", i})
+			i++
+		case r == '"':
+			start := i
+			var b strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			tokens = append(tokens, queryToken{queryString, b.String(), start})
+		case isQueryOperatorChar(r):
+			start := i
+			for i < len(runes) && isQueryOperatorChar(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, queryToken{queryOperator, string(runes[start:i]), start})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !isQueryOperatorChar(runes[i]) &&
+				!strings.ContainsRune(`()"`, runes[i]) {
+				i++
+			}
+			tokens = append(tokens, queryToken{queryWord, string(runes[start:i]), start})
+		}
+	}
+	return tokens, nil
+}
+
+// queryParser is a recursive descent parser over query tokens
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+// peekKeyword reports whether the next token is the given keyword
+func (qp *queryParser) peekKeyword(keyword string) bool {
+	return qp.pos < len(qp.tokens) && qp.tokens[qp.pos].kind == queryWord &&
+		strings.EqualFold(qp.tokens[qp.pos].text, keyword)
+}
+
+// parseOr parses: and ("or" and)*
+func (qp *queryParser) parseOr() (RuleFilter, error) {
+	filters := []RuleFilter{}
+	for {
+		filter, err := qp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+		if !qp.peekKeyword("or") {
+			break
+		}
+		qp.pos++
+	}
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+	return OrFilters(filters...), nil
+}
+
+// parseAnd parses: unary ("and" unary)*
+func (qp *queryParser) parseAnd() (RuleFilter, error) {
+	filters := []RuleFilter{}
+	for {
+		filter, err := qp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+		if !qp.peekKeyword("and") {
+			break
+		}
+		qp.pos++
+	}
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+	return CombineFilters(filters...), nil
+}
+
+// parseUnary parses: "not" unary | "(" or ")" | predicate
+func (qp *queryParser) parseUnary() (RuleFilter, error) {
+	if qp.pos >= len(qp.tokens) {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+
+	if qp.peekKeyword("not") {
+		qp.pos++
+		filter, err := qp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return NotFilter(filter), nil
+	}
+
+	token := qp.tokens[qp.pos]
+	switch token.kind {
+	case queryLParen:
+		qp.pos++
+		filter, err := qp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if qp.pos >= len(qp.tokens) || qp.tokens[qp.pos].kind != queryRParen {
+			return nil, fmt.Errorf("missing ')' for '(' at position %d", token.offset)
+		}
+		qp.pos++
+		return filter, nil
+	case queryWord:
+		return qp.parsePredicate()
+	default:
+		return nil, fmt.Errorf("unexpected %q at position %d", token.text, token.offset)
+	}
+}
+
+// parsePredicate parses: field [op value]
+func (qp *queryParser) parsePredicate() (RuleFilter, error) {
+	field := qp.tokens[qp.pos]
+	qp.pos++
+
+	if qp.pos >= len(qp.tokens) || qp.tokens[qp.pos].kind != queryOperator {
+		filter, ok := queryKeyword(field.text)
+		if !ok {
+			return nil, fmt.Errorf("unknown predicate %q at position %d", field.text, field.offset)
+		}
+		return filter, nil
+	}
+
+	op := qp.tokens[qp.pos]
+	qp.pos++
+	if qp.pos >= len(qp.tokens) || (qp.tokens[qp.pos].kind != queryWord && qp.tokens[qp.pos].kind != queryString) {
+		return nil, fmt.Errorf("missing value after %q at position %d", op.text, op.offset)
+	}
+	value := qp.tokens[qp.pos].text
+	qp.pos++
+
+	// complex controls are compared in their canonical written form
+	if strings.EqualFold(field.text, "control") && strings.HasPrefix(value, "[") && !strings.Contains(op.text, "~") {
+		control, err := NewParser().parseControl(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w at position %d", err, qp.tokens[qp.pos-1].offset)
+		}
+		value = NewWriter().formatControl(Control{Complex: control.Complex, Optional: control.Optional})
+	}
+
+	getter, err := queryField(field.text, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w at position %d", err, field.offset)
+	}
+	filter, err := queryComparison(getter, field.text, op.text, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w at position %d", err, op.offset)
+	}
+	return filter, nil
+}
+
+// queryKeyword returns the filter for a bare keyword predicate
+func queryKeyword(keyword string) (RuleFilter, bool) {
+	switch strings.ToLower(keyword) {
+	case "directive":
+		return func(rule Rule) bool { return rule.IsDirective }, true
+	case "optional":
+		return func(rule Rule) bool {
+			return !rule.IsDirective && (strings.HasPrefix(string(rule.Type), "-") || rule.Control.Optional)
+		}, true
+	case "complex":
+		return func(rule Rule) bool { return rule.Control.Complex != nil }, true
+	case "comment":
+		return func(rule Rule) bool { return rule.Comment != "" }, true
+	}
+	if name, ok := strings.CutPrefix(keyword, "arg:"); ok && name != "" {
+		return func(rule Rule) bool { return rule.HasArgument(name) }, true
+	}
+	return nil, false
+}
+
+// queryGetter extracts a field value from a rule, reporting whether the rule has the field
+type queryGetter func(rule Rule) (string, bool)
+
+// queryField returns the getter for a comparison field
+func queryField(field, value string) (queryGetter, error) {
+	lower := strings.ToLower(field)
+
+	if name, ok := strings.CutPrefix(field, "arg:"); ok && name != "" {
+		return func(rule Rule) (string, bool) {
+			if v, ok := rule.ArgumentValue(name); ok {
+				return v, true
+			}
+			return "", !rule.IsDirective && rule.HasArgument(name)
+		}, nil
+	}
+	if retval, ok := strings.CutPrefix(lower, "control."); ok && retval != "" {
+		return func(rule Rule) (string, bool) {
+			action, ok := rule.Control.Complex[ReturnValue(retval)]
+			if !ok {
+				return "", false
+			}
+			return fmt.Sprint(action), true
+		}, nil
+	}
+
+	switch lower {
+	case "type":
+		return func(rule Rule) (string, bool) {
+			if rule.IsDirective {
+				return "", false
+			}
+			if strings.HasPrefix(value, "-") {
+				return string(rule.Type), true
+			}
+			return string(GetNormalizedModuleType(rule.Type)), true
+		}, nil
+	case "service":
+		return func(rule Rule) (string, bool) { return rule.Service, rule.Service != "" }, nil
+	case "module":
+		return func(rule Rule) (string, bool) {
+			if rule.IsDirective {
+				return "", false
+			}
+			if strings.Contains(value, "/") {
+				return rule.ModulePath, true
+			}
+			return rule.ModuleName(), true
+		}, nil
+	case "path":
+		return func(rule Rule) (string, bool) { return rule.ModulePath, !rule.IsDirective }, nil
+	case "control":
+		return func(rule Rule) (string, bool) {
+			if rule.IsDirective {
+				return "", false
+			}
+			if rule.Control.Simple != nil {
+				return string(*rule.Control.Simple), true
+			}
+			return NewWriter().formatControl(Control{Complex: rule.Control.Complex}), true
+		}, nil
+	case "directive":
+		return func(rule Rule) (string, bool) { return rule.DirectiveType, rule.IsDirective }, nil
+	case "target":
+		return func(rule Rule) (string, bool) { return rule.DirectiveTarget, rule.IsDirective }, nil
+	case "line":
+		return func(rule Rule) (string, bool) { return strconv.Itoa(rule.LineNumber), rule.LineNumber > 0 }, nil
+	case "id":
+		return func(rule Rule) (string, bool) { return strconv.FormatUint(uint64(rule.ID), 10), rule.ID > 0 }, nil
+	case "comment":
+		return func(rule Rule) (string, bool) { return rule.Comment, rule.Comment != "" }, nil
+	}
+	return nil, fmt.Errorf("unknown field %q", field)
+}
+
+// queryComparison builds a filter comparing a field value against the query value
+func queryComparison(get queryGetter, field, op, value string) (RuleFilter, error) {
+	switch op {
+	case "=", "!=":
+		equal := func(actual string) bool { return actual == value }
+		if lower := strings.ToLower(field); lower == "type" || lower == "control" || lower == "directive" {
+			equal = func(actual string) bool { return strings.EqualFold(actual, value) }
+		}
+		// Only line accepts ranges; other values may contain ".." literally
+		if low, high, ok := strings.Cut(value, ".."); ok && strings.EqualFold(field, "line") {
+			first, err1 := strconv.Atoi(low)
+			last, err2 := strconv.Atoi(high)
+			if err1 != nil || err2 != nil || first > last {
+				return nil, fmt.Errorf("invalid range %q", value)
+			}
+			equal = func(actual string) bool {
+				n, err := strconv.Atoi(actual)
+				return err == nil && n >= first && n <= last
+			}
+		}
+		negate := op == "!="
+		return func(rule Rule) bool {
+			actual, ok := get(rule)
+			return (ok && equal(actual)) != negate
+		}, nil
+
+	case "~", "!~":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", value, err)
+		}
+		negate := op == "!~"
+		return func(rule Rule) bool {
+			actual, ok := get(rule)
+			return (ok && re.MatchString(actual)) != negate
+		}, nil
+
+	case "<", "<=", ">", ">=":
+		want, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("operator %s needs a number, got %q", op, value)
+		}
+		return func(rule Rule) bool {
+			actual, ok := get(rule)
+			if !ok {
+				return false
+			}
+			n, err := strconv.Atoi(actual)
+			if err != nil {
+				return false
+			}
+			switch op {
+			case "<":
+				return n < want
+			case "<=":
+				return n <= want
+			case ">":
+				return n > want
+			default:
+				return n >= want
+			}
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown operator %q", op)
+}
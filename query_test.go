@@ -0,0 +1,133 @@
+package pamparser
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const queryTestConfig = `auth required pam_env.so
+auth [success=done default=ignore] pam_sss.so nullok # sssd first
+auth sufficient pam_ldap.so use_first_pass
+auth required pam_unix.so nullok try_first_pass
+account required pam_unix.so
+password requisite pam_pwquality.so retry=3 minlen=12
+-session optional pam_systemd.so
+@include common-session
+`
+
+func TestParseQuery(t *testing.T) {
+	config := mustParsePamD(t, queryTestConfig)
+	editor := NewEditor(config)
+
+	tests := []struct {
+		query    string
+		expected []int
+	}{
+		{`type=auth`, []int{0, 1, 2, 3}},
+		{`TYPE=AUTH and module=pam_unix.so`, []int{3}},
+		{`type=auth and module~"pam_(sss|ldap)" and (control=sufficient or control.success=done)`, []int{1, 2}},
+		{`type=auth and module~"pam_(sss|ldap)" and (control=sufficient or control.success=done) and arg:nullok`, []int{1}},
+		{`arg:nullok and not complex`, []int{3}},
+		{`control="[success=done default=ignore]"`, []int{1}},
+		{`control.default=ignore`, []int{1}},
+		{`arg:retry=3 and arg:minlen>=12`, []int{5}},
+		{`arg:minlen<12`, []int{}},
+		{`arg:retry!=3 and type=password`, []int{}},
+		{`optional`, []int{6}},
+		{`type=-session`, []int{6}},
+		{`type=session`, []int{6}},
+		{`directive and target=common-session`, []int{7}},
+		{`directive=include`, []int{7}},
+		{`line=2..4`, []int{1, 2, 3}},
+		{`line>6 or id=1`, []int{0, 6, 7}},
+		{`comment`, []int{1}},
+		{`comment~sssd`, []int{1}},
+		{`module=/lib/security/pam_unix.so`, []int{}},
+		{`path!~"^pam_"`, []int{7}},
+		{`not (type=auth or type=account) and not directive`, []int{5, 6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := editor.FindRulesByQuery(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(got, tt.expected) && !(len(got) == 0 && len(tt.expected) == 0) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseQuery_DotsOutsideLine(t *testing.T) {
+	editor := NewEditor(mustParsePamD(t, `auth required pam_unix.so uids=1..2 # see docs...
+password requisite pam_pwquality.so retry=3
+`))
+
+	tests := []struct {
+		query    string
+		expected []int
+	}{
+		{`comment="see docs..."`, []int{0}},
+		{`arg:uids="1..2"`, []int{0}},
+		{`arg:retry="1..5"`, []int{}},
+		{`arg:retry!="1..5"`, []int{0, 1}},
+		{`line=1..1`, []int{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := editor.FindRulesByQuery(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(got, tt.expected) && !(len(got) == 0 && len(tt.expected) == 0) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseQuery_Errors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{``, "empty query"},
+		{`type=`, "missing value"},
+		{`type=auth and`, "unexpected end"},
+		{`(type=auth`, "missing ')'"},
+		{`type=auth)`, "unexpected"},
+		{`bogus`, "unknown predicate"},
+		{`bogus=1`, "unknown field"},
+		{`module~"("`, "invalid regular expression"},
+		{`line>abc`, "needs a number"},
+		{`line=5..1`, "invalid range"},
+		{`module="pam_unix`, "unterminated string"},
+		{`type=>auth`, "unknown operator"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := ParseQuery(tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestOrAndNotFilters(t *testing.T) {
+	config := mustParsePamD(t, queryTestConfig)
+	editor := NewEditor(config)
+
+	filter := CombineFilters(
+		OrFilters(FilterByModulePath("pam_sss"), FilterByModulePath("pam_ldap")),
+		NotFilter(FilterByControl(ControlSufficient)),
+	)
+	if got := editor.FindRules(filter); !slices.Equal(got, []int{1}) {
+		t.Errorf("expected [1], got %v", got)
+	}
+}
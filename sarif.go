@@ -0,0 +1,226 @@
+package pamparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SARIFVersion is the version of the SARIF format SARIF writes
+const SARIFVersion = "2.1.0"
+
+// sarifSchema is the JSON schema of SARIF 2.1.0
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// sarifSourceRoot is the uriBaseId that relative artifact URIs are resolved against
+const sarifSourceRoot = "SRCROOT"
+
+// sarifLog and the types below are the subset of the SARIF 2.1.0 object model SARIF writes
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool              sarifTool                        `json:"tool"`
+	OriginalURIBaseID map[string]sarifArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results           []sarifResult                    `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string               `json:"name"`
+	InformationURI string               `json:"informationUri"`
+	Rules          []sarifReportingRule `json:"rules"`
+}
+
+type sarifReportingRule struct {
+	ID                   string              `json:"id"`
+	ShortDescription     *sarifMessage       `json:"shortDescription,omitempty"`
+	FullDescription      *sarifMessage       `json:"fullDescription,omitempty"`
+	DefaultConfiguration *sarifConfiguration `json:"defaultConfiguration,omitempty"`
+	Properties           *sarifProperties    `json:"properties,omitempty"`
+}
+
+type sarifConfiguration struct {
+	Level Severity `json:"level"`
+}
+
+type sarifProperties struct {
+	Tags []string `json:"tags,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     Severity        `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+	Fixes     []sarifFix      `json:"fixes,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion  `json:"deletedRegion"`
+	InsertedContent sarifMessage `json:"insertedContent"`
+}
+
+// SARIF renders diagnostics as a SARIF 2.1.0 log with one run. Files below baseDir are
+// written as URIs relative to the SRCROOT base, so code review tools can annotate them;
+// other files are written as file URIs. Pass "" for baseDir to write paths as they are.
+// Reporting rules are taken from the lint and compliance catalogues.
+func SARIF(diagnostics []Diagnostic, baseDir string) ([]byte, error) {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "pamparser",
+			InformationURI: "https://github.com/StephenBrown2/pamparser",
+			Rules:          []sarifReportingRule{},
+		}},
+		Results: []sarifResult{},
+	}
+	if baseDir != "" {
+		abs, err := filepath.Abs(baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("error writing SARIF log: %w", err)
+		}
+		base := url.URL{Scheme: "file", Path: filepath.ToSlash(abs) + "/"}
+		run.OriginalURIBaseID = map[string]sarifArtifactLocation{sarifSourceRoot: {URI: base.String()}}
+		baseDir = abs
+	}
+
+	ruleIndex := make(map[string]int)
+	for _, d := range diagnostics {
+		index, ok := ruleIndex[d.Check]
+		if !ok {
+			index = len(run.Tool.Driver.Rules)
+			ruleIndex[d.Check] = index
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule(d.Check))
+		}
+		run.Results = append(run.Results, sarifDiagnostic(d, index, baseDir))
+	}
+
+	log := sarifLog{Schema: sarifSchema, Version: SARIFVersion, Runs: []sarifRun{run}}
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error writing SARIF log: %w", err)
+	}
+	return data, nil
+}
+
+// sarifRule describes a lint check or compliance control
+func sarifRule(id string) sarifReportingRule {
+	rule := sarifReportingRule{ID: id}
+	if check, ok := lintCheck(id); ok {
+		rule.ShortDescription = &sarifMessage{Text: check.Summary}
+		rule.FullDescription = &sarifMessage{Text: check.Description}
+		rule.DefaultConfiguration = &sarifConfiguration{Level: check.Severity}
+		rule.Properties = &sarifProperties{Tags: []string{"pam", "lint"}}
+	}
+	index := slices.IndexFunc(complianceCatalogue, func(c ComplianceControl) bool { return c.ID == id })
+	if index >= 0 {
+		control := complianceCatalogue[index]
+		rule.ShortDescription = &sarifMessage{Text: control.Title}
+		rule.FullDescription = &sarifMessage{Text: control.Description}
+		rule.DefaultConfiguration = &sarifConfiguration{Level: SeverityWarning}
+		rule.Properties = &sarifProperties{Tags: []string{"pam", "compliance", string(control.Benchmark)}}
+	}
+	return rule
+}
+
+// sarifDiagnostic converts a diagnostic to a SARIF result
+func sarifDiagnostic(d Diagnostic, ruleIndex int, baseDir string) sarifResult {
+	result := sarifResult{
+		RuleID:    d.Check,
+		RuleIndex: ruleIndex,
+		Level:     d.Severity,
+		Message:   sarifMessage{Text: d.Message},
+	}
+	if d.File == "" {
+		return result
+	}
+
+	artifact := sarifArtifact(d.File, baseDir)
+	location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: artifact}}
+	if d.Line > 0 {
+		location.PhysicalLocation.Region = &sarifRegion{StartLine: d.Line}
+	}
+	result.Locations = []sarifLocation{location}
+
+	if d.Fix == nil {
+		return result
+	}
+	if len(d.Fix.Edits) == 0 {
+		result.Message.Text += ". Suggested fix: " + d.Fix.Description
+		return result
+	}
+	change := sarifArtifactChange{ArtifactLocation: artifact}
+	for _, edit := range d.Fix.Edits {
+		// Whole lines are replaced, so the deleted region runs to the start of the next line
+		change.Replacements = append(change.Replacements, sarifReplacement{
+			DeletedRegion:   sarifRegion{StartLine: edit.StartLine, StartColumn: 1, EndLine: edit.EndLine + 1, EndColumn: 1},
+			InsertedContent: sarifMessage{Text: edit.Text},
+		})
+	}
+	result.Fixes = []sarifFix{{Description: sarifMessage{Text: d.Fix.Description}, ArtifactChanges: []sarifArtifactChange{change}}}
+	return result
+}
+
+// sarifArtifact locates a file relative to baseDir if it is below it
+func sarifArtifact(file, baseDir string) sarifArtifactLocation {
+	if baseDir != "" {
+		abs, err := filepath.Abs(file)
+		if err == nil {
+			if rel, err := filepath.Rel(baseDir, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				uri := url.URL{Path: filepath.ToSlash(rel)}
+				return sarifArtifactLocation{URI: uri.String(), URIBaseID: sarifSourceRoot}
+			}
+		}
+	}
+	if filepath.IsAbs(file) {
+		uri := url.URL{Scheme: "file", Path: filepath.ToSlash(file)}
+		return sarifArtifactLocation{URI: uri.String()}
+	}
+	uri := url.URL{Path: filepath.ToSlash(file)}
+	return sarifArtifactLocation{URI: uri.String()}
+}
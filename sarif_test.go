@@ -0,0 +1,105 @@
+package pamparser
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+// decodeSARIF parses a SARIF log back into its object model
+func decodeSARIF(t *testing.T, data []byte) sarifRun {
+	t.Helper()
+	var log sarifLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatalf("SARIF output is not valid JSON: %v", err)
+	}
+	if log.Version != SARIFVersion || log.Schema != sarifSchema || len(log.Runs) != 1 {
+		t.Fatalf("unexpected log header: %+v", log)
+	}
+	return log.Runs[0]
+}
+
+func TestSARIF(t *testing.T) {
+	base := t.TempDir()
+	config := mustParsePamD(t, "auth sufficient pam_unix.so nullok\npassword required pam_unix.so md5\n")
+	config.FilePath = filepath.Join(base, "pam.d", "login")
+	diagnostics := NewEditor(config).Lint()
+	diagnostics = append(diagnostics, Diagnostic{Check: "custom", Severity: SeverityNote, Message: "outside", File: "/etc/pam.d/sshd", RuleIndex: -1})
+
+	data, err := SARIF(diagnostics, base)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	run := decodeSARIF(t, data)
+
+	var ruleIDs []string
+	for _, rule := range run.Tool.Driver.Rules {
+		ruleIDs = append(ruleIDs, rule.ID)
+	}
+	if len(ruleIDs) != 4 || ruleIDs[0] != "nullok" || ruleIDs[3] != "custom" {
+		t.Fatalf("rules = %v", ruleIDs)
+	}
+	if rule := run.Tool.Driver.Rules[0]; rule.ShortDescription == nil || rule.DefaultConfiguration.Level != SeverityWarning {
+		t.Errorf("nullok rule metadata = %+v", rule)
+	}
+	if rule := run.Tool.Driver.Rules[3]; rule.ShortDescription != nil {
+		t.Errorf("expected no metadata for an unknown check, got %+v", rule)
+	}
+
+	if len(run.Results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(run.Results))
+	}
+	nullok := run.Results[0]
+	location := nullok.Locations[0].PhysicalLocation
+	if location.ArtifactLocation.URI != "pam.d/login" || location.ArtifactLocation.URIBaseID != sarifSourceRoot || location.Region.StartLine != 1 {
+		t.Errorf("location = %+v", location)
+	}
+	if len(nullok.Fixes) != 1 {
+		t.Fatalf("expected a fix, got %+v", nullok.Fixes)
+	}
+	replacement := nullok.Fixes[0].ArtifactChanges[0].Replacements[0]
+	wantRegion := sarifRegion{StartLine: 1, StartColumn: 1, EndLine: 2, EndColumn: 1}
+	if replacement.DeletedRegion != wantRegion || replacement.InsertedContent.Text != "auth sufficient pam_unix.so\n" {
+		t.Errorf("replacement = %+v", replacement)
+	}
+
+	// Inserting a line deletes an empty region
+	deny := run.Results[2]
+	if deny.RuleID != "auth-no-deny" || deny.Fixes[0].ArtifactChanges[0].Replacements[0].DeletedRegion != (sarifRegion{StartLine: 2, StartColumn: 1, EndLine: 2, EndColumn: 1}) {
+		t.Errorf("insertion result = %+v", deny)
+	}
+
+	if uri := run.Results[3].Locations[0].PhysicalLocation.ArtifactLocation; uri.URI != "file:///etc/pam.d/sshd" || uri.URIBaseID != "" {
+		t.Errorf("outside location = %+v", uri)
+	}
+	if run.OriginalURIBaseID[sarifSourceRoot].URI == "" {
+		t.Error("expected SRCROOT to be defined")
+	}
+}
+
+func TestSARIF_Compliance(t *testing.T) {
+	root := writeSettingsFiles(t, complianceHost)
+	report, err := NewFileManager().CheckCompliance(root, ComplianceControls(BenchmarkSTIG))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	diagnostics := report.Diagnostics()
+	if len(diagnostics) != report.Count(ComplianceFail) {
+		t.Fatalf("expected one diagnostic per failure, got %d", len(diagnostics))
+	}
+	data, err := SARIF(diagnostics, root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	run := decodeSARIF(t, data)
+
+	rule := run.Tool.Driver.Rules[0]
+	if rule.ID != "stig-faillock-deny" || rule.Properties == nil || rule.Properties.Tags[2] != "stig" {
+		t.Errorf("rule = %+v", rule)
+	}
+	location := run.Results[0].Locations[0].PhysicalLocation
+	if location.ArtifactLocation.URI != "etc/security/faillock.conf" || location.Region.StartLine != 1 {
+		t.Errorf("location = %+v", location)
+	}
+}
@@ -0,0 +1,482 @@
+package pamparser
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Modules whose settings come from both a key=value file and their arguments
+const (
+	// FaillockModule is the module name of pam_faillock
+	FaillockModule = "pam_faillock.so"
+	// PwqualityModule is the module name of pam_pwquality
+	PwqualityModule = "pam_pwquality.so"
+	// PwhistoryModule is the module name of pam_pwhistory
+	PwhistoryModule = "pam_pwhistory.so"
+)
+
+// Default locations of the key=value files read by pam_faillock, pam_pwquality and
+// pam_pwhistory
+const (
+	// DefaultFaillockFile is read unless a conf= argument names another file
+	DefaultFaillockFile = "/etc/security/faillock.conf"
+	// DefaultPwqualityFile is the main libpwquality configuration file
+	DefaultPwqualityFile = "/etc/security/pwquality.conf"
+	// DefaultPwqualityDir holds *.conf files read before DefaultPwqualityFile
+	DefaultPwqualityDir = "/etc/security/pwquality.conf.d"
+	// DefaultPwhistoryFile is read unless a conf= argument names another file
+	DefaultPwhistoryFile = "/etc/security/pwhistory.conf"
+)
+
+// settingsSpec describes the settings a module reads from its file and arguments
+type settingsSpec struct {
+	defaults  map[string]string // built-in values
+	values    []string          // settings that take a value but have no default
+	flags     []string          // settings that take no value and are off by default
+	arguments []string          // module arguments that are not settings
+}
+
+// known reports whether key is a setting of the module
+func (s settingsSpec) known(key string) bool {
+	_, ok := s.defaults[key]
+	return ok || slices.Contains(s.values, key) || slices.Contains(s.flags, key)
+}
+
+// faillockSpec follows faillock.conf(5)
+var faillockSpec = settingsSpec{
+	defaults: map[string]string{
+		"dir":           "/var/run/faillock",
+		"deny":          "3",
+		"fail_interval": "900",
+		"unlock_time":   "600",
+	},
+	values:    []string{"root_unlock_time", "admin_group"},
+	flags:     []string{"audit", "silent", "no_log_info", "local_users_only", "nodelay", "even_deny_root"},
+	arguments: []string{"preauth", "authfail", "authsucc", "conf"},
+}
+
+// pwqualitySpec follows pwquality.conf(5) and pam_pwquality(8)
+var pwqualitySpec = settingsSpec{
+	defaults: map[string]string{
+		"difok":          "1",
+		"minlen":         "8",
+		"dcredit":        "0",
+		"ucredit":        "0",
+		"lcredit":        "0",
+		"ocredit":        "0",
+		"minclass":       "0",
+		"maxrepeat":      "0",
+		"maxsequence":    "0",
+		"maxclassrepeat": "0",
+		"gecoscheck":     "0",
+		"dictcheck":      "1",
+		"usercheck":      "1",
+		"usersubstr":     "0",
+		"enforcing":      "1",
+		"retry":          "1",
+	},
+	values:    []string{"badwords", "dictpath"},
+	flags:     []string{"enforce_for_root", "local_users_only"},
+	arguments: []string{"debug", "use_authtok", "authtok_type", "try_first_pass", "use_first_pass"},
+}
+
+// pwhistorySpec follows pwhistory.conf(5) and pam_pwhistory(8)
+var pwhistorySpec = settingsSpec{
+	defaults: map[string]string{
+		"remember": "10",
+		"retry":    "1",
+		"file":     "/etc/security/opasswd",
+	},
+	flags:     []string{"debug", "enforce_for_root"},
+	arguments: []string{"use_authtok", "authtok_type", "conf"},
+}
+
+// KeyValueSetting is one key = value (or bare flag) line of a module configuration file
+type KeyValueSetting struct {
+	Key        string `json:"key"`
+	Value      string `json:"value,omitempty"`
+	Flag       bool   `json:"flag,omitempty"` // written without a value
+	LineNumber int    `json:"line_number,omitempty"`
+}
+
+// KeyValueConfig represents a key = value module configuration file such as faillock.conf
+// or pwquality.conf, keeping settings in file order
+type KeyValueConfig struct {
+	FilePath string            `json:"file_path,omitempty"`
+	Settings []KeyValueSetting `json:"settings"`
+	Comments []string          `json:"comments,omitempty"`
+}
+
+// ParseKeyValueConfig parses key = value syntax. Lines without '=' are flags; comment-only
+// lines are kept in Comments.
+func ParseKeyValueConfig(reader io.Reader) (*KeyValueConfig, error) {
+	config := &KeyValueConfig{}
+
+	scanner := bufio.NewScanner(reader)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if comment, ok := strings.CutPrefix(line, "#"); ok {
+			config.Comments = append(config.Comments, strings.TrimSpace(comment))
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(line, "=")
+		setting := KeyValueSetting{
+			Key:        strings.TrimSpace(key),
+			Value:      strings.TrimSpace(value),
+			Flag:       !hasValue,
+			LineNumber: lineNum,
+		}
+		if setting.Key == "" || strings.ContainsAny(setting.Key, " \t") {
+			return nil, fmt.Errorf("invalid setting '%s' at line %d", line, lineNum)
+		}
+		config.Settings = append(config.Settings, setting)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading input: %w", err)
+	}
+	return config, nil
+}
+
+// LoadKeyValueFile loads a key = value module configuration file
+func LoadKeyValueFile(filePath string) (*KeyValueConfig, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	config, err := ParseKeyValueConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file %s: %w", filePath, err)
+	}
+	config.FilePath = filePath
+	return config, nil
+}
+
+// Get returns the value of the last setting for key, as the modules let later lines win
+func (c *KeyValueConfig) Get(key string) (KeyValueSetting, bool) {
+	for i := len(c.Settings) - 1; i >= 0; i-- {
+		if c.Settings[i].Key == key {
+			return c.Settings[i], true
+		}
+	}
+	return KeyValueSetting{}, false
+}
+
+// Set gives key a value, or makes it a flag if value is empty, updating the last setting for
+// key or appending one. It reports whether anything changed.
+func (c *KeyValueConfig) Set(key, value string) bool {
+	setting := KeyValueSetting{Key: key, Value: value, Flag: value == ""}
+	for i := len(c.Settings) - 1; i >= 0; i-- {
+		if existing := &c.Settings[i]; existing.Key == key {
+			if existing.Value == setting.Value && existing.Flag == setting.Flag {
+				return false
+			}
+			existing.Value, existing.Flag = setting.Value, setting.Flag
+			return true
+		}
+	}
+	c.Settings = append(c.Settings, setting)
+	return true
+}
+
+// Unset removes every setting for key and reports whether any was removed
+func (c *KeyValueConfig) Unset(key string) bool {
+	before := len(c.Settings)
+	c.Settings = slices.DeleteFunc(c.Settings, func(s KeyValueSetting) bool { return s.Key == key })
+	return len(c.Settings) != before
+}
+
+// String returns the configuration in key = value syntax, standalone comments first
+func (c *KeyValueConfig) String() string {
+	var b strings.Builder
+	for _, comment := range c.Comments {
+		b.WriteString("# " + comment + "\n")
+	}
+	for _, setting := range c.Settings {
+		if setting.Flag {
+			b.WriteString(setting.Key + "\n")
+		} else {
+			b.WriteString(setting.Key + " = " + setting.Value + "\n")
+		}
+	}
+	return b.String()
+}
+
+// Write writes the configuration in key = value syntax
+func (c *KeyValueConfig) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, c.String()); err != nil {
+		return fmt.Errorf("error writing configuration: %w", err)
+	}
+	return nil
+}
+
+// SettingSource says where an effective setting came from
+type SettingSource string
+
+const (
+	// SettingFromDefault is the module's built-in default
+	SettingFromDefault SettingSource = "default"
+	// SettingFromFile is a line in a configuration file
+	SettingFromFile SettingSource = "file"
+	// SettingFromArgument is a module argument on the rule
+	SettingFromArgument SettingSource = "argument"
+)
+
+// EffectiveSetting is the value a module uses for one setting and where it came from
+type EffectiveSetting struct {
+	Key    string        `json:"key"`
+	Value  string        `json:"value,omitempty"`
+	Flag   bool          `json:"flag,omitempty"`
+	Source SettingSource `json:"source"`
+	File   string        `json:"file,omitempty"`
+	Line   int           `json:"line,omitempty"`
+}
+
+// EffectiveSettings are the settings a pam_faillock, pam_pwquality or pam_pwhistory rule
+// runs with
+type EffectiveSettings struct {
+	Module   string                      `json:"module"`
+	Files    []string                    `json:"files,omitempty"` // files read, in order
+	Settings map[string]EffectiveSetting `json:"settings"`
+}
+
+// Value returns the value of a setting, or "" if it is unset
+func (s *EffectiveSettings) Value(key string) string {
+	return s.Settings[key].Value
+}
+
+// Int returns the value of a numeric setting
+func (s *EffectiveSettings) Int(key string) (int, error) {
+	setting, ok := s.Settings[key]
+	if !ok {
+		return 0, fmt.Errorf("%s has no setting %s", s.Module, key)
+	}
+	n, err := strconv.Atoi(setting.Value)
+	if err != nil {
+		return 0, fmt.Errorf("%s setting %s is not a number: '%s'", s.Module, key, setting.Value)
+	}
+	return n, nil
+}
+
+// Enabled reports whether a flag setting is on
+func (s *EffectiveSettings) Enabled(flag string) bool {
+	setting, ok := s.Settings[flag]
+	return ok && setting.Flag
+}
+
+// Keys returns the names of all settings in sorted order
+func (s *EffectiveSettings) Keys() []string {
+	keys := make([]string, 0, len(s.Settings))
+	for key := range s.Settings {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// newEffectiveSettings starts from a module's defaults
+func newEffectiveSettings(module string, defaults map[string]string) *EffectiveSettings {
+	settings := &EffectiveSettings{Module: module, Settings: make(map[string]EffectiveSetting)}
+	for key, value := range defaults {
+		settings.Settings[key] = EffectiveSetting{Key: key, Value: value, Source: SettingFromDefault}
+	}
+	return settings
+}
+
+// applyFile overlays the settings of a configuration file
+func (s *EffectiveSettings) applyFile(config *KeyValueConfig) {
+	s.Files = append(s.Files, config.FilePath)
+	for _, setting := range config.Settings {
+		s.Settings[setting.Key] = EffectiveSetting{
+			Key:    setting.Key,
+			Value:  setting.Value,
+			Flag:   setting.Flag,
+			Source: SettingFromFile,
+			File:   config.FilePath,
+			Line:   setting.LineNumber,
+		}
+	}
+}
+
+// applyArguments overlays a rule's arguments, skipping those that are not settings
+func (s *EffectiveSettings) applyArguments(rule Rule, skip []string) {
+	for _, arg := range rule.Arguments {
+		key, value, hasValue := strings.Cut(arg, "=")
+		if slices.Contains(skip, key) {
+			continue
+		}
+		s.Settings[key] = EffectiveSetting{Key: key, Value: value, Flag: !hasValue, Source: SettingFromArgument}
+	}
+}
+
+// applyConfFile overlays the file named by the rule's conf= argument, or defaultPath. A
+// missing default file is skipped; a missing conf= file is an error.
+func (s *EffectiveSettings) applyConfFile(rule Rule, root, defaultPath string) error {
+	path, explicit := rule.ArgumentValue("conf")
+	if !explicit {
+		path = defaultPath
+	}
+	config, err := LoadKeyValueFile(filepath.Join(root, path))
+	switch {
+	case err == nil:
+		s.applyFile(config)
+	case explicit || !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	return nil
+}
+
+// EffectiveFaillockSettings resolves the settings a pam_faillock rule runs with: built-in
+// defaults, then faillock.conf (or the conf= file), then the rule's arguments. A missing
+// default file is skipped; a missing conf= file is an error. root is prepended to paths.
+func EffectiveFaillockSettings(rule Rule, root string) (*EffectiveSettings, error) {
+	if !rule.IsModule(FaillockModule) {
+		return nil, fmt.Errorf("rule module %s is not %s", rule.ModulePath, FaillockModule)
+	}
+
+	settings := newEffectiveSettings(FaillockModule, faillockSpec.defaults)
+	if err := settings.applyConfFile(rule, root, DefaultFaillockFile); err != nil {
+		return nil, err
+	}
+	settings.applyArguments(rule, faillockSpec.arguments)
+
+	// root_unlock_time defaults to unlock_time
+	if _, ok := settings.Settings["root_unlock_time"]; !ok {
+		unlock := settings.Settings["unlock_time"]
+		settings.Settings["root_unlock_time"] = EffectiveSetting{
+			Key: "root_unlock_time", Value: unlock.Value, Source: unlock.Source, File: unlock.File, Line: unlock.Line,
+		}
+	}
+	return settings, nil
+}
+
+// EffectivePwqualitySettings resolves the settings a pam_pwquality rule runs with: built-in
+// defaults, then pwquality.conf.d/*.conf in C locale order, then pwquality.conf, then the
+// rule's arguments. Missing files are skipped. root is prepended to paths.
+func EffectivePwqualitySettings(rule Rule, root string) (*EffectiveSettings, error) {
+	if !rule.IsModule(PwqualityModule) {
+		return nil, fmt.Errorf("rule module %s is not %s", rule.ModulePath, PwqualityModule)
+	}
+
+	settings := newEffectiveSettings(PwqualityModule, pwqualitySpec.defaults)
+	files, err := filepath.Glob(filepath.Join(root, DefaultPwqualityDir, "*.conf"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", DefaultPwqualityDir, err)
+	}
+	slices.Sort(files)
+	files = append(files, filepath.Join(root, DefaultPwqualityFile))
+
+	for _, file := range files {
+		config, err := LoadKeyValueFile(file)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		settings.applyFile(config)
+	}
+
+	settings.applyArguments(rule, pwqualitySpec.arguments)
+	return settings, nil
+}
+
+// EffectivePwhistorySettings resolves the settings a pam_pwhistory rule runs with: built-in
+// defaults, then pwhistory.conf (or the conf= file), then the rule's arguments. A missing
+// default file is skipped; a missing conf= file is an error. root is prepended to paths.
+func EffectivePwhistorySettings(rule Rule, root string) (*EffectiveSettings, error) {
+	if !rule.IsModule(PwhistoryModule) {
+		return nil, fmt.Errorf("rule module %s is not %s", rule.ModulePath, PwhistoryModule)
+	}
+
+	settings := newEffectiveSettings(PwhistoryModule, pwhistorySpec.defaults)
+	if err := settings.applyConfFile(rule, root, DefaultPwhistoryFile); err != nil {
+		return nil, err
+	}
+	settings.applyArguments(rule, pwhistorySpec.arguments)
+	return settings, nil
+}
+
+// Validate reports settings the module does not know, flags given a value and values given
+// as flags
+func (s *EffectiveSettings) Validate() []string {
+	var spec settingsSpec
+	switch s.Module {
+	case FaillockModule:
+		spec = faillockSpec
+	case PwqualityModule:
+		spec = pwqualitySpec
+	case PwhistoryModule:
+		spec = pwhistorySpec
+	}
+
+	var warnings []string
+	for _, key := range s.Keys() {
+		setting := s.Settings[key]
+		isFlag := slices.Contains(spec.flags, key)
+		switch {
+		case !spec.known(key):
+			warnings = append(warnings, fmt.Sprintf("%s: unknown setting '%s'%s", s.Module, key, setting.location()))
+		case isFlag && !setting.Flag:
+			warnings = append(warnings, fmt.Sprintf("%s: '%s' is a flag and takes no value%s", s.Module, key, setting.location()))
+		case !isFlag && setting.Flag:
+			warnings = append(warnings, fmt.Sprintf("%s: '%s' needs a value%s", s.Module, key, setting.location()))
+		}
+	}
+	return warnings
+}
+
+// location describes where a setting was set, for messages
+func (s EffectiveSetting) location() string {
+	switch s.Source {
+	case SettingFromFile:
+		return fmt.Sprintf(" (%s line %d)", s.File, s.Line)
+	case SettingFromArgument:
+		return " (module argument)"
+	default:
+		return ""
+	}
+}
+
+// EffectiveSettings resolves the settings of every pam_faillock, pam_pwquality and
+// pam_pwhistory rule in the configuration, keyed by rule ID
+func (e *Editor) EffectiveSettings(root string) (map[RuleID]*EffectiveSettings, error) {
+	e.ensureIDs()
+
+	result := make(map[RuleID]*EffectiveSettings)
+	for i, rule := range e.config.Rules {
+		var settings *EffectiveSettings
+		var err error
+		switch {
+		case rule.IsModule(FaillockModule):
+			settings, err = EffectiveFaillockSettings(rule, root)
+		case rule.IsModule(PwqualityModule):
+			settings, err = EffectivePwqualitySettings(rule, root)
+		case rule.IsModule(PwhistoryModule):
+			settings, err = EffectivePwhistorySettings(rule, root)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		result[rule.ID] = settings
+	}
+	return result, nil
+}
@@ -0,0 +1,266 @@
+package pamparser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKeyValueConfig(t *testing.T) {
+	input := `# Configuration for locking the user after multiple failed
+# authentication attempts.
+dir = /var/run/faillock
+audit
+deny=5
+  unlock_time =  900
+deny = 4
+`
+	config, err := ParseKeyValueConfig(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(config.Comments) != 2 || len(config.Settings) != 5 {
+		t.Fatalf("expected 2 comments and 5 settings, got %d and %d", len(config.Comments), len(config.Settings))
+	}
+	if got := config.Settings[1]; !reflect.DeepEqual(got, KeyValueSetting{Key: "audit", Flag: true, LineNumber: 4}) {
+		t.Errorf("flag setting = %+v", got)
+	}
+	if got, _ := config.Get("unlock_time"); got.Value != "900" {
+		t.Errorf("unlock_time = %q, want 900", got.Value)
+	}
+	if got, _ := config.Get("deny"); got.Value != "4" || got.LineNumber != 7 {
+		t.Errorf("expected the last deny to win, got %+v", got)
+	}
+
+	if _, err := ParseKeyValueConfig(strings.NewReader("bad key = 1\n")); err == nil {
+		t.Error("expected error for a key with spaces")
+	}
+	if _, err := ParseKeyValueConfig(strings.NewReader("= 1\n")); err == nil {
+		t.Error("expected error for a missing key")
+	}
+}
+
+func TestKeyValueConfig_Edit(t *testing.T) {
+	config, err := ParseKeyValueConfig(strings.NewReader("# pwquality\nminlen = 8\ndcredit = 0\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !config.Set("minlen", "14") || config.Set("minlen", "14") {
+		t.Error("expected Set to change minlen once")
+	}
+	if !config.Set("enforce_for_root", "") {
+		t.Error("expected Set to append a flag")
+	}
+	if !config.Unset("dcredit") || config.Unset("dcredit") {
+		t.Error("expected Unset to remove dcredit once")
+	}
+
+	want := "# pwquality\nminlen = 14\nenforce_for_root\n"
+	if got := config.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func writeSettingsFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for path, content := range files {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestEffectiveFaillockSettings(t *testing.T) {
+	root := writeSettingsFiles(t, map[string]string{
+		DefaultFaillockFile:                "deny = 5\nunlock_time = 1200\neven_deny_root\n",
+		"/etc/security/faillock-sshd.conf": "deny = 2\n",
+	})
+
+	tests := []struct {
+		name       string
+		line       string
+		deny       string
+		denySource SettingSource
+		unlock     string
+		rootUnlock string
+	}{
+		{"file overrides defaults", "auth required pam_faillock.so preauth", "5", SettingFromFile, "1200", "1200"},
+		{"arguments override file", "auth required pam_faillock.so authfail deny=4 unlock_time=0", "4", SettingFromArgument, "0", "0"},
+		{"conf argument", "auth required pam_faillock.so preauth conf=/etc/security/faillock-sshd.conf", "2", SettingFromFile, "600", "600"},
+		{"root unlock time", "auth required pam_faillock.so preauth root_unlock_time=60", "5", SettingFromFile, "1200", "60"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := mustParsePamD(t, tt.line+"\n").Rules[0]
+			settings, err := EffectiveFaillockSettings(rule, root)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := settings.Settings["deny"]; got.Value != tt.deny || got.Source != tt.denySource {
+				t.Errorf("deny = %+v, want %s from %s", got, tt.deny, tt.denySource)
+			}
+			if got := settings.Value("unlock_time"); got != tt.unlock {
+				t.Errorf("unlock_time = %s, want %s", got, tt.unlock)
+			}
+			if got := settings.Value("root_unlock_time"); got != tt.rootUnlock {
+				t.Errorf("root_unlock_time = %s, want %s", got, tt.rootUnlock)
+			}
+			if _, ok := settings.Settings["preauth"]; ok {
+				t.Error("expected mode arguments not to be settings")
+			}
+			if warnings := settings.Validate(); len(warnings) != 0 {
+				t.Errorf("unexpected warnings: %v", warnings)
+			}
+		})
+	}
+
+	settings, err := EffectiveFaillockSettings(Rule{Type: ModuleTypeAuth, ModulePath: FaillockModule}, t.TempDir())
+	if err != nil {
+		t.Fatalf("expected a missing default file to be skipped: %v", err)
+	}
+	if deny, err := settings.Int("deny"); err != nil || deny != 3 || settings.Enabled("audit") {
+		t.Errorf("expected built-in defaults, got deny=%d err=%v", deny, err)
+	}
+
+	missing := Rule{Type: ModuleTypeAuth, ModulePath: FaillockModule, Arguments: []string{"conf=/nonexistent.conf"}}
+	if _, err := EffectiveFaillockSettings(missing, root); err == nil {
+		t.Error("expected error for a missing conf= file")
+	}
+	if _, err := EffectiveFaillockSettings(Rule{Type: ModuleTypeAuth, ModulePath: "pam_unix.so"}, root); err == nil {
+		t.Error("expected error for a rule that is not pam_faillock")
+	}
+}
+
+func TestEffectivePwqualitySettings(t *testing.T) {
+	root := writeSettingsFiles(t, map[string]string{
+		DefaultPwqualityFile:                               "minlen = 12\n",
+		filepath.Join(DefaultPwqualityDir, "50-cis.conf"):  "minlen = 14\ndcredit = -1\nucredit = -1\n",
+		filepath.Join(DefaultPwqualityDir, "10-base.conf"): "dcredit = 1\nminclass = 3\n",
+		filepath.Join(DefaultPwqualityDir, "README"):       "minlen = 99\n",
+	})
+
+	rule := mustParsePamD(t, "password requisite pam_pwquality.so try_first_pass retry=3 ucredit=-2\n").Rules[0]
+	settings, err := EffectivePwqualitySettings(rule, root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{"minlen": "12", "dcredit": "-1", "ucredit": "-2", "minclass": "3", "retry": "3", "difok": "1"}
+	for key, value := range want {
+		if got := settings.Value(key); got != value {
+			t.Errorf("%s = %s, want %s", key, got, value)
+		}
+	}
+	if got := settings.Settings["minlen"]; got.File != filepath.Join(root, DefaultPwqualityFile) || got.Line != 1 {
+		t.Errorf("expected minlen from the main file, got %+v", got)
+	}
+	if len(settings.Files) != 3 {
+		t.Errorf("expected 3 files read, got %v", settings.Files)
+	}
+	if _, ok := settings.Settings["try_first_pass"]; ok {
+		t.Error("expected try_first_pass not to be a setting")
+	}
+
+	rule.Arguments = append(rule.Arguments, "minlen", "enforce_for_root=1", "maxlen=20")
+	settings, err = EffectivePwqualitySettings(rule, root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if warnings := settings.Validate(); len(warnings) != 3 {
+		t.Errorf("expected 3 warnings, got %v", warnings)
+	}
+}
+
+func TestEffectivePwhistorySettings(t *testing.T) {
+	root := writeSettingsFiles(t, map[string]string{
+		DefaultPwhistoryFile:         "remember = 24\nenforce_for_root\n",
+		"/etc/security/pwhistory-su": "remember = 5\n",
+	})
+
+	tests := []struct {
+		name     string
+		line     string
+		remember string
+		source   SettingSource
+	}{
+		{"file overrides defaults", "password required pam_pwhistory.so use_authtok", "24", SettingFromFile},
+		{"arguments override file", "password required pam_pwhistory.so remember=30 use_authtok", "30", SettingFromArgument},
+		{"conf argument", "password required pam_pwhistory.so conf=/etc/security/pwhistory-su", "5", SettingFromFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := mustParsePamD(t, tt.line+"\n").Rules[0]
+			settings, err := EffectivePwhistorySettings(rule, root)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := settings.Settings["remember"]; got.Value != tt.remember || got.Source != tt.source {
+				t.Errorf("remember = %+v, want %s from %s", got, tt.remember, tt.source)
+			}
+			if warnings := settings.Validate(); len(warnings) != 0 {
+				t.Errorf("unexpected warnings: %v", warnings)
+			}
+		})
+	}
+
+	settings, err := EffectivePwhistorySettings(Rule{Type: ModuleTypePassword, ModulePath: PwhistoryModule}, t.TempDir())
+	if err != nil {
+		t.Fatalf("expected a missing default file to be skipped: %v", err)
+	}
+	if remember, err := settings.Int("remember"); err != nil || remember != 10 || settings.Enabled("enforce_for_root") {
+		t.Errorf("expected built-in defaults, got remember=%d err=%v", remember, err)
+	}
+
+	missing := Rule{Type: ModuleTypePassword, ModulePath: PwhistoryModule, Arguments: []string{"conf=/nonexistent.conf"}}
+	if _, err := EffectivePwhistorySettings(missing, root); err == nil {
+		t.Error("expected error for a missing conf= file")
+	}
+}
+
+func TestEditor_EffectiveSettings(t *testing.T) {
+	root := writeSettingsFiles(t, map[string]string{
+		DefaultFaillockFile:  "deny = 5\n",
+		DefaultPwqualityFile: "minlen = 14\n",
+	})
+
+	config := mustParsePamD(t, `auth required pam_faillock.so preauth
+auth sufficient pam_unix.so
+auth [default=die] pam_faillock.so authfail deny=3
+password requisite pam_pwquality.so dcredit=-1
+password required pam_pwhistory.so use_authtok
+`)
+	editor := NewEditor(config)
+	settings, err := editor.EffectiveSettings(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(settings) != 4 {
+		t.Fatalf("expected settings for 4 rules, got %d", len(settings))
+	}
+
+	rules := editor.GetConfig().Rules
+	if got := settings[rules[0].ID].Value("deny"); got != "5" {
+		t.Errorf("preauth deny = %s, want 5", got)
+	}
+	if got := settings[rules[2].ID].Value("deny"); got != "3" {
+		t.Errorf("authfail deny = %s, want 3", got)
+	}
+	if got := settings[rules[3].ID]; got.Value("minlen") != "14" || got.Value("dcredit") != "-1" {
+		t.Errorf("unexpected pwquality settings: %+v", got.Settings)
+	}
+	if got := settings[rules[4].ID].Value("remember"); got != "10" {
+		t.Errorf("pwhistory remember = %s, want 10", got)
+	}
+}
@@ -0,0 +1,186 @@
+package pamparser
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+)
+
+// DefaultPamDDir is the directory libpam reads service files and include targets from
+const DefaultPamDDir = "/etc/pam.d"
+
+// maxIncludeDepth is libpam's limit on nested includes and substacks (PAM_SUBSTACK_MAX_LEVEL)
+const maxIncludeDepth = 16
+
+// StackRule is a rule of a service's stack after include resolution
+type StackRule struct {
+	Rule
+	File     string   `json:"file"`               // file the rule was read from
+	Via      []string `json:"via,omitempty"`      // files the rule was included through, outermost first
+	Substack bool     `json:"substack,omitempty"` // reached through a substack control
+
+	substacks []int // the substack expansions the rule was reached through, outermost first
+}
+
+// ServiceStack is the flattened stack of a pam.d service: include and substack controls and
+// @include directives are replaced by the rules they pull in
+type ServiceStack struct {
+	Service  string      `json:"service"`
+	Rules    []StackRule `json:"rules"`
+	Files    []string    `json:"files"` // every file read, in first-read order
+	Warnings []string    `json:"warnings,omitempty"`
+}
+
+// stackResolver carries the state of one ResolveService call
+type stackResolver struct {
+	fm        *FileManager
+	root      string
+	stack     *ServiceStack
+	configs   map[string]*Config
+	substacks int // substack expansions so far
+}
+
+// ResolveService reads root/etc/pam.d/service and resolves its includes as libpam does:
+// include and substack pull in the rules of their own type from the target file, and
+// @include pulls in every rule. Relative targets are looked up in /etc/pam.d. Missing
+// targets, include cycles and nesting deeper than libpam allows are reported as warnings.
+func ResolveService(root, service string) (*ServiceStack, error) {
+	return NewFileManager().ResolveService(root, service)
+}
+
+// ResolveService is like the package-level ResolveService but parses files with fm
+func (fm *FileManager) ResolveService(root, service string) (*ServiceStack, error) {
+	r := &stackResolver{
+		fm:      fm,
+		root:    root,
+		stack:   &ServiceStack{Service: service, Rules: []StackRule{}},
+		configs: make(map[string]*Config),
+	}
+	path := filepath.Join(DefaultPamDDir, service)
+	config, err := r.load(path)
+	if err != nil {
+		return nil, err
+	}
+	r.expand(config, path, "", nil, nil)
+	return r.stack, nil
+}
+
+// load parses a file once, keyed by its path below root
+func (r *stackResolver) load(path string) (*Config, error) {
+	if config, ok := r.configs[path]; ok {
+		return config, nil
+	}
+	config, err := r.fm.LoadFromFile(filepath.Join(r.root, path))
+	if err != nil {
+		return nil, err
+	}
+	r.configs[path] = config
+	r.stack.Files = append(r.stack.Files, path)
+	return config, nil
+}
+
+// expand appends the rules of config whose type is moduleType (all rules if it is empty),
+// following includes. Types are compared without the '-' prefix, so an included
+// -session rule is part of the session stack. via is the chain of files that led to config and substacks the
+// substack expansions it is part of.
+func (r *stackResolver) expand(config *Config, path string, moduleType ModuleType, via []string, substacks []int) {
+	for _, rule := range config.Rules {
+		target := includeTarget(rule)
+		if target == "" {
+			if moduleType == "" || GetNormalizedModuleType(rule.Type) == moduleType {
+				r.stack.Rules = append(r.stack.Rules, StackRule{Rule: rule, File: path, Via: via, Substack: len(substacks) > 0, substacks: substacks})
+			}
+			continue
+		}
+
+		// @include takes every type; include and substack take their own
+		includeType := moduleType
+		if !rule.IsDirective {
+			if moduleType != "" && GetNormalizedModuleType(rule.Type) != moduleType {
+				continue
+			}
+			includeType = GetNormalizedModuleType(rule.Type)
+		}
+
+		targetPath := target
+		if !filepath.IsAbs(targetPath) {
+			targetPath = filepath.Join(DefaultPamDDir, target)
+		}
+		chain := append(slices.Clone(via), path)
+		switch {
+		case slices.Contains(chain, targetPath):
+			r.warn(path, rule, "include cycle through %s", targetPath)
+			continue
+		case len(chain) > maxIncludeDepth:
+			r.warn(path, rule, "includes nested deeper than %d levels", maxIncludeDepth)
+			continue
+		}
+
+		included, err := r.load(targetPath)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				r.warn(path, rule, "included file %s does not exist", targetPath)
+			} else {
+				r.warn(path, rule, "%v", err)
+			}
+			continue
+		}
+		nested := substacks
+		if !rule.IsDirective && *rule.Control.Simple == ControlSubstack {
+			r.substacks++
+			nested = append(slices.Clone(substacks), r.substacks)
+		}
+		r.expand(included, targetPath, includeType, chain, nested)
+	}
+}
+
+// warn records a problem found at a rule
+func (r *stackResolver) warn(path string, rule Rule, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	r.stack.Warnings = append(r.stack.Warnings, fmt.Sprintf("%s line %d: %s", path, rule.LineNumber, message))
+}
+
+// ResolveHost resolves every service in root/etc/pam.d. Files that other services include,
+// such as common-auth or system-auth, and package upgrade siblings are not returned as
+// services of their own.
+func (fm *FileManager) ResolveHost(root string) ([]*ServiceStack, error) {
+	files, err := ListPamDFiles(filepath.Join(root, DefaultPamDDir))
+	if err != nil {
+		return nil, err
+	}
+
+	var stacks []*ServiceStack
+	included := make(map[string]bool)
+	for _, file := range files {
+		service := filepath.Base(file)
+		if isUpgradeSibling(service) {
+			continue
+		}
+		stack, err := fm.ResolveService(root, service)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range stack.Files[1:] {
+			included[path] = true
+		}
+		stacks = append(stacks, stack)
+	}
+
+	return slices.DeleteFunc(stacks, func(s *ServiceStack) bool {
+		return included[filepath.Join(DefaultPamDDir, s.Service)]
+	}), nil
+}
+
+// OfType returns the rules of one module type in stack order, including rules written with
+// the '-' prefix
+func (s *ServiceStack) OfType(moduleType ModuleType) []StackRule {
+	var rules []StackRule
+	for _, rule := range s.Rules {
+		if GetNormalizedModuleType(rule.Type) == GetNormalizedModuleType(moduleType) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
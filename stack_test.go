@@ -0,0 +1,121 @@
+package pamparser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveService(t *testing.T) {
+	root := writeSettingsFiles(t, map[string]string{
+		"/etc/pam.d/sshd": `auth       substack     password-auth
+auth       include      postlogin
+account    required     pam_nologin.so
+@include common-session
+password   include      password-auth
+`,
+		"/etc/pam.d/password-auth": `auth        required      pam_env.so
+auth        sufficient    pam_unix.so try_first_pass
+auth        required      pam_deny.so
+password    requisite     pam_pwquality.so
+password    sufficient    pam_unix.so sha512
+`,
+		"/etc/pam.d/postlogin":      "session optional pam_lastlog.so\n",
+		"/etc/pam.d/common-session": "session required pam_limits.so\nsession include missing\n",
+	})
+
+	stack, err := ResolveService(root, "sshd")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, rule := range stack.Rules {
+		got = append(got, string(rule.Type)+" "+rule.ModuleName())
+	}
+	want := []string{
+		"auth pam_env.so", "auth pam_unix.so", "auth pam_deny.so",
+		"account pam_nologin.so",
+		"session pam_limits.so",
+		"password pam_pwquality.so", "password pam_unix.so",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stack = %v, want %v", got, want)
+	}
+
+	wantFiles := []string{"/etc/pam.d/sshd", "/etc/pam.d/password-auth", "/etc/pam.d/postlogin", "/etc/pam.d/common-session"}
+	if !reflect.DeepEqual(stack.Files, wantFiles) {
+		t.Errorf("files = %v, want %v", stack.Files, wantFiles)
+	}
+
+	first := stack.Rules[0]
+	if first.File != "/etc/pam.d/password-auth" || !first.Substack || !reflect.DeepEqual(first.Via, []string{"/etc/pam.d/sshd"}) {
+		t.Errorf("first rule = %+v", first)
+	}
+	if stack.Rules[5].Substack {
+		t.Error("expected rules pulled in by include not to be marked as substack")
+	}
+
+	if len(stack.Warnings) != 1 || !strings.Contains(stack.Warnings[0], "missing does not exist") {
+		t.Errorf("warnings = %v", stack.Warnings)
+	}
+	if got := len(stack.OfType(ModuleTypeAuth)); got != 3 {
+		t.Errorf("expected 3 auth rules, got %d", got)
+	}
+}
+
+func TestResolveService_Cycle(t *testing.T) {
+	root := writeSettingsFiles(t, map[string]string{
+		"/etc/pam.d/a": "auth include b\nauth required pam_unix.so\n",
+		"/etc/pam.d/b": "auth include a\nauth required pam_deny.so\n",
+	})
+
+	stack, err := ResolveService(root, "a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stack.Rules) != 2 || len(stack.Warnings) != 1 || !strings.Contains(stack.Warnings[0], "include cycle") {
+		t.Errorf("rules = %d, warnings = %v", len(stack.Rules), stack.Warnings)
+	}
+
+	if _, err := ResolveService(root, "nonexistent"); err == nil {
+		t.Error("expected error for a missing service")
+	}
+}
+
+func TestResolveService_OptionalTypes(t *testing.T) {
+	root := writeSettingsFiles(t, map[string]string{
+		"/etc/pam.d/sshd": "auth include system-auth\nsession include system-auth\n-password include system-auth\n",
+		"/etc/pam.d/system-auth": `auth      required pam_unix.so
+-auth     sufficient pam_sss.so
+-password optional pam_gnome_keyring.so
+-session  optional pam_systemd.so
+session   required pam_unix.so
+`,
+	})
+
+	stack, err := ResolveService(root, "sshd")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, rule := range stack.Rules {
+		got = append(got, string(rule.Type)+" "+rule.ModuleName())
+	}
+	want := []string{
+		"auth pam_unix.so", "-auth pam_sss.so",
+		"-session pam_systemd.so", "session pam_unix.so",
+		"-password pam_gnome_keyring.so",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stack = %v, want %v", got, want)
+	}
+	if got := len(stack.OfType(ModuleTypeSession)); got != 2 {
+		t.Errorf("expected 2 session rules, got %d", got)
+	}
+
+	posture := assessStack(stack, root)
+	if want := []string{"optional pam_systemd.so", "required pam_unix.so"}; !reflect.DeepEqual(posture.Session, want) {
+		t.Errorf("posture session = %v, want %v", posture.Session, want)
+	}
+}
@@ -0,0 +1,514 @@
+package pamparser
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SucceedIfModule is the module name of pam_succeed_if
+const SucceedIfModule = "pam_succeed_if.so"
+
+// SucceedIfField represents a field that a pam_succeed_if condition can test
+type SucceedIfField string
+
+const (
+	// SucceedIfFieldLogin is the login name (an alias of user)
+	SucceedIfFieldLogin SucceedIfField = "login"
+	// SucceedIfFieldUser is the name of the user being authenticated
+	SucceedIfFieldUser SucceedIfField = "user"
+	// SucceedIfFieldUID is the numeric user ID
+	SucceedIfFieldUID SucceedIfField = "uid"
+	// SucceedIfFieldGID is the numeric primary group ID
+	SucceedIfFieldGID SucceedIfField = "gid"
+	// SucceedIfFieldShell is the user's login shell
+	SucceedIfFieldShell SucceedIfField = "shell"
+	// SucceedIfFieldHome is the user's home directory
+	SucceedIfFieldHome SucceedIfField = "home"
+	// SucceedIfFieldRUser is the name of the requesting user
+	SucceedIfFieldRUser SucceedIfField = "ruser"
+	// SucceedIfFieldRHost is the name of the remote host
+	SucceedIfFieldRHost SucceedIfField = "rhost"
+	// SucceedIfFieldTTY is the name of the terminal
+	SucceedIfFieldTTY SucceedIfField = "tty"
+	// SucceedIfFieldService is the name of the PAM service
+	SucceedIfFieldService SucceedIfField = "service"
+)
+
+// SucceedIfOperator represents a comparison operator in a pam_succeed_if condition
+type SucceedIfOperator string
+
+const (
+	// SucceedIfLess compares integers with <
+	SucceedIfLess SucceedIfOperator = "<"
+	// SucceedIfLessEqual compares integers with <=
+	SucceedIfLessEqual SucceedIfOperator = "<="
+	// SucceedIfEqual compares integers for equality
+	SucceedIfEqual SucceedIfOperator = "eq"
+	// SucceedIfGreaterEqual compares integers with >=
+	SucceedIfGreaterEqual SucceedIfOperator = ">="
+	// SucceedIfGreater compares integers with >
+	SucceedIfGreater SucceedIfOperator = ">"
+	// SucceedIfNotEqual compares integers for inequality
+	SucceedIfNotEqual SucceedIfOperator = "ne"
+	// SucceedIfStringEqual compares strings for equality
+	SucceedIfStringEqual SucceedIfOperator = "="
+	// SucceedIfStringNotEqual compares strings for inequality
+	SucceedIfStringNotEqual SucceedIfOperator = "!="
+	// SucceedIfMatch matches a string against an fnmatch(3) glob pattern
+	SucceedIfMatch SucceedIfOperator = "=~"
+	// SucceedIfNotMatch checks that a string does not match an fnmatch(3) glob pattern
+	SucceedIfNotMatch SucceedIfOperator = "!~"
+	// SucceedIfInGroup checks that the user is a member of a group
+	SucceedIfInGroup SucceedIfOperator = "ingroup"
+	// SucceedIfNotInGroup checks that the user is not a member of a group
+	SucceedIfNotInGroup SucceedIfOperator = "notingroup"
+	// SucceedIfIn checks that a value is in a colon-separated list
+	SucceedIfIn SucceedIfOperator = "in"
+	// SucceedIfNotIn checks that a value is not in a colon-separated list
+	SucceedIfNotIn SucceedIfOperator = "notin"
+	// SucceedIfInNetgroup checks that the user or host is in a netgroup
+	SucceedIfInNetgroup SucceedIfOperator = "innetgr"
+	// SucceedIfNotInNetgroup checks that the user or host is not in a netgroup
+	SucceedIfNotInNetgroup SucceedIfOperator = "notinnetgr"
+)
+
+// succeedIfFlags lists the module options that are not part of a condition
+var succeedIfFlags = []string{"debug", "use_uid", "quiet", "quiet_fail", "quiet_success", "audit"}
+
+// SucceedIfCondition represents a single "field operator value" test
+type SucceedIfCondition struct {
+	Field    SucceedIfField    `json:"field"`
+	Operator SucceedIfOperator `json:"operator"`
+	Value    string            `json:"value"`
+}
+
+// SucceedIfExpression represents the parsed arguments of a pam_succeed_if rule.
+// All conditions must hold for the module to return success.
+type SucceedIfExpression struct {
+	Conditions []SucceedIfCondition `json:"conditions"`
+	Flags      []string             `json:"flags,omitempty"`
+}
+
+// SucceedIfContext describes the user and session a condition is evaluated against
+type SucceedIfContext struct {
+	User           string   `json:"user"`
+	Shell          string   `json:"shell,omitempty"`
+	Home           string   `json:"home,omitempty"`
+	RUser          string   `json:"ruser,omitempty"`
+	RHost          string   `json:"rhost,omitempty"`
+	TTY            string   `json:"tty,omitempty"`
+	Service        string   `json:"service,omitempty"`
+	Groups         []string `json:"groups,omitempty"`
+	Netgroups      []string `json:"netgroups,omitempty"`       // netgroups the user is a member of
+	RHostNetgroups []string `json:"rhost_netgroups,omitempty"` // netgroups the remote host is a member of
+	UID            int      `json:"uid"`
+	GID            int      `json:"gid"`
+}
+
+// IsValidSucceedIfField checks if the given string is a field pam_succeed_if can test
+func IsValidSucceedIfField(f string) bool {
+	switch SucceedIfField(f) {
+	case SucceedIfFieldLogin, SucceedIfFieldUser, SucceedIfFieldUID, SucceedIfFieldGID,
+		SucceedIfFieldShell, SucceedIfFieldHome, SucceedIfFieldRUser, SucceedIfFieldRHost,
+		SucceedIfFieldTTY, SucceedIfFieldService:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidSucceedIfOperator checks if the given string is an operator pam_succeed_if understands
+func IsValidSucceedIfOperator(op string) bool {
+	switch SucceedIfOperator(op) {
+	case SucceedIfLess, SucceedIfLessEqual, SucceedIfEqual, SucceedIfGreaterEqual, SucceedIfGreater,
+		SucceedIfNotEqual, SucceedIfStringEqual, SucceedIfStringNotEqual, SucceedIfMatch, SucceedIfNotMatch,
+		SucceedIfInGroup, SucceedIfNotInGroup, SucceedIfIn, SucceedIfNotIn, SucceedIfInNetgroup, SucceedIfNotInNetgroup:
+		return true
+	default:
+		return false
+	}
+}
+
+// isNumeric reports whether the operator compares integers
+func (op SucceedIfOperator) isNumeric() bool {
+	switch op {
+	case SucceedIfLess, SucceedIfLessEqual, SucceedIfEqual, SucceedIfGreaterEqual, SucceedIfGreater, SucceedIfNotEqual:
+		return true
+	default:
+		return false
+	}
+}
+
+// ParseSucceedIf parses pam_succeed_if module arguments into an expression.
+// Flags such as quiet or use_uid may appear anywhere; every other argument starts a
+// three-token condition.
+func ParseSucceedIf(args []string) (*SucceedIfExpression, error) {
+	expr := &SucceedIfExpression{}
+
+	for i := 0; i < len(args); {
+		if slices.Contains(succeedIfFlags, args[i]) {
+			expr.Flags = append(expr.Flags, args[i])
+			i++
+			continue
+		}
+
+		if i+2 >= len(args) {
+			return nil, fmt.Errorf("incomplete condition at argument %d: %s", i+1, strings.Join(args[i:], " "))
+		}
+
+		condition := SucceedIfCondition{
+			Field:    SucceedIfField(args[i]),
+			Operator: SucceedIfOperator(args[i+1]),
+			Value:    args[i+2],
+		}
+		if err := condition.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid condition at argument %d: %w", i+1, err)
+		}
+
+		expr.Conditions = append(expr.Conditions, condition)
+		i += 3
+	}
+
+	return expr, nil
+}
+
+// ParseSucceedIfRule parses the arguments of a pam_succeed_if rule
+func ParseSucceedIfRule(rule Rule) (*SucceedIfExpression, error) {
+	if !rule.IsModule(SucceedIfModule) {
+		return nil, fmt.Errorf("rule module %s is not %s", rule.ModulePath, SucceedIfModule)
+	}
+	return ParseSucceedIf(rule.Arguments)
+}
+
+// Validate checks the condition against the fields and operators documented for pam_succeed_if
+func (c SucceedIfCondition) Validate() error {
+	if !IsValidSucceedIfField(string(c.Field)) {
+		return fmt.Errorf("unknown field '%s'", c.Field)
+	}
+	if !IsValidSucceedIfOperator(string(c.Operator)) {
+		return fmt.Errorf("unknown operator '%s'", c.Operator)
+	}
+	if c.Value == "" {
+		return fmt.Errorf("missing value for %s %s", c.Field, c.Operator)
+	}
+
+	switch {
+	case c.Operator.isNumeric():
+		if c.Field != SucceedIfFieldUID && c.Field != SucceedIfFieldGID {
+			return fmt.Errorf("operator '%s' only applies to the uid and gid fields", c.Operator)
+		}
+		if _, err := strconv.Atoi(c.Value); err != nil {
+			return fmt.Errorf("operator '%s' requires an integer value, got '%s'", c.Operator, c.Value)
+		}
+	case c.Operator == SucceedIfInGroup || c.Operator == SucceedIfNotInGroup:
+		if c.Field != SucceedIfFieldUser && c.Field != SucceedIfFieldLogin {
+			return fmt.Errorf("operator '%s' only applies to the user field", c.Operator)
+		}
+	case c.Operator == SucceedIfInNetgroup || c.Operator == SucceedIfNotInNetgroup:
+		if c.Field != SucceedIfFieldUser && c.Field != SucceedIfFieldLogin && c.Field != SucceedIfFieldRHost {
+			return fmt.Errorf("operator '%s' only applies to the user and rhost fields", c.Operator)
+		}
+	}
+
+	return nil
+}
+
+// String returns the condition in pam_succeed_if argument form
+func (c SucceedIfCondition) String() string {
+	return string(c.Field) + " " + string(c.Operator) + " " + c.Value
+}
+
+// fieldValue returns the context value the condition's field refers to
+func (c SucceedIfCondition) fieldValue(ctx SucceedIfContext) string {
+	switch c.Field {
+	case SucceedIfFieldLogin, SucceedIfFieldUser:
+		return ctx.User
+	case SucceedIfFieldUID:
+		return strconv.Itoa(ctx.UID)
+	case SucceedIfFieldGID:
+		return strconv.Itoa(ctx.GID)
+	case SucceedIfFieldShell:
+		return ctx.Shell
+	case SucceedIfFieldHome:
+		return ctx.Home
+	case SucceedIfFieldRUser:
+		return ctx.RUser
+	case SucceedIfFieldRHost:
+		return ctx.RHost
+	case SucceedIfFieldTTY:
+		return ctx.TTY
+	case SucceedIfFieldService:
+		return ctx.Service
+	default:
+		return ""
+	}
+}
+
+// Evaluate reports whether the condition holds for the given context
+func (c SucceedIfCondition) Evaluate(ctx SucceedIfContext) (bool, error) {
+	if err := c.Validate(); err != nil {
+		return false, err
+	}
+
+	left := c.fieldValue(ctx)
+
+	switch c.Operator {
+	case SucceedIfLess, SucceedIfLessEqual, SucceedIfEqual, SucceedIfGreaterEqual, SucceedIfGreater, SucceedIfNotEqual:
+		return compareSucceedIfInts(c.Operator, left, c.Value)
+	case SucceedIfStringEqual:
+		return left == c.Value, nil
+	case SucceedIfStringNotEqual:
+		return left != c.Value, nil
+	case SucceedIfMatch, SucceedIfNotMatch:
+		matched := fnmatchRegexp(c.Value).MatchString(left)
+		return matched == (c.Operator == SucceedIfMatch), nil
+	case SucceedIfInGroup, SucceedIfNotInGroup:
+		member := false
+		for _, group := range strings.Split(c.Value, ":") {
+			if slices.Contains(ctx.Groups, group) {
+				member = true
+				break
+			}
+		}
+		return member == (c.Operator == SucceedIfInGroup), nil
+	case SucceedIfIn, SucceedIfNotIn:
+		found := slices.Contains(strings.Split(c.Value, ":"), left)
+		return found == (c.Operator == SucceedIfIn), nil
+	case SucceedIfInNetgroup, SucceedIfNotInNetgroup:
+		netgroups := ctx.Netgroups
+		if c.Field == SucceedIfFieldRHost {
+			netgroups = ctx.RHostNetgroups
+		}
+		member := slices.Contains(netgroups, c.Value)
+		return member == (c.Operator == SucceedIfInNetgroup), nil
+	default:
+		return false, fmt.Errorf("unknown operator '%s'", c.Operator)
+	}
+}
+
+// fnmatchRegexp translates an fnmatch(3) pattern, which pam_succeed_if matches =~ and !~
+// with, into an anchored regular expression. '*' and '?' also match '/', a backslash quotes
+// the next character, and a '[' without a closing ']' is literal, so every pattern is valid.
+func fnmatchRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString(`^(?s:`)
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*':
+			b.WriteString(".*")
+		case c == '?':
+			b.WriteString(".")
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case c == '[' && fnmatchBracketEnd(pattern, i) > 0:
+			end := fnmatchBracketEnd(pattern, i)
+			b.WriteString(fnmatchClass(pattern[i+1 : end]))
+			i = end
+		case c < utf8.RuneSelf:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteString(`)$`)
+	return regexp.MustCompile(b.String())
+}
+
+// fnmatchBracketEnd returns the index of the ']' closing the bracket expression that starts
+// at start, or -1. A ']' right after the '[' or its negation is a member, not the end.
+func fnmatchBracketEnd(pattern string, start int) int {
+	i := start + 1
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		i++
+	}
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+	for ; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// fnmatchClass translates the members of a bracket expression into a regular expression class
+func fnmatchClass(members string) string {
+	var b strings.Builder
+	b.WriteString("[")
+	if len(members) > 0 && (members[0] == '!' || members[0] == '^') {
+		b.WriteString("^")
+		members = members[1:]
+	}
+	escaped := false
+	for _, r := range members {
+		switch {
+		case r == '\\' && !escaped:
+			escaped = true
+			continue
+		case r == '-' && !escaped:
+			b.WriteRune(r)
+		case r < utf8.RuneSelf && !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			b.WriteString(`\` + string(r))
+		default:
+			b.WriteRune(r)
+		}
+		escaped = false
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// compareSucceedIfInts applies an integer comparison operator
+func compareSucceedIfInts(op SucceedIfOperator, left, right string) (bool, error) {
+	l, err := strconv.Atoi(left)
+	if err != nil {
+		return false, fmt.Errorf("field value '%s' is not an integer", left)
+	}
+	r, err := strconv.Atoi(right)
+	if err != nil {
+		return false, fmt.Errorf("operator '%s' requires an integer value, got '%s'", op, right)
+	}
+
+	switch op {
+	case SucceedIfLess:
+		return l < r, nil
+	case SucceedIfLessEqual:
+		return l <= r, nil
+	case SucceedIfEqual:
+		return l == r, nil
+	case SucceedIfGreaterEqual:
+		return l >= r, nil
+	case SucceedIfGreater:
+		return l > r, nil
+	case SucceedIfNotEqual:
+		return l != r, nil
+	default:
+		return false, fmt.Errorf("operator '%s' is not an integer comparison", op)
+	}
+}
+
+// Evaluate reports whether every condition in the expression holds for the given context
+func (e *SucceedIfExpression) Evaluate(ctx SucceedIfContext) (bool, error) {
+	for _, condition := range e.Conditions {
+		ok, err := condition.Evaluate(ctx)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// HasFlag reports whether the expression carries the given module flag (e.g. quiet or use_uid)
+func (e *SucceedIfExpression) HasFlag(flag string) bool {
+	return slices.Contains(e.Flags, flag)
+}
+
+// String returns the expression in pam_succeed_if argument form
+func (e *SucceedIfExpression) String() string {
+	parts := make([]string, 0, len(e.Flags)+len(e.Conditions))
+	for _, condition := range e.Conditions {
+		parts = append(parts, condition.String())
+	}
+	parts = append(parts, e.Flags...)
+	return strings.Join(parts, " ")
+}
+
+// Arguments returns the expression as module arguments suitable for Rule.Arguments
+func (e *SucceedIfExpression) Arguments() []string {
+	args := make([]string, 0, len(e.Conditions)*3+len(e.Flags))
+	for _, condition := range e.Conditions {
+		args = append(args, string(condition.Field), string(condition.Operator), condition.Value)
+	}
+	return append(args, e.Flags...)
+}
+
+// SucceedIfResult describes how a pam_succeed_if rule evaluates for a context
+type SucceedIfResult struct {
+	Expression *SucceedIfExpression `json:"expression,omitempty"`
+	Error      string               `json:"error,omitempty"`
+	Rule       Rule                 `json:"rule"`
+	RuleIndex  int                  `json:"rule_index"`
+	Matched    bool                 `json:"matched"`
+}
+
+// EvaluateSucceedIf evaluates every pam_succeed_if rule in the configuration against the context,
+// in stack order. Rules for a different service than ctx.Service are skipped when both are set.
+func (e *Editor) EvaluateSucceedIf(ctx SucceedIfContext) []SucceedIfResult {
+	var results []SucceedIfResult
+
+	for i, rule := range e.config.Rules {
+		if !rule.IsModule(SucceedIfModule) {
+			continue
+		}
+		if ctx.Service != "" && rule.Service != "" && !strings.EqualFold(rule.Service, ctx.Service) {
+			continue
+		}
+
+		result := SucceedIfResult{Rule: rule, RuleIndex: i}
+		expr, err := ParseSucceedIf(rule.Arguments)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		result.Expression = expr
+
+		matched, err := expr.Evaluate(ctx)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.Matched = matched
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// SucceedIfAffectedUsers returns the contexts for which the rule's conditions hold,
+// i.e. the users a pam_succeed_if rule returns success for
+func SucceedIfAffectedUsers(rule Rule, contexts []SucceedIfContext) ([]SucceedIfContext, error) {
+	expr, err := ParseSucceedIfRule(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	var affected []SucceedIfContext
+	for _, ctx := range contexts {
+		ok, err := expr.Evaluate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			affected = append(affected, ctx)
+		}
+	}
+	return affected, nil
+}
+
+// FilterBySucceedIf creates a filter for pam_succeed_if rules whose conditions hold for the context
+func FilterBySucceedIf(ctx SucceedIfContext) RuleFilter {
+	return func(rule Rule) bool {
+		if !rule.IsModule(SucceedIfModule) {
+			return false
+		}
+		expr, err := ParseSucceedIf(rule.Arguments)
+		if err != nil {
+			return false
+		}
+		ok, err := expr.Evaluate(ctx)
+		return err == nil && ok
+	}
+}
@@ -0,0 +1,218 @@
+package pamparser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSucceedIf(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		expectedConds int
+		expectedFlags int
+		expectError   bool
+	}{
+		{"uid comparison with flag", []string{"uid", ">=", "1000", "quiet"}, 1, 1, false},
+		{"ingroup", []string{"user", "ingroup", "wheel"}, 1, 0, false},
+		{"service list", []string{"service", "in", "sshd:login"}, 1, 0, false},
+		{"notin list", []string{"user", "notin", "root:admin"}, 1, 0, false},
+		{"flags between conditions", []string{"quiet_success", "uid", ">", "999", "use_uid", "shell", "!=", "/bin/false"}, 2, 2, false},
+		{"no arguments", nil, 0, 0, false},
+		{"incomplete condition", []string{"uid", ">="}, 0, 0, true},
+		{"unknown field", []string{"name", "=", "root"}, 0, 0, true},
+		{"unknown operator", []string{"uid", "=>", "1000"}, 0, 0, true},
+		{"numeric operator with string", []string{"uid", "eq", "abc"}, 0, 0, true},
+		{"integer operator with string", []string{"uid", "<", "abc"}, 0, 0, true},
+		{"ingroup on non-user field", []string{"shell", "ingroup", "wheel"}, 0, 0, true},
+		{"numeric operator on user", []string{"user", ">=", "5"}, 0, 0, true},
+		{"numeric operator on home", []string{"home", "eq", "0"}, 0, 0, true},
+		{"glob", []string{"shell", "=~", "*nologin"}, 1, 0, false},
+		{"glob with regular expression characters", []string{"user", "=~", "(a|b)[x"}, 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := ParseSucceedIf(tt.args)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error for %v, got %+v", tt.args, expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(expr.Conditions) != tt.expectedConds {
+				t.Errorf("expected %d conditions, got %d", tt.expectedConds, len(expr.Conditions))
+			}
+			if len(expr.Flags) != tt.expectedFlags {
+				t.Errorf("expected %d flags, got %d", tt.expectedFlags, len(expr.Flags))
+			}
+		})
+	}
+}
+
+func TestSucceedIfExpression_Evaluate(t *testing.T) {
+	alice := SucceedIfContext{User: "alice", UID: 1000, GID: 1000, Groups: []string{"users", "wheel"}, Netgroups: []string{"admins"}, RHost: "ws1", RHostNetgroups: []string{"trusted"}, Service: "sshd", Shell: "/bin/bash"}
+	root := SucceedIfContext{User: "root", UID: 0, GID: 0, Groups: []string{"root"}, Service: "login", Shell: "/bin/bash"}
+
+	tests := []struct {
+		name      string
+		args      []string
+		aliceWant bool
+		rootWant  bool
+	}{
+		{"uid >= 1000", []string{"uid", ">=", "1000", "quiet"}, true, false},
+		{"uid eq 0", []string{"uid", "eq", "0"}, false, true},
+		{"uid ne 0", []string{"uid", "ne", "0"}, true, false},
+		{"user ingroup wheel", []string{"user", "ingroup", "wheel"}, true, false},
+		{"user ingroup list", []string{"user", "ingroup", "admin:root"}, false, true},
+		{"user notingroup wheel", []string{"user", "notingroup", "wheel"}, false, true},
+		{"service in sshd:login", []string{"service", "in", "sshd:login"}, true, true},
+		{"user notin root:admin", []string{"user", "notin", "root:admin"}, true, false},
+		{"user = root", []string{"user", "=", "root"}, false, true},
+		{"user glob", []string{"user", "=~", "al*"}, true, false},
+		{"user not glob", []string{"user", "!~", "al*"}, false, true},
+		{"glob is anchored", []string{"user", "=~", "lic"}, false, false},
+		{"glob star matches slashes", []string{"shell", "=~", "*bash"}, true, true},
+		{"glob bracket expression", []string{"user", "=~", "[a-r]?[!x]*"}, true, true},
+		{"user innetgr", []string{"user", "innetgr", "admins"}, true, false},
+		{"rhost innetgr uses host netgroups", []string{"rhost", "innetgr", "trusted"}, true, false},
+		{"rhost notinnetgr user netgroup", []string{"rhost", "notinnetgr", "admins"}, true, true},
+		{"all conditions must hold", []string{"uid", ">=", "1000", "service", "=", "login"}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := ParseSucceedIf(tt.args)
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+
+			got, err := expr.Evaluate(alice)
+			if err != nil {
+				t.Fatalf("unexpected evaluation error: %v", err)
+			}
+			if got != tt.aliceWant {
+				t.Errorf("alice: expected %v, got %v", tt.aliceWant, got)
+			}
+
+			got, err = expr.Evaluate(root)
+			if err != nil {
+				t.Fatalf("unexpected evaluation error: %v", err)
+			}
+			if got != tt.rootWant {
+				t.Errorf("root: expected %v, got %v", tt.rootWant, got)
+			}
+		})
+	}
+}
+
+func TestSucceedIfExpression_RoundTrip(t *testing.T) {
+	args := []string{"uid", ">=", "1000", "user", "notin", "root:admin", "quiet"}
+	expr, err := ParseSucceedIf(args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := strings.Join(expr.Arguments(), " "); got != strings.Join(args, " ") {
+		t.Errorf("Arguments() = %q, want %q", got, strings.Join(args, " "))
+	}
+	if !expr.HasFlag("quiet") {
+		t.Error("expected quiet flag to be recorded")
+	}
+}
+
+func TestEditor_EvaluateSucceedIf(t *testing.T) {
+	content := `auth requisite pam_succeed_if.so uid >= 1000 quiet
+auth sufficient /lib/security/pam_succeed_if.so user ingroup wheel
+auth required pam_unix.so
+account required pam_succeed_if.so uid <
+`
+	config, err := NewParser().Parse(strings.NewReader(content), true)
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	editor := NewEditor(config)
+	ctx := SucceedIfContext{User: "bob", UID: 1001, Groups: []string{"users"}}
+	results := editor.EvaluateSucceedIf(ctx)
+
+	if len(results) != 3 {
+		t.Fatalf("expected 3 pam_succeed_if results, got %d", len(results))
+	}
+	if !results[0].Matched || results[0].RuleIndex != 0 {
+		t.Errorf("expected rule 0 to match, got %+v", results[0])
+	}
+	if results[1].Matched {
+		t.Errorf("expected rule 1 not to match for a non-wheel user")
+	}
+	if results[2].Error == "" {
+		t.Errorf("expected an error for the incomplete condition")
+	}
+
+	matching := editor.FindRules(FilterBySucceedIf(ctx))
+	if len(matching) != 1 || matching[0] != 0 {
+		t.Errorf("expected FilterBySucceedIf to match rule 0 only, got %v", matching)
+	}
+
+	warnings := editor.Validate()
+	found := false
+	for _, w := range warnings {
+		if strings.Contains(w, "Rule 3") && strings.Contains(w, SucceedIfModule) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a validation warning for rule 3, got %v", warnings)
+	}
+}
+
+func TestSucceedIfAffectedUsers(t *testing.T) {
+	rule := Rule{Type: ModuleTypeAuth, ModulePath: SucceedIfModule, Arguments: []string{"uid", ">=", "1000"}}
+	contexts := []SucceedIfContext{
+		{User: "root", UID: 0},
+		{User: "daemon", UID: 1},
+		{User: "alice", UID: 1000},
+		{User: "bob", UID: 1001},
+	}
+
+	affected, err := SucceedIfAffectedUsers(rule, contexts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(affected) != 2 || affected[0].User != "alice" || affected[1].User != "bob" {
+		t.Errorf("expected alice and bob, got %+v", affected)
+	}
+
+	if _, err := SucceedIfAffectedUsers(Rule{ModulePath: "pam_unix.so"}, contexts); err == nil {
+		t.Error("expected error for a non pam_succeed_if rule")
+	}
+}
+
+func TestFnmatchRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"*nologin", "/sbin/nologin", true},
+		{"adm", "badmin", false},
+		{"adm*", "admin", true},
+		{"a?m", "adm", true},
+		{"[!a]dm", "adm", false},
+		{"[]x]dm", "]dm", true},
+		{"[a", "[a", true},
+		{`\*`, "*", true},
+		{`\*`, "x", false},
+		{"a.c", "abc", false},
+		{"(a|b)", "(a|b)", true},
+	}
+
+	for _, tt := range tests {
+		if got := fnmatchRegexp(tt.pattern).MatchString(tt.value); got != tt.want {
+			t.Errorf("%q matching %q = %v, want %v", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,437 @@
+package pamparser
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Modules that read services;ttys;users;times rules
+const (
+	// TimeModule is the module name of pam_time
+	TimeModule = "pam_time.so"
+	// GroupModule is the module name of pam_group
+	GroupModule = "pam_group.so"
+)
+
+// Default locations of the files read by pam_time and pam_group
+const (
+	// DefaultTimeFile is read by pam_time unless conffile= names another file
+	DefaultTimeFile = "/etc/security/time.conf"
+	// DefaultGroupFile is read by pam_group
+	DefaultGroupFile = "/etc/security/group.conf"
+)
+
+// timeDays maps the two-letter day codes of time.conf to weekday bits. Codes are combined
+// with exclusive or, so "AlFr" is every day but Friday.
+var timeDays = map[string]uint8{
+	"Su": 1 << time.Sunday,
+	"Mo": 1 << time.Monday,
+	"Tu": 1 << time.Tuesday,
+	"We": 1 << time.Wednesday,
+	"Th": 1 << time.Thursday,
+	"Fr": 1 << time.Friday,
+	"Sa": 1 << time.Saturday,
+	"Wk": 1<<time.Monday | 1<<time.Tuesday | 1<<time.Wednesday | 1<<time.Thursday | 1<<time.Friday,
+	"Wd": 1<<time.Saturday | 1<<time.Sunday,
+	"Al": 0x7f,
+}
+
+// TimeRule is one services;ttys;users;times line of time.conf, or one
+// services;ttys;users;times;groups line of group.conf. The first four fields are logic lists
+// of terms joined by & and |, each optionally negated with !.
+type TimeRule struct {
+	Services   string   `json:"services"`
+	Ttys       string   `json:"ttys"`
+	Users      string   `json:"users"`
+	Times      string   `json:"times"`
+	Groups     []string `json:"groups,omitempty"` // group.conf only
+	Comment    string   `json:"comment,omitempty"`
+	LineNumber int      `json:"line_number,omitempty"`
+}
+
+// TimeConfig represents a time.conf or group.conf file
+type TimeConfig struct {
+	FilePath  string     `json:"file_path,omitempty"`
+	Rules     []TimeRule `json:"rules"`
+	Comments  []string   `json:"comments,omitempty"`
+	GroupConf bool       `json:"group_conf,omitempty"` // rules have a groups field
+}
+
+// TimeSpec is one parsed term of a times field, such as MoTuWe0800-1700. Start and End are
+// HHMM values; when End is not after Start the range runs past midnight.
+type TimeSpec struct {
+	Days  uint8 `json:"days"` // bit n is set for time.Weekday(n)
+	Start int   `json:"start"`
+	End   int   `json:"end"`
+}
+
+// TimeRequest describes an access attempt to check against time.conf or group.conf. Group
+// and netgroup membership is not looked up and must be supplied.
+type TimeRequest struct {
+	Service   string    `json:"service"`
+	Tty       string    `json:"tty"`
+	User      string    `json:"user"`
+	Groups    []string  `json:"groups,omitempty"`    // matched by %group terms
+	Netgroups []string  `json:"netgroups,omitempty"` // matched by @netgroup terms
+	Time      time.Time `json:"time"`
+}
+
+// TimeDecision is the outcome of evaluating a TimeRequest
+type TimeDecision struct {
+	Allowed bool     `json:"allowed"`
+	Rule    int      `json:"rule"` // index of the denying rule, -1 when access is allowed
+	Line    int      `json:"line,omitempty"`
+	Groups  []string `json:"groups,omitempty"` // groups granted by group.conf
+}
+
+// ParseTimeConf parses time.conf syntax
+func ParseTimeConf(reader io.Reader) (*TimeConfig, error) {
+	return parseTimeRules(reader, false)
+}
+
+// ParseGroupConf parses group.conf syntax
+func ParseGroupConf(reader io.Reader) (*TimeConfig, error) {
+	return parseTimeRules(reader, true)
+}
+
+// parseTimeRules parses semicolon-separated rules with four fields, or five when groupConf
+// is set. Lines ending in a backslash continue on the next line and '#' starts a comment.
+func parseTimeRules(reader io.Reader, groupConf bool) (*TimeConfig, error) {
+	config := &TimeConfig{GroupConf: groupConf}
+	want := 4
+	if groupConf {
+		want = 5
+	}
+
+	comments, err := scanContinuedLines(reader, func(line string, lineNum int) error {
+		content, comment := splitConfigComment(line)
+		fields := strings.Split(content, ";")
+		if len(fields) != want {
+			return fmt.Errorf("expected %d fields separated by ';' at line %d, got %d", want, lineNum, len(fields))
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		rule := TimeRule{
+			Services:   fields[0],
+			Ttys:       fields[1],
+			Users:      fields[2],
+			Times:      fields[3],
+			Comment:    comment,
+			LineNumber: lineNum,
+		}
+		if groupConf {
+			rule.Groups = strings.FieldsFunc(fields[4], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		}
+		config.Rules = append(config.Rules, rule)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	config.Comments = comments
+	return config, nil
+}
+
+// LoadTimeFile loads a time.conf file
+func LoadTimeFile(filePath string) (*TimeConfig, error) {
+	return loadTimeRules(filePath, false)
+}
+
+// LoadGroupFile loads a group.conf file
+func LoadGroupFile(filePath string) (*TimeConfig, error) {
+	return loadTimeRules(filePath, true)
+}
+
+// loadTimeRules loads a time.conf or group.conf file
+func loadTimeRules(filePath string, groupConf bool) (*TimeConfig, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	config, err := parseTimeRules(file, groupConf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file %s: %w", filePath, err)
+	}
+	config.FilePath = filePath
+	return config, nil
+}
+
+// LoadTimeForRule loads the file a pam_time or pam_group rule reads. pam_time honors a
+// conffile= argument. root is prepended to the file path.
+func LoadTimeForRule(rule Rule, root string) (*TimeConfig, error) {
+	switch {
+	case rule.IsModule(TimeModule):
+		path := DefaultTimeFile
+		if conf, ok := rule.ArgumentValue("conffile"); ok {
+			path = conf
+		}
+		return LoadTimeFile(filepath.Join(root, path))
+	case rule.IsModule(GroupModule):
+		return LoadGroupFile(filepath.Join(root, DefaultGroupFile))
+	default:
+		return nil, fmt.Errorf("rule module %s is not %s or %s", rule.ModulePath, TimeModule, GroupModule)
+	}
+}
+
+// String returns the configuration in time.conf or group.conf syntax, standalone comments
+// first
+func (c *TimeConfig) String() string {
+	var b strings.Builder
+	for _, comment := range c.Comments {
+		b.WriteString("# " + comment + "\n")
+	}
+	for _, rule := range c.Rules {
+		fields := []string{rule.Services, rule.Ttys, rule.Users, rule.Times}
+		if c.GroupConf {
+			fields = append(fields, strings.Join(rule.Groups, ", "))
+		}
+		line := strings.Join(fields, ";")
+		if rule.Comment != "" {
+			line += " # " + rule.Comment
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// Write writes the configuration in time.conf or group.conf syntax
+func (c *TimeConfig) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, c.String()); err != nil {
+		return fmt.Errorf("error writing time configuration: %w", err)
+	}
+	return nil
+}
+
+// splitTimeLogic splits a logic list into its terms and the operators between them
+func splitTimeLogic(field string) (terms []string, ops []byte) {
+	start := 0
+	for i := 0; i < len(field); i++ {
+		if field[i] == '&' || field[i] == '|' {
+			terms = append(terms, strings.TrimSpace(field[start:i]))
+			ops = append(ops, field[i])
+			start = i + 1
+		}
+	}
+	return append(terms, strings.TrimSpace(field[start:])), ops
+}
+
+// matchTimeLogic evaluates a logic list as pam_time does: strictly left to right, with no
+// precedence between & and |
+func matchTimeLogic(field string, match func(term string) bool) bool {
+	terms, ops := splitTimeLogic(field)
+	result := false
+	for i, term := range terms {
+		negate := strings.HasPrefix(term, "!")
+		matched := match(strings.TrimPrefix(term, "!")) != negate
+		if i == 0 || ops[i-1] == '|' {
+			result = result || matched
+		} else {
+			result = result && matched
+		}
+	}
+	return result
+}
+
+// checkTimeLogic reports the first malformed term of a logic list
+func checkTimeLogic(field string, check func(term string) error) error {
+	terms, _ := splitTimeLogic(field)
+	for _, term := range terms {
+		term = strings.TrimPrefix(term, "!")
+		if term == "" {
+			return fmt.Errorf("empty term in '%s'", field)
+		}
+		if strings.Count(term, "*") > 1 {
+			return fmt.Errorf("more than one wildcard in '%s'", term)
+		}
+		if check != nil {
+			if err := check(term); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matchTimeWildcard matches a value against a term that may contain one '*'
+func matchTimeWildcard(term, value string) bool {
+	prefix, suffix, ok := strings.Cut(term, "*")
+	if !ok {
+		return term == value
+	}
+	return len(value) >= len(prefix)+len(suffix) && strings.HasPrefix(value, prefix) && strings.HasSuffix(value, suffix)
+}
+
+// matchTimeUser matches a users term: %group, @netgroup or a user name pattern
+func matchTimeUser(term string, req TimeRequest) bool {
+	if group, ok := strings.CutPrefix(term, "%"); ok {
+		return slices.ContainsFunc(req.Groups, func(g string) bool { return matchTimeWildcard(group, g) })
+	}
+	if netgroup, ok := strings.CutPrefix(term, "@"); ok {
+		return slices.Contains(req.Netgroups, netgroup)
+	}
+	return matchTimeWildcard(term, req.User)
+}
+
+// ParseTimeSpec parses one term of a times field, such as Wk0800-1800 or AlFr2200-0600. Day
+// codes are matched case-insensitively.
+func ParseTimeSpec(term string) (TimeSpec, error) {
+	var spec TimeSpec
+	i := 0
+	for ; i+2 <= len(term) && !isDigit(term[i]); i += 2 {
+		code := strings.ToUpper(term[i:i+1]) + strings.ToLower(term[i+1:i+2])
+		bits, ok := timeDays[code]
+		if !ok {
+			return TimeSpec{}, fmt.Errorf("unknown day '%s' in '%s'", term[i:i+2], term)
+		}
+		spec.Days ^= bits
+	}
+	if i == 0 {
+		return TimeSpec{}, fmt.Errorf("missing days in '%s'", term)
+	}
+
+	start, end, ok := strings.Cut(term[i:], "-")
+	if !ok {
+		return TimeSpec{}, fmt.Errorf("expected HHMM-HHMM in '%s'", term)
+	}
+	var err error
+	if spec.Start, err = parseTimeOfDay(start); err != nil {
+		return TimeSpec{}, fmt.Errorf("%w in '%s'", err, term)
+	}
+	if spec.End, err = parseTimeOfDay(end); err != nil {
+		return TimeSpec{}, fmt.Errorf("%w in '%s'", err, term)
+	}
+	return spec, nil
+}
+
+// isDigit reports whether c is an ASCII digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// parseTimeOfDay parses an HHMM time between 0000 and 2400
+func parseTimeOfDay(s string) (int, error) {
+	if len(s) != 4 {
+		return 0, fmt.Errorf("time '%s' is not HHMM", s)
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 2400 || n%100 >= 60 {
+		return 0, fmt.Errorf("invalid time '%s'", s)
+	}
+	return n, nil
+}
+
+// Matches reports whether t falls in the spec. A range that ends at or before its start
+// runs past midnight, so its early hours belong to the day after a listed day.
+func (s TimeSpec) Matches(t time.Time) bool {
+	now := t.Hour()*100 + t.Minute()
+	today := uint8(1) << t.Weekday()
+	yesterday := uint8(1) << ((t.Weekday() + 6) % 7)
+
+	if s.Start < s.End {
+		return s.Days&today != 0 && now >= s.Start && now < s.End
+	}
+	return (s.Days&today != 0 && now >= s.Start) || (s.Days&yesterday != 0 && now < s.End)
+}
+
+// matchTimeSpec matches a times term, treating a malformed one as not matching
+func matchTimeSpec(term string, t time.Time) bool {
+	spec, err := ParseTimeSpec(term)
+	return err == nil && spec.Matches(t)
+}
+
+// applies reports whether the services, ttys and users fields of a rule match the request
+func (r TimeRule) applies(req TimeRequest) bool {
+	return matchTimeLogic(r.Services, func(term string) bool { return matchTimeWildcard(term, req.Service) }) &&
+		matchTimeLogic(r.Ttys, func(term string) bool { return matchTimeWildcard(term, req.Tty) }) &&
+		matchTimeLogic(r.Users, func(term string) bool { return matchTimeUser(term, req) })
+}
+
+// inTime reports whether the times field of a rule matches the request time
+func (r TimeRule) inTime(req TimeRequest) bool {
+	return matchTimeLogic(r.Times, func(term string) bool { return matchTimeSpec(term, req.Time) })
+}
+
+// Evaluate decides a request. For time.conf, as in pam_time, every rule whose services,
+// ttys and users match must also match on time, and the first that does not denies access.
+// For group.conf, as in pam_group, access is always allowed and every fully matching rule
+// grants its groups.
+func (c *TimeConfig) Evaluate(req TimeRequest) TimeDecision {
+	decision := TimeDecision{Allowed: true, Rule: -1}
+	for i, rule := range c.Rules {
+		if !rule.applies(req) {
+			continue
+		}
+		inTime := rule.inTime(req)
+		if c.GroupConf {
+			if inTime {
+				for _, group := range rule.Groups {
+					if !slices.Contains(decision.Groups, group) {
+						decision.Groups = append(decision.Groups, group)
+					}
+				}
+			}
+			continue
+		}
+		if !inTime {
+			return TimeDecision{Allowed: false, Rule: i, Line: rule.LineNumber}
+		}
+	}
+	return decision
+}
+
+// Allows reports whether the request is allowed
+func (c *TimeConfig) Allows(req TimeRequest) bool {
+	return c.Evaluate(req).Allowed
+}
+
+// Validate checks every rule, returning one warning per problem: empty terms, repeated
+// wildcards, malformed time specs and group.conf rules without groups
+func (c *TimeConfig) Validate() []string {
+	var warnings []string
+	for i, rule := range c.Rules {
+		prefix := fmt.Sprintf("Rule %d (line %d)", i, rule.LineNumber)
+		for _, field := range []string{rule.Services, rule.Ttys, rule.Users} {
+			if err := checkTimeLogic(field, nil); err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: %v", prefix, err))
+			}
+		}
+		err := checkTimeLogic(rule.Times, func(term string) error {
+			_, err := ParseTimeSpec(term)
+			return err
+		})
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v", prefix, err))
+		}
+		if c.GroupConf && len(rule.Groups) == 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: no groups to grant", prefix))
+		}
+	}
+	return warnings
+}
+
+// CheckTime evaluates a request against the time.conf or group.conf of every pam_time and
+// pam_group rule in the configuration, keyed by rule ID
+func (e *Editor) CheckTime(req TimeRequest, root string) (map[RuleID]TimeDecision, error) {
+	e.ensureIDs()
+
+	decisions := make(map[RuleID]TimeDecision)
+	for _, i := range e.FindRules(func(rule Rule) bool { return rule.IsModule(TimeModule) || rule.IsModule(GroupModule) }) {
+		rule := e.config.Rules[i]
+		config, err := LoadTimeForRule(rule, root)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		decisions[rule.ID] = config.Evaluate(req)
+	}
+	return decisions, nil
+}
@@ -0,0 +1,180 @@
+package pamparser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleTimeConf = `# time.conf
+login ; tty* & !ttyp* ; !root ; !Al0000-2400
+games ; * ; !waster ; Wd0000-2400 | Wk1800-0800
+sshd;*;%contractors|bob;Wk0900-1700 # office hours only
+`
+
+// at returns the given weekday and time of day in the week starting Sunday 7 January 2024
+func at(day time.Weekday, hour, minute int) time.Time {
+	return time.Date(2024, time.January, 7+int(day), hour, minute, 0, 0, time.UTC)
+}
+
+func TestParseTimeConf(t *testing.T) {
+	config, err := ParseTimeConf(strings.NewReader(sampleTimeConf))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := TimeRule{Services: "sshd", Ttys: "*", Users: "%contractors|bob", Times: "Wk0900-1700", Comment: "office hours only", LineNumber: 4}
+	if len(config.Rules) != 3 || !reflect.DeepEqual(config.Rules[2], want) {
+		t.Fatalf("rules = %+v", config.Rules)
+	}
+	if config.Rules[0].Ttys != "tty* & !ttyp*" {
+		t.Errorf("ttys = %q", config.Rules[0].Ttys)
+	}
+	if warnings := config.Validate(); len(warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+
+	reparsed, err := ParseTimeConf(strings.NewReader(config.String()))
+	if err != nil || len(reparsed.Rules) != 3 || reparsed.Rules[2].Comment != want.Comment {
+		t.Errorf("written output does not parse back: %v", err)
+	}
+
+	if _, err := ParseTimeConf(strings.NewReader("login;*;*\n")); err == nil {
+		t.Error("expected error for a missing field")
+	}
+	if _, err := ParseGroupConf(strings.NewReader(sampleTimeConf)); err == nil {
+		t.Error("expected group.conf parsing to require a groups field")
+	}
+}
+
+func TestParseTimeSpec(t *testing.T) {
+	tests := []struct {
+		term    string
+		want    TimeSpec
+		wantErr bool
+	}{
+		{term: "Al0000-2400", want: TimeSpec{Days: 0x7f, Start: 0, End: 2400}},
+		{term: "MoTu0800-1200", want: TimeSpec{Days: 1<<time.Monday | 1<<time.Tuesday, Start: 800, End: 1200}},
+		{term: "AlFr2200-0600", want: TimeSpec{Days: 0x7f &^ (1 << time.Friday), Start: 2200, End: 600}},
+		{term: "MoMo0000-2400", want: TimeSpec{Days: 0, Start: 0, End: 2400}},
+		{term: "wd1000-1100", want: TimeSpec{Days: 1<<time.Saturday | 1<<time.Sunday, Start: 1000, End: 1100}},
+		{term: "0800-1200", wantErr: true},
+		{term: "Xx0800-1200", wantErr: true},
+		{term: "Mo0800", wantErr: true},
+		{term: "Mo0870-0900", wantErr: true},
+		{term: "Mo800-900", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.term, func(t *testing.T) {
+			got, err := ParseTimeSpec(tt.term)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimeSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseTimeSpec() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeSpec_Matches(t *testing.T) {
+	overnight, err := ParseTimeSpec("Fr2200-0600")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		when time.Time
+		want bool
+	}{
+		{at(time.Friday, 23, 0), true},
+		{at(time.Saturday, 5, 59), true},
+		{at(time.Saturday, 6, 0), false},
+		{at(time.Friday, 5, 0), false},
+		{at(time.Thursday, 23, 0), false},
+	}
+	for _, tt := range tests {
+		if got := overnight.Matches(tt.when); got != tt.want {
+			t.Errorf("Matches(%s) = %v, want %v", tt.when.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestTimeConfig_Evaluate(t *testing.T) {
+	config, err := ParseTimeConf(strings.NewReader(sampleTimeConf))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		req   TimeRequest
+		allow bool
+		rule  int
+	}{
+		{"login on tty denied", TimeRequest{Service: "login", Tty: "tty1", User: "alice", Time: at(time.Monday, 12, 0)}, false, 0},
+		{"login on pty not covered", TimeRequest{Service: "login", Tty: "ttyp0", User: "alice", Time: at(time.Monday, 12, 0)}, true, -1},
+		{"root excepted", TimeRequest{Service: "login", Tty: "tty1", User: "root", Time: at(time.Monday, 12, 0)}, true, -1},
+		{"games on weekend", TimeRequest{Service: "games", Tty: "pts/0", User: "alice", Time: at(time.Sunday, 12, 0)}, true, -1},
+		{"games during work", TimeRequest{Service: "games", Tty: "pts/0", User: "alice", Time: at(time.Wednesday, 12, 0)}, false, 1},
+		{"games after work", TimeRequest{Service: "games", Tty: "pts/0", User: "alice", Time: at(time.Wednesday, 19, 0)}, true, -1},
+		{"contractor out of hours", TimeRequest{Service: "sshd", Tty: "ssh", User: "carol", Groups: []string{"contractors"}, Time: at(time.Tuesday, 20, 0)}, false, 2},
+		{"user in hours", TimeRequest{Service: "sshd", Tty: "ssh", User: "bob", Time: at(time.Tuesday, 10, 0)}, true, -1},
+		{"other user any time", TimeRequest{Service: "sshd", Tty: "ssh", User: "dave", Time: at(time.Tuesday, 20, 0)}, true, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := config.Evaluate(tt.req)
+			if got.Allowed != tt.allow || got.Rule != tt.rule {
+				t.Errorf("Evaluate() = %+v, want allowed=%v rule=%d", got, tt.allow, tt.rule)
+			}
+		})
+	}
+}
+
+func TestMatchTimeLogic_LeftToRight(t *testing.T) {
+	values := map[string]bool{"a": true, "b": false, "c": true}
+	match := func(term string) bool { return values[term] }
+
+	// (a | b) & !c, not a | (b & !c)
+	if matchTimeLogic("a|b&!c", match) {
+		t.Error("expected operators to be applied left to right")
+	}
+	if !matchTimeLogic("b&c|a", match) {
+		t.Error("expected b&c|a to match")
+	}
+}
+
+func TestEditor_CheckTime(t *testing.T) {
+	root := writeSettingsFiles(t, map[string]string{
+		DefaultTimeFile:  sampleTimeConf,
+		DefaultGroupFile: "xsh;tty*;%staff;Wk0800-1800;audio, video\n*;*;*;Al0000-2400;plugdev\n",
+	})
+
+	config := mustParsePamD(t, `account required pam_time.so
+auth optional pam_group.so
+`)
+	editor := NewEditor(config)
+	decisions, err := editor.CheckTime(TimeRequest{Service: "xsh", Tty: "tty2", User: "erin", Groups: []string{"staff"}, Time: at(time.Monday, 9, 30)}, root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rules := editor.GetConfig().Rules
+	if !decisions[rules[0].ID].Allowed {
+		t.Errorf("expected pam_time to allow, got %+v", decisions[rules[0].ID])
+	}
+	if got := decisions[rules[1].ID].Groups; !reflect.DeepEqual(got, []string{"audio", "video", "plugdev"}) {
+		t.Errorf("granted groups = %v", got)
+	}
+
+	group, err := LoadTimeForRule(rules[1], root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(group.String(), "xsh;tty*;%staff;Wk0800-1800;audio, video\n") {
+		t.Errorf("String() = %q", group.String())
+	}
+}
@@ -20,6 +20,9 @@ type Writer struct {
 	TypeColumnWidth    int
 	ControlColumnWidth int
 	ModuleColumnWidth  int
+
+	// ShortestControls writes each control in its shortest equivalent form
+	ShortestControls bool
 }
 
 // NewWriter creates a new PAM configuration writer
@@ -49,8 +52,19 @@ func (w *Writer) SetColumnWidths(typeWidth, controlWidth, moduleWidth int) *Writ
 	return w
 }
 
+// SetShortestControls enables/disables writing controls in their shortest equivalent form,
+// e.g. [success=ok new_authtok_reqd=ok ignore=ignore default=bad] as required
+func (w *Writer) SetShortestControls(enabled bool) *Writer {
+	w.ShortestControls = enabled
+	return w
+}
+
 // formatControl formats a Control structure back to string representation
 func (w *Writer) formatControl(control Control) string {
+	if w.ShortestControls {
+		control = control.Shortest()
+	}
+
 	var result strings.Builder
 
 	if control.Optional {
@@ -65,12 +79,20 @@ func (w *Writer) formatControl(control Control) string {
 	if control.Complex != nil {
 		result.WriteString("[")
 
-		// Sort keys for consistent output
-		var keys []string
+		// Keep the parsed key order, then add any other keys sorted for consistent output
+		var keys, added []string
+		for _, k := range control.Order {
+			if _, ok := control.Complex[k]; ok && !slices.Contains(keys, string(k)) {
+				keys = append(keys, string(k))
+			}
+		}
 		for k := range control.Complex {
-			keys = append(keys, string(k))
+			if !slices.Contains(keys, string(k)) {
+				added = append(added, string(k))
+			}
 		}
-		sort.Strings(keys)
+		sort.Strings(added)
+		keys = append(keys, added...)
 
 		var pairs []string
 		for _, key := range keys {
@@ -206,7 +228,9 @@ func (w *Writer) formatPrettyRule(typeStr, controlStr, modulePath string, argume
 	return line
 }
 
-// handleLineContinuation splits a long line into multiple lines with continuation
+// handleLineContinuation splits a long line into multiple lines with continuation. Lines
+// are only broken between tokens: never inside a bracketed argument or complex control, and
+// never inside a trailing comment, which libpam would not continue.
 func (w *Writer) handleLineContinuation(line string) []string {
 	if w.MaxLineLength <= 0 || len(line) <= w.MaxLineLength {
 		return []string{line}
@@ -217,17 +241,23 @@ func (w *Writer) handleLineContinuation(line string) []string {
 	indentStr := strings.Repeat(" ", w.ContinuationIndent)
 
 	for len(remaining) > w.MaxLineLength {
-		// Find a good break point (prefer breaking at spaces)
-		breakPoint := w.MaxLineLength
-		for i := w.MaxLineLength - 1; i > w.MaxLineLength/2; i-- {
-			if remaining[i] == ' ' {
+		// Prefer the last token boundary that fits, otherwise take the first one after it
+		breaks := tokenBoundaries(remaining)
+		breakPoint := -1
+		for _, i := range breaks {
+			if i > len(indentStr) && (i <= w.MaxLineLength || breakPoint < 0) {
 				breakPoint = i
+			}
+			if i > w.MaxLineLength && breakPoint >= 0 {
 				break
 			}
 		}
+		if breakPoint < 0 {
+			break
+		}
 
 		// Add continuation marker and create line
-		currentLine := strings.TrimSpace(remaining[:breakPoint]) + " \\"
+		currentLine := strings.TrimRight(remaining[:breakPoint], " \t") + " \\"
 		lines = append(lines, currentLine)
 
 		// Continue with remaining text, adding indentation
@@ -245,6 +275,59 @@ func (w *Writer) handleLineContinuation(line string) []string {
 	return lines
 }
 
+// tokenBoundaries returns the offsets of the whitespace between tokens of a written rule,
+// skipping whitespace inside brackets and stopping at a comment
+func tokenBoundaries(line string) []int {
+	var boundaries []int
+	inBrackets := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case inBrackets && c == '\\' && i+1 < len(line) && line[i+1] == ']':
+			i++ // escaped bracket inside an argument
+		case c == '[':
+			inBrackets = true
+		case c == ']':
+			inBrackets = false
+		case !inBrackets && c == '#':
+			// the comment has to stay on the line with the last token
+			if n := len(boundaries); n > 0 && strings.TrimSpace(line[boundaries[n-1]:i]) == "" {
+				boundaries = boundaries[:n-1]
+			}
+			return boundaries
+		case !inBrackets && (c == ' ' || c == '\t') && i > 0 && line[i-1] != ' ' && line[i-1] != '\t':
+			boundaries = append(boundaries, i)
+		}
+	}
+	return boundaries
+}
+
+// unchangedFragments returns the original physical lines of a continued rule if the rule
+// still reads the same as when it was parsed, with the tokenizer the configuration was
+// parsed with, and the writer would not rewrite its control
+func (w *Writer) unchangedFragments(rule Rule, config *Config) ([]string, bool) {
+	if len(rule.Fragments) < 2 {
+		return nil, false
+	}
+	parser := NewParser().SetLenient(true).SetLibpamCompat(config.libpamCompat)
+	parsed, err := parser.parseFragments(rule.Fragments, config.IsPamD, rule.Service)
+	if err != nil || parsed == nil {
+		return nil, false
+	}
+
+	plain := NewWriter()
+	if plain.formatRule(*parsed) != plain.formatRule(rule) {
+		return nil, false
+	}
+	if w.formatControl(rule.Control) != plain.formatControl(rule.Control) {
+		return nil, false
+	}
+	lines := make([]string, len(rule.Fragments))
+	for i, fragment := range rule.Fragments {
+		lines[i] = fragment.Text
+	}
+	return lines, true
+}
+
 // Write writes a PAM configuration to the provided writer
 func (w *Writer) Write(config *Config, writer io.Writer) error {
 	if config == nil {
@@ -281,6 +364,12 @@ func (w *Writer) Write(config *Config, writer io.Writer) error {
 			}
 		}
 
+		// Keep the original layout of continued rules that have not been edited
+		if original, ok := w.unchangedFragments(rule, &configCopy); ok {
+			lines = append(lines, original...)
+			continue
+		}
+
 		ruleLine := w.formatRule(rule)
 
 		// Handle line continuation if needed
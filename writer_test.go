@@ -1,6 +1,7 @@
 package pamparser
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -297,3 +298,104 @@ func TestSortRulesByTypeEdgeCases(t *testing.T) {
 		t.Error("Expected directive to be sorted to the end")
 	}
 }
+
+func TestWriter_LineContinuationTokenBoundaries(t *testing.T) {
+	writer := NewWriter()
+	writer.MaxLineLength = 40
+
+	rule := Rule{
+		Type: ModuleTypeAuth,
+		Control: Control{Complex: map[ReturnValue]any{
+			ReturnSuccess: 1, ReturnNewAuthtokReqd: ActionOK, ReturnUserUnknown: ActionIgnore, ReturnDefault: ActionBad,
+		}},
+		ModulePath: "pam_mysql.so",
+		Arguments:  []string{"user=test", "query=SELECT user FROM users WHERE name='%u' AND active=1", "verbose"},
+		Comment:    "a comment that is long enough to need wrapping",
+	}
+
+	lines := writer.handleLineContinuation(writer.formatRule(rule))
+	if len(lines) < 3 {
+		t.Fatalf("Expected the rule to be wrapped, got %q", lines)
+	}
+	for i, line := range lines {
+		if strings.Count(line, "[") != strings.Count(line, "]") {
+			t.Errorf("Line %d splits a bracketed token: %q", i, line)
+		}
+		if i < len(lines)-1 && strings.Contains(line, "#") {
+			t.Errorf("Line %d continues a comment: %q", i, line)
+		}
+	}
+
+	config, err := NewParser().Parse(strings.NewReader(strings.Join(lines, "\n")), true)
+	if err != nil {
+		t.Fatalf("Failed to parse wrapped rule: %v", err)
+	}
+	got := config.Rules[0]
+	if !reflect.DeepEqual(got.Arguments, rule.Arguments) || !Equivalent(got.Control, rule.Control) || got.Comment != rule.Comment {
+		t.Errorf("Wrapped rule reads differently: %+v", got)
+	}
+}
+
+func TestWriter_PreservesContinuationLayout(t *testing.T) {
+	content := `auth    required   pam_mysql.so user=test \
+          db=testdb \
+          [query=select user from users]
+account required pam_unix.so
+`
+	config, err := NewParser().Parse(strings.NewReader(content), true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	output, err := NewWriter().WriteString(config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	original := strings.Join(strings.Split(content, "\n")[:3], "\n")
+	if !strings.Contains(output, original) {
+		t.Errorf("Expected unchanged rule to keep its layout, got:\n%s", output)
+	}
+
+	// Edited rules are written afresh
+	editor := NewEditor(config)
+	if err := editor.UpdateArgumentByID(1, "db", "otherdb"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	output, err = NewWriter().WriteString(config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(output, "auth required pam_mysql.so user=test db=otherdb [query=select user from users]") {
+		t.Errorf("Expected edited rule on one line, got:\n%s", output)
+	}
+}
+
+func TestWriter_ContinuationFollowsParserMode(t *testing.T) {
+	// libpam reads "[a [nested] b]" as the arguments "a [nested" and "b]"
+	compat := "auth required pam_x.so [a [nested] b] \\\n    debug\n"
+	config, err := NewParser().SetLibpamCompat(true).Parse(strings.NewReader(compat), true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	output, err := NewWriter().WriteString(NewEditor(config).GetConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(output, compat) {
+		t.Errorf("Expected the libpam-parsed rule to keep its layout, got:\n%s", output)
+	}
+
+	// A control the writer shortens is written afresh
+	long := "auth [success=ok new_authtok_reqd=ok ignore=ignore default=bad] \\\n    pam_unix.so\n"
+	config, err = NewParser().Parse(strings.NewReader(long), true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	output, err = NewWriter().SetShortestControls(true).WriteString(config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(output, "auth required pam_unix.so") {
+		t.Errorf("Expected the shortest control, got:\n%s", output)
+	}
+}